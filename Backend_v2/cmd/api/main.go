@@ -10,26 +10,38 @@ import (
 func main() {
 	fmt.Println("Hello, Neurade Backend v2!")
 	envConfig := config.NewConfig()
-	minioClient := config.NewMinio(envConfig)
 	log := config.NewLogger(envConfig)
+	storage, err := config.NewStorage(envConfig, log)
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
 	agentConfig := config.NewAgentConfig(envConfig)
 	dbConfig := config.NewDatabase(envConfig, log)
 	JWTConfig := config.NewJWTConfig(envConfig)
+	sandbox := config.NewSandbox(envConfig, log)
+	githubClient := config.NewGitHubClient(envConfig, log)
+	githubApp, err := config.NewGitHubApp(envConfig, githubClient, log)
+	if err != nil {
+		log.Fatalf("Failed to set up GitHub App: %v", err)
+	}
 
 	r := config.Bootstrap(&config.BootstrapConfig{
 		DB:        dbConfig,
 		Log:       log,
 		Agent:     agentConfig,
-		Minio:     minioClient,
+		Storage:   storage,
 		JWTConfig: JWTConfig,
 		Config:    envConfig,
+		Sandbox:   sandbox,
+		GitHub:    githubClient,
+		GitHubApp: githubApp,
 	})
 
 	webPort := os.Getenv("WEB_PORT")
 	webHost := os.Getenv("WEB_HOST")
 	fmt.Printf("Web server will run on %s:%s\n", webHost, webPort)
 	webEndpoint := fmt.Sprintf("%s:%s", webHost, webPort)
-	err := http.ListenAndServe(webEndpoint, r)
+	err = http.ListenAndServe(webEndpoint, r)
 	if err != nil {
 		fmt.Printf("Error starting server: %v\n", err)
 		log.Fatalf("Server failed to start: %v", err)
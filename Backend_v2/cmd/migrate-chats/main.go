@@ -0,0 +1,39 @@
+package main
+
+import (
+	"be/neurade/v2/internal/config"
+	"be/neurade/v2/internal/repository"
+	"be/neurade/v2/internal/service"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// migrate-chats turns the legacy chats table, one JSONB history per PR, into
+// the conversation thread of each PR. Each chat is deleted once its messages
+// are in, so the command can be stopped and run again. Chats whose PR has not
+// been synced yet are kept; sync the course and run it again to move them.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "count the chats and messages to migrate without writing anything")
+	flag.Parse()
+
+	envConfig := config.NewConfig()
+	log := config.NewLogger(envConfig)
+	db := config.NewDatabase(envConfig, log)
+
+	chatService := service.NewChatService(db, repository.NewChatRepository(db, log), repository.NewChatThreadRepository(db, log), repository.NewChatMessageRepository(db, log), log)
+	report, err := chatService.MigrateLegacy(context.Background(), *dryRun)
+	if report != nil {
+		output, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(output))
+	}
+	if err != nil {
+		log.Errorf("Chat migration failed: %v", err)
+		os.Exit(1)
+	}
+	if len(report.Skipped) > 0 {
+		log.Warnf("%d legacy chats were kept because their PR is not synced", len(report.Skipped))
+	}
+}
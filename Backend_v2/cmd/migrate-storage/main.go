@@ -0,0 +1,43 @@
+package main
+
+import (
+	"be/neurade/v2/internal/config"
+	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// migrate-storage copies the files of the per-course buckets into
+// STORAGE_BUCKET under courses/{id}/ and rewrites the minio:// URLs stored in
+// the database. The old buckets are kept, so they can be removed by hand once
+// the new URLs are checked. URLs are only rewritten when every one of them
+// points at an object; the report lists those that do not, and -force
+// rewrites the rest anyway. -dry-run prints the report without copying.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "list objects and URLs to migrate without writing anything")
+	force := flag.Bool("force", false, "rewrite the URLs that were found even when some point at no object")
+	flag.Parse()
+
+	envConfig := config.NewConfig()
+	log := config.NewLogger(envConfig)
+	db := config.NewDatabase(envConfig, log)
+	storage, err := config.NewStorage(envConfig, log)
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+
+	migrationService := service.NewStorageMigrationService(db, util.NewMinioUtil(storage, envConfig.StorageBucket, log), log)
+	report, err := migrationService.Migrate(context.Background(), *dryRun, *force)
+	if report != nil {
+		output, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(output))
+	}
+	if err != nil {
+		log.Errorf("Storage migration failed: %v", err)
+		os.Exit(1)
+	}
+}
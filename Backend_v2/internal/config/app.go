@@ -1,6 +1,8 @@
 package config
 
 import (
+	"context"
+
 	"be/neurade/v2/internal/http/controller"
 	"be/neurade/v2/internal/http/route"
 	"be/neurade/v2/internal/repository"
@@ -8,7 +10,6 @@ import (
 	"be/neurade/v2/internal/util"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/minio/minio-go/v7"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -17,9 +18,12 @@ type BootstrapConfig struct {
 	DB        *gorm.DB
 	Log       *logrus.Logger
 	Agent     *AgentConfig
-	Minio     *minio.Client
+	Storage   util.Storage
 	Config    *Config
 	JWTConfig *JWTConfig
+	Sandbox   *util.Sandbox
+	GitHub    *util.GitHubClient
+	GitHubApp *util.GitHubApp
 }
 
 func Bootstrap(config *BootstrapConfig) *chi.Mux {
@@ -29,28 +33,78 @@ func Bootstrap(config *BootstrapConfig) *chi.Mux {
 	asisgnmentRepo := repository.NewAssignmentRepository(config.DB, config.Log)
 	prRepo := repository.NewPrRepository(config.DB, config.Log)
 	chatRepo := repository.NewChatRepository(config.DB, config.Log)
+	chatThreadRepo := repository.NewChatThreadRepository(config.DB, config.Log)
+	chatMessageRepo := repository.NewChatMessageRepository(config.DB, config.Log)
+	testRunRepo := repository.NewTestRunRepository(config.DB, config.Log)
+	documentVersionRepo := repository.NewDocumentVersionRepository(config.DB, config.Log)
+	fileRepo := repository.NewFileRepository(config.DB, config.Log)
+	courseDeletionJobRepo := repository.NewCourseDeletionJobRepository(config.DB, config.Log)
+	webhookDeliveryRepo := repository.NewWebhookDeliveryRepository(config.DB, config.Log)
+	gitRepositoryRepo := repository.NewGitRepositoryRepository(config.DB, config.Log)
+	courseLabelRepo := repository.NewCourseLabelRepository(config.DB, config.Log)
+	prCommandRepo := repository.NewPrCommandRepository(config.DB, config.Log)
 
 	userService := service.NewUserService(config.DB, userRepo, config.Log)
 	llmService := service.NewLLMService(config.DB, llmRepo, config.Log)
 	courseService := service.NewCourseService(config.DB, courseRepo, config.Log)
 	assignmentService := service.NewAssignmentService(config.DB, asisgnmentRepo, config.Log)
 	prService := service.NewPrService(config.DB, prRepo, config.Log)
-	githubService := service.NewGitHubService(config.Log)
-	chatService := service.NewChatService(chatRepo, config.Log)
+	githubService := service.NewGitHubService(config.GitHub, config.Log)
+	gitlabService := service.NewGitLabService(config.Log)
+	chatService := service.NewChatService(config.DB, chatRepo, chatThreadRepo, chatMessageRepo, config.Log)
+	gitRoot, gitBaseURL := LocalGit(config.Config)
+	localGitService := service.NewLocalGitService(config.DB, gitRepositoryRepo, prService, chatService, gitRoot, gitBaseURL, config.Log)
+	gitProviders := service.NewGitProviders(service.NewGitHubProvider(githubService), gitlabService, localGitService)
+	githubTokenService := service.NewGitHubTokenService(config.DB, githubService, gitProviders, config.GitHubApp, config.Config.GitLabToken, config.Log)
+	webhookDeliveryService := service.NewWebhookDeliveryService(config.DB, webhookDeliveryRepo, config.Log)
+	prSyncService := service.NewPrSyncService(config.DB, githubService, gitProviders, githubTokenService, prService, courseService, chatService, config.Log)
+	courseWebhookService := service.NewCourseWebhookService(config.DB, githubService, gitProviders, githubTokenService, config.Config.WebhookEnpoint, config.Config.GitLabWebhookEnpoint, config.Config.GitHubWebhookSecret, config.Log)
 
 	userController := controller.NewUserController(userService, config.Log, config.Config.JWTSecret)
 	llmController := controller.NewLLMController(llmService, config.Log, config.Agent.LLMServiceEnpoint)
 	permissionUserCourseRepo := repository.NewPermissionUserCourseRepository()
 	permissionUserCourseService := service.NewPermissionUserCourseService(config.DB, permissionUserCourseRepo)
-	prController := controller.NewPrController(prService, courseService, userService, config.Log)
-	minioUtil := util.NewMinioUtil(config.Minio, config.Log)
-	agentController := controller.NewAgentController(courseService, prService, githubService, minioUtil, config.Log, config.Agent.ReviewEnpoint, userService, llmService, assignmentService, prController)
-	githubWebhookController := controller.NewGitHubWebhookController(githubService, prService, courseService, userService, chatService, llmService, assignmentService, minioUtil, config.Log, config.Agent.ChatEnpoint, agentController)
-	courseController := controller.NewCourseController(courseService, userService, config.Log, config.Minio, userController.JWTUtil, permissionUserCourseService, githubWebhookController)
-	assignmentController := controller.NewAssignmentController(assignmentService, config.Log, config.Minio, agentController)
+	minioUtil := util.NewMinioUtil(config.Storage, config.Config.StorageBucket, config.Log)
+	fileService := service.NewFileService(config.DB, fileRepo, minioUtil, userController.JWTUtil, PublicURL(config.Config), config.Log)
+	documentVersionService := service.NewDocumentVersionService(config.DB, documentVersionRepo, minioUtil, config.Log)
+	courseCloneService := service.NewCourseCloneService(config.DB, courseRepo, documentVersionRepo, minioUtil, config.Log)
+	courseDeletionService := service.NewCourseDeletionService(config.DB, courseDeletionJobRepo, minioUtil, courseWebhookService, localGitService, config.Log)
+	// Deletions interrupted by a restart pick up where they stopped
+	go courseDeletionService.ResumeUnfinished(context.Background())
+	prDiffService := service.NewPrDiffService(gitProviders, minioUtil, config.Log)
+	checkRunService := service.NewCheckRunService(githubService, config.Log)
+	prLabelService := service.NewPrLabelService(config.DB, courseLabelRepo, githubService, config.Log)
+	prCommandService := service.NewPrCommandService(config.DB, prCommandRepo, config.Log)
+	prController := controller.NewPrController(prService, courseService, userService, githubService, prDiffService, config.Log, githubTokenService)
+	testRunService := service.NewTestRunService(config.DB, testRunRepo, minioUtil, config.Sandbox, localGitService, config.Log)
+	agentController := controller.NewAgentController(courseService, prService, githubService, minioUtil, config.Log, config.Agent.ReviewEnpoint, userService, llmService, assignmentService, prController, testRunService, prDiffService, documentVersionService, fileService, githubTokenService, checkRunService, prLabelService)
+	githubWebhookController := controller.NewGitHubWebhookController(githubService, githubTokenService, prService, courseService, userService, chatService, llmService, assignmentService, minioUtil, config.Log, config.Agent.ChatEnpoint, agentController, courseWebhookService, webhookDeliveryService, prSyncService, gitProviders, prCommandService, permissionUserCourseService)
+	prSyncService.AutoGrade = githubWebhookController.StartAutoGrade
+	prCommandService.Execute = githubWebhookController.RunCommand
+	// Commands interrupted by a restart are run again
+	go prCommandService.ResumeUnfinished(context.Background())
+	// Catches up on PRs and comments the webhook missed
+	if interval, jitter := PrSyncSchedule(config.Config); interval > 0 {
+		go prSyncService.RunScheduler(context.Background(), interval, jitter)
+	}
+	courseController := controller.NewCourseController(courseService, userService, config.Log, minioUtil, userController.JWTUtil, permissionUserCourseService, githubWebhookController, documentVersionService, fileService, courseCloneService, courseDeletionService, githubTokenService, courseWebhookService)
+	assignmentController := controller.NewAssignmentController(assignmentService, config.Log, minioUtil, agentController, documentVersionService, userController.JWTUtil, fileService)
 	chatController := controller.NewChatController(chatService, config.Log)
+	testRunController := controller.NewTestRunController(testRunService, assignmentService, prService, courseService, userService, minioUtil, config.Log, githubTokenService)
+
+	documentVersionController := controller.NewDocumentVersionController(documentVersionService, userController.JWTUtil, config.Log)
+	labelController := controller.NewLabelController(prLabelService, courseService, config.Log)
+
+	fileController := controller.NewFileController(fileService, config.Log)
+	gitController := controller.NewGitController(localGitService, userService, courseService, assignmentService, permissionUserCourseService, userController.JWTUtil, config.Log)
+	gitController.AutoGrade = githubWebhookController.StartAutoGrade
+
+	var storageController *controller.StorageController
+	if localStorage, ok := config.Storage.(*util.LocalStorage); ok {
+		storageController = controller.NewStorageController(localStorage, config.Log)
+	}
 
-	adminUserController := controller.NewAdminUserController(userService, permissionUserCourseService)
+	adminUserController := controller.NewAdminUserController(userService, permissionUserCourseService, githubService, githubTokenService)
 
 	r := route.RouteConfig{
 		App:                         chi.NewRouter(),
@@ -63,7 +117,14 @@ func Bootstrap(config *BootstrapConfig) *chi.Mux {
 		AgentController:             agentController,
 		ChatController:              chatController,
 		AdminUserController:         adminUserController,
+		TestRunController:           testRunController,
+		DocumentVersionController:   documentVersionController,
+		StorageController:           storageController,
+		FileController:              fileController,
+		GitController:               gitController,
+		LabelController:             labelController,
 		PermissionUserCourseService: permissionUserCourseService,
+		WebhookRelayToken:           config.Config.WebhookRelayToken,
 	}
 
 	return r.Setup()
@@ -25,6 +25,12 @@ type Config struct {
 	MinioSecretKey string
 	MinioUseSSL    bool
 
+	StorageDriver        string
+	StorageBucket        string
+	StorageLocalRoot     string
+	StoragePublicURL     string
+	StorageSigningSecret string
+
 	// QueueHost     string
 	// QueuePort     string
 	// QueueUser     string
@@ -40,6 +46,31 @@ type Config struct {
 	JWTSecret           string
 	GitHubWebhookSecret string
 	WebhookEnpoint      string
+	WebhookRelayToken   string
+
+	GitLabToken          string
+	GitLabWebhookEnpoint string
+
+	GitHubRateLimitReserve        int
+	GitHubRateLimitMaxWaitSeconds int
+
+	PrSyncIntervalMinutes int
+	PrSyncJitterSeconds   int
+
+	GitHubAppID             int64
+	GitHubAppPrivateKey     string
+	GitHubAppPrivateKeyPath string
+
+	GitRepoRoot    string
+	GitHTTPBaseURL string
+
+	SandboxWorkDir        string
+	SandboxCPUSeconds     int
+	SandboxMemoryMB       int
+	SandboxTimeoutSeconds int
+	SandboxAllowNetwork   bool
+	SandboxUID            int
+	SandboxGID            int
 }
 
 func NewConfig() *Config {
@@ -50,6 +81,27 @@ func NewConfig() *Config {
 	dbIdleConnection, _ := strconv.Atoi(os.Getenv("DB_IDLE_CONNECTION"))
 	dbMaxConnection, _ := strconv.Atoi(os.Getenv("DB_MAX_CONNECTION"))
 	dbMaxLifeTimeConnection, _ := strconv.Atoi(os.Getenv("DB_MAX_LIFETIME_CONNECTION"))
+	sandboxCPUSeconds, _ := strconv.Atoi(os.Getenv("SANDBOX_CPU_SECONDS"))
+	sandboxMemoryMB, _ := strconv.Atoi(os.Getenv("SANDBOX_MEMORY_MB"))
+	sandboxTimeoutSeconds, _ := strconv.Atoi(os.Getenv("SANDBOX_TIMEOUT_SECONDS"))
+	sandboxAllowNetwork, _ := strconv.ParseBool(os.Getenv("SANDBOX_ALLOW_NETWORK"))
+	// The sandbox runs as nobody unless told otherwise; 0 keeps the backend's uid
+	sandboxUID, sandboxGID := 65534, 65534
+	if uid, err := strconv.Atoi(os.Getenv("SANDBOX_UID")); err == nil {
+		sandboxUID = uid
+	}
+	if gid, err := strconv.Atoi(os.Getenv("SANDBOX_GID")); err == nil {
+		sandboxGID = gid
+	}
+	githubRateLimitReserve, _ := strconv.Atoi(os.Getenv("GITHUB_RATE_LIMIT_RESERVE"))
+	githubRateLimitMaxWaitSeconds, _ := strconv.Atoi(os.Getenv("GITHUB_RATE_LIMIT_MAX_WAIT_SECONDS"))
+	prSyncIntervalMinutes, _ := strconv.Atoi(os.Getenv("PR_SYNC_INTERVAL_MINUTES"))
+	prSyncJitterSeconds, _ := strconv.Atoi(os.Getenv("PR_SYNC_JITTER_SECONDS"))
+	githubAppID, _ := strconv.ParseInt(os.Getenv("GITHUB_APP_ID"), 10, 64)
+	storageBucket := os.Getenv("STORAGE_BUCKET")
+	if storageBucket == "" {
+		storageBucket = "neurade"
+	}
 	return &Config{
 		DBHost:                  os.Getenv("DB_HOST"),
 		DBUser:                  os.Getenv("DB_USER"),
@@ -65,6 +117,12 @@ func NewConfig() *Config {
 		MinioSecretKey: os.Getenv("MINIO_SECRET"),
 		MinioUseSSL:    minioUseSSL,
 
+		StorageDriver:        os.Getenv("STORAGE_DRIVER"),
+		StorageBucket:        storageBucket,
+		StorageLocalRoot:     os.Getenv("STORAGE_LOCAL_ROOT"),
+		StoragePublicURL:     os.Getenv("STORAGE_PUBLIC_URL"),
+		StorageSigningSecret: os.Getenv("STORAGE_SIGNING_SECRET"),
+
 		// QueueHost:     os.Getenv("QUEUE_HOST"),
 		// QueuePort:     os.Getenv("QUEUE_PORT"),
 		// QueueUser:     os.Getenv("QUEUE_USER"),
@@ -75,10 +133,35 @@ func NewConfig() *Config {
 
 		JWTSecret:           os.Getenv("JWT_SECRET"),
 		GitHubWebhookSecret: os.Getenv("GITHUB_WEBHOOK_SECRET"),
+		WebhookRelayToken:   os.Getenv("WEBHOOK_RELAY_TOKEN"),
 
 		ReviewEnpoint:     os.Getenv("REVIEW_ENPOINT"),
 		ChatEnpoint:       os.Getenv("CHAT_ENPOINT"),
 		LLMServiceEnpoint: os.Getenv("LLM_SERVICE_ENPOINT"),
 		WebhookEnpoint:    os.Getenv("WEBHOOK_ENPOINT"),
+
+		GitLabToken:          os.Getenv("GITLAB_TOKEN"),
+		GitLabWebhookEnpoint: os.Getenv("GITLAB_WEBHOOK_ENPOINT"),
+
+		GitHubRateLimitReserve:        githubRateLimitReserve,
+		GitHubRateLimitMaxWaitSeconds: githubRateLimitMaxWaitSeconds,
+
+		PrSyncIntervalMinutes: prSyncIntervalMinutes,
+		PrSyncJitterSeconds:   prSyncJitterSeconds,
+
+		GitHubAppID:             githubAppID,
+		GitHubAppPrivateKey:     os.Getenv("GITHUB_APP_PRIVATE_KEY"),
+		GitHubAppPrivateKeyPath: os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"),
+
+		GitRepoRoot:    os.Getenv("GIT_REPO_ROOT"),
+		GitHTTPBaseURL: os.Getenv("GIT_HTTP_BASE_URL"),
+
+		SandboxWorkDir:        os.Getenv("SANDBOX_WORK_DIR"),
+		SandboxCPUSeconds:     sandboxCPUSeconds,
+		SandboxMemoryMB:       sandboxMemoryMB,
+		SandboxTimeoutSeconds: sandboxTimeoutSeconds,
+		SandboxAllowNetwork:   sandboxAllowNetwork,
+		SandboxUID:            sandboxUID,
+		SandboxGID:            sandboxGID,
 	}
 }
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"be/neurade/v2/internal/util"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func NewGitHubClient(config *Config, log *logrus.Logger) *util.GitHubClient {
+	reserve := config.GitHubRateLimitReserve
+	if reserve == 0 {
+		reserve = 200
+	}
+	maxWait := time.Duration(config.GitHubRateLimitMaxWaitSeconds) * time.Second
+	if maxWait == 0 {
+		maxWait = 15 * time.Minute
+	}
+	return util.NewGitHubClient(reserve, maxWait, log)
+}
+
+// PrSyncSchedule returns how often every course is synced with GitHub and the
+// most each round is delayed at random, so courses sharing a token do not all
+// hit GitHub at the same moment. A zero interval means the scheduler is off.
+func PrSyncSchedule(config *Config) (time.Duration, time.Duration) {
+	if config.PrSyncIntervalMinutes < 0 {
+		return 0, 0
+	}
+	interval := time.Duration(config.PrSyncIntervalMinutes) * time.Minute
+	if interval == 0 {
+		interval = 30 * time.Minute
+	}
+	jitter := time.Duration(config.PrSyncJitterSeconds) * time.Second
+	if jitter == 0 {
+		jitter = 2 * time.Minute
+	}
+	return interval, jitter
+}
+
+// NewGitHubApp loads the GitHub App credentials. It returns nil when no app is
+// configured, in which case personal tokens are used.
+func NewGitHubApp(config *Config, client *util.GitHubClient, log *logrus.Logger) (*util.GitHubApp, error) {
+	if config.GitHubAppID == 0 {
+		return nil, nil
+	}
+	privateKey := []byte(strings.ReplaceAll(config.GitHubAppPrivateKey, `\n`, "\n"))
+	if config.GitHubAppPrivateKeyPath != "" {
+		content, err := os.ReadFile(config.GitHubAppPrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+		privateKey = content
+	}
+	app, err := util.NewGitHubApp(config.GitHubAppID, privateKey, client)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Authenticating to GitHub as app %d", config.GitHubAppID)
+	return app, nil
+}
+
+// LocalGit returns where hosted repositories of local courses live and the
+// public URL of the /git routes students clone from
+func LocalGit(config *Config) (string, string) {
+	root := config.GitRepoRoot
+	if root == "" {
+		root = "./data/git"
+	}
+	baseURL := strings.TrimRight(config.GitHTTPBaseURL, "/")
+	if baseURL == "" {
+		baseURL = PublicURL(config) + "/git"
+	}
+	return root, baseURL
+}
@@ -7,22 +7,20 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-func NewMinio(config *Config) *minio.Client {
+func NewMinio(config *Config) (*minio.Client, error) {
 	minioHost := config.MinioEndpoint
 	accessKey := config.MinioAccessKey
 	secretKey := config.MinioSecretKey
 	useSSL := config.MinioUseSSL
 
-	client, err := minio.New(fmt.Sprintf("%s", minioHost), &minio.Options{
+	client, err := minio.New(minioHost, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
 		Secure: useSSL,
 	})
-	fmt.Printf("Minio client created with access key %s\n", accessKey)
 	if err != nil {
-		fmt.Printf("Error creating Minio client: %v\n", err)
-		return nil
+		return nil, fmt.Errorf("failed to create minio client for %s: %w", minioHost, err)
 	}
 	fmt.Printf("Minio client created successfully\n")
 
-	return client
+	return client, nil
 }
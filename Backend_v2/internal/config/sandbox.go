@@ -0,0 +1,29 @@
+package config
+
+import (
+	"be/neurade/v2/internal/util"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func NewSandbox(config *Config, log *logrus.Logger) *util.Sandbox {
+	limits := util.SandboxLimits{
+		CPUSeconds:   config.SandboxCPUSeconds,
+		MemoryMB:     config.SandboxMemoryMB,
+		Timeout:      time.Duration(config.SandboxTimeoutSeconds) * time.Second,
+		AllowNetwork: config.SandboxAllowNetwork,
+		UID:          config.SandboxUID,
+		GID:          config.SandboxGID,
+	}
+	if limits.CPUSeconds == 0 {
+		limits.CPUSeconds = 60
+	}
+	if limits.MemoryMB == 0 {
+		limits.MemoryMB = 512
+	}
+	if limits.Timeout == 0 {
+		limits.Timeout = 5 * time.Minute
+	}
+	return util.NewSandbox(config.SandboxWorkDir, limits, log)
+}
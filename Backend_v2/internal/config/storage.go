@@ -0,0 +1,51 @@
+package config
+
+import (
+	"be/neurade/v2/internal/util"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	StorageDriverMinio = "minio"
+	StorageDriverLocal = "local"
+)
+
+// NewStorage picks the object store from STORAGE_DRIVER. MinIO is the default;
+// "local" keeps files on disk and serves signed links through this backend.
+func NewStorage(config *Config, log *logrus.Logger) (util.Storage, error) {
+	switch config.StorageDriver {
+	case "", StorageDriverMinio:
+		client, err := NewMinio(config)
+		if err != nil {
+			return nil, err
+		}
+		return util.NewMinioStorage(client), nil
+	case StorageDriverLocal:
+		baseURL := PublicURL(config)
+		secret := config.StorageSigningSecret
+		if secret == "" {
+			secret = config.JWTSecret
+		}
+		storage, err := util.NewLocalStorage(config.StorageLocalRoot, baseURL, secret)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Using local storage in %s", config.StorageLocalRoot)
+		return storage, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", config.StorageDriver)
+	}
+}
+
+// PublicURL is the address other services use to reach this backend, for
+// signed file links
+func PublicURL(config *Config) string {
+	if config.StoragePublicURL != "" {
+		return strings.TrimRight(config.StoragePublicURL, "/")
+	}
+	return fmt.Sprintf("http://%s:%s", os.Getenv("WEB_HOST"), os.Getenv("WEB_PORT"))
+}
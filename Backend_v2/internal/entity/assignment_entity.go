@@ -8,6 +8,11 @@ type Assignment struct {
 	AssignmentName string    `gorm:"column:assignment_name"`
 	Description    string    `gorm:"column:description"`
 	AssignmentURL  string    `gorm:"column:assignment_url"`
+	TestBundleURL  string    `gorm:"column:test_bundle_url"`
+	TestCommand    string    `gorm:"column:test_command"`
+	TestReportPath string    `gorm:"column:test_report_path"`
 	CreatedAt      time.Time `gorm:"column:created_at"`
 	UpdatedAt      time.Time `gorm:"column:updated_at"`
+	// DueDate is the deadline; PRs opened after it are late
+	DueDate *time.Time `gorm:"column:due_date"`
 }
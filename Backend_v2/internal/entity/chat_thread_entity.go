@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+// ChatThread is one conversation on a PR: the PR's own conversation, or a
+// review thread on a line of its diff
+type ChatThread struct {
+	ID       int `gorm:"column:id;primaryKey"`
+	CourseID int `gorm:"column:course_id"`
+	// PrID is the PR's row in prs, not its number
+	PrID int `gorm:"column:pr_id"`
+	// ThreadKey is "conversation" for the PR's conversation, otherwise the
+	// key of the thread's first comment, such as "review_comment:123"
+	ThreadKey string    `gorm:"column:thread_key"`
+	File      string    `gorm:"column:file"`
+	Line      *int      `gorm:"column:line"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+// ChatMessage is a comment in a chat thread
+type ChatMessage struct {
+	ID          int    `gorm:"column:id;primaryKey"`
+	CourseID    int    `gorm:"column:course_id"`
+	ThreadID    int    `gorm:"column:thread_id"`
+	AuthorLogin string `gorm:"column:author_login"`
+	Role        string `gorm:"column:role"`
+	Message     string `gorm:"column:message"`
+	// GitHubID is the comment's key, such as "issue_comment:123", so a comment
+	// delivered again is not added twice; empty for messages without one
+	GitHubID  string    `gorm:"column:github_id"`
+	File      string    `gorm:"column:file"`
+	Line      *int      `gorm:"column:line"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+type CourseDeletionJob struct {
+	ID          int        `gorm:"column:id;primaryKey"`
+	CourseID    int        `gorm:"column:course_id"`
+	CourseName  string     `gorm:"column:course_name"`
+	RequestedBy int        `gorm:"column:requested_by"`
+	Status      string     `gorm:"column:status"`
+	Report      JSON       `gorm:"column:report;type:jsonb"`
+	Error       string     `gorm:"column:error"`
+	StartedAt   *time.Time `gorm:"column:started_at"`
+	FinishedAt  *time.Time `gorm:"column:finished_at"`
+	CreatedAt   time.Time  `gorm:"column:created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at"`
+}
@@ -3,14 +3,38 @@ package entity
 import "time"
 
 type Course struct {
-	ID            int       `gorm:"column:id;primaryKey"`
-	UserID        int       `gorm:"column:user_id"`
-	CourseName    string    `gorm:"column:course_name"`
-	GithubURL     string    `gorm:"column:github_url"`
-	Owner         string    `gorm:"column:owner"`
-	RepoName      string    `gorm:"column:repo_name"`
-	GeneralAnswer string    `gorm:"column:general_answer"`
-	AutoGrade     bool      `gorm:"column:auto_grade"`
-	CreatedAt     time.Time `gorm:"column:created_at"`
-	UpdatedAt     time.Time `gorm:"column:updated_at"`
+	ID         int    `gorm:"column:id;primaryKey"`
+	UserID     int    `gorm:"column:user_id"`
+	CourseName string `gorm:"column:course_name"`
+	GithubURL  string `gorm:"column:github_url"`
+	Owner      string `gorm:"column:owner"`
+	RepoName   string `gorm:"column:repo_name"`
+	// GitProvider is "github" or "gitlab"; empty means it follows the host of
+	// GithubURL
+	GitProvider   string `gorm:"column:git_provider"`
+	GeneralAnswer string `gorm:"column:general_answer"`
+	AutoGrade     bool   `gorm:"column:auto_grade"`
+	// PassScore is the 0-100 score a graded PR needs for its check run to pass
+	PassScore int `gorm:"column:pass_score"`
+	// BotHandle is mentioned, as "@bot", to ask the bot a question in a PR
+	BotHandle string `gorm:"column:bot_handle"`
+	// GithubToken is the course's own credential, for repositories the
+	// owner's and super admin's tokens cannot reach
+	GithubToken string `gorm:"column:github_token"`
+	// WebhookID is the repository hook we registered and WebhookSecret the
+	// secret GitHub signs its deliveries with
+	WebhookID     int64  `gorm:"column:webhook_id"`
+	WebhookSecret string `gorm:"column:webhook_secret"`
+	// ArchivedAt is set for finished courses, which are read-only
+	ArchivedAt *time.Time `gorm:"column:archived_at"`
+	// PrSyncedAt is the GitHub update time of the newest PR seen by the last
+	// complete sync; the next sync only asks for PRs updated since then
+	PrSyncedAt *time.Time `gorm:"column:pr_synced_at"`
+	// LastSyncAt, LastSyncStatus and LastSyncMessage describe the latest PR
+	// sync, manual or scheduled
+	LastSyncAt      *time.Time `gorm:"column:last_sync_at"`
+	LastSyncStatus  string     `gorm:"column:last_sync_status"`
+	LastSyncMessage string     `gorm:"column:last_sync_message"`
+	CreatedAt       time.Time  `gorm:"column:created_at"`
+	UpdatedAt       time.Time  `gorm:"column:updated_at"`
 }
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// CourseLabel is a course's own name and colour for one kind of PR label
+type CourseLabel struct {
+	ID        int       `gorm:"column:id;primaryKey"`
+	CourseID  int       `gorm:"column:course_id"`
+	Kind      string    `gorm:"column:kind"`
+	Name      string    `gorm:"column:name"`
+	Color     string    `gorm:"column:color"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
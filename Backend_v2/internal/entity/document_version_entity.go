@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+type DocumentVersion struct {
+	ID           int       `gorm:"column:id;primaryKey"`
+	CourseID     int       `gorm:"column:course_id"`
+	AssignmentID int       `gorm:"column:assignment_id"`
+	DocType      string    `gorm:"column:doc_type"`
+	Version      int       `gorm:"column:version"`
+	FileURL      string    `gorm:"column:file_url"`
+	FileName     string    `gorm:"column:file_name"`
+	Size         int64     `gorm:"column:size"`
+	Checksum     string    `gorm:"column:checksum"`
+	UploadedBy   int       `gorm:"column:uploaded_by"`
+	Note         string    `gorm:"column:note"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+}
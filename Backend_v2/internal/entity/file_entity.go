@@ -0,0 +1,10 @@
+package entity
+
+import "time"
+
+type File struct {
+	ID        int       `gorm:"column:id;primaryKey"`
+	CourseID  int       `gorm:"column:course_id"`
+	FileURL   string    `gorm:"column:file_url"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// GitRepository is a bare repository this server hosts for one student's work
+// on one assignment of a local course. Its ID is the PR number of the
+// submission it carries.
+type GitRepository struct {
+	ID           int        `gorm:"column:id;primaryKey"`
+	CourseID     int        `gorm:"column:course_id"`
+	AssignmentID int        `gorm:"column:assignment_id"`
+	UserID       int        `gorm:"column:user_id"`
+	SubmitSHA    string     `gorm:"column:submit_sha"`
+	SubmittedAt  *time.Time `gorm:"column:submitted_at"`
+	CreatedAt    time.Time  `gorm:"column:created_at"`
+	UpdatedAt    time.Time  `gorm:"column:updated_at"`
+}
@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// PrCommand is a /neurade command from a PR comment, queued to run in the
+// background
+type PrCommand struct {
+	ID          int        `gorm:"column:id;primaryKey"`
+	CourseID    int        `gorm:"column:course_id"`
+	PrNumber    int        `gorm:"column:pr_number"`
+	CommentKey  string     `gorm:"column:comment_key"`
+	ThreadID    string     `gorm:"column:thread_id"`
+	File        string     `gorm:"column:file"`
+	AuthorLogin string     `gorm:"column:author_login"`
+	AuthorRole  string     `gorm:"column:author_role"`
+	Command     string     `gorm:"column:command"`
+	Args        string     `gorm:"column:args"`
+	Status      string     `gorm:"column:status"`
+	Result      string     `gorm:"column:result"`
+	Error       string     `gorm:"column:error"`
+	StartedAt   *time.Time `gorm:"column:started_at"`
+	FinishedAt  *time.Time `gorm:"column:finished_at"`
+	CreatedAt   time.Time  `gorm:"column:created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at"`
+}
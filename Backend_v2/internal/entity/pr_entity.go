@@ -3,15 +3,23 @@ package entity
 import "time"
 
 type Pr struct {
-	ID            int       `gorm:"column:id;primaryKey"`
-	PrName        string    `gorm:"column:pr_name"`
-	PrDescription string    `gorm:"column:pr_description"`
-	PrNumber      int       `gorm:"column:pr_number"`
-	AssignmentID  int       `gorm:"column:assignment_id"`
-	CourseID      int       `gorm:"course_id"`
-	Status        string    `gorm:"column:status"`
-	Result        string    `gorm:"column:result"`
-	StatusGrade   string    `gorm:"column:status_grade"`
-	CreatedAt     time.Time `gorm:"column:created_at"`
-	UpdatedAt     time.Time `gorm:"column:updated_at"`
+	ID            int    `gorm:"column:id;primaryKey"`
+	PrName        string `gorm:"column:pr_name"`
+	PrDescription string `gorm:"column:pr_description"`
+	PrNumber      int    `gorm:"column:pr_number"`
+	AssignmentID  int    `gorm:"column:assignment_id"`
+	CourseID      int    `gorm:"course_id"`
+	Status        string `gorm:"column:status"`
+	Result        string `gorm:"column:result"`
+	StatusGrade   string `gorm:"column:status_grade"`
+	// Synced from GitHub; see PrService.SyncFromGitHub
+	AuthorLogin string     `gorm:"column:author_login"`
+	HeadRef     string     `gorm:"column:head_ref"`
+	HeadRepo    string     `gorm:"column:head_repo"`
+	BaseRef     string     `gorm:"column:base_ref"`
+	HeadSHA     string     `gorm:"column:head_sha"`
+	Draft       bool       `gorm:"column:draft"`
+	MergedAt    *time.Time `gorm:"column:merged_at"`
+	CreatedAt   time.Time  `gorm:"column:created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at"`
 }
@@ -0,0 +1,21 @@
+package entity
+
+import "time"
+
+type TestRun struct {
+	ID           int        `gorm:"column:id;primaryKey"`
+	CourseID     int        `gorm:"column:course_id"`
+	AssignmentID int        `gorm:"column:assignment_id"`
+	PrID         int        `gorm:"column:pr_id"`
+	CommitSHA    string     `gorm:"column:commit_sha"`
+	Status       string     `gorm:"column:status"`
+	Passed       int        `gorm:"column:passed"`
+	Failed       int        `gorm:"column:failed"`
+	Total        int        `gorm:"column:total"`
+	Results      JSON       `gorm:"column:results;type:jsonb"`
+	Log          string     `gorm:"column:log"`
+	StartedAt    *time.Time `gorm:"column:started_at"`
+	FinishedAt   *time.Time `gorm:"column:finished_at"`
+	CreatedAt    time.Time  `gorm:"column:created_at"`
+	UpdatedAt    time.Time  `gorm:"column:updated_at"`
+}
@@ -8,6 +8,7 @@ type User struct {
 	PasswordHash string    `gorm:"column:password_hash"`
 	Role         string    `gorm:"column:role"`
 	GithubToken  string    `gorm:"column:github_token"`
+	GithubLogin  string    `gorm:"column:github_login"`
 	Locked       bool      `gorm:"column:locked"`
 	Deleted      bool      `gorm:"column:deleted"`
 	CreatedAt    time.Time `gorm:"column:created_at"`
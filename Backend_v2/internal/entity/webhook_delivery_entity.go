@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// WebhookDelivery is one delivery received from GitHub, kept so a failed one
+// can be replayed and a redelivered one recognised
+type WebhookDelivery struct {
+	ID          int        `gorm:"column:id;primaryKey"`
+	DeliveryID  string     `gorm:"column:delivery_id"`
+	Provider    string     `gorm:"column:provider"`
+	Event       string     `gorm:"column:event"`
+	Action      string     `gorm:"column:action"`
+	Repository  string     `gorm:"column:repository"`
+	Payload     string     `gorm:"column:payload"`
+	Status      string     `gorm:"column:status"`
+	Result      string     `gorm:"column:result"`
+	Error       string     `gorm:"column:error"`
+	Attempts    int        `gorm:"column:attempts"`
+	ProcessedAt *time.Time `gorm:"column:processed_at"`
+	CreatedAt   time.Time  `gorm:"column:created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at"`
+}
@@ -4,10 +4,11 @@ import (
 	"be/neurade/v2/internal/model"
 	"be/neurade/v2/internal/service"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -15,10 +16,12 @@ import (
 type AdminUserController struct {
 	UserService                 *service.UserService
 	PermissionUserCourseService *service.PermissionUserCourseService
+	GitHubService               *service.GitHubService
+	GitHubTokenService          *service.GitHubTokenService
 }
 
-func NewAdminUserController(userService *service.UserService, pucService *service.PermissionUserCourseService) *AdminUserController {
-	return &AdminUserController{UserService: userService, PermissionUserCourseService: pucService}
+func NewAdminUserController(userService *service.UserService, pucService *service.PermissionUserCourseService, githubService *service.GitHubService, githubTokenService *service.GitHubTokenService) *AdminUserController {
+	return &AdminUserController{UserService: userService, PermissionUserCourseService: pucService, GitHubService: githubService, GitHubTokenService: githubTokenService}
 }
 
 func (c *AdminUserController) Create(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +37,7 @@ func (c *AdminUserController) Create(w http.ResponseWriter, r *http.Request) {
 		Email:        email,
 		PasswordHash: password,
 		Role:         role,
+		GithubLogin:  strings.TrimSpace(r.FormValue("github_login")),
 	}
 	user, err := c.UserService.Register(r.Context(), &request)
 	if err != nil {
@@ -117,32 +121,42 @@ func (c *AdminUserController) UpdateGithubToken(w http.ResponseWriter, r *http.R
 		http.Error(w, "github_token is required", http.StatusBadRequest)
 		return
 	}
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+	githubUser, err := c.GitHubService.GetAuthenticatedUser(r.Context(), githubToken)
 	if err != nil {
-		http.Error(w, "Failed to create request for GitHub validation", http.StatusInternalServerError)
+		http.Error(w, "Invalid GitHub token: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	req.Header.Set("Authorization", "Bearer "+githubToken)
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	// The token's account is the user's login in PR comments
+	updateReq := &model.UserUpdateRequest{ID: id, GithubToken: githubToken, GithubLogin: githubUser.Login}
+	user, err := c.UserService.Update(r.Context(), updateReq)
+	if err != nil {
+		http.Error(w, "Failed to update github_token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
 
-	resp, err := client.Do(req)
+// UpdateGithubLogin lets super admin set the GitHub or GitLab username a user
+// comments on PRs as, which makes course staff without a token known
+func (c *AdminUserController) UpdateGithubLogin(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "Failed to contact GitHub API: "+err.Error(), http.StatusBadGateway)
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
 		return
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Println("GitHub API response:", string(body))
-	if resp.StatusCode != http.StatusOK {
-		http.Error(w, "Invalid GitHub token: "+string(body), http.StatusBadRequest)
+	if err := r.ParseMultipartForm(4 << 20); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
 		return
 	}
-	updateReq := &model.UserUpdateRequest{ID: id, GithubToken: githubToken}
-	user, err := c.UserService.Update(r.Context(), updateReq)
+	githubLogin := strings.TrimSpace(r.FormValue("github_login"))
+	if githubLogin == "" {
+		http.Error(w, "github_login is required", http.StatusBadRequest)
+		return
+	}
+	user, err := c.UserService.Update(r.Context(), &model.UserUpdateRequest{ID: id, GithubLogin: githubLogin})
 	if err != nil {
-		http.Error(w, "Failed to update github_token", http.StatusInternalServerError)
+		http.Error(w, "Failed to update github_login", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -160,22 +174,8 @@ func (c *AdminUserController) ValidateGithubToken(w http.ResponseWriter, r *http
 		http.Error(w, "token is required", http.StatusBadRequest)
 		return
 	}
-	fmt.Println("token", token)
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-	if err != nil {
-		http.Error(w, "Failed to create request for GitHub validation", http.StatusInternalServerError)
-		return
-	}
-
-	resp, err := client.Do(req)
-	valid := err == nil && resp.StatusCode == http.StatusOK
-	if resp != nil {
-		defer resp.Body.Close()
-	}
+	_, err := c.GitHubService.GetAuthenticatedUser(r.Context(), token)
+	valid := err == nil
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"valid": valid})
 }
@@ -225,25 +225,42 @@ func (c *AdminUserController) GetGithubTokenByUserID(w http.ResponseWriter, r *h
 	json.NewEncoder(w).Encode(map[string]string{"github_token": masked})
 }
 
-// GetSuperAdminGithubToken returns the masked github_token of the first super_admin user
+// GetSuperAdminGithubToken returns the github_token of the first super_admin
+// user that has one, the same token GitHubTokenService falls back to
 func (c *AdminUserController) GetSuperAdminGithubToken(w http.ResponseWriter, r *http.Request) {
-	users, err := c.UserService.GetAllUsers(r.Context())
-	if err != nil {
-		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+	token, err := c.GitHubTokenService.DefaultToken(r.Context())
+	if errors.Is(err, service.ErrNoGitHubToken) {
+		http.Error(w, "Super admin not found or no github_token", http.StatusNotFound)
 		return
 	}
-	var token string
-	for _, user := range users {
-		if user.Role == "super_admin" {
-			token = user.GithubToken
-			break
-		}
-	}
-	if token == "" {
-		http.Error(w, "Super admin not found or no github_token", http.StatusNotFound)
+	if err != nil {
+		http.Error(w, "Failed to get super admin github_token", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"github_token": token})
 }
+
+// GitHubRateLimit returns the remaining GitHub API budget of every token the
+// backend has used. With refresh=true the super admin token is checked live.
+func (c *AdminUserController) GitHubRateLimit(w http.ResponseWriter, r *http.Request) {
+	client := c.GitHubService.Client
+	if r.URL.Query().Get("refresh") == "true" {
+		token, err := c.GitHubTokenService.DefaultToken(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := client.RateLimit(r.Context(), token); err != nil {
+			http.Error(w, "Failed to get rate limit from GitHub: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reserve":  client.Reserve,
+		"max_wait": client.MaxWait.String(),
+		"budgets":  client.Budgets(),
+	})
+}
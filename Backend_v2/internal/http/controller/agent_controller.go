@@ -28,20 +28,37 @@ type AgentController struct {
 	LLMService        *service.LLMService
 	AssignmentService *service.AssignmentService
 	PrController      *PrController // <-- Fix type here
+	TestRunService    *service.TestRunService
+	PrDiffService     *service.PrDiffService
+	// DocumentVersionService records which document versions each review used
+	DocumentVersionService *service.DocumentVersionService
+	FileService            *service.FileService
+	GitHubTokenService     *service.GitHubTokenService
+	// CheckRunService reports each review on the PR's head commit
+	CheckRunService *service.CheckRunService
+	// PrLabelService keeps the grading labels on the PR
+	PrLabelService *service.PrLabelService
 }
 
-func NewAgentController(courseService *service.CourseService, prService *service.PrService, githubService *service.GitHubService, minioUtil *util.MinioUtil, log *logrus.Logger, agentEndpoint string, userService *service.UserService, llmService *service.LLMService, assignmentService *service.AssignmentService, prController *PrController) *AgentController {
+func NewAgentController(courseService *service.CourseService, prService *service.PrService, githubService *service.GitHubService, minioUtil *util.MinioUtil, log *logrus.Logger, agentEndpoint string, userService *service.UserService, llmService *service.LLMService, assignmentService *service.AssignmentService, prController *PrController, testRunService *service.TestRunService, prDiffService *service.PrDiffService, documentVersionService *service.DocumentVersionService, fileService *service.FileService, githubTokenService *service.GitHubTokenService, checkRunService *service.CheckRunService, prLabelService *service.PrLabelService) *AgentController {
 	return &AgentController{
-		CourseService:     courseService,
-		PrService:         prService,
-		GitHubService:     githubService,
-		MinioUtil:         minioUtil,
-		Log:               log,
-		AgentEndpoint:     agentEndpoint,
-		UserService:       userService,
-		LLMService:        llmService,
-		AssignmentService: assignmentService,
-		PrController:      prController, // <-- Fix type here
+		CourseService:          courseService,
+		PrService:              prService,
+		GitHubService:          githubService,
+		MinioUtil:              minioUtil,
+		Log:                    log,
+		AgentEndpoint:          agentEndpoint,
+		UserService:            userService,
+		LLMService:             llmService,
+		AssignmentService:      assignmentService,
+		PrController:           prController, // <-- Fix type here
+		TestRunService:         testRunService,
+		PrDiffService:          prDiffService,
+		DocumentVersionService: documentVersionService,
+		FileService:            fileService,
+		GitHubTokenService:     githubTokenService,
+		CheckRunService:        checkRunService,
+		PrLabelService:         prLabelService,
 	}
 }
 
@@ -91,23 +108,6 @@ func (c *AgentController) ReviewPRV2(w http.ResponseWriter, r *http.Request) {
 			prIDs = append(prIDs, id)
 		}
 	}
-	// Always use super_admin github_token
-	users, err := c.UserService.GetAllUsers(r.Context())
-	if err != nil {
-		http.Error(w, "Failed to get users", http.StatusInternalServerError)
-		return
-	}
-	var githubToken string
-	for _, user := range users {
-		if user.Role == "super_admin" && user.GithubToken != "" {
-			githubToken = user.GithubToken
-			break
-		}
-	}
-	if githubToken == "" {
-		http.Error(w, "Super admin github_token not found", http.StatusBadRequest)
-		return
-	}
 	llm, err := c.LLMService.GetByID(r.Context(), llmID)
 	if err != nil {
 		http.Error(w, "LLM not found", http.StatusNotFound)
@@ -118,31 +118,29 @@ func (c *AgentController) ReviewPRV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Course not found", http.StatusNotFound)
 		return
 	}
+	if rejectArchived(w, course) {
+		return
+	}
+	githubToken, err := c.GitHubTokenService.Token(r.Context(), course.ID)
+	if err != nil {
+		http.Error(w, "GitHub token not available: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 	assignment, err := c.AssignmentService.GetByID(r.Context(), assignmentID)
 	if err != nil {
 		http.Error(w, "Assignment not found", http.StatusNotFound)
 		return
 	}
 	// Presign URLs if needed
-	answerFilePath := assignment.AssignmentURL
-	if c.MinioUtil != nil && answerFilePath != "" {
-		presigned, err := c.MinioUtil.GeneratePresignedURL(r.Context(), answerFilePath)
-		if err == nil {
-			answerFilePath = presigned
-		}
-	}
-	codingConventionPath := course.GeneralAnswer
-	if c.MinioUtil != nil && codingConventionPath != "" {
-		presigned, err := c.MinioUtil.GeneratePresignedURL(r.Context(), codingConventionPath)
-		if err == nil {
-			codingConventionPath = presigned
-		}
-	}
-	owner, repo, err := util.ParseGitHubURL(course.GithubURL)
+	answerFilePath := c.agentFileURL(r.Context(), course.ID, assignment.AssignmentURL)
+	answerFiles := c.referenceFiles(r.Context(), course.ID, assignment.AssignmentURL)
+	codingConventionPath := c.agentFileURL(r.Context(), course.ID, course.GeneralAnswer)
+	_, repository, err := c.PrDiffService.GitProviders.ForCourse(course)
 	if err != nil {
 		http.Error(w, "Invalid GitHub URL in course", http.StatusBadRequest)
 		return
 	}
+	owner, repo := repository.Owner, repository.Name
 	results := make([]map[string]interface{}, 0, len(prIDs))
 	for _, prID := range prIDs {
 		pr, err := c.PrService.GetByID(r.Context(), prID)
@@ -159,20 +157,50 @@ func (c *AgentController) ReviewPRV2(w http.ResponseWriter, r *http.Request) {
 			"repo_name":              repo,
 			"pr_number":              prNumber,
 			"answer_file_path":       answerFilePath,
+			"answer_files":           answerFiles,
 			"coding_convention_path": codingConventionPath,
 			"model":                  llm.ModelID,
 		}
+		diff, err := c.PrDiffService.GetDiff(r.Context(), course, prNumber, pr.HeadSHA, githubToken)
+		if err == nil {
+			agentRequest["pr_diff"] = service.AgentFiles(diff)
+		} else {
+			c.Log.Errorf("Failed to get diff for PR #%d: %v", prNumber, err)
+			diff = nil
+		}
+		// The agent may outlast the router's 60s timeout, and the check run
+		// must be concluded even then
+		checkRun := c.CheckRunService.Start(context.WithoutCancel(r.Context()), course, prNumber, headSHA(diff, pr), githubToken)
+		if pr.Result != "" {
+			c.PrLabelService.Regrade(r.Context(), course, pr, githubToken)
+		}
+		testSummary := c.runHiddenTests(r.Context(), course, assignment, pr, owner, repo, githubToken)
+		if testSummary != nil {
+			agentRequest["test_results"] = testSummary
+		}
 		agentResp, err := callAgentAPIFormData(c.AgentEndpoint, agentRequest)
 		if err != nil {
+			c.CheckRunService.Fail(context.WithoutCancel(r.Context()), checkRun, "the review agent did not answer")
 			results = append(results, map[string]interface{}{"pr_id": prID, "error": "Agent call failed"})
 			continue
 		}
+		c.CheckRunService.Complete(context.WithoutCancel(r.Context()), checkRun, &service.CheckRunResult{Agent: agentResp, Tests: testSummary, Diff: diff})
 		c.Log.Info(agentResp)
 		// Save full response (summary + comments) as JSON in pr.Result
 		resultToSave := map[string]interface{}{
 			"summary":  agentResp.Summary,
 			"comments": agentResp.Comments,
 		}
+		if agentResp.Score != nil {
+			resultToSave["score"] = *agentResp.Score
+		}
+		if len(agentResp.Rubric) > 0 {
+			resultToSave["rubric"] = agentResp.Rubric
+		}
+		if testSummary != nil {
+			resultToSave["tests"] = testSummary
+		}
+		resultToSave["document_versions"] = c.DocumentVersionService.UsedVersions(r.Context(), assignment.AssignmentURL, course.GeneralAnswer)
 		resultJSON, err := json.Marshal(resultToSave)
 		if err != nil {
 			results = append(results, map[string]interface{}{"pr_id": prID, "error": "Failed to marshal agent response"})
@@ -199,6 +227,7 @@ func (c *AgentController) ReviewPRV2(w http.ResponseWriter, r *http.Request) {
 			results = append(results, map[string]interface{}{"pr_id": prID, "error": "Failed to update PR with agent result"})
 			continue
 		}
+		c.PrLabelService.Apply(context.WithoutCancel(r.Context()), course, pr, assignment, service.ReviewPassed(agentResp, testSummary, course.PassScore), githubToken)
 		results = append(results, map[string]interface{}{"pr_id": prID, "response": agentResp})
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -208,6 +237,73 @@ func (c *AgentController) ReviewPRV2(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// referenceFiles lists the reference answer behind fileURL with signed links,
+// so the agent can fetch each file of a multi-file solution
+func (c *AgentController) referenceFiles(ctx context.Context, courseID int, fileURL string) []model.ReferenceFile {
+	manifest, err := c.DocumentVersionService.GetReferenceFiles(ctx, fileURL)
+	if err != nil {
+		c.Log.Errorf("Failed to list reference files for %s: %v", fileURL, err)
+		return []model.ReferenceFile{}
+	}
+	for i := range manifest.Files {
+		manifest.Files[i].URL = c.agentFileURL(ctx, courseID, manifest.Files[i].FileURL)
+		manifest.Files[i].FileURL = ""
+	}
+	return manifest.Files
+}
+
+// agentFileURL returns a short-lived link the agent can fetch fileURL from,
+// or "" when there is no file
+func (c *AgentController) agentFileURL(ctx context.Context, courseID int, fileURL string) string {
+	if fileURL == "" {
+		return ""
+	}
+	signed, err := c.FileService.SignedURL(ctx, courseID, fileURL, service.FilePurposeAgentReview, service.AgentFileTokenTTL)
+	if err != nil {
+		c.Log.Errorf("Failed to sign file link for %s: %v", fileURL, err)
+		return ""
+	}
+	return signed
+}
+
+// headSHA is the commit a review of pr looks at: the diff's, or the last one
+// synced when the diff could not be fetched
+func headSHA(diff *model.PrDiff, pr *model.PrResponse) string {
+	if diff != nil && diff.HeadSHA != "" {
+		return diff.HeadSHA
+	}
+	return pr.HeadSHA
+}
+
+// runHiddenTests runs the assignment's hidden test suite against the PR and
+// returns its summary, or nil when the assignment has no tests configured
+func (c *AgentController) runHiddenTests(ctx context.Context, course *model.CourseResponse, assignment *model.AssignmentResponse, pr *model.PrResponse, owner, repo, githubToken string) map[string]interface{} {
+	if c.TestRunService == nil || assignment.TestCommand == "" || assignment.TestBundleURL == "" {
+		return nil
+	}
+	// The request's context ends with the router's 60s timeout; the sandbox
+	// bounds the run with its own
+	run, err := c.TestRunService.Run(context.WithoutCancel(ctx), &model.TestRunRequest{
+		CourseID:       course.ID,
+		AssignmentID:   assignment.ID,
+		PrID:           pr.ID,
+		RepoOwner:      owner,
+		RepoName:       repo,
+		RepoURL:        course.GithubURL,
+		GitProvider:    course.GitProvider,
+		PrNumber:       pr.PrNumber,
+		GithubToken:    githubToken,
+		TestBundleURL:  assignment.TestBundleURL,
+		TestCommand:    assignment.TestCommand,
+		TestReportPath: assignment.TestReportPath,
+	})
+	if err != nil {
+		c.Log.Errorf("Hidden tests failed to run for PR #%d: %v", pr.PrNumber, err)
+		return nil
+	}
+	return service.TestRunSummary(run)
+}
+
 // callAgentAPIFormData posts JSON to the agent endpoint and parses the response
 func callAgentAPIFormData(endpoint string, req map[string]interface{}) (*model.AgentResponse, error) {
 	client := &http.Client{Timeout: 600 * time.Second}
@@ -257,23 +353,6 @@ func (c *AgentController) ReviewPRAuto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Always use super_admin github_token
-	users, err := c.UserService.GetAllUsers(r.Context())
-	if err != nil {
-		http.Error(w, "Failed to get users", http.StatusInternalServerError)
-		return
-	}
-	var githubToken string
-	for _, user := range users {
-		if user.Role == "super_admin" && user.GithubToken != "" {
-			githubToken = user.GithubToken
-			break
-		}
-	}
-	if githubToken == "" {
-		http.Error(w, "Super admin github_token not found", http.StatusBadRequest)
-		return
-	}
 	llm, err := c.LLMService.GetByID(r.Context(), llmID)
 	if err != nil {
 		http.Error(w, "LLM not found", http.StatusNotFound)
@@ -284,6 +363,14 @@ func (c *AgentController) ReviewPRAuto(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Course not found", http.StatusNotFound)
 		return
 	}
+	if rejectArchived(w, course) {
+		return
+	}
+	githubToken, err := c.GitHubTokenService.Token(r.Context(), course.ID)
+	if err != nil {
+		http.Error(w, "GitHub token not available: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Get all assignments for this course
 	assignments, err := c.AssignmentService.GetAllByCourse(r.Context(), courseID)
@@ -301,21 +388,16 @@ func (c *AgentController) ReviewPRAuto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse GitHub URL to get owner and repo
-	owner, repo, err := util.ParseGitHubURL(course.GithubURL)
+	// Locate the repository to get owner and repo
+	_, repository, err := c.PrDiffService.GitProviders.ForCourse(course)
 	if err != nil {
 		http.Error(w, "Invalid GitHub URL in course", http.StatusBadRequest)
 		return
 	}
+	owner, repo := repository.Owner, repository.Name
 
-	// Generate presigned URLs for coding convention
-	codingConventionPath := course.GeneralAnswer
-	if c.MinioUtil != nil && codingConventionPath != "" {
-		presigned, err := c.MinioUtil.GeneratePresignedURL(r.Context(), codingConventionPath)
-		if err == nil {
-			codingConventionPath = presigned
-		}
-	}
+	// Short-lived signed link for the coding convention
+	codingConventionPath := c.agentFileURL(r.Context(), course.ID, course.GeneralAnswer)
 
 	// Process each PR
 	results := make([]map[string]interface{}, 0, len(prs))
@@ -332,16 +414,13 @@ func (c *AgentController) ReviewPRAuto(w http.ResponseWriter, r *http.Request) {
 
 		// Prepare answer file paths map with all assignments for the course
 		answerFilePaths := make(map[string]string)
+		answerFiles := make(map[string][]model.ReferenceFile)
+		usedDocuments := []string{course.GeneralAnswer}
 		for _, assignment := range assignments {
-			assignmentURL := assignment.AssignmentURL
-			if c.MinioUtil != nil && assignmentURL != "" {
-				presigned, err := c.MinioUtil.GeneratePresignedURL(r.Context(), assignmentURL)
-				if err == nil {
-					assignmentURL = presigned
-				}
-			}
+			usedDocuments = append(usedDocuments, assignment.AssignmentURL)
 			key := assignment.AssignmentName
-			answerFilePaths[key] = assignmentURL
+			answerFilePaths[key] = c.agentFileURL(r.Context(), course.ID, assignment.AssignmentURL)
+			answerFiles[key] = c.referenceFiles(r.Context(), course.ID, assignment.AssignmentURL)
 		}
 
 		// Call the agent API for auto-review
@@ -353,14 +432,39 @@ func (c *AgentController) ReviewPRAuto(w http.ResponseWriter, r *http.Request) {
 			"pr_description":         pr.PrDescription,
 			"pr_number":              pr.PrNumber,
 			"answer_file_paths":      answerFilePaths,
+			"answer_files":           answerFiles,
 			"coding_convention_path": codingConventionPath,
 			"model":                  llm.ModelID,
 		}
+		diff, err := c.PrDiffService.GetDiff(r.Context(), course, pr.PrNumber, pr.HeadSHA, githubToken)
+		if err == nil {
+			agentRequest["pr_diff"] = service.AgentFiles(diff)
+		} else {
+			c.Log.Errorf("Failed to get diff for PR #%d: %v", pr.PrNumber, err)
+			diff = nil
+		}
+		checkRun := c.CheckRunService.Start(context.WithoutCancel(r.Context()), course, pr.PrNumber, headSHA(diff, pr), githubToken)
+		if pr.Result != "" {
+			c.PrLabelService.Regrade(r.Context(), course, pr, githubToken)
+		}
+		var testSummary map[string]interface{}
+		var prAssignment *model.AssignmentResponse
+		for _, assignment := range assignments {
+			if assignment.ID == pr.AssignmentID {
+				prAssignment = assignment
+				testSummary = c.runHiddenTests(r.Context(), course, assignment, pr, owner, repo, githubToken)
+				break
+			}
+		}
+		if testSummary != nil {
+			agentRequest["test_results"] = testSummary
+		}
 		// c.Log.Infof("Calling agent API for PR #%d with request: %+v", pr.PrNumber, agentRequest)
 
 		agentResp, err := callAgentAPIAutoReview(c.AgentEndpoint, agentRequest)
 		if err != nil {
 			c.Log.Errorf("Error calling agent API for PR #%d: %v", pr.PrNumber, err)
+			c.CheckRunService.Fail(context.WithoutCancel(r.Context()), checkRun, "the review agent did not answer")
 
 			results = append(results, map[string]interface{}{
 				"pr_id":     pr.ID,
@@ -371,12 +475,23 @@ func (c *AgentController) ReviewPRAuto(w http.ResponseWriter, r *http.Request) {
 		}
 
 		c.Log.Infof("Auto-review response for PR %d: %+v", pr.PrNumber, agentResp)
+		c.CheckRunService.Complete(context.WithoutCancel(r.Context()), checkRun, &service.CheckRunResult{Agent: agentResp, Tests: testSummary, Diff: diff})
 
 		// Save the response to the PR
 		resultToSave := map[string]interface{}{
 			"summary":  agentResp.Summary,
 			"comments": agentResp.Comments,
 		}
+		if agentResp.Score != nil {
+			resultToSave["score"] = *agentResp.Score
+		}
+		if len(agentResp.Rubric) > 0 {
+			resultToSave["rubric"] = agentResp.Rubric
+		}
+		if testSummary != nil {
+			resultToSave["tests"] = testSummary
+		}
+		resultToSave["document_versions"] = c.DocumentVersionService.UsedVersions(r.Context(), usedDocuments...)
 		resultJSON, err := json.Marshal(resultToSave)
 		if err != nil {
 			results = append(results, map[string]interface{}{
@@ -413,6 +528,7 @@ func (c *AgentController) ReviewPRAuto(w http.ResponseWriter, r *http.Request) {
 			})
 			continue
 		}
+		c.PrLabelService.Apply(context.WithoutCancel(r.Context()), course, pr, prAssignment, service.ReviewPassed(agentResp, testSummary, course.PassScore), githubToken)
 
 		// Auto post review to GitHub
 		go func(prID, courseID int, agentResp *model.AgentResponse) {
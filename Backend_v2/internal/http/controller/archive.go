@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/model"
+	"net/http"
+)
+
+// rejectArchived answers 409 and returns true when the course is archived and
+// so must not be changed, graded or reviewed
+func rejectArchived(w http.ResponseWriter, course *model.CourseResponse) bool {
+	if course == nil || !course.Archived {
+		return false
+	}
+	http.Error(w, "Course is archived", http.StatusConflict)
+	return true
+}
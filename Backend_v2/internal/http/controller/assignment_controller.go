@@ -8,29 +8,35 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/minio/minio-go/v7"
 	"github.com/sirupsen/logrus"
 )
 
 type AssignmentController struct {
-	AssignmentService *service.AssignmentService
-	Log               *logrus.Logger
-	MinioUtil         *util.MinioUtil
-	AgentController   *AgentController // Added AgentController field
+	AssignmentService      *service.AssignmentService
+	Log                    *logrus.Logger
+	MinioUtil              *util.MinioUtil
+	AgentController        *AgentController // Added AgentController field
+	DocumentVersionService *service.DocumentVersionService
+	JWTUtil                *util.JWTUtil
+	FileService            *service.FileService
 }
 
-func NewAssignmentController(assignmentService *service.AssignmentService, log *logrus.Logger, minioClient *minio.Client, agentController *AgentController) *AssignmentController {
+func NewAssignmentController(assignmentService *service.AssignmentService, log *logrus.Logger, minioUtil *util.MinioUtil, agentController *AgentController, documentVersionService *service.DocumentVersionService, jwtUtil *util.JWTUtil, fileService *service.FileService) *AssignmentController {
 	return &AssignmentController{
-		AssignmentService: assignmentService,
-		Log:               log,
-		MinioUtil:         util.NewMinioUtil(minioClient, log),
-		AgentController:   agentController,
+		AssignmentService:      assignmentService,
+		Log:                    log,
+		MinioUtil:              minioUtil,
+		AgentController:        agentController,
+		DocumentVersionService: documentVersionService,
+		JWTUtil:                jwtUtil,
+		FileService:            fileService,
 	}
 }
 
@@ -42,27 +48,44 @@ func (c *AssignmentController) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	assignment := converter.RequestToAssignmentRequest(r)
-	var assignmentContent string
+	if r.FormValue("due_date") != "" && assignment.DueDate == nil {
+		http.Error(w, "Invalid due_date, expected RFC 3339", http.StatusBadRequest)
+		return
+	}
+	var assignmentContent []byte
+	var assignmentFileName string
 	assignmentFile, fileHeader, err := r.FormFile("file")
 	if err == nil {
 		defer assignmentFile.Close()
 		c.Log.Infof("Upload file: %s, size: %d bytes", fileHeader.Filename, fileHeader.Size)
 
-		content, err := io.ReadAll(assignmentFile)
+		assignmentContent, err = io.ReadAll(assignmentFile)
 		if err != nil {
 			c.Log.WithError(err).Error("Error reading assignment file")
 			http.Error(w, "Error reading assignment file", http.StatusInternalServerError)
 			return
 		}
-		assignmentContent = string(content)
-	}
-	course, _ := c.AssignmentService.GetCourseByID(r.Context(), assignment.CourseID)
-	assignmentURL, _ := c.MinioUtil.SaveFile(r.Context(), course.CourseName, course.CreatedAt, "assignment", assignment.AssignmentName, assignmentContent)
-	assignment.AssignmentURL = assignmentURL
-	// fmt.Println("assignmentURL")
-	// fmt.Println(assignmentURL)
-	// fmt.Println("assignment content")
-	// fmt.Println(assignmentContent)
+		assignmentFileName = fileHeader.Filename
+	}
+	// A reference solution folder can also be sent as several "files" parts
+	assignmentFiles, err := readDocumentFiles(r, "files")
+	if err != nil {
+		c.Log.WithError(err).Error("Error reading assignment files")
+		http.Error(w, "Error reading assignment files", http.StatusInternalServerError)
+		return
+	}
+	if assignmentFileName == "" && len(assignmentFiles) > 0 {
+		assignmentFileName = assignment.AssignmentName
+	}
+	course, err := c.AssignmentService.GetCourseByID(r.Context(), assignment.CourseID)
+	if err != nil {
+		c.Log.Println("Failed to get course for assignment:", err)
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+	if rejectArchived(w, course) {
+		return
+	}
 	assignmentResponse, err := c.AssignmentService.Create(r.Context(), assignment)
 	if err != nil {
 		c.Log.Println("Failed to create assignment:", err)
@@ -70,9 +93,26 @@ func (c *AssignmentController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The reference answer becomes version 1 of the assignment's document history
+	if assignmentFileName != "" {
+		version, err := c.DocumentVersionService.Upload(r.Context(), course, &model.DocumentUploadRequest{
+			CourseID:     course.ID,
+			AssignmentID: assignmentResponse.ID,
+			DocType:      service.DocTypeAssignmentAnswer,
+			FileName:     assignmentFileName,
+			Content:      assignmentContent,
+			Files:        assignmentFiles,
+			UploadedBy:   util.UserIDFromRequest(r, c.JWTUtil),
+		})
+		if err != nil {
+			c.Log.WithError(err).Error("Failed to store assignment answer")
+		} else {
+			assignmentResponse.AssignmentURL = version.FileURL
+		}
+	}
+
 	// Auto trigger agent review if course has auto_grade
-	course, err = c.AssignmentService.GetCourseByID(r.Context(), assignment.CourseID)
-	if err == nil && course.AutoGrade && c.AgentController != nil {
+	if course.AutoGrade && !course.Archived && c.AgentController != nil {
 		go func(courseID int) {
 			form := &bytes.Buffer{}
 			writer := multipart.NewWriter(form)
@@ -96,21 +136,45 @@ func (c *AssignmentController) Create(w http.ResponseWriter, r *http.Request) {
 func (c *AssignmentController) GetByID(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "assignment_id"))
 	assignmentResponse, err := c.AssignmentService.GetByID(r.Context(), id)
-	// c.Log.Println("assignmentResponse URL")
-	// c.Log.Println(assignmentResponse.AssignmentURL)
-	assignmentPres, _ := c.MinioUtil.GetFile(r.Context(), assignmentResponse.AssignmentURL)
-	// c.Log.Println("assignmentPres URL")
-	// c.Log.Println(assignmentPres)
-	assignmentResponse.AssignmentURL = assignmentPres
 	if err != nil {
 		c.Log.Println("Failed to get assignment by ID")
 		http.Error(w, "Failed to get assignment by ID", http.StatusInternalServerError)
 		return
 	}
+	// The answer is downloaded through /files/{id}, which checks course permission
+	assignmentResponse.AssignmentURL = c.FileService.Path(r.Context(), assignmentResponse.CourseID, assignmentResponse.AssignmentURL)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(assignmentResponse)
 }
 
+// GetFiles handles GET /assignments/{assignment_id}/files and lists the files of
+// the current reference answer, each with its own /files/{id} download path
+func (c *AssignmentController) GetFiles(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "assignment_id"))
+	if err != nil {
+		http.Error(w, "Invalid assignment ID", http.StatusBadRequest)
+		return
+	}
+	assignment, err := c.AssignmentService.GetByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Assignment not found", http.StatusNotFound)
+		return
+	}
+	manifest, err := c.DocumentVersionService.GetReferenceFiles(r.Context(), assignment.AssignmentURL)
+	if err != nil {
+		c.Log.Println("Failed to get reference files:", err)
+		http.Error(w, "Failed to get reference files", http.StatusInternalServerError)
+		return
+	}
+	manifest.AssignmentID = assignment.ID
+	for i := range manifest.Files {
+		manifest.Files[i].URL = c.FileService.Path(r.Context(), assignment.CourseID, manifest.Files[i].FileURL)
+		manifest.Files[i].FileURL = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
 func (c *AssignmentController) GetAllByCourse(w http.ResponseWriter, r *http.Request) {
 	courseID, _ := strconv.Atoi(chi.URLParam(r, "course_id"))
 	assignmentResponse, err := c.AssignmentService.GetAllByCourse(r.Context(), courseID)
@@ -146,16 +210,24 @@ func (c *AssignmentController) Update(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt:      time.Now(),
 	}
 
-	// Handle file upload for assignment
-	assignmentFile, fileHeader, err := r.FormFile("assignment_file")
-	if err == nil {
-		defer assignmentFile.Close()
-		content, err := io.ReadAll(assignmentFile)
-		if err == nil {
-			assignmentContent := string(content)
-			assignmentURL, _ := c.MinioUtil.SaveFile(r.Context(), request.AssignmentName, request.UpdatedAt, "assignment", fileHeader.Filename, assignmentContent)
-			request.AssignmentURL = assignmentURL
+	// Keep the hidden test suite; it is managed through /assignments/{id}/tests
+	if existing, err := c.AssignmentService.GetByID(r.Context(), id); err == nil {
+		if c.courseArchived(w, r, existing.CourseID) {
+			return
+		}
+		request.TestBundleURL = existing.TestBundleURL
+		request.TestCommand = existing.TestCommand
+		request.TestReportPath = existing.TestReportPath
+		request.AssignmentURL = existing.AssignmentURL
+		request.DueDate = existing.DueDate
+	}
+	if value := r.FormValue("due_date"); value != "" {
+		dueDate, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid due_date, expected RFC 3339", http.StatusBadRequest)
+			return
 		}
+		request.DueDate = &dueDate
 	}
 
 	assignmentResponse, err := c.AssignmentService.Update(r.Context(), request)
@@ -165,6 +237,54 @@ func (c *AssignmentController) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A new answer file or folder is stored as a new version; older ones stay available
+	var content []byte
+	var fileName string
+	assignmentFile, fileHeader, err := r.FormFile("assignment_file")
+	if err == nil {
+		defer assignmentFile.Close()
+		content, err = io.ReadAll(assignmentFile)
+		if err != nil {
+			c.Log.WithError(err).Error("Error reading assignment file")
+			http.Error(w, "Error reading assignment file", http.StatusInternalServerError)
+			return
+		}
+		fileName = fileHeader.Filename
+	}
+	assignmentFiles, err := readDocumentFiles(r, "files")
+	if err != nil {
+		c.Log.WithError(err).Error("Error reading assignment files")
+		http.Error(w, "Error reading assignment files", http.StatusInternalServerError)
+		return
+	}
+	if fileName == "" && len(assignmentFiles) > 0 {
+		fileName = assignmentResponse.AssignmentName
+	}
+	if fileName != "" {
+		course, err := c.AssignmentService.GetCourseByID(r.Context(), assignmentResponse.CourseID)
+		if err != nil {
+			c.Log.Println("Failed to get course for assignment:", err)
+			http.Error(w, "Course not found", http.StatusNotFound)
+			return
+		}
+		version, err := c.DocumentVersionService.Upload(r.Context(), course, &model.DocumentUploadRequest{
+			CourseID:     course.ID,
+			AssignmentID: assignmentResponse.ID,
+			DocType:      service.DocTypeAssignmentAnswer,
+			FileName:     fileName,
+			Content:      content,
+			Files:        assignmentFiles,
+			UploadedBy:   util.UserIDFromRequest(r, c.JWTUtil),
+			Note:         r.FormValue("note"),
+		})
+		if err != nil {
+			c.Log.Println("Failed to store assignment answer:", err)
+			http.Error(w, "Failed to store assignment answer", http.StatusInternalServerError)
+			return
+		}
+		assignmentResponse.AssignmentURL = version.FileURL
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(assignmentResponse)
 }
@@ -177,6 +297,9 @@ func (c *AssignmentController) Delete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid assignment ID", http.StatusBadRequest)
 		return
 	}
+	if existing, err := c.AssignmentService.GetByID(r.Context(), id); err == nil && c.courseArchived(w, r, existing.CourseID) {
+		return
+	}
 
 	err = c.AssignmentService.Delete(r.Context(), id)
 	if err != nil {
@@ -187,3 +310,41 @@ func (c *AssignmentController) Delete(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// courseArchived answers 409 and returns true when the assignment's course is archived
+func (c *AssignmentController) courseArchived(w http.ResponseWriter, r *http.Request, courseID int) bool {
+	course, err := c.AssignmentService.GetCourseByID(r.Context(), courseID)
+	if err != nil {
+		return false
+	}
+	return rejectArchived(w, course)
+}
+
+// readDocumentFiles collects every part named field of a multipart form, keyed
+// by the client-supplied file name (which may include a relative folder path)
+func readDocumentFiles(r *http.Request, field string) ([]model.DocumentFile, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+	files := make([]model.DocumentFile, 0, len(r.MultipartForm.File[field]))
+	for _, header := range r.MultipartForm.File[field] {
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		name := header.Filename
+		if params := header.Header.Get("Content-Disposition"); params != "" {
+			// multipart.FileHeader.Filename drops folders, so read the raw name
+			if _, p, err := mime.ParseMediaType(params); err == nil && p["filename"] != "" {
+				name = p["filename"]
+			}
+		}
+		files = append(files, model.DocumentFile{Path: name, Data: data})
+	}
+	return files, nil
+}
@@ -23,6 +23,8 @@ func NewChatController(chatService *service.ChatService, logger *logrus.Logger)
 	}
 }
 
+// Create adds a message to a thread of a PR, the PR's conversation unless
+// thread_key names another
 func (c *ChatController) Create(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseMultipartForm(64 << 20); err != nil {
 		c.log.WithError(err).Error("Error parsing multipart form")
@@ -30,25 +32,26 @@ func (c *ChatController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	request := converter.RequestToChatRequest(r)
-	if request.CourseID == 0 || request.UserID == 0 {
+	request := converter.RequestToChatMessageRequest(r)
+	if request.CourseID == 0 || request.PrID == 0 || request.Role == "" || request.Message == "" {
 		c.log.Println("Missing required fields")
-		http.Error(w, "Course ID and User ID are required", http.StatusBadRequest)
+		http.Error(w, "Course ID, PR ID, role and message are required", http.StatusBadRequest)
 		return
 	}
 
-	chat, err := c.ChatService.Create(r.Context(), request)
+	message, _, err := c.ChatService.AddMessage(r.Context(), request)
 	if err != nil {
-		c.log.Println("Failed to create chat:", err)
+		c.log.Println("Failed to add chat message:", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(chat)
+	json.NewEncoder(w).Encode(message)
 }
 
+// GetByID returns a thread with its messages
 func (c *ChatController) GetByID(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
@@ -58,17 +61,18 @@ func (c *ChatController) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chat, err := c.ChatService.GetByID(r.Context(), id)
+	thread, err := c.ChatService.GetThread(r.Context(), id)
 	if err != nil {
-		c.log.Println("Failed to get chat by ID:", err)
+		c.log.Println("Failed to get chat thread by ID:", err)
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(chat)
+	json.NewEncoder(w).Encode(thread)
 }
 
+// GetByCourseID lists the threads of the course's PRs, without messages
 func (c *ChatController) GetByCourseID(w http.ResponseWriter, r *http.Request) {
 	courseIDStr := chi.URLParam(r, "course_id")
 	courseID, err := strconv.Atoi(courseIDStr)
@@ -78,61 +82,18 @@ func (c *ChatController) GetByCourseID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chats, err := c.ChatService.GetByCourseID(r.Context(), courseID)
+	threads, err := c.ChatService.GetThreadsByCourse(r.Context(), courseID)
 	if err != nil {
-		c.log.Println("Failed to get chats by course ID:", err)
+		c.log.Println("Failed to get chat threads by course ID:", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(chats)
+	json.NewEncoder(w).Encode(threads)
 }
 
-// GetChatHistoryAsArray returns chat history as parsed JSON array
-func (c *ChatController) GetChatHistoryAsArray(w http.ResponseWriter, r *http.Request) {
-	courseIDStr := chi.URLParam(r, "course_id")
-	userIDStr := chi.URLParam(r, "user_id")
-	prIDStr := chi.URLParam(r, "pr_id")
-
-	courseID, err := strconv.Atoi(courseIDStr)
-	if err != nil {
-		c.log.Println("Invalid course ID:", err)
-		http.Error(w, "Invalid course ID", http.StatusBadRequest)
-		return
-	}
-
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		c.log.Println("Invalid user ID:", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-
-	prID, err := strconv.Atoi(prIDStr)
-	if err != nil {
-		c.log.Println("Invalid PR ID:", err)
-		http.Error(w, "Invalid PR ID", http.StatusBadRequest)
-		return
-	}
-
-	chatHistory, err := c.ChatService.GetChatHistoryAsArray(r.Context(), courseID, userID, prID)
-	if err != nil {
-		c.log.Println("Failed to get chat history:", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"course_id": courseID,
-		"user_id":   userID,
-		"pr_id":     prID,
-		"messages":  chatHistory,
-	})
-}
-
-// GetByPrID returns all chats for a specific PR
+// GetByPrID returns the threads of a PR, by its row ID, with their messages
 func (c *ChatController) GetByPrID(w http.ResponseWriter, r *http.Request) {
 	prIDStr := chi.URLParam(r, "pr_id")
 	prID, err := strconv.Atoi(prIDStr)
@@ -142,13 +103,13 @@ func (c *ChatController) GetByPrID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chats, err := c.ChatService.GetByPrID(r.Context(), prID)
+	threads, err := c.ChatService.GetThreadsByPr(r.Context(), prID)
 	if err != nil {
-		c.log.Println("Failed to get chats by PR ID:", err)
+		c.log.Println("Failed to get chat threads by PR ID:", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(chats)
+	json.NewEncoder(w).Encode(threads)
 }
@@ -6,7 +6,9 @@ import (
 	"be/neurade/v2/internal/service"
 	"be/neurade/v2/internal/util"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -17,8 +19,8 @@ import (
 	"be/neurade/v2/internal/entity"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/minio/minio-go/v7"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type CourseController struct {
@@ -29,17 +31,29 @@ type CourseController struct {
 	JWTUtil                     *util.JWTUtil
 	PermissionUserCourseService *service.PermissionUserCourseService
 	GitHubWebhookController     *GitHubWebhookController // Fixed type
+	DocumentVersionService      *service.DocumentVersionService
+	FileService                 *service.FileService
+	CourseCloneService          *service.CourseCloneService
+	CourseDeletionService       *service.CourseDeletionService
+	GitHubTokenService          *service.GitHubTokenService
+	CourseWebhookService        *service.CourseWebhookService
 }
 
-func NewCourseController(courseService *service.CourseService, userService *service.UserService, log *logrus.Logger, minioClient *minio.Client, jwtUtil *util.JWTUtil, permissionUserCourseService *service.PermissionUserCourseService, githubWebhookController *GitHubWebhookController) *CourseController {
+func NewCourseController(courseService *service.CourseService, userService *service.UserService, log *logrus.Logger, minioUtil *util.MinioUtil, jwtUtil *util.JWTUtil, permissionUserCourseService *service.PermissionUserCourseService, githubWebhookController *GitHubWebhookController, documentVersionService *service.DocumentVersionService, fileService *service.FileService, courseCloneService *service.CourseCloneService, courseDeletionService *service.CourseDeletionService, githubTokenService *service.GitHubTokenService, courseWebhookService *service.CourseWebhookService) *CourseController {
 	return &CourseController{
 		CourseService:               courseService,
 		UserService:                 userService,
 		Log:                         log,
-		MinioUntil:                  util.NewMinioUtil(minioClient, log),
+		MinioUntil:                  minioUtil,
 		JWTUtil:                     jwtUtil,
 		PermissionUserCourseService: permissionUserCourseService,
 		GitHubWebhookController:     githubWebhookController, // Pass as parameter
+		DocumentVersionService:      documentVersionService,
+		FileService:                 fileService,
+		CourseCloneService:          courseCloneService,
+		CourseDeletionService:       courseDeletionService,
+		GitHubTokenService:          githubTokenService,
+		CourseWebhookService:        courseWebhookService,
 	}
 }
 
@@ -68,45 +82,60 @@ func (c *CourseController) Create(w http.ResponseWriter, r *http.Request) {
 
 	course := converter.RequestToCourseRequest(r)
 	course.UserID = userID
-	var generalAnswerContent string
-	var generalAnswerURL string
+	if !util.ValidGitProvider(course.GitProvider) {
+		http.Error(w, "Invalid git_provider, expected github, gitlab or local", http.StatusBadRequest)
+		return
+	}
+	if !validPassScore(r.FormValue("pass_score")) {
+		http.Error(w, "Invalid pass_score, expected 0-100", http.StatusBadRequest)
+		return
+	}
+	if !util.ValidBotHandle(course.BotHandle) {
+		http.Error(w, "Invalid bot_handle, expected a GitHub or GitLab username", http.StatusBadRequest)
+		return
+	}
+	var generalAnswerContent []byte
+	var generalAnswerName string
 	generalAnswerFile, fileHeader, err := r.FormFile("file")
 	if err == nil && fileHeader != nil {
 		defer generalAnswerFile.Close()
 		c.Log.Infof("Uploaded file: %s, size: %d bytes", fileHeader.Filename, fileHeader.Size)
 
-		content, err := io.ReadAll(generalAnswerFile)
+		generalAnswerContent, err = io.ReadAll(generalAnswerFile)
 		if err != nil {
 			c.Log.WithError(err).Error("Error reading general answer file")
 			http.Error(w, "Error reading file", http.StatusInternalServerError)
 			return
 		}
-		generalAnswerContent = string(content)
-		generalAnswerURL, _ = c.MinioUntil.SaveFile(r.Context(), course.CourseName, course.CreatedAt, "course", fileHeader.Filename, generalAnswerContent)
-	} else {
-		generalAnswerURL = ""
-	}
-	// c.Log.Infof("General answer URL: %s", generalAnswerURL)
-	// c.Log.Infof("Course: %+v", course)
-	// c.Log.Infof("Owner: %s, RepoName: %s", course.Owner, course.RepoName)
-	// c.Log.Infof("Github URL: %s", course.GithubURL)
-	// c.Log.Infof("General answer content: %s", generalAnswerContent)
-	course.GeneralAnswer = generalAnswerURL
+		generalAnswerName = fileHeader.Filename
+	}
+	course.GeneralAnswer = ""
 	owner, repoName, err := util.ParseGitHubURL(course.GithubURL)
 	course.Owner = owner
 	course.RepoName = repoName
 	courseResponse, err := c.CourseService.Create(r.Context(), course)
-	if err != nil {
-		c.Log.Println("Fail to parse github url:", err)
-		http.Error(w, "Fail to crate courses", http.StatusInternalServerError)
-	}
-
 	if err != nil {
 		c.Log.Println("Failed to create course:", err)
 		http.Error(w, "Failed to create course", http.StatusInternalServerError)
 		return
 	}
 
+	// The coding convention becomes version 1 of the course's document history
+	if generalAnswerName != "" {
+		version, err := c.DocumentVersionService.Upload(r.Context(), courseResponse, &model.DocumentUploadRequest{
+			CourseID:   courseResponse.ID,
+			DocType:    service.DocTypeCodingConvention,
+			FileName:   generalAnswerName,
+			Content:    generalAnswerContent,
+			UploadedBy: userID,
+		})
+		if err != nil {
+			c.Log.WithError(err).Error("Failed to store coding convention")
+		} else {
+			courseResponse.GeneralAnswer = version.FileURL
+		}
+	}
+
 	// Immediately sync PRs for the new course
 	go func(courseID int) {
 		defer func() { recover() }()
@@ -121,22 +150,78 @@ func (c *CourseController) Create(w http.ResponseWriter, r *http.Request) {
 			c.GitHubWebhookController.FetchPullRequests(wDummy, dummyReq)
 		}
 	}(courseResponse.ID)
+	c.registerWebhook(courseResponse.ID)
 	c.Log.Infof("Course created: %+v", courseResponse)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(courseResponse)
 }
 
+// Clone handles POST /courses/{course_id}/clone with course_name, github_url and
+// optional copy_permissions, creating next term's course from this one
+func (c *CourseController) Clone(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(8 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	sourceID, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	request := converter.RequestToCourseCloneRequest(r)
+	if request.CourseName == "" || (request.GithubURL == "" && request.GitProvider != util.GitProviderLocal) {
+		http.Error(w, "course_name and github_url are required", http.StatusBadRequest)
+		return
+	}
+	if !util.ValidGitProvider(request.GitProvider) {
+		http.Error(w, "Invalid git_provider, expected github, gitlab or local", http.StatusBadRequest)
+		return
+	}
+	request.UserID = util.UserIDFromRequest(r, c.JWTUtil)
+
+	cloneResponse, err := c.CourseCloneService.Clone(r.Context(), sourceID, request)
+	if err != nil {
+		c.Log.Println("Failed to clone course:", err)
+		http.Error(w, "Failed to clone course", http.StatusInternalServerError)
+		return
+	}
+
+	// Pull the new repository's PRs, as for a freshly created course
+	go func(courseID int) {
+		defer func() { recover() }()
+		form := &bytes.Buffer{}
+		writer := multipart.NewWriter(form)
+		_ = writer.WriteField("course_id", strconv.Itoa(courseID))
+		writer.Close()
+		dummyReq, _ := http.NewRequest("POST", "", form)
+		dummyReq.Header.Set("Content-Type", writer.FormDataContentType())
+		wDummy := &util.DummyResponseWriter{}
+		if c.GitHubWebhookController != nil {
+			c.GitHubWebhookController.FetchPullRequests(wDummy, dummyReq)
+		}
+	}(cloneResponse.Course.ID)
+	c.registerWebhook(cloneResponse.Course.ID)
+
+	cloneResponse.Course.GeneralAnswer = c.FileService.Path(r.Context(), cloneResponse.Course.ID, cloneResponse.Course.GeneralAnswer)
+	for _, assignment := range cloneResponse.Assignments {
+		assignment.AssignmentURL = c.FileService.Path(r.Context(), assignment.CourseID, assignment.AssignmentURL)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cloneResponse)
+}
+
 func (c *CourseController) GetByID(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "course_id"))
 	courseResponse, err := c.CourseService.GetByID(r.Context(), id)
-	generalAnsPres, _ := c.MinioUntil.GetFile(r.Context(), courseResponse.GeneralAnswer)
-	courseResponse.GeneralAnswer = generalAnsPres
 	if err != nil {
 		c.Log.Println("Failed to get course:", err)
 		http.Error(w, "Failed to get course", http.StatusInternalServerError)
 		return
 	}
+	// The convention is downloaded through /files/{id}, which checks course permission
+	courseResponse.GeneralAnswer = c.FileService.Path(r.Context(), courseResponse.ID, courseResponse.GeneralAnswer)
 	json.NewEncoder(w).Encode(courseResponse)
 }
 
@@ -174,6 +259,9 @@ func (c *CourseController) Update(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Course not found", http.StatusNotFound)
 		return
 	}
+	if rejectArchived(w, existingCourse) {
+		return
+	}
 	c.Log.Infof("Existing course: %+v", existingCourse)
 	request := &model.CourseUpdateRequest{
 		ID:         id,
@@ -195,6 +283,29 @@ func (c *CourseController) Update(w http.ResponseWriter, r *http.Request) {
 	if r.FormValue("auto_grade") == "" {
 		request.AutoGrade = existingCourse.AutoGrade
 	}
+	request.GitProvider = r.FormValue("git_provider")
+	if request.GitProvider == "" {
+		request.GitProvider = existingCourse.GitProvider
+	} else if !util.ValidGitProvider(request.GitProvider) {
+		http.Error(w, "Invalid git_provider, expected github, gitlab or local", http.StatusBadRequest)
+		return
+	}
+	request.PassScore = existingCourse.PassScore
+	if value := r.FormValue("pass_score"); value != "" {
+		if !validPassScore(value) {
+			http.Error(w, "Invalid pass_score, expected 0-100", http.StatusBadRequest)
+			return
+		}
+		request.PassScore, _ = strconv.Atoi(value)
+	}
+	request.BotHandle = existingCourse.BotHandle
+	if value := util.NormalizeBotHandle(r.FormValue("bot_handle")); value != "" {
+		if !util.ValidBotHandle(value) {
+			http.Error(w, "Invalid bot_handle, expected a GitHub or GitLab username", http.StatusBadRequest)
+			return
+		}
+		request.BotHandle = value
+	}
 
 	// Parse GitHub URL to get owner and repo name
 	owner, repoName, err := util.ParseGitHubURL(request.GithubURL)
@@ -206,20 +317,15 @@ func (c *CourseController) Update(w http.ResponseWriter, r *http.Request) {
 		request.RepoName = existingCourse.RepoName
 	}
 
-	// Handle file upload for general answer
-	generalAnswerFile, fileHeader, err := r.FormFile("general_answer")
-	if err == nil {
-		defer generalAnswerFile.Close()
-		content, err := io.ReadAll(generalAnswerFile)
-		if err == nil {
-			generalAnswerContent := string(content)
-			generalAnswerURL, _ := c.MinioUntil.SaveFile(r.Context(), request.CourseName, request.UpdatedAt, "course", fileHeader.Filename, generalAnswerContent)
-			request.GeneralAnswer = generalAnswerURL
+	request.GeneralAnswer = existingCourse.GeneralAnswer
+
+	// The hook on the old repository goes before the course points elsewhere
+	repositoryChanged := request.Owner != existingCourse.Owner || request.RepoName != existingCourse.RepoName
+	if repositoryChanged {
+		if err := c.CourseWebhookService.Unregister(r.Context(), id); err != nil {
+			c.Log.WithError(err).Warnf("Failed to remove webhook of course %d from its old repository", id)
 		}
 	}
-	if request.GeneralAnswer == "" {
-		request.GeneralAnswer = existingCourse.GeneralAnswer
-	}
 
 	courseResponse, err := c.CourseService.Update(r.Context(), request)
 	if err != nil {
@@ -227,11 +333,38 @@ func (c *CourseController) Update(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to update course", http.StatusInternalServerError)
 		return
 	}
+	c.registerWebhook(id)
+
+	// A new general answer is stored as a new version; older ones stay available
+	generalAnswerFile, fileHeader, err := r.FormFile("general_answer")
+	if err == nil {
+		defer generalAnswerFile.Close()
+		content, err := io.ReadAll(generalAnswerFile)
+		if err == nil {
+			version, err := c.DocumentVersionService.Upload(r.Context(), courseResponse, &model.DocumentUploadRequest{
+				CourseID:   courseResponse.ID,
+				DocType:    service.DocTypeCodingConvention,
+				FileName:   fileHeader.Filename,
+				Content:    content,
+				UploadedBy: util.UserIDFromRequest(r, c.JWTUtil),
+				Note:       r.FormValue("note"),
+			})
+			if err != nil {
+				c.Log.Println("Failed to store general answer:", err)
+				http.Error(w, "Failed to store general answer", http.StatusInternalServerError)
+				return
+			}
+			courseResponse.GeneralAnswer = version.FileURL
+		}
+	}
 	c.Log.Infof("Course updated: %+v", courseResponse)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(courseResponse)
 }
 
+// Delete handles DELETE /courses/{course_id}. The course is archived at once
+// and removed with all its PRs, chats, assignments and files by a background
+// job; poll GET /courses/deletions/{job_id} for the outcome.
 func (c *CourseController) Delete(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "course_id")
 	id, err := strconv.Atoi(idStr)
@@ -241,14 +374,172 @@ func (c *CourseController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = c.CourseService.Delete(r.Context(), id)
+	job, err := c.CourseDeletionService.Request(r.Context(), id, util.UserIDFromRequest(r, c.JWTUtil))
 	if err != nil {
 		c.Log.Println("Failed to delete course:", err)
 		http.Error(w, "Failed to delete course", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetDeletionJob handles GET /courses/deletions/{job_id}
+func (c *CourseController) GetDeletionJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "job_id"))
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	job, err := c.CourseDeletionService.GetByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Deletion job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// Archive handles POST /courses/{course_id}/archive
+func (c *CourseController) Archive(w http.ResponseWriter, r *http.Request) {
+	c.setArchived(w, r, true)
+}
+
+// Unarchive handles POST /courses/{course_id}/unarchive
+func (c *CourseController) Unarchive(w http.ResponseWriter, r *http.Request) {
+	c.setArchived(w, r, false)
+}
+
+func (c *CourseController) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	if !archived && c.CourseDeletionService.InProgress(r.Context(), id) {
+		http.Error(w, "Course is being deleted", http.StatusConflict)
+		return
+	}
+	courseResponse, err := c.CourseService.SetArchived(r.Context(), id, archived)
+	if err != nil {
+		c.Log.Println("Failed to change course archive state:", err)
+		http.Error(w, "Failed to change course archive state", http.StatusInternalServerError)
+		return
+	}
+	courseResponse.GeneralAnswer = c.FileService.Path(r.Context(), courseResponse.ID, courseResponse.GeneralAnswer)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(courseResponse)
+}
+
+// GetGitHubCredential handles GET /courses/{course_id}/github-credential and
+// tells which credential the course's GitHub calls use
+func (c *CourseController) GetGitHubCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	credential, err := c.GitHubTokenService.Describe(r.Context(), id)
+	if err != nil {
+		http.Error(w, "No GitHub credential for course: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(credential)
+}
+
+// UpdateGitHubCredential handles PUT /courses/{course_id}/github-credential.
+// The github_token must be able to read the course repository; an empty one
+// removes the course credential.
+func (c *CourseController) UpdateGitHubCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseMultipartForm(4 << 20); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	credential, err := c.GitHubTokenService.SetCourseToken(r.Context(), id, r.FormValue("github_token"))
+	if err != nil {
+		c.Log.Println("Failed to update course GitHub credential:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(credential)
+}
+
+// GetWebhook handles GET /courses/{course_id}/webhook and reports the course
+// webhook's latest deliveries as recorded by GitHub
+func (c *CourseController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	health, err := c.CourseWebhookService.Health(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotRegistered) || errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, service.ErrWebhookLocalCourse) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.Log.Println("Failed to get webhook health:", err)
+		http.Error(w, "Failed to get webhook from GitHub: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// RegisterWebhook handles POST /courses/{course_id}/webhook, registering the
+// course webhook again, e.g. after it was removed on GitHub
+func (c *CourseController) RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	course, err := c.CourseService.GetByID(r.Context(), id)
+	if err != nil || course == nil {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+	if rejectArchived(w, course) {
+		return
+	}
+	if _, err := c.CourseWebhookService.Register(r.Context(), id); err != nil {
+		c.Log.Println("Failed to register webhook:", err)
+		if errors.Is(err, service.ErrWebhookNotConfigured) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, service.ErrWebhookLocalCourse) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to register webhook: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	c.GetWebhook(w, r)
+}
+
+// registerWebhook sets up the course webhook in the background; a course is
+// still usable without one through manual PR syncs
+func (c *CourseController) registerWebhook(courseID int) {
+	go func() {
+		defer func() { recover() }()
+		if _, err := c.CourseWebhookService.Register(context.Background(), courseID); err != nil && !errors.Is(err, service.ErrWebhookLocalCourse) {
+			c.Log.WithError(err).Warnf("Failed to register webhook for course %d", courseID)
+		}
+	}()
 }
 
 // Handler to get all courses a user has permission for
@@ -380,3 +671,13 @@ func (c *CourseController) UpdateUserCoursePermissions(w http.ResponseWriter, r
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("User course permissions updated"))
 }
+
+// validPassScore reports whether value, from the pass_score form field, is
+// empty or a score between 0 and 100
+func validPassScore(value string) bool {
+	if value == "" {
+		return true
+	}
+	score, err := strconv.Atoi(value)
+	return err == nil && score >= 0 && score <= 100
+}
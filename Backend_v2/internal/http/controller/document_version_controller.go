@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+type DocumentVersionController struct {
+	DocumentVersionService *service.DocumentVersionService
+	JWTUtil                *util.JWTUtil
+	Log                    *logrus.Logger
+}
+
+func NewDocumentVersionController(documentVersionService *service.DocumentVersionService, jwtUtil *util.JWTUtil, log *logrus.Logger) *DocumentVersionController {
+	return &DocumentVersionController{
+		DocumentVersionService: documentVersionService,
+		JWTUtil:                jwtUtil,
+		Log:                    log,
+	}
+}
+
+// GetChangelog handles GET /courses/{course_id}/documents. Pass ?assignment_id=
+// for one assignment's answers, or assignment_id=0 for the coding convention.
+func (c *DocumentVersionController) GetChangelog(w http.ResponseWriter, r *http.Request) {
+	courseID, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	assignmentID := -1
+	if v := r.URL.Query().Get("assignment_id"); v != "" {
+		assignmentID, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid assignment ID", http.StatusBadRequest)
+			return
+		}
+	}
+	versions, err := c.DocumentVersionService.GetChangelog(r.Context(), courseID, assignmentID)
+	if err != nil {
+		http.Error(w, "Failed to get document changelog", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// Rollback handles POST /courses/{course_id}/documents/{version_id}/rollback
+func (c *DocumentVersionController) Rollback(w http.ResponseWriter, r *http.Request) {
+	courseID, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	versionID, err := strconv.Atoi(chi.URLParam(r, "version_id"))
+	if err != nil {
+		http.Error(w, "Invalid version ID", http.StatusBadRequest)
+		return
+	}
+	target, err := c.DocumentVersionService.GetChangelog(r.Context(), courseID, -1)
+	if err != nil {
+		http.Error(w, "Failed to get document changelog", http.StatusInternalServerError)
+		return
+	}
+	found := false
+	for _, v := range target {
+		if v.ID == versionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		http.Error(w, "Document version not found in course", http.StatusNotFound)
+		return
+	}
+
+	version, err := c.DocumentVersionService.Rollback(r.Context(), versionID, util.UserIDFromRequest(r, c.JWTUtil))
+	if err != nil {
+		c.Log.Println("Failed to roll back document:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version)
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type FileController struct {
+	FileService *service.FileService
+	Log         *logrus.Logger
+}
+
+func NewFileController(fileService *service.FileService, log *logrus.Logger) *FileController {
+	return &FileController{
+		FileService: fileService,
+		Log:         log,
+	}
+}
+
+// Download handles GET /files/{file_id}. It supports Range requests and
+// answers If-None-Match with 304 using the object's ETag.
+func (c *FileController) Download(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "file_id"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	reader, info, err := c.FileService.Open(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, util.ErrObjectNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		c.Log.WithError(err).Error("Failed to open file")
+		http.Error(w, "Failed to open file", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if info.ETag != "" {
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+	}
+	http.ServeContent(w, r, "", info.LastModified, reader)
+}
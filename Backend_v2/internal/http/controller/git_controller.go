@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cgi"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	gitUploadPack  = "git-upload-pack"
+	gitReceivePack = "git-receive-pack"
+)
+
+// GitController serves the repositories of local courses over git's smart
+// HTTP protocol, through git http-backend. Students sign in with their email
+// and password and only ever reach their own repository.
+type GitController struct {
+	LocalGitService             *service.LocalGitService
+	UserService                 *service.UserService
+	CourseService               *service.CourseService
+	AssignmentService           *service.AssignmentService
+	PermissionUserCourseService *service.PermissionUserCourseService
+	JWTUtil                     *util.JWTUtil
+	Log                         *logrus.Logger
+	// AutoGrade reviews the course's ungraded PRs after a submission
+	AutoGrade func(course *model.CourseResponse)
+}
+
+func NewGitController(localGitService *service.LocalGitService, userService *service.UserService, courseService *service.CourseService, assignmentService *service.AssignmentService, permissionUserCourseService *service.PermissionUserCourseService, jwtUtil *util.JWTUtil, log *logrus.Logger) *GitController {
+	return &GitController{
+		LocalGitService:             localGitService,
+		UserService:                 userService,
+		CourseService:               courseService,
+		AssignmentService:           assignmentService,
+		PermissionUserCourseService: permissionUserCourseService,
+		JWTUtil:                     jwtUtil,
+		Log:                         log,
+	}
+}
+
+// Serve handles /git/{course_id}/{assignment_id}.git/..., the info/refs,
+// git-upload-pack and git-receive-pack requests of clone, fetch and push. A
+// push that moves the submit branch is saved as the student's PR.
+func (c *GitController) Serve(w http.ResponseWriter, r *http.Request) {
+	email, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="neurade"`)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	user, err := c.UserService.Authenticate(r.Context(), email, password)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="neurade"`)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	gitService := chi.URLParam(r, "service")
+	if gitService == "" {
+		gitService = r.URL.Query().Get("service")
+	}
+	if gitService != gitUploadPack && gitService != gitReceivePack {
+		http.Error(w, "Unsupported git service", http.StatusForbidden)
+		return
+	}
+	course, assignment, ok := c.target(w, r, user.ID, user.Role)
+	if !ok {
+		return
+	}
+	if gitService == gitReceivePack && rejectArchived(w, course) {
+		return
+	}
+	repo, err := c.LocalGitService.Open(r.Context(), course.ID, assignment.ID, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to open repository", http.StatusInternalServerError)
+		return
+	}
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		http.Error(w, "git is not installed", http.StatusInternalServerError)
+		return
+	}
+	root, err := filepath.Abs(c.LocalGitService.Root)
+	if err != nil {
+		http.Error(w, "Invalid repository root", http.StatusInternalServerError)
+		return
+	}
+	// The backend finds the repository from PATH_INFO under GIT_PROJECT_ROOT
+	rest := r.URL.Path[strings.Index(r.URL.Path, ".git/")+len(".git"):]
+	backendRequest := r.Clone(r.Context())
+	backendRequest.URL.Path = "/" + c.LocalGitService.Path(repo) + rest
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + root,
+			"GIT_HTTP_EXPORT_ALL=1",
+			"REMOTE_USER=" + user.Email,
+		},
+	}
+	backend.ServeHTTP(w, backendRequest)
+
+	if gitService == gitReceivePack && r.Method == http.MethodPost {
+		c.submit(context.WithoutCancel(r.Context()), course, repo)
+	}
+}
+
+// submit saves the submit branch, if the push moved it, and starts grading.
+// The push has been answered by now, so failures are only logged.
+func (c *GitController) submit(ctx context.Context, course *model.CourseResponse, repo *entity.GitRepository) {
+	pr, created, err := c.LocalGitService.Submit(ctx, repo)
+	if err != nil {
+		c.Log.Errorf("Failed to save submission of repository %s: %v", c.LocalGitService.Path(repo), err)
+		return
+	}
+	if pr == nil {
+		return
+	}
+	c.Log.Infof("Submission for PR %d of course %d received (new: %v)", pr.PrNumber, course.ID, created)
+	if course.AutoGrade && c.AutoGrade != nil {
+		c.AutoGrade(course)
+	}
+}
+
+// GetRepository handles GET /courses/{course_id}/assignments/{assignment_id}/repository,
+// the calling user's repository for the assignment with its clone URL. The
+// repository is created on the first call.
+func (c *GitController) GetRepository(w http.ResponseWriter, r *http.Request) {
+	userID := util.UserIDFromRequest(r, c.JWTUtil)
+	if userID == 0 {
+		http.Error(w, "Missing token", http.StatusUnauthorized)
+		return
+	}
+	user, err := c.UserService.GetByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+	course, assignment, ok := c.target(w, r, user.ID, user.Role)
+	if !ok {
+		return
+	}
+	repo, err := c.LocalGitService.Open(r.Context(), course.ID, assignment.ID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrLocalGitNotConfigured) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "Failed to open repository", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.LocalGitService.Describe(repo))
+}
+
+// target resolves the local course and assignment of the request and checks
+// the user may work on the course
+func (c *GitController) target(w http.ResponseWriter, r *http.Request, userID int, role string) (*model.CourseResponse, *model.AssignmentResponse, bool) {
+	courseID, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	assignmentID, err := strconv.Atoi(chi.URLParam(r, "assignment_id"))
+	if err != nil {
+		http.Error(w, "Invalid assignment ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	course, err := c.CourseService.GetByID(r.Context(), courseID)
+	if err != nil || course == nil || course.GitProvider != util.GitProviderLocal {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	assignment, err := c.AssignmentService.GetByID(r.Context(), assignmentID)
+	if err != nil || assignment.CourseID != course.ID {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if role != "super_admin" && course.UserID != userID {
+		permission, err := c.PermissionUserCourseService.Repository.FindByUserAndCourse(c.PermissionUserCourseService.DB, userID, course.ID)
+		if err != nil || permission == nil {
+			http.Error(w, "No permission for this course", http.StatusForbidden)
+			return nil, nil, false
+		}
+	}
+	return course, assignment, true
+}
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/http"
@@ -18,32 +19,47 @@ import (
 )
 
 type GitHubWebhookController struct {
-	githubService     *service.GitHubService
-	prService         *service.PrService
-	courseService     *service.CourseService
-	userService       *service.UserService
-	chatService       *service.ChatService
-	llmService        *service.LLMService
-	assignmentService *service.AssignmentService
-	minioUtil         *util.MinioUtil
-	log               *logrus.Logger
-	chatEnpoint       string
-	agentController   *AgentController // <-- Add this line
+	githubService      *service.GitHubService
+	githubTokenService *service.GitHubTokenService
+	prService          *service.PrService
+	courseService      *service.CourseService
+	userService        *service.UserService
+	chatService        *service.ChatService
+	llmService         *service.LLMService
+	assignmentService  *service.AssignmentService
+	minioUtil          *util.MinioUtil
+	log                *logrus.Logger
+	chatEnpoint        string
+	agentController    *AgentController // <-- Add this line
+	webhookService     *service.CourseWebhookService
+	deliveryService    *service.WebhookDeliveryService
+	prSyncService      *service.PrSyncService
+	gitProviders       *service.GitProviders
+	prCommandService   *service.PrCommandService
+	// permissionService tells course staff from students in comments
+	permissionService *service.PermissionUserCourseService
 }
 
-func NewGitHubWebhookController(githubService *service.GitHubService, prService *service.PrService, courseService *service.CourseService, userService *service.UserService, chatService *service.ChatService, llmService *service.LLMService, assignmentService *service.AssignmentService, minioUtil *util.MinioUtil, log *logrus.Logger, chatEnpoint string, agentController *AgentController) *GitHubWebhookController {
+func NewGitHubWebhookController(githubService *service.GitHubService, githubTokenService *service.GitHubTokenService, prService *service.PrService, courseService *service.CourseService, userService *service.UserService, chatService *service.ChatService, llmService *service.LLMService, assignmentService *service.AssignmentService, minioUtil *util.MinioUtil, log *logrus.Logger, chatEnpoint string, agentController *AgentController, webhookService *service.CourseWebhookService, deliveryService *service.WebhookDeliveryService, prSyncService *service.PrSyncService, gitProviders *service.GitProviders, prCommandService *service.PrCommandService, permissionService *service.PermissionUserCourseService) *GitHubWebhookController {
 	return &GitHubWebhookController{
-		githubService:     githubService,
-		prService:         prService,
-		courseService:     courseService,
-		userService:       userService,
-		chatService:       chatService,
-		llmService:        llmService,
-		assignmentService: assignmentService,
-		minioUtil:         minioUtil,
-		log:               log,
-		chatEnpoint:       chatEnpoint,
-		agentController:   agentController, // <-- Add this line
+		githubService:      githubService,
+		githubTokenService: githubTokenService,
+		prService:          prService,
+		courseService:      courseService,
+		userService:        userService,
+		chatService:        chatService,
+		llmService:         llmService,
+		assignmentService:  assignmentService,
+		minioUtil:          minioUtil,
+		log:                log,
+		chatEnpoint:        chatEnpoint,
+		agentController:    agentController, // <-- Add this line
+		webhookService:     webhookService,
+		deliveryService:    deliveryService,
+		prSyncService:      prSyncService,
+		gitProviders:       gitProviders,
+		prCommandService:   prCommandService,
+		permissionService:  permissionService,
 	}
 }
 
@@ -60,133 +76,51 @@ func (c *GitHubWebhookController) FetchPullRequests(w http.ResponseWriter, r *ht
 		return
 	}
 
-	// Always use super_admin github_token
-	users, err := c.userService.GetAllUsers(r.Context())
-	if err != nil {
-		http.Error(w, "Failed to get users", http.StatusInternalServerError)
-		return
-	}
-	var githubToken string
-	for _, user := range users {
-		if user.Role == "super_admin" && user.GithubToken != "" {
-			githubToken = user.GithubToken
-			break
-		}
-	}
-	if githubToken == "" {
-		http.Error(w, "Super admin github_token not found", http.StatusBadRequest)
-		return
-	}
-
 	course, err := c.courseService.GetByID(r.Context(), courseID)
 	if err != nil {
 		http.Error(w, "Course not found", http.StatusNotFound)
 		return
 	}
+	if rejectArchived(w, course) {
+		return
+	}
 	if course.GithubURL == "" {
 		http.Error(w, "GitHub URL not found for course", http.StatusBadRequest)
 		return
 	}
-	c.log.Info("githubToken", githubToken)
+	// Incremental by default: only PRs updated since the course's last complete
+	// sync. "since" overrides the cursor and full=true resyncs everything.
+	since := course.PrSyncedAt
+	if r.FormValue("full") == "true" {
+		since = nil
+	} else if sinceStr := r.FormValue("since"); sinceStr != "" {
+		t, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			http.Error(w, "Invalid since, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		since = &t
+	}
 	c.log.Info("course.GithubURL", course.GithubURL)
-	pullRequests, err := c.githubService.GetPullRequests(r.Context(), course.GithubURL, githubToken)
-	if err != nil {
-		c.log.Errorf("Failed to fetch pull requests: %v", err)
-		http.Error(w, "Failed to fetch pull requests from GitHub", http.StatusInternalServerError)
+	response, err := c.prSyncService.Sync(r.Context(), course, since)
+	if errors.Is(err, service.ErrPrSyncRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
-
-	savedCount := 0
-	for _, pr := range pullRequests {
-		createdAt, _ := time.Parse(time.RFC3339, pr.CreatedAt)
-		updatedAt, _ := time.Parse(time.RFC3339, pr.UpdatedAt)
-
-		prRequest := &model.PrCreateRequest{
-			CourseID:      courseID,
-			PrName:        pr.Title,
-			PrDescription: pr.Body,
-			PrNumber:      pr.Number,
-			Status:        pr.State,
-			CreatedAt:     createdAt,
-			UpdatedAt:     updatedAt,
-		}
-
-		existingPr, err := c.prService.GetByCourseIDAndPrNumber(r.Context(), courseID, pr.Number)
-		if err == nil && existingPr != nil {
-			// Update existing PR (do not create duplicate)
-			prRequest.ID = existingPr.ID // ensure update targets the correct PR
-			prRequest.StatusGrade = existingPr.StatusGrade
-			prRequest.Result = existingPr.Result
-			_, err = c.prService.Update(r.Context(), prRequest)
-			if err != nil {
-				c.log.Errorf("Failed to update PR %d: %v", pr.Number, err)
-				continue
-			}
-		} else if existingPr == nil {
-			// Create new PR only if it does not exist
-			_, err = c.prService.Create(r.Context(), prRequest)
-			if err != nil {
-				c.log.Errorf("Failed to save PR %d: %v", pr.Number, err)
-				continue
-			}
-		}
-		savedCount++
-	}
-
-	response := model.FetchPullRequestsResponse{
-		Message:           "Successfully fetched and saved pull requests",
-		PullRequestsCount: savedCount,
-		CourseID:          courseID,
+	if err != nil {
+		c.log.Errorf("Failed to sync pull requests of course %d: %v", courseID, err)
+		http.Error(w, "Failed to fetch pull requests from GitHub: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 
-	c.log.Infof("Successfully processed %d pull requests for course %d", savedCount, courseID)
+	c.log.Infof("Successfully processed %d pull requests for course %d", response.PullRequestsCount, courseID)
 
 	if course.AutoGrade {
-		go func() {
-			// ✅ Dùng context mới không bị cancel sau khi HTTP request kết thúc
-			ctx := context.Background()
-
-			llms, err := c.llmService.GetAllByOwner(ctx, course.UserID)
-			if err != nil || len(llms) == 0 {
-				c.log.Errorf("No LLM found for auto-grade: %v", err)
-				return
-			}
-
-			// Lấy LLM đang active hoặc fallback lấy cái đầu tiên
-			var llmID int
-			for _, llm := range llms {
-				if llm.Status == "active" {
-					llmID = llm.ID
-					break
-				}
-			}
-			if llmID == 0 {
-				llmID = llms[0].ID
-			}
-
-			userID := course.UserID
-			courseID := course.ID
-
-			// ✅ Tạo multipart form body
-			var body bytes.Buffer
-			writer := multipart.NewWriter(&body)
-			_ = writer.WriteField("user_id", strconv.Itoa(userID))
-			_ = writer.WriteField("course_id", strconv.Itoa(courseID))
-			_ = writer.WriteField("llm_id", strconv.Itoa(llmID))
-			writer.Close()
-
-			// ✅ Tạo request với context mới
-			dummyReq, _ := http.NewRequestWithContext(ctx, "POST", "", &body)
-			dummyReq.Header.Set("Content-Type", writer.FormDataContentType())
-
-			// ✅ Gọi hàm xử lý auto review
-			wDummy := &util.DummyResponseWriter{}
-			c.agentController.ReviewPRAuto(wDummy, dummyReq)
-		}()
+		c.StartAutoGrade(course)
 	}
 
 }
@@ -203,35 +137,26 @@ func (c *GitHubWebhookController) GetPullRequestsByCourse(w http.ResponseWriter,
 		return
 	}
 
-	// Always use super_admin github_token
-	users, err := c.userService.GetAllUsers(r.Context())
+	course, err := c.courseService.GetByID(r.Context(), courseID)
 	if err != nil {
-		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		http.Error(w, "Course not found", http.StatusNotFound)
 		return
 	}
-	var githubToken string
-	for _, user := range users {
-		if user.Role == "super_admin" && user.GithubToken != "" {
-			githubToken = user.GithubToken
-			break
-		}
-	}
-	if githubToken == "" {
-		http.Error(w, "Super admin github_token not found", http.StatusBadRequest)
+	if course.GithubURL == "" {
+		http.Error(w, "GitHub URL not found for course", http.StatusBadRequest)
 		return
 	}
-
-	course, err := c.courseService.GetByID(r.Context(), courseID)
+	githubToken, err := c.githubTokenService.Token(r.Context(), course.ID)
 	if err != nil {
-		http.Error(w, "Course not found", http.StatusNotFound)
+		http.Error(w, "GitHub token not available: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	if course.GithubURL == "" {
-		http.Error(w, "GitHub URL not found for course", http.StatusBadRequest)
+	provider, repo, err := c.gitProviders.ForCourse(course)
+	if err != nil {
+		http.Error(w, "Invalid repository URL in course", http.StatusBadRequest)
 		return
 	}
-	c.log.Info("githubToken", githubToken)
-	pullRequests, err := c.githubService.GetPullRequests(r.Context(), course.GithubURL, githubToken)
+	pullRequests, err := provider.ListPullRequests(r.Context(), repo, githubToken, nil)
 	if err != nil {
 		c.log.Errorf("Failed to fetch pull requests: %v", err)
 		http.Error(w, "Failed to fetch pull requests", http.StatusInternalServerError)
@@ -255,7 +180,7 @@ func (c *GitHubWebhookController) ListenPullRequest(w http.ResponseWriter, r *ht
 		prDescription = ""
 	}
 	prNumberStr := r.FormValue("pr_number")
-	// prUser := r.FormValue("pr_user") // Unused for now
+	prUser := r.FormValue("pr_user")
 	user := r.FormValue("user") // Unused for now
 	repoURL := r.FormValue("repo_url")
 	status := r.FormValue("status")
@@ -281,6 +206,12 @@ func (c *GitHubWebhookController) ListenPullRequest(w http.ResponseWriter, r *ht
 		http.Error(w, "Course not found", http.StatusNotFound)
 		return
 	}
+	// Archived courses are read-only; acknowledge so GitHub does not retry
+	if course.Archived {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Course is archived, event ignored"))
+		return
+	}
 
 	// Check if PR already exists
 	existingPr, err := c.prService.GetByCourseIDAndPrNumber(r.Context(), course.ID, prNumber)
@@ -312,6 +243,7 @@ func (c *GitHubWebhookController) ListenPullRequest(w http.ResponseWriter, r *ht
 			PrDescription: prDescription,
 			PrNumber:      prNumber,
 			Status:        status,
+			AuthorLogin:   prUser,
 			CreatedAt:     time.Now(),
 			UpdatedAt:     time.Now(),
 		}
@@ -326,47 +258,7 @@ func (c *GitHubWebhookController) ListenPullRequest(w http.ResponseWriter, r *ht
 	}
 
 	if course.AutoGrade {
-		go func() {
-			// ✅ Dùng context mới không bị cancel sau khi HTTP request kết thúc
-			ctx := context.Background()
-
-			llms, err := c.llmService.GetAllByOwner(ctx, course.UserID)
-			if err != nil || len(llms) == 0 {
-				c.log.Errorf("No LLM found for auto-grade: %v", err)
-				return
-			}
-
-			// Lấy LLM đang active hoặc fallback lấy cái đầu tiên
-			var llmID int
-			for _, llm := range llms {
-				if llm.Status == "active" {
-					llmID = llm.ID
-					break
-				}
-			}
-			if llmID == 0 {
-				llmID = llms[0].ID
-			}
-
-			userID := course.UserID
-			courseID := course.ID
-
-			// ✅ Tạo multipart form body
-			var body bytes.Buffer
-			writer := multipart.NewWriter(&body)
-			_ = writer.WriteField("user_id", strconv.Itoa(userID))
-			_ = writer.WriteField("course_id", strconv.Itoa(courseID))
-			_ = writer.WriteField("llm_id", strconv.Itoa(llmID))
-			writer.Close()
-
-			// ✅ Tạo request với context mới
-			dummyReq, _ := http.NewRequestWithContext(ctx, "POST", "", &body)
-			dummyReq.Header.Set("Content-Type", writer.FormDataContentType())
-
-			// ✅ Gọi hàm xử lý auto review
-			wDummy := &util.DummyResponseWriter{}
-			c.agentController.ReviewPRAuto(wDummy, dummyReq)
-		}()
+		c.StartAutoGrade(course)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -390,8 +282,6 @@ func (c *GitHubWebhookController) ListenComments(w http.ResponseWriter, r *http.
 	positionStr := r.FormValue("position")
 	commitID := r.FormValue("commit_id")
 	commentID := r.FormValue("comment_id")
-
-	prNumber := r.FormValue("pr_number")
 	side := r.FormValue("side")
 	c.log.Info("hic hic hic")
 	c.log.Info(file)
@@ -410,6 +300,12 @@ func (c *GitHubWebhookController) ListenComments(w http.ResponseWriter, r *http.
 		http.Error(w, "Course not found", http.StatusNotFound)
 		return
 	}
+	// Archived courses are read-only; acknowledge so GitHub does not retry
+	if course.Archived {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Course is archived, event ignored"))
+		return
+	}
 
 	// Try to find PR by issue number (GitHub comments are on issues, which can be PRs)
 	// var prID int
@@ -423,103 +319,238 @@ func (c *GitHubWebhookController) ListenComments(w http.ResponseWriter, r *http.
 	// 		}
 	// 	}
 	// }
-	issueNumber, err := strconv.Atoi(issueNumberStr)
-	prID := issueNumber
+	issueNumber, _ := strconv.Atoi(issueNumberStr)
 	// If we couldn't find a PR, use a default value or skip
-	if prID == 0 {
+	if issueNumber == 0 {
 		c.log.Printf("Could not determine PR ID for issue %s, skipping chat message", issueNumberStr)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	// Determine user role based on GitHub username comparison
-	// If the commenter's username matches the course owner's GitHub username, they are a teacher
-	// Otherwise, they are a student
-	var userRole string
-	var userID int
-	c.log.Printf("course ID: %v", course.UserID)
-	// Get the course owner's user information
-	courseOwner, err := c.userService.GetByID(r.Context(), course.UserID)
+	comment := &webhookComment{
+		Body:              body,
+		User:              user,
+		AuthorAssociation: authorAssociation,
+		PrNumber:          issueNumber,
+		File:              file,
+		Position:          positionStr,
+		CommitID:          commitID,
+		CommentID:         commentID,
+		Side:              side,
+	}
+	// The relay sends the review comment being replied to
+	if id, err := strconv.ParseInt(commentID, 10, 64); err == nil {
+		comment.ThreadKey = service.ReviewThreadKey(id, 0)
+	}
+	err = c.handleComment(r.Context(), course, comment)
 	if err != nil {
-		c.log.Printf("Failed to get course owner: %v", err)
-		http.Error(w, "Failed to get course owner", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Check if the commenter is the course owner (teacher)
-	if user == courseOwner.Email || user == course.Owner || authorAssociation == "COLLABORATOR" || authorAssociation == "CONTRIBUTOR" || authorAssociation == "OWNER" {
-		userRole = "teacher"
-		userID = course.UserID
-	} else {
-		// For students, we need to find or create a user record
-		// For now, we'll use a placeholder approach
-		// In a real implementation, you might want to create user records for students
-		userRole = "student"
-		// For simplicity, we'll use the course owner's ID as a placeholder
-		// In a real system, you'd want to create or find student user records
-		userID = course.UserID // This should be replaced with actual student user ID
+	w.WriteHeader(http.StatusOK)
+}
+
+// webhookComment is a comment on a PR, whether it came from the relay's form
+// or from one of GitHub's comment and review events
+type webhookComment struct {
+	Body              string
+	User              string
+	AuthorAssociation string
+	PrNumber          int
+	File              string
+	Position          string
+	CommitID          string
+	CommentID         string
+	Side              string
+	// GitHubID keys the message in the chat so a later sync does not add the
+	// comment again
+	GitHubID string
+	// ThreadKey is the chat thread of a review comment, empty for the PR's
+	// conversation
+	ThreadKey string
+	Line      *int
+}
+
+// handleComment adds the comment to its thread of the PR's chat and answers it
+// on GitHub when it mentions the bot or gives a /neurade command. A comment
+// already in the chat, delivered again, is not answered twice.
+func (c *GitHubWebhookController) handleComment(ctx context.Context, course *model.CourseResponse, comment *webhookComment) error {
+	body := comment.Body
+	user := comment.User
+	authorAssociation := comment.AuthorAssociation
+
+	// Comments are kept against the PR's row, which the pull_request event or
+	// a sync creates
+	pr, err := c.prService.GetByCourseIDAndPrNumber(ctx, course.ID, comment.PrNumber)
+	if err != nil {
+		return fmt.Errorf("PR #%d of course %d is not synced yet: %w", comment.PrNumber, course.ID, err)
+	}
+
+	// The bot's own replies come back as comment events; they are kept in
+	// the chat but never answered, or the bot would talk to itself
+	own, err := c.isOwnComment(ctx, course, user)
+	if err != nil {
+		return err
 	}
 
-	// Create chat message
-	chatMessage := map[string]interface{}{
-		"role":    userRole,
-		"message": body,
+	// Teachers are the course's staff on the roster; everyone else, whatever
+	// their access to the repository, is a student
+	userRole := "student"
+	if own {
+		userRole = service.CommentRoleBot
+	} else if staff, err := c.permissionService.IsCourseStaff(ctx, course, user, authorAssociation); err != nil {
+		return fmt.Errorf("failed to look up %s on the course roster: %w", user, err)
+	} else if staff {
+		userRole = "teacher"
 	}
 
-	// Append to chat history
-	err = c.chatService.AppendToChatHistory(r.Context(), course.ID, userID, prID, chatMessage)
+	message, created, err := c.chatService.AddMessage(ctx, &model.ChatMessageCreateRequest{
+		CourseID:    course.ID,
+		PrID:        pr.ID,
+		ThreadKey:   comment.ThreadKey,
+		AuthorLogin: user,
+		Role:        userRole,
+		Message:     body,
+		GitHubID:    comment.GitHubID,
+		File:        comment.File,
+		Line:        comment.Line,
+	})
 	if err != nil {
-		c.log.Printf("Failed to append to chat history: %v", err)
-		http.Error(w, "Failed to save chat message", http.StatusInternalServerError)
-		return
+		c.log.Printf("Failed to add chat message: %v", err)
+		return fmt.Errorf("failed to save chat message: %w", err)
 	}
 
-	c.log.Printf("Chat comment from %s (%s) for course %d, PR %d: %s", user, userRole, course.ID, prID, body)
+	c.log.Printf("Chat comment from %s (%s) for course %d, PR %d: %s", user, userRole, course.ID, comment.PrNumber, body)
+	if own || !created {
+		return nil
+	}
+
+	if command, args, ok := service.ParsePrCommand(body); ok {
+		return c.handleCommand(ctx, course, comment, userRole, command, args)
+	}
 
-	// Check if the comment contains "@bot"
-	if strings.Contains(strings.ToLower(body), "@bot") {
+	// Mentions of the course's handle outside code and quotes ask the bot
+	if util.MentionsHandle(body, botHandle(course)) {
 		c.log.Printf("Bot mention detected in comment, calling chat API")
 
-		// Call the chat API with position information
-		botResponse, err := c.callChatAPI(r.Context(), course, prID, body, file)
+		// Only the thread the bot is asked in is its context
+		history, err := c.chatService.History(ctx, message.ThreadID)
+		if err != nil {
+			return fmt.Errorf("failed to get chat history: %w", err)
+		}
+		botResponse, err := c.callChatAPI(ctx, course, history, body, comment.File)
 		if err != nil {
 			c.log.Printf("Failed to call chat API: %v", err)
 			// Don't fail the request, just log the error
 		} else if botResponse != "" {
 			// Post the bot response as a comment to GitHub
+			githubToken, err := c.githubTokenService.Token(ctx, course.ID)
+			if err != nil {
+				c.log.Printf("No GitHub token to post bot response: %v", err)
+				return nil
+			}
 			err = c.postBotResponseToGitHub(
-				r.Context(),
+				ctx,
 				course,
-				prID,
+				pr.ID,
 				botResponse,
-				courseOwner.GithubToken,
-				file,
-				positionStr,
-				commitID,
-				prNumber,
-				side,
-				commentID, // ✅ truyền thêm comment_id để reply
+				githubToken,
+				comment.File,
+				comment.Position,
+				comment.CommitID,
+				strconv.Itoa(comment.PrNumber),
+				comment.Side,
+				comment.CommentID, // ✅ truyền thêm comment_id để reply
 			)
 			if err != nil {
 				c.log.Printf("Failed to post bot response to GitHub: %v", err)
 			}
 		}
 	}
+	return nil
+}
 
-	w.WriteHeader(http.StatusOK)
+// isOwnComment reports whether login is the account the course's credential
+// comments as. When that account cannot be told, the comment fails instead
+// of being taken for someone else's, so its delivery can be replayed.
+func (c *GitHubWebhookController) isOwnComment(ctx context.Context, course *model.CourseResponse, login string) (bool, error) {
+	identity, err := c.githubTokenService.Identity(ctx, course.ID)
+	if errors.Is(err, service.ErrNoGitHubToken) {
+		// Without credentials the bot has never commented
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not tell whether %s is the bot in course %d: %w", login, course.ID, err)
+	}
+	return identity != "" && strings.EqualFold(login, identity), nil
 }
 
-// callChatAPI calls the chat API endpoint with the given parameters
-func (c *GitHubWebhookController) callChatAPI(ctx context.Context, course *model.CourseResponse, prID int, query string, file string) (string, error) {
-	if c.chatEnpoint == "" {
-		return "", fmt.Errorf("chat endpoint not configured")
+// botHandle is the handle the course's comments mention the bot with
+func botHandle(course *model.CourseResponse) string {
+	if course.BotHandle == "" {
+		return model.DefaultBotHandle
 	}
+	return course.BotHandle
+}
+
+// StartAutoGrade reviews the course's PRs in the background with the owner's
+// active LLM
+func (c *GitHubWebhookController) StartAutoGrade(course *model.CourseResponse) {
+	go func() {
+		// ✅ Dùng context mới không bị cancel sau khi HTTP request kết thúc
+		ctx := context.Background()
+
+		llmID, err := c.courseLLM(ctx, course)
+		if err != nil {
+			c.log.Errorf("No LLM found for auto-grade: %v", err)
+			return
+		}
+
+		userID := course.UserID
+		courseID := course.ID
+
+		// ✅ Tạo multipart form body
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		_ = writer.WriteField("user_id", strconv.Itoa(userID))
+		_ = writer.WriteField("course_id", strconv.Itoa(courseID))
+		_ = writer.WriteField("llm_id", strconv.Itoa(llmID))
+		writer.Close()
+
+		// ✅ Tạo request với context mới
+		dummyReq, _ := http.NewRequestWithContext(ctx, "POST", "", &body)
+		dummyReq.Header.Set("Content-Type", writer.FormDataContentType())
+
+		// ✅ Gọi hàm xử lý auto review
+		wDummy := &util.DummyResponseWriter{}
+		c.agentController.ReviewPRAuto(wDummy, dummyReq)
+	}()
+}
 
-	// Get chat history for this PR
-	chatHistory, err := c.chatService.GetChatHistoryAsArray(ctx, course.ID, course.UserID, prID)
+// courseLLM picks the LLM reviews of the course use: the owner's active one,
+// or else the first they have
+func (c *GitHubWebhookController) courseLLM(ctx context.Context, course *model.CourseResponse) (int, error) {
+	llms, err := c.llmService.GetAllByOwner(ctx, course.UserID)
 	if err != nil {
-		c.log.Printf("Failed to get chat history: %v", err)
-		chatHistory = []map[string]interface{}{}
+		return 0, err
+	}
+	if len(llms) == 0 {
+		return 0, errors.New("the course owner has no LLM")
+	}
+	for _, llm := range llms {
+		if llm.Status == "active" {
+			return llm.ID, nil
+		}
+	}
+	return llms[0].ID, nil
+}
+
+// callChatAPI calls the chat API endpoint with the given parameters; history
+// is the chat thread the query was asked in
+func (c *GitHubWebhookController) callChatAPI(ctx context.Context, course *model.CourseResponse, history []map[string]interface{}, query string, file string) (string, error) {
+	if c.chatEnpoint == "" {
+		return "", fmt.Errorf("chat endpoint not configured")
 	}
 
 	// Get the course owner's LLM to get the API key
@@ -561,14 +592,15 @@ func (c *GitHubWebhookController) callChatAPI(ctx context.Context, course *model
 		answerFilePath = assignments[0].AssignmentURL
 	}
 
-	// Generate presigned URL for the answer file if it exists
+	// Hand the chat agent a short-lived signed link to the answer file
 	if answerFilePath != "" {
-		presignedURL, err := c.minioUtil.GeneratePresignedURL(ctx, answerFilePath)
+		signedURL, err := c.agentController.FileService.SignedURL(ctx, course.ID, answerFilePath, service.FilePurposeAgentChat, service.AgentFileTokenTTL)
 		if err != nil {
-			c.log.Printf("Failed to generate presigned URL for %s: %v", answerFilePath, err)
+			c.log.Printf("Failed to sign file link for %s: %v", answerFilePath, err)
 			// Continue without the file, as it might not be accessible
+			answerFilePath = ""
 		} else {
-			answerFilePath = presignedURL
+			answerFilePath = signedURL
 		}
 	}
 
@@ -579,7 +611,7 @@ func (c *GitHubWebhookController) callChatAPI(ctx context.Context, course *model
 		Query:              query,
 		FileQueriedOn:      file,
 		AnswerFilePath:     answerFilePath,
-		PreviousCommentRaw: chatHistory,
+		PreviousCommentRaw: history,
 	}
 
 	// Make HTTP request to the chat API
@@ -621,47 +653,25 @@ func (c *GitHubWebhookController) postBotResponseToGitHub(
 	side string,
 	commentID string, // ✅ thêm commentID
 ) error {
-	owner, repo, err := util.ParseGitHubURL(course.GithubURL)
+	provider, repository, err := c.gitProviders.ForCourse(course)
 	if err != nil {
 		return fmt.Errorf("failed to parse GitHub URL: %w", err)
 	}
+	owner, repo := repository.Owner, repository.Name
+	number, _ := strconv.Atoi(prNumber)
 
-	// ✅ 1. Reply to an existing comment if commentID is present
-	if commentID != "" {
-		apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%s/comments/%s/replies", owner, repo, prNumber, commentID)
-		c.log.Info("tesst")
-		c.log.Info(apiURL)
-		commentData := map[string]interface{}{
-			"body": botResponse,
-		}
-		jsonBody, err := json.Marshal(commentData)
-		if err != nil {
-			return fmt.Errorf("failed to marshal reply comment: %w", err)
-		}
-
-		req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonBody))
-		if err != nil {
-			return fmt.Errorf("failed to create reply request: %w", err)
-		}
-		req.Header.Set("Authorization", "token "+githubToken)
-		req.Header.Set("Accept", "application/vnd.github.v3+json")
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("User-Agent", "Neurade-Backend")
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
+	// ✅ 1. Reply to an existing comment if commentID is present; on GitLab
+	// it is the ID of the comment's discussion
+	if commentID != "" && number != 0 {
+		if err := provider.ReplyToThread(ctx, repository, number, commentID, githubToken, botResponse); err != nil {
 			return fmt.Errorf("failed to post reply: %w", err)
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode < 200 || resp.StatusCode > 299 {
-			return fmt.Errorf("GitHub API error (reply comment): %d", resp.StatusCode)
-		}
-		c.log.Printf("✅ Replied to GitHub review comment %s successfully", commentID)
+		c.log.Printf("✅ Replied to review comment %s successfully", commentID)
 		return nil
 	}
 
 	// ✅ 2. Fallback to review comment with position info (code-level comment)
-	if positionStr != "" && commitID != "" && file != "" && prNumber != "" {
+	if repository.Provider == util.GitProviderGitHub && positionStr != "" && commitID != "" && file != "" && number != 0 {
 		position, err := strconv.Atoi(positionStr)
 		if err != nil {
 			c.log.Printf("Invalid position: %v", err)
@@ -675,30 +685,9 @@ func (c *GitHubWebhookController) postBotResponseToGitHub(
 			if side != "" {
 				commentData["side"] = side
 			}
-
-			jsonBody, err := json.Marshal(commentData)
-			if err != nil {
-				return fmt.Errorf("failed to marshal review comment: %w", err)
-			}
-
-			apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%s/comments", owner, repo, prNumber)
-			req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonBody))
-			if err != nil {
-				return fmt.Errorf("failed to create review comment request: %w", err)
-			}
-			req.Header.Set("Authorization", "token "+githubToken)
-			req.Header.Set("Accept", "application/vnd.github.v3+json")
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("User-Agent", "Neurade-Backend")
-
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
+			if err := c.githubService.CreateReviewComment(ctx, owner, repo, number, githubToken, commentData); err != nil {
 				return fmt.Errorf("failed to post review comment: %w", err)
 			}
-			defer resp.Body.Close()
-			if resp.StatusCode < 200 || resp.StatusCode > 299 {
-				return fmt.Errorf("GitHub API error (review comment): %d", resp.StatusCode)
-			}
 			c.log.Printf("✅ Posted review comment to GitHub PR %s at position %d", prNumber, position)
 			return nil
 		}
@@ -709,33 +698,9 @@ func (c *GitHubWebhookController) postBotResponseToGitHub(
 	if err != nil {
 		return fmt.Errorf("failed to get PR: %w", err)
 	}
-
-	commentData := map[string]interface{}{
-		"body": botResponse,
-	}
-	jsonBody, err := json.Marshal(commentData)
-	if err != nil {
-		return fmt.Errorf("failed to marshal issue comment: %w", err)
-	}
-
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/comments", owner, repo, pr.PrNumber)
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to create issue comment request: %w", err)
-	}
-	req.Header.Set("Authorization", "token "+githubToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "Neurade-Backend")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+	if err := provider.CreateComment(ctx, repository, pr.PrNumber, githubToken, botResponse); err != nil {
 		return fmt.Errorf("failed to post issue comment: %w", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return fmt.Errorf("GitHub API error (issue comment): %d", resp.StatusCode)
-	}
 	c.log.Printf("✅ Fallback: posted issue-level comment to GitHub PR %d", pr.PrNumber)
 	return nil
 }
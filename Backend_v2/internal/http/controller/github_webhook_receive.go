@@ -0,0 +1,354 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxWebhookPayload is GitHub's cap on delivery size
+const maxWebhookPayload = 25 << 20
+
+// Receive handles POST /webhooks/github, deliveries sent by GitHub itself. The
+// X-Hub-Signature-256 header must match the secret of a course on the
+// repository's html_url, which the event is routed by, or the global
+// GITHUB_WEBHOOK_SECRET; the event is then handled according to X-GitHub-Event.
+func (c *GitHubWebhookController) Receive(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookPayload+1))
+	if err != nil || len(body) > maxWebhookPayload {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	var envelope struct {
+		Action     string                        `json:"action"`
+		Repository model.GitHubWebhookRepository `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !service.SameRepository(envelope.Repository.FullName, envelope.Repository.HTMLURL) {
+		c.log.Warnf("Rejected webhook delivery %s: %s is not at %s", r.Header.Get("X-GitHub-Delivery"), envelope.Repository.FullName, envelope.Repository.HTMLURL)
+		http.Error(w, "Repository name does not match its URL", http.StatusBadRequest)
+		return
+	}
+	if err := c.webhookService.VerifySignature(r.Context(), envelope.Repository.HTMLURL, body, r.Header.Get("X-Hub-Signature-256")); err != nil {
+		if errors.Is(err, service.ErrWebhookSignatureInvalid) {
+			c.log.Warnf("Rejected webhook delivery %s for %s: invalid signature", r.Header.Get("X-GitHub-Delivery"), envelope.Repository.FullName)
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to verify signature", http.StatusInternalServerError)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	deliveryID := r.Header.Get("X-GitHub-Delivery")
+	if deliveryID == "" {
+		http.Error(w, "Missing X-GitHub-Delivery header", http.StatusBadRequest)
+		return
+	}
+	delivery, fresh, err := c.deliveryService.Record(r.Context(), util.GitProviderGitHub, deliveryID, event, envelope.Action, envelope.Repository.FullName, body)
+	if err != nil {
+		http.Error(w, "Failed to record delivery", http.StatusInternalServerError)
+		return
+	}
+	if !fresh {
+		c.log.Infof("Skipping webhook delivery %s, already %s", deliveryID, delivery.Status)
+		w.Write([]byte("Delivery already " + delivery.Status))
+		return
+	}
+
+	message, err := c.dispatch(r.Context(), event, body)
+	c.deliveryService.Finish(r.Context(), delivery, message, err)
+	if err != nil {
+		c.log.Errorf("Failed to handle webhook delivery %s: %v", deliveryID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(message))
+}
+
+// ListDeliveries handles GET /webhooks/deliveries?status=failed&limit=50
+func (c *GitHubWebhookController) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	deliveries, err := c.deliveryService.List(r.Context(), r.URL.Query().Get("status"), limit)
+	if err != nil {
+		http.Error(w, "Failed to list deliveries", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// ReplayDelivery handles POST /webhooks/deliveries/{delivery_id}/replay and
+// handles a failed delivery again from its stored payload
+func (c *GitHubWebhookController) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "delivery_id"))
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := c.deliveryService.GetByID(r.Context(), id); err != nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	delivery, err := c.deliveryService.Claim(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookDeliveryNotReplayable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to replay delivery", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.replay(r.Context(), delivery))
+}
+
+// ReplayFailedDeliveries handles POST /webhooks/deliveries/replay?limit=100. The
+// failed deliveries are claimed at once and handled one after another in the
+// background; their progress shows in ListDeliveries.
+func (c *GitHubWebhookController) ReplayFailedDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	deliveries, err := c.deliveryService.ClaimFailed(r.Context(), limit)
+	if err != nil && len(deliveries) == 0 {
+		http.Error(w, "Failed to replay deliveries", http.StatusInternalServerError)
+		return
+	}
+	claimed := make([]*model.WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		claimed = append(claimed, converter.WebhookDeliveryToResponse(delivery))
+	}
+	go func() {
+		ctx := context.Background()
+		for _, delivery := range deliveries {
+			c.replay(ctx, delivery)
+		}
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(claimed)
+}
+
+func (c *GitHubWebhookController) replay(ctx context.Context, delivery *entity.WebhookDelivery) *model.WebhookDeliveryResponse {
+	c.log.Infof("Replaying webhook delivery %s (%s), attempt %d", delivery.DeliveryID, delivery.Event, delivery.Attempts)
+	dispatch := c.dispatch
+	if delivery.Provider == util.GitProviderGitLab {
+		dispatch = c.dispatchGitLab
+	}
+	message, err := dispatch(ctx, delivery.Event, []byte(delivery.Payload))
+	if err != nil {
+		c.log.Errorf("Replay of webhook delivery %s failed: %v", delivery.DeliveryID, err)
+	}
+	return c.deliveryService.Finish(ctx, delivery, message, err)
+}
+
+// dispatch decodes a GitHub delivery of the given event and runs its handler.
+// It returns what was done, or an error when the event should be retried.
+func (c *GitHubWebhookController) dispatch(ctx context.Context, event string, body []byte) (string, error) {
+	switch event {
+	case "ping":
+		return "pong", nil
+	case "pull_request":
+		payload := &model.PullRequestEvent{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return "", fmt.Errorf("invalid %s payload: %w", event, err)
+		}
+		return c.onPullRequest(ctx, payload)
+	case "issue_comment":
+		payload := &model.IssueCommentEvent{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return "", fmt.Errorf("invalid %s payload: %w", event, err)
+		}
+		return c.onIssueComment(ctx, payload)
+	case "pull_request_review":
+		payload := &model.PullRequestReviewEvent{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return "", fmt.Errorf("invalid %s payload: %w", event, err)
+		}
+		return c.onPullRequestReview(ctx, payload)
+	case "pull_request_review_comment":
+		payload := &model.PullRequestReviewCommentEvent{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return "", fmt.Errorf("invalid %s payload: %w", event, err)
+		}
+		return c.onPullRequestReviewComment(ctx, payload)
+	case "pull_request_review_thread":
+		payload := &model.PullRequestReviewThreadEvent{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return "", fmt.Errorf("invalid %s payload: %w", event, err)
+		}
+		return c.onPullRequestReviewThread(ctx, payload)
+	case "push":
+		payload := &model.PushEvent{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return "", fmt.Errorf("invalid %s payload: %w", event, err)
+		}
+		return c.onPush(ctx, payload)
+	}
+	return fmt.Sprintf("Event %q ignored", event), nil
+}
+
+// webhookCourse finds the active course on the event's repository. When there
+// is none the event is acknowledged and dropped with the returned message.
+func (c *GitHubWebhookController) webhookCourse(ctx context.Context, repository *model.GitHubWebhookRepository) (*model.CourseResponse, string) {
+	course, err := c.courseService.GetByGithubURL(ctx, repository.HTMLURL)
+	if err != nil || course == nil {
+		return nil, "No course for " + repository.FullName + ", event ignored"
+	}
+	// Archived courses are read-only
+	if course.Archived {
+		return nil, "Course is archived, event ignored"
+	}
+	return course, ""
+}
+
+func (c *GitHubWebhookController) onPullRequest(ctx context.Context, event *model.PullRequestEvent) (string, error) {
+	course, ignored := c.webhookCourse(ctx, &event.Repository)
+	if course == nil {
+		return ignored, nil
+	}
+	pr, created, err := c.prService.SyncFromGitHub(ctx, converter.GitHubPullRequestToPrRequest(course.ID, &event.PullRequest))
+	if err != nil {
+		return "", fmt.Errorf("failed to save PR #%d: %w", event.PullRequest.Number, err)
+	}
+	c.log.Infof("PR #%d of course %d %s (created: %v)", pr.PrNumber, course.ID, event.Action, created)
+
+	// Only new code is worth grading, not edits of the title or labels
+	switch event.Action {
+	case "opened", "reopened", "synchronize":
+		if course.AutoGrade {
+			c.StartAutoGrade(course)
+		}
+	}
+	return fmt.Sprintf("PR #%d %s", pr.PrNumber, event.Action), nil
+}
+
+func (c *GitHubWebhookController) onIssueComment(ctx context.Context, event *model.IssueCommentEvent) (string, error) {
+	// Comments on plain issues have nothing to do with a PR
+	if event.Issue.PullRequest == nil {
+		return "Issue comment ignored", nil
+	}
+	if event.Action != "created" {
+		return "Comment " + event.Action + " ignored", nil
+	}
+	course, ignored := c.webhookCourse(ctx, &event.Repository)
+	if course == nil {
+		return ignored, nil
+	}
+	err := c.handleComment(ctx, course, &webhookComment{
+		Body:              event.Comment.Body,
+		User:              event.Comment.User.Login,
+		AuthorAssociation: event.Comment.AuthorAssociation,
+		PrNumber:          event.Issue.Number,
+		GitHubID:          service.GitHubCommentKey("issue_comment", event.Comment.ID),
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Comment on PR #%d recorded", event.Issue.Number), nil
+}
+
+func (c *GitHubWebhookController) onPullRequestReview(ctx context.Context, event *model.PullRequestReviewEvent) (string, error) {
+	// Reviews without a summary are just the envelope of their line comments,
+	// which arrive as pull_request_review_comment events of their own
+	if event.Action != "submitted" || strings.TrimSpace(event.Review.Body) == "" {
+		return "Review ignored", nil
+	}
+	course, ignored := c.webhookCourse(ctx, &event.Repository)
+	if course == nil {
+		return ignored, nil
+	}
+	err := c.handleComment(ctx, course, &webhookComment{
+		Body:              event.Review.Body,
+		User:              event.Review.User.Login,
+		AuthorAssociation: event.Review.AuthorAssociation,
+		PrNumber:          event.PullRequest.Number,
+		GitHubID:          service.GitHubCommentKey("review", event.Review.ID),
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Review on PR #%d recorded", event.PullRequest.Number), nil
+}
+
+func (c *GitHubWebhookController) onPullRequestReviewComment(ctx context.Context, event *model.PullRequestReviewCommentEvent) (string, error) {
+	if event.Action != "created" {
+		return "Review comment " + event.Action + " ignored", nil
+	}
+	course, ignored := c.webhookCourse(ctx, &event.Repository)
+	if course == nil {
+		return ignored, nil
+	}
+	comment := &webhookComment{
+		Body:              event.Comment.Body,
+		User:              event.Comment.User.Login,
+		AuthorAssociation: event.Comment.AuthorAssociation,
+		PrNumber:          event.PullRequest.Number,
+		File:              event.Comment.Path,
+		CommitID:          event.Comment.CommitID,
+		CommentID:         strconv.FormatInt(event.Comment.ID, 10),
+		Side:              event.Comment.Side,
+		GitHubID:          service.GitHubCommentKey("review_comment", event.Comment.ID),
+		ThreadKey:         service.ReviewThreadKey(event.Comment.ID, event.Comment.InReplyToID),
+		Line:              event.Comment.Line,
+	}
+	if event.Comment.Position != nil {
+		comment.Position = strconv.Itoa(*event.Comment.Position)
+	}
+	if err := c.handleComment(ctx, course, comment); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Review comment on PR #%d recorded", event.PullRequest.Number), nil
+}
+
+func (c *GitHubWebhookController) onPullRequestReviewThread(ctx context.Context, event *model.PullRequestReviewThreadEvent) (string, error) {
+	course, ignored := c.webhookCourse(ctx, &event.Repository)
+	if course == nil {
+		return ignored, nil
+	}
+	path := ""
+	if len(event.Thread.Comments) > 0 {
+		path = event.Thread.Comments[0].Path
+	}
+	c.log.Infof("Review thread on %s of PR #%d in course %d %s by %s", path, event.PullRequest.Number, course.ID, event.Action, event.Sender.Login)
+	return fmt.Sprintf("Review thread %s", event.Action), nil
+}
+
+// onPush keeps the head commit of open PRs built from the pushed branch of
+// this repository current between pull_request synchronize events. Pushes to
+// forks arrive only through synchronize.
+func (c *GitHubWebhookController) onPush(ctx context.Context, event *model.PushEvent) (string, error) {
+	branch, isBranch := strings.CutPrefix(event.Ref, "refs/heads/")
+	if !isBranch || event.Deleted {
+		return "Push ignored", nil
+	}
+	course, ignored := c.webhookCourse(ctx, &event.Repository)
+	if course == nil {
+		return ignored, nil
+	}
+	updated, err := c.prService.UpdateHeadByBranch(ctx, course.ID, event.Repository.FullName, branch, event.After)
+	if err != nil {
+		return "", fmt.Errorf("failed to update PRs of %s: %w", branch, err)
+	}
+	return fmt.Sprintf("Push to %s updated %d PRs", branch, updated), nil
+}
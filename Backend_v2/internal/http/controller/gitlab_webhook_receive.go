@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// GitLab names its events in the X-Gitlab-Event header
+const (
+	gitlabMergeRequestHook = "Merge Request Hook"
+	gitlabNoteHook         = "Note Hook"
+)
+
+// ReceiveGitLab handles POST /webhooks/gitlab, deliveries from GitLab project
+// hooks. The X-Gitlab-Token header must be the secret of a course on the
+// project's web_url or the global GITHUB_WEBHOOK_SECRET. Deliveries go through
+// the same log as GitHub's, keyed by X-Gitlab-Event-UUID.
+func (c *GitHubWebhookController) ReceiveGitLab(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookPayload+1))
+	if err != nil || len(body) > maxWebhookPayload {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	var envelope struct {
+		ObjectKind       string              `json:"object_kind"`
+		Project          model.GitLabProject `json:"project"`
+		ObjectAttributes struct {
+			Action string `json:"action"`
+		} `json:"object_attributes"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	repository := envelope.Project.PathWithNamespace
+	if !service.SameRepository(repository, envelope.Project.WebURL) {
+		c.log.Warnf("Rejected GitLab delivery: %s is not at %s", repository, envelope.Project.WebURL)
+		http.Error(w, "Project path does not match its URL", http.StatusBadRequest)
+		return
+	}
+	if err := c.webhookService.VerifyToken(r.Context(), envelope.Project.WebURL, r.Header.Get("X-Gitlab-Token")); err != nil {
+		if errors.Is(err, service.ErrWebhookSignatureInvalid) {
+			c.log.Warnf("Rejected GitLab delivery for %s: invalid token", repository)
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to verify token", http.StatusInternalServerError)
+		return
+	}
+
+	event := r.Header.Get("X-Gitlab-Event")
+	deliveryID := r.Header.Get("X-Gitlab-Event-UUID")
+	if deliveryID == "" {
+		http.Error(w, "Missing X-Gitlab-Event-UUID header", http.StatusBadRequest)
+		return
+	}
+	delivery, fresh, err := c.deliveryService.Record(r.Context(), util.GitProviderGitLab, deliveryID, event, envelope.ObjectAttributes.Action, repository, body)
+	if err != nil {
+		http.Error(w, "Failed to record delivery", http.StatusInternalServerError)
+		return
+	}
+	if !fresh {
+		c.log.Infof("Skipping GitLab delivery %s, already %s", deliveryID, delivery.Status)
+		w.Write([]byte("Delivery already " + delivery.Status))
+		return
+	}
+
+	message, err := c.dispatchGitLab(r.Context(), event, body)
+	c.deliveryService.Finish(r.Context(), delivery, message, err)
+	if err != nil {
+		c.log.Errorf("Failed to handle GitLab delivery %s: %v", deliveryID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(message))
+}
+
+// dispatchGitLab decodes a GitLab delivery of the given event and runs its
+// handler, like dispatch does for GitHub's. Only merge request and note events
+// are handled.
+func (c *GitHubWebhookController) dispatchGitLab(ctx context.Context, event string, body []byte) (string, error) {
+	switch event {
+	case gitlabMergeRequestHook:
+		payload := &model.GitLabMergeRequestEvent{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return "", fmt.Errorf("invalid %s payload: %w", event, err)
+		}
+		return c.onGitLabMergeRequest(ctx, payload)
+	case gitlabNoteHook:
+		payload := &model.GitLabNoteEvent{}
+		if err := json.Unmarshal(body, payload); err != nil {
+			return "", fmt.Errorf("invalid %s payload: %w", event, err)
+		}
+		return c.onGitLabNote(ctx, payload)
+	}
+	return fmt.Sprintf("Event %q ignored", event), nil
+}
+
+// gitlabCourse finds the active course on the event's project
+func (c *GitHubWebhookController) gitlabCourse(ctx context.Context, project *model.GitLabProject) (*model.CourseResponse, string) {
+	return c.webhookCourse(ctx, &model.GitHubWebhookRepository{
+		ID:       project.ID,
+		FullName: project.PathWithNamespace,
+		HTMLURL:  project.WebURL,
+	})
+}
+
+// onGitLabMergeRequest saves the merge request as the course's PR. The payload
+// lacks some fields, such as the author's username, so the merge request is
+// read back from the API.
+func (c *GitHubWebhookController) onGitLabMergeRequest(ctx context.Context, event *model.GitLabMergeRequestEvent) (string, error) {
+	course, ignored := c.gitlabCourse(ctx, &event.Project)
+	if course == nil {
+		return ignored, nil
+	}
+	provider, repo, err := c.gitProviders.ForCourse(course)
+	if err != nil {
+		return "", err
+	}
+	token, err := c.githubTokenService.Token(ctx, course.ID)
+	if err != nil {
+		return "", err
+	}
+	number := event.ObjectAttributes.IID
+	pullRequest, err := provider.GetPullRequest(ctx, repo, number, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to get merge request !%d: %w", number, err)
+	}
+	pr, created, err := c.prService.SyncFromGitHub(ctx, converter.GitHubPullRequestToPrRequest(course.ID, pullRequest))
+	if err != nil {
+		return "", fmt.Errorf("failed to save merge request !%d: %w", number, err)
+	}
+	action := event.ObjectAttributes.Action
+	c.log.Infof("Merge request !%d of course %d %s (created: %v)", pr.PrNumber, course.ID, action, created)
+
+	// Only new code is worth grading: an update carries oldrev when it pushed commits
+	newCode := action == "open" || action == "reopen" || (action == "update" && event.ObjectAttributes.OldRev != "")
+	if newCode && course.AutoGrade {
+		c.StartAutoGrade(course)
+	}
+	return fmt.Sprintf("Merge request !%d %s", pr.PrNumber, action), nil
+}
+
+func (c *GitHubWebhookController) onGitLabNote(ctx context.Context, event *model.GitLabNoteEvent) (string, error) {
+	// Notes on issues, commits and snippets have nothing to do with a PR
+	if event.ObjectAttributes.NoteableType != "MergeRequest" || event.MergeRequest == nil {
+		return "Note ignored", nil
+	}
+	if event.ObjectAttributes.System {
+		return "System note ignored", nil
+	}
+	course, ignored := c.gitlabCourse(ctx, &event.Project)
+	if course == nil {
+		return ignored, nil
+	}
+	note := event.ObjectAttributes
+	comment := &webhookComment{
+		Body:      note.Note,
+		User:      event.User.Username,
+		PrNumber:  event.MergeRequest.IID,
+		CommentID: note.DiscussionID,
+		GitHubID:  service.GitHubCommentKey("gitlab_note", note.ID),
+	}
+	// Notes on lines are threads of their own; the others are the merge
+	// request's conversation
+	if note.Position != nil {
+		comment.File = note.Position.NewPath
+		comment.CommitID = note.Position.HeadSHA
+		comment.ThreadKey = "gitlab_discussion:" + note.DiscussionID
+		if note.Position.NewLine != 0 {
+			line := note.Position.NewLine
+			comment.Position = strconv.Itoa(line)
+			comment.Line = &line
+		}
+	}
+	if err := c.handleComment(ctx, course, comment); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Note on merge request !%d recorded", event.MergeRequest.IID), nil
+}
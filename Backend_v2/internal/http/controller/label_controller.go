@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+type LabelController struct {
+	PrLabelService *service.PrLabelService
+	CourseService  *service.CourseService
+	Log            *logrus.Logger
+}
+
+func NewLabelController(prLabelService *service.PrLabelService, courseService *service.CourseService, log *logrus.Logger) *LabelController {
+	return &LabelController{
+		PrLabelService: prLabelService,
+		CourseService:  courseService,
+		Log:            log,
+	}
+}
+
+// GetLabels handles GET /courses/{course_id}/labels, the name and colour of
+// each label kept on the course's graded PRs
+func (c *LabelController) GetLabels(w http.ResponseWriter, r *http.Request) {
+	courseID, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	labels, err := c.PrLabelService.Labels(r.Context(), courseID)
+	if err != nil {
+		http.Error(w, "Failed to get labels", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(labels)
+}
+
+// UpdateLabel handles PUT /courses/{course_id}/labels/{kind} with name and
+// color. Empty name and color restore the default.
+func (c *LabelController) UpdateLabel(w http.ResponseWriter, r *http.Request) {
+	courseID, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	course, err := c.CourseService.GetByID(r.Context(), courseID)
+	if err != nil || course == nil {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+	if rejectArchived(w, course) {
+		return
+	}
+	label, err := c.PrLabelService.SetLabel(r.Context(), &model.CourseLabelUpdateRequest{
+		CourseID: course.ID,
+		Kind:     chi.URLParam(r, "kind"),
+		Name:     r.FormValue("name"),
+		Color:    r.FormValue("color"),
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLabel) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to update label", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(label)
+}
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleCommand answers a /neurade command in a PR comment. Help, unknown
+// commands and commands the commenter may not give are answered straight
+// away; the others are queued, and the comment gets an "eyes" reaction.
+func (c *GitHubWebhookController) handleCommand(ctx context.Context, course *model.CourseResponse, comment *webhookComment, role, command, args string) error {
+	switch command {
+	case service.PrCommandRegrade, service.PrCommandExplain, service.PrCommandScore, service.PrCommandHint, service.PrCommandRequestHuman:
+	default:
+		c.replyToCommand(ctx, course, comment.PrNumber, comment.CommentID, service.PrCommandUsage)
+		return nil
+	}
+	pr, err := c.prService.GetByCourseIDAndPrNumber(ctx, course.ID, comment.PrNumber)
+	if err != nil || pr == nil {
+		c.replyToCommand(ctx, course, comment.PrNumber, comment.CommentID, fmt.Sprintf("@%s this PR has not been synced yet; try again in a minute.", comment.User))
+		return nil
+	}
+	if !service.PrCommandAllowed(command, role, comment.User, pr.AuthorLogin) {
+		c.reactToComment(ctx, course, comment.GitHubID, "-1")
+		reason := "can only be given on your own PR"
+		if command == service.PrCommandRegrade {
+			reason = "is for course staff"
+		}
+		c.replyToCommand(ctx, course, comment.PrNumber, comment.CommentID, fmt.Sprintf("@%s `%s %s` %s.", comment.User, service.PrCommandPrefix, command, reason))
+		return nil
+	}
+
+	// Comments from the relay's form carry no GitHub ID
+	commentKey := comment.GitHubID
+	if commentKey == "" && comment.CommentID != "" {
+		commentKey = "comment:" + comment.CommentID
+	}
+	if commentKey == "" {
+		commentKey = fmt.Sprintf("relay:%d", time.Now().UnixNano())
+	}
+	_, created, err := c.prCommandService.Enqueue(ctx, &model.PrCommandCreateRequest{
+		CourseID:    course.ID,
+		PrNumber:    pr.PrNumber,
+		CommentKey:  commentKey,
+		ThreadID:    comment.CommentID,
+		File:        comment.File,
+		AuthorLogin: comment.User,
+		AuthorRole:  role,
+		Command:     command,
+		Args:        args,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue command: %w", err)
+	}
+	if created {
+		c.reactToComment(ctx, course, comment.GitHubID, "eyes")
+	}
+	return nil
+}
+
+// RunCommand executes a queued PR command and answers it on the PR. It is
+// the PrCommandService's Execute.
+func (c *GitHubWebhookController) RunCommand(ctx context.Context, command *model.PrCommandResponse) (string, error) {
+	course, err := c.courseService.GetByID(ctx, command.CourseID)
+	if err != nil {
+		return "", fmt.Errorf("course not found: %w", err)
+	}
+	if course.Archived {
+		return "", fmt.Errorf("course %d is archived", course.ID)
+	}
+	pr, err := c.prService.GetByCourseIDAndPrNumber(ctx, course.ID, command.PrNumber)
+	if err != nil {
+		return "", fmt.Errorf("PR not found: %w", err)
+	}
+
+	// explain and hint are questions to the chat agent about query in file
+	var answer, query, file string
+	switch command.Command {
+	case service.PrCommandRegrade:
+		answer, err = c.regrade(ctx, course, pr)
+	case service.PrCommandScore:
+		answer = service.PrGradeSummary(pr, course.PassScore)
+	case service.PrCommandExplain:
+		var line int
+		file, line = parseFileLine(command.Args)
+		if file == "" {
+			file = command.File
+		}
+		if file == "" {
+			answer = fmt.Sprintf("Which line should I explain? Try `%s explain path/to/file.go:42`, or give the command in a review comment on the line.", service.PrCommandPrefix)
+			break
+		}
+		query = fmt.Sprintf("Explain what the code in %s does in this pull request, and why it may be a problem if it is one.", file)
+		if line > 0 {
+			query = fmt.Sprintf("Explain what line %d of %s does in this pull request, and why it may be a problem if it is one.", line, file)
+		}
+	case service.PrCommandHint:
+		query = "Give the student one hint towards fixing the biggest problem in this pull request. Do not give the solution or write the code for them."
+		if command.Args != "" {
+			query += " They are asking about: " + command.Args
+		}
+		file = command.File
+	case service.PrCommandRequestHuman:
+		answer = fmt.Sprintf("@%s asked for a human to look at this PR. The course staff have been notified.", command.AuthorLogin)
+		if course.Owner != "" {
+			answer = fmt.Sprintf("@%s, @%s asked for a human to look at this PR.", course.Owner, command.AuthorLogin)
+		}
+	default:
+		return "", fmt.Errorf("unknown command %q", command.Command)
+	}
+	if query != "" {
+		// The agent gets the history of the thread the command was given in
+		var history []map[string]interface{}
+		if history, err = c.chatService.HistoryOfComment(ctx, course.ID, pr.ID, command.CommentKey); err == nil {
+			answer, err = c.callChatAPI(ctx, course, history, query, file)
+		}
+	}
+	if err != nil {
+		c.replyToCommand(ctx, course, pr.PrNumber, command.ThreadID, fmt.Sprintf("@%s `%s %s` failed, please try again later.", command.AuthorLogin, service.PrCommandPrefix, command.Command))
+		return "", err
+	}
+	if command.Command != service.PrCommandRequestHuman {
+		answer = "@" + command.AuthorLogin + " " + answer
+	}
+	if err := c.replyToCommand(ctx, course, pr.PrNumber, command.ThreadID, answer); err != nil {
+		return answer, err
+	}
+	return answer, nil
+}
+
+// regrade reviews the PR again with the course's LLM and answers with the new
+// grade
+func (c *GitHubWebhookController) regrade(ctx context.Context, course *model.CourseResponse, pr *model.PrResponse) (string, error) {
+	if pr.AssignmentID == 0 {
+		return "", errors.New("the PR is not linked to an assignment")
+	}
+	llmID, err := c.courseLLM(ctx, course)
+	if err != nil {
+		return "", err
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("course_id", strconv.Itoa(course.ID))
+	_ = writer.WriteField("llm_id", strconv.Itoa(llmID))
+	_ = writer.WriteField("assignment_id", strconv.Itoa(pr.AssignmentID))
+	_ = writer.WriteField("pr_ids", strconv.Itoa(pr.ID))
+	writer.Close()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "", &body)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	c.agentController.ReviewPRV2(&util.DummyResponseWriter{}, request)
+
+	graded, err := c.prService.GetByID(ctx, pr.ID)
+	if err != nil {
+		return "", err
+	}
+	if !graded.UpdatedAt.After(pr.UpdatedAt) {
+		return "", errors.New("the review agent did not grade the PR")
+	}
+	return "Regraded. " + service.PrGradeSummary(graded, course.PassScore), nil
+}
+
+// replyToCommand answers in the comment's thread when it has one, otherwise
+// on the PR's conversation
+func (c *GitHubWebhookController) replyToCommand(ctx context.Context, course *model.CourseResponse, prNumber int, threadID, body string) error {
+	provider, repository, err := c.gitProviders.ForCourse(course)
+	if err != nil {
+		return err
+	}
+	token, err := c.githubTokenService.Token(ctx, course.ID)
+	if err != nil {
+		c.log.Errorf("No token to answer command on PR %d of course %d: %v", prNumber, course.ID, err)
+		return err
+	}
+	if threadID != "" {
+		err = provider.ReplyToThread(ctx, repository, prNumber, threadID, token, body)
+	} else {
+		err = provider.CreateComment(ctx, repository, prNumber, token, body)
+	}
+	if err != nil {
+		c.log.Errorf("Failed to answer command on PR %d of course %d: %v", prNumber, course.ID, err)
+	}
+	return err
+}
+
+// reactToComment adds a reaction to a GitHub conversation or review comment,
+// identified by its chat key. Other comments get none.
+func (c *GitHubWebhookController) reactToComment(ctx context.Context, course *model.CourseResponse, commentKey, content string) {
+	kind, idText, _ := strings.Cut(commentKey, ":")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		return
+	}
+	switch kind {
+	case "issue_comment":
+		kind = "issues"
+	case "review_comment":
+		kind = "pulls"
+	default:
+		return
+	}
+	_, repository, err := c.gitProviders.ForCourse(course)
+	if err != nil || repository.Provider != util.GitProviderGitHub {
+		return
+	}
+	token, err := c.githubTokenService.Token(ctx, course.ID)
+	if err != nil {
+		return
+	}
+	if err := c.githubService.CreateReaction(ctx, repository.Owner, repository.Name, kind, id, token, content); err != nil {
+		c.log.Errorf("Failed to react to comment %s of course %d: %v", commentKey, course.ID, err)
+	}
+}
+
+// ListCommands handles GET /courses/{course_id}/pull-requests/{pr_number}/commands,
+// the /neurade commands given on the PR and their answers
+func (c *GitHubWebhookController) ListCommands(w http.ResponseWriter, r *http.Request) {
+	courseID, err := strconv.Atoi(chi.URLParam(r, "course_id"))
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+	prNumber, err := strconv.Atoi(chi.URLParam(r, "pr_number"))
+	if err != nil {
+		http.Error(w, "Invalid PR number", http.StatusBadRequest)
+		return
+	}
+	commands, err := c.prCommandService.GetAllByPr(r.Context(), courseID, prNumber)
+	if err != nil {
+		http.Error(w, "Failed to get commands", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+}
+
+// parseFileLine splits "path/to/file.go:42" into the file and line; the line
+// is 0 when there is none
+func parseFileLine(arg string) (string, int) {
+	arg = strings.Trim(strings.TrimSpace(arg), "`")
+	if arg == "" {
+		return "", 0
+	}
+	if i := strings.LastIndex(arg, ":"); i > 0 {
+		if line, err := strconv.Atoi(arg[i+1:]); err == nil && line > 0 {
+			return arg[:i], line
+		}
+	}
+	return arg, 0
+}
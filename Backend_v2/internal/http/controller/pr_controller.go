@@ -4,17 +4,13 @@ import (
 	"be/neurade/v2/internal/model"
 	"be/neurade/v2/internal/model/converter"
 	"be/neurade/v2/internal/service"
-	"be/neurade/v2/internal/util"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"time"
 
-	"bytes"
-
 	"github.com/go-chi/chi/v5"
 	"github.com/sirupsen/logrus"
 )
@@ -23,15 +19,22 @@ type PrController struct {
 	PrService     *service.PrService
 	CourseService *service.CourseService
 	UserService   *service.UserService
+	GitHubService *service.GitHubService
+	PrDiffService *service.PrDiffService
 	Log           *logrus.Logger
+	// GitHubTokenService resolves the credential each course acts with
+	GitHubTokenService *service.GitHubTokenService
 }
 
-func NewPrController(prService *service.PrService, courseService *service.CourseService, userService *service.UserService, log *logrus.Logger) *PrController {
+func NewPrController(prService *service.PrService, courseService *service.CourseService, userService *service.UserService, githubService *service.GitHubService, prDiffService *service.PrDiffService, log *logrus.Logger, githubTokenService *service.GitHubTokenService) *PrController {
 	return &PrController{
-		PrService:     prService,
-		CourseService: courseService,
-		UserService:   userService,
-		Log:           log,
+		PrService:          prService,
+		CourseService:      courseService,
+		UserService:        userService,
+		GitHubService:      githubService,
+		PrDiffService:      prDiffService,
+		Log:                log,
+		GitHubTokenService: githubTokenService,
 	}
 }
 
@@ -144,24 +147,39 @@ func (c *PrController) PostReviewToGitHubInternal(ctx context.Context, prID, cou
 	if err != nil {
 		return fmt.Errorf("Course not found: %w", err)
 	}
-	user, err := c.UserService.GetByID(ctx, course.UserID)
+	if course.Archived {
+		return fmt.Errorf("course %d is archived", courseID)
+	}
+	githubToken, err := c.GitHubTokenService.Token(ctx, course.ID)
 	if err != nil {
-		return fmt.Errorf("User not found: %w", err)
+		return fmt.Errorf("GitHub token not available: %w", err)
 	}
-	githubToken := user.GithubToken
-	c.Log.Info("githubToken", githubToken)
-	owner, repo, err := util.ParseGitHubURL(course.GithubURL)
+	provider, repo, err := c.PrDiffService.GitProviders.ForCourse(course)
 	if err != nil {
 		return fmt.Errorf("Invalid GitHub URL: %w", err)
 	}
+	diff, err := c.PrDiffService.GetDiff(ctx, course, pr.PrNumber, pr.HeadSHA, githubToken)
+	if err != nil {
+		c.Log.Errorf("Failed to get diff for PR %d, posting comments unchecked: %v", pr.PrNumber, err)
+	} else {
+		if review.CommitID == "" {
+			review.CommitID = diff.HeadSHA
+		}
+		// Comments outside the diff would make GitHub reject the whole review
+		anchored, unanchored := service.AnchorComments(diff, review.Comments)
+		review.Comments = anchored
+		for _, comment := range unanchored {
+			review.Body += fmt.Sprintf("\n\n**%s** (position %d):\n%s", comment.Path, comment.Position, comment.Body)
+		}
+	}
 	if review.CommitID == "" {
-		sha, err := getPRCommitSHA(owner, repo, pr.PrNumber, githubToken)
+		pullRequest, err := provider.GetPullRequest(ctx, repo, pr.PrNumber, githubToken)
 		if err != nil {
 			return fmt.Errorf("Failed to get PR commit SHA: %w", err)
 		}
-		review.CommitID = sha
+		review.CommitID = pullRequest.Head.SHA
 	}
-	err = postReview(owner, repo, pr.PrNumber, githubToken, &review)
+	err = provider.CreateReview(ctx, repo, pr.PrNumber, githubToken, &review)
 	if err != nil {
 		return fmt.Errorf("Failed to post review to GitHub: %w", err)
 	}
@@ -203,6 +221,9 @@ func (c *PrController) PostReviewToGitHub(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Invalid course_id", http.StatusBadRequest)
 		return
 	}
+	if course, err := c.CourseService.GetByID(r.Context(), courseID); err == nil && rejectArchived(w, course) {
+		return
+	}
 	// Fetch PR from DB and use its result field
 	pr, err := c.PrService.GetByID(r.Context(), prID)
 	if err != nil {
@@ -259,57 +280,77 @@ func (c *PrController) PostReviewToGitHub(w http.ResponseWriter, r *http.Request
 	w.Write([]byte(`{"success":true}`))
 }
 
-func postReview(owner, repo string, prNumber int, token string, review *model.GitHubReviewRequest) error {
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/reviews", owner, repo, prNumber)
-	// fmt.Println(apiURL)
-	reviewData, err := json.Marshal(review)
-	// fmt.Println("reviewData", string(reviewData))
+// GetDiff returns the cached diff of a PR for the dashboard diff view
+func (c *PrController) GetDiff(w http.ResponseWriter, r *http.Request) {
+	prID, err := strconv.Atoi(chi.URLParam(r, "pr_id"))
 	if err != nil {
-		return fmt.Errorf("error marshaling review: %w", err)
+		http.Error(w, "Invalid pr_id", http.StatusBadRequest)
+		return
 	}
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(reviewData))
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Add("Accept", "application/vnd.github+json")
-	req.Header.Add("X-GitHub-Api-Version", "2022-11-28")
-	req.Header.Add("Content-Type", "application/json")
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	pr, course, githubToken, err := c.prContext(r.Context(), prID)
 	if err != nil {
-		return fmt.Errorf("error making request: %w", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("GitHub API error: %d - %s", resp.StatusCode, body)
+	diff, err := c.PrDiffService.GetDiff(r.Context(), course, pr.PrNumber, pr.HeadSHA, githubToken)
+	if err != nil {
+		c.Log.Errorf("Failed to get diff for PR %d: %v", pr.PrNumber, err)
+		http.Error(w, "Failed to get PR diff", http.StatusBadGateway)
+		return
 	}
-	return nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
 }
 
-func getPRCommitSHA(owner, repo string, prNumber int, token string) (string, error) {
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d", owner, repo, prNumber)
-	req, _ := http.NewRequest("GET", apiURL, nil)
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Add("Accept", "application/vnd.github+json")
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+// GetFileSnapshot returns one file of a PR at ?sha= (defaults to the head) for ?path=
+func (c *PrController) GetFileSnapshot(w http.ResponseWriter, r *http.Request) {
+	prID, err := strconv.Atoi(chi.URLParam(r, "pr_id"))
+	if err != nil {
+		http.Error(w, "Invalid pr_id", http.StatusBadRequest)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
+	}
+	pr, course, githubToken, err := c.prContext(r.Context(), prID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sha := r.URL.Query().Get("sha")
+	if sha == "" {
+		diff, err := c.PrDiffService.GetDiff(r.Context(), course, pr.PrNumber, pr.HeadSHA, githubToken)
+		if err != nil {
+			http.Error(w, "Failed to get PR diff", http.StatusBadGateway)
+			return
+		}
+		sha = diff.HeadSHA
+	}
+	snapshot, err := c.PrDiffService.GetFileSnapshot(r.Context(), course, sha, path, githubToken)
 	if err != nil {
-		return "", err
+		c.Log.Errorf("Failed to get %s@%s: %v", path, sha, err)
+		http.Error(w, "Failed to get file", http.StatusBadGateway)
+		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("GitHub API error: %d - %s", resp.StatusCode, body)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// prContext loads a PR with its course and the course's GitHub token
+func (c *PrController) prContext(ctx context.Context, prID int) (*model.PrResponse, *model.CourseResponse, string, error) {
+	pr, err := c.PrService.GetByID(ctx, prID)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("PR not found")
 	}
-	var prData struct {
-		Head struct {
-			SHA string `json:"sha"`
-		} `json:"head"`
+	course, err := c.CourseService.GetByID(ctx, pr.CourseID)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("Course not found")
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&prData); err != nil {
-		return "", err
+	githubToken, err := c.GitHubTokenService.Token(ctx, course.ID)
+	if err != nil {
+		return nil, nil, "", err
 	}
-	return prData.Head.SHA, nil
+	return pr, course, githubToken, nil
 }
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/util"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// StorageController serves presigned links of the local-disk storage backend
+type StorageController struct {
+	Storage *util.LocalStorage
+	Log     *logrus.Logger
+}
+
+func NewStorageController(storage *util.LocalStorage, log *logrus.Logger) *StorageController {
+	return &StorageController{
+		Storage: storage,
+		Log:     log,
+	}
+}
+
+// Download handles GET /storage/{bucket}/* with the expires and signature
+// query parameters produced by LocalStorage.Presign
+func (c *StorageController) Download(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	object := chi.URLParam(r, "*")
+	query := r.URL.Query()
+	if err := c.Storage.Verify(bucket, object, query.Get("expires"), query.Get("signature")); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	file, info, err := c.Storage.Open(r.Context(), bucket, object)
+	if err != nil {
+		if errors.Is(err, util.ErrObjectNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		c.Log.WithError(err).Error("Failed to open stored file")
+		http.Error(w, "Failed to open file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	if info.ETag != "" {
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+	}
+	http.ServeContent(w, r, "", info.LastModified, file)
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+type TestRunController struct {
+	TestRunService    *service.TestRunService
+	AssignmentService *service.AssignmentService
+	PrService         *service.PrService
+	CourseService     *service.CourseService
+	UserService       *service.UserService
+	MinioUtil         *util.MinioUtil
+	Log               *logrus.Logger
+	// GitHubTokenService supplies the token the sandbox clones the PR with
+	GitHubTokenService *service.GitHubTokenService
+}
+
+func NewTestRunController(testRunService *service.TestRunService, assignmentService *service.AssignmentService, prService *service.PrService, courseService *service.CourseService, userService *service.UserService, minioUtil *util.MinioUtil, log *logrus.Logger, githubTokenService *service.GitHubTokenService) *TestRunController {
+	return &TestRunController{
+		TestRunService:     testRunService,
+		AssignmentService:  assignmentService,
+		PrService:          prService,
+		CourseService:      courseService,
+		UserService:        userService,
+		MinioUtil:          minioUtil,
+		Log:                log,
+		GitHubTokenService: githubTokenService,
+	}
+}
+
+// UploadTestBundle handles POST /assignments/{assignment_id}/tests with a
+// zip/tar bundle in "file" plus "test_command" and optional "test_report_path"
+func (c *TestRunController) UploadTestBundle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		c.Log.WithError(err).Error("Error parsing multipart form")
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	assignmentID, err := strconv.Atoi(chi.URLParam(r, "assignment_id"))
+	if err != nil {
+		http.Error(w, "Invalid assignment ID", http.StatusBadRequest)
+		return
+	}
+	assignment, err := c.AssignmentService.GetByID(r.Context(), assignmentID)
+	if err != nil {
+		http.Error(w, "Assignment not found", http.StatusNotFound)
+		return
+	}
+	course, err := c.AssignmentService.GetCourseByID(r.Context(), assignment.CourseID)
+	if err != nil {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+	if rejectArchived(w, course) {
+		return
+	}
+
+	testCommand := r.FormValue("test_command")
+	if testCommand == "" {
+		testCommand = assignment.TestCommand
+	}
+	if testCommand == "" {
+		http.Error(w, "test_command is required", http.StatusBadRequest)
+		return
+	}
+
+	bundleURL := assignment.TestBundleURL
+	bundleFile, fileHeader, err := r.FormFile("file")
+	if err == nil {
+		defer bundleFile.Close()
+		c.Log.Infof("Uploaded test bundle: %s, size: %d bytes", fileHeader.Filename, fileHeader.Size)
+		content, err := io.ReadAll(bundleFile)
+		if err != nil {
+			c.Log.WithError(err).Error("Error reading test bundle")
+			http.Error(w, "Error reading test bundle", http.StatusInternalServerError)
+			return
+		}
+		if _, err := util.ReadArchive(content); err != nil {
+			http.Error(w, "Test bundle must be a zip or tar archive", http.StatusBadRequest)
+			return
+		}
+		bundleURL, err = c.MinioUtil.SaveObject(r.Context(), course.ID, "tests", assignment.AssignmentName, content, "application/octet-stream")
+		if err != nil {
+			c.Log.WithError(err).Error("Failed to store test bundle")
+			http.Error(w, "Failed to store test bundle", http.StatusInternalServerError)
+			return
+		}
+	}
+	if bundleURL == "" {
+		http.Error(w, "Test bundle file is required", http.StatusBadRequest)
+		return
+	}
+
+	reportPath := r.FormValue("test_report_path")
+	if reportPath == "" {
+		reportPath = assignment.TestReportPath
+	}
+	assignmentResponse, err := c.AssignmentService.Update(r.Context(), &model.AssignmentUpdateRequest{
+		ID:             assignment.ID,
+		CourseID:       assignment.CourseID,
+		AssignmentName: assignment.AssignmentName,
+		Description:    assignment.Description,
+		AssignmentURL:  assignment.AssignmentURL,
+		TestBundleURL:  bundleURL,
+		TestCommand:    testCommand,
+		TestReportPath: reportPath,
+		UpdatedAt:      time.Now(),
+	})
+	if err != nil {
+		c.Log.Println("Failed to update assignment:", err)
+		http.Error(w, "Failed to update assignment", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assignmentResponse)
+}
+
+// RunTests handles POST /pull-requests/{pr_id}/tests/run. The run executes in
+// the background; poll GET /pull-requests/{pr_id}/tests for the outcome.
+func (c *TestRunController) RunTests(w http.ResponseWriter, r *http.Request) {
+	prID, err := strconv.Atoi(chi.URLParam(r, "pr_id"))
+	if err != nil {
+		http.Error(w, "Invalid pr_id", http.StatusBadRequest)
+		return
+	}
+	_ = r.ParseMultipartForm(2 << 20)
+	pr, err := c.PrService.GetByID(r.Context(), prID)
+	if err != nil {
+		http.Error(w, "PR not found", http.StatusNotFound)
+		return
+	}
+	assignmentID := pr.AssignmentID
+	if v := r.FormValue("assignment_id"); v != "" {
+		assignmentID, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid assignment_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if assignmentID == 0 {
+		http.Error(w, "PR is not linked to an assignment", http.StatusBadRequest)
+		return
+	}
+	assignment, err := c.AssignmentService.GetByID(r.Context(), assignmentID)
+	if err != nil || assignment.CourseID != pr.CourseID {
+		http.Error(w, "Assignment not found", http.StatusNotFound)
+		return
+	}
+	course, err := c.CourseService.GetByID(r.Context(), pr.CourseID)
+	if err != nil {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+	if rejectArchived(w, course) {
+		return
+	}
+	// Local courses have no URL; their submissions are found by PR number
+	owner, repo, err := util.ParseGitHubURL(course.GithubURL)
+	if err != nil && course.GitProvider != util.GitProviderLocal {
+		http.Error(w, "Invalid GitHub URL in course", http.StatusBadRequest)
+		return
+	}
+
+	githubToken, err := c.GitHubTokenService.Token(r.Context(), course.ID)
+	if err != nil {
+		http.Error(w, "GitHub token not available: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := &model.TestRunRequest{
+		CourseID:       course.ID,
+		AssignmentID:   assignment.ID,
+		PrID:           pr.ID,
+		RepoOwner:      owner,
+		RepoName:       repo,
+		RepoURL:        course.GithubURL,
+		GitProvider:    course.GitProvider,
+		PrNumber:       pr.PrNumber,
+		GithubToken:    githubToken,
+		TestBundleURL:  assignment.TestBundleURL,
+		TestCommand:    assignment.TestCommand,
+		TestReportPath: assignment.TestReportPath,
+	}
+	run, err := c.TestRunService.Start(r.Context(), request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	go func(runID int) {
+		if _, err := c.TestRunService.Execute(context.Background(), runID, request); err != nil {
+			c.Log.Errorf("Test run %d for PR %d failed: %v", runID, prID, err)
+		}
+	}(run.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetByPr handles GET /pull-requests/{pr_id}/tests, newest run first
+func (c *TestRunController) GetByPr(w http.ResponseWriter, r *http.Request) {
+	prID, err := strconv.Atoi(chi.URLParam(r, "pr_id"))
+	if err != nil {
+		http.Error(w, "Invalid pr_id", http.StatusBadRequest)
+		return
+	}
+	runs, err := c.TestRunService.GetAllByPr(r.Context(), prID)
+	if err != nil {
+		http.Error(w, "Failed to get test runs", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
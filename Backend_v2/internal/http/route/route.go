@@ -3,6 +3,8 @@ package route
 import (
 	http "be/neurade/v2/internal/http/controller"
 	"be/neurade/v2/internal/service"
+	"be/neurade/v2/internal/util"
+	"context"
 	"strconv"
 	"strings"
 	"time"
@@ -25,7 +27,15 @@ type RouteConfig struct {
 	AgentController             *http.AgentController
 	ChatController              *http.ChatController
 	AdminUserController         *http.AdminUserController
+	TestRunController           *http.TestRunController
+	DocumentVersionController   *http.DocumentVersionController
+	StorageController           *http.StorageController
+	FileController              *http.FileController
+	GitController               *http.GitController
+	LabelController             *http.LabelController
 	PermissionUserCourseService *service.PermissionUserCourseService
+	// WebhookRelayToken authenticates the webhook relay on the /listen routes
+	WebhookRelayToken string
 }
 
 func (c *RouteConfig) Setup() *chi.Mux {
@@ -47,6 +57,14 @@ func (c *RouteConfig) Setup() *chi.Mux {
 
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	// Signed downloads, only when files are kept on local disk
+	if c.StorageController != nil {
+		r.Get("/storage/{bucket}/*", c.StorageController.Download)
+	}
+
+	// Stored files, for course members or holders of a signed file token
+	r.With(c.PermissionForFile).Get("/files/{file_id}", c.FileController.Download)
+
 	// OAuth2 and Auth routes
 	r.Route("/auth", func(r chi.Router) {
 		r.Post("/login", c.UserController.Login)              // Only super admin at first
@@ -62,7 +80,9 @@ func (c *RouteConfig) Setup() *chi.Mux {
 		r.With(c.SuperAdminOnly).Delete("/{id}", c.AdminUserController.Delete) // Delete user
 		r.With(c.SuperAdminOnly).Post("/{user_id}/courses-permission", c.CourseController.UpdateUserCoursePermissions)
 		r.With(c.SuperAdminOnly).Put("/{id}/github-token", c.AdminUserController.UpdateGithubToken)
+		r.With(c.SuperAdminOnly).Put("/{id}/github-login", c.AdminUserController.UpdateGithubLogin)
 		r.With(c.SuperAdminOnly).Post("/validate-github-token", c.AdminUserController.ValidateGithubToken)
+		r.With(c.SuperAdminOnly).Get("/github-rate-limit", c.AdminUserController.GitHubRateLimit)
 		r.With(c.LoginRequired).Get("/github-token", c.AdminUserController.GetSuperAdminGithubToken)
 		// r.With(c.SuperAdminOnly).Post("/{id}/assign-course", c.AdminUserController.AssignCourse) // Assign course permission
 	})
@@ -86,18 +106,41 @@ func (c *RouteConfig) Setup() *chi.Mux {
 		r.With(c.PermissionForCourse).Get("/{course_id}", c.CourseController.GetByID)
 		r.With(c.PermissionForCourse).Put("/{course_id}", c.CourseController.Update)
 		r.With(c.SuperAdminOnly).Delete("/{course_id}", c.CourseController.Delete)
+		r.With(c.SuperAdminOnly).Get("/deletions/{job_id}", c.CourseController.GetDeletionJob)
+		r.With(c.PermissionForCourse).Post("/{course_id}/archive", c.CourseController.Archive)
+		r.With(c.PermissionForCourse).Post("/{course_id}/unarchive", c.CourseController.Unarchive)
 		r.With(c.LoginRequiredAndTokenMatchesUserID).Get("/permission/{user_id}", c.CourseController.GetAllByPermission)
 		r.With(c.SuperAdminOnly).Post("/{course_id}/assign-user/{user_id}", c.CourseController.AssignUserToCourse)
 		r.With(c.SuperAdminOnly).Get("/{course_id}/users", c.CourseController.ListUsersByCourse)
+		r.With(c.SuperAdminOnly).Post("/{course_id}/clone", c.CourseController.Clone)
+		r.With(c.PermissionForCourse).Get("/{course_id}/github-credential", c.CourseController.GetGitHubCredential)
+		r.With(c.PermissionForCourse).Put("/{course_id}/github-credential", c.CourseController.UpdateGitHubCredential)
+		r.With(c.PermissionForCourse).Get("/{course_id}/webhook", c.CourseController.GetWebhook)
+		r.With(c.PermissionForCourse).Post("/{course_id}/webhook", c.CourseController.RegisterWebhook)
+		r.With(c.PermissionForCourse).Get("/{course_id}/documents", c.DocumentVersionController.GetChangelog)
+		r.With(c.PermissionForCourse).Post("/{course_id}/documents/{version_id}/rollback", c.DocumentVersionController.Rollback)
+		r.With(c.PermissionForCourse).Get("/{course_id}/assignments/{assignment_id}/repository", c.GitController.GetRepository)
+		r.With(c.PermissionForCourse).Get("/{course_id}/labels", c.LabelController.GetLabels)
+		r.With(c.PermissionForCourse).Put("/{course_id}/labels/{kind}", c.LabelController.UpdateLabel)
+		r.With(c.PermissionForCourse).Get("/{course_id}/pull-requests/{pr_number}/commands", c.GitHubWebhookController.ListCommands)
+	})
+
+	// Hosted repositories of local courses: git over smart HTTP, signed in
+	// with the user's email and password
+	r.Route("/git", func(r chi.Router) {
+		r.Get("/{course_id}/{assignment_id}.git/info/refs", c.GitController.Serve)
+		r.Post("/{course_id}/{assignment_id}.git/{service}", c.GitController.Serve)
 	})
 
 	// Assignment routes
 	r.Route("/assignments", func(r chi.Router) {
 		r.Post("/", c.AssignmentController.Create)
 		r.Get("/{assignment_id}", c.AssignmentController.GetByID)
+		r.With(c.PermissionForAssignment).Get("/{assignment_id}/files", c.AssignmentController.GetFiles)
 		r.Get("/course/{course_id}", c.AssignmentController.GetAllByCourse)
 		r.Put("/{assignment_id}", c.AssignmentController.Update)
 		r.Delete("/{assignment_id}", c.AssignmentController.Delete)
+		r.With(c.PermissionForAssignment).Post("/{assignment_id}/tests", c.TestRunController.UploadTestBundle)
 	})
 
 	// Pull Request routes
@@ -107,16 +150,28 @@ func (c *RouteConfig) Setup() *chi.Mux {
 		r.With(c.PermissionForCourse).Get("/course/{course_id}", c.PrController.GetAllByCourse)
 		r.With(c.PermissionForCourse).Put("/{pr_id}/result", c.PrController.UpdateResult)
 		r.With(c.PermissionForCourse).Put("/{pr_id}/review", c.PrController.PostReviewToGitHub)
+		r.With(c.PermissionForPr).Get("/{pr_id}/diff", c.PrController.GetDiff)
+		r.With(c.PermissionForPr).Get("/{pr_id}/files", c.PrController.GetFileSnapshot)
+		r.With(c.PermissionForPr).Post("/{pr_id}/tests/run", c.TestRunController.RunTests)
+		r.With(c.PermissionForPr).Get("/{pr_id}/tests", c.TestRunController.GetByPr)
 	})
 
 	// Webhook routes
 	r.Route("/webhooks", func(r chi.Router) {
+		// Deliveries straight from GitHub, authenticated by their signature
+		r.Post("/github", c.GitHubWebhookController.Receive)
+		// Deliveries from GitLab project hooks, authenticated by their token
+		r.Post("/gitlab", c.GitHubWebhookController.ReceiveGitLab)
+		r.With(c.SuperAdminOnly).Get("/deliveries", c.GitHubWebhookController.ListDeliveries)
+		r.With(c.SuperAdminOnly).Post("/deliveries/replay", c.GitHubWebhookController.ReplayFailedDeliveries)
+		r.With(c.SuperAdminOnly).Post("/deliveries/{delivery_id}/replay", c.GitHubWebhookController.ReplayDelivery)
 		r.Post("/fetch-pull-requests", c.GitHubWebhookController.FetchPullRequests)
 		r.Get("/course/{course_id}/pull-requests", c.PrController.GetAllByCourse)
 	})
 
 	// Webhook listener routes for automatic updates
 	r.Route("/listen", func(r chi.Router) {
+		r.Use(c.RelayTokenRequired)
 		r.Post("/pull-request", c.GitHubWebhookController.ListenPullRequest)
 		r.Post("/comments", c.GitHubWebhookController.ListenComments)
 	})
@@ -133,7 +188,6 @@ func (c *RouteConfig) Setup() *chi.Mux {
 		r.Get("/{id}", c.ChatController.GetByID)
 		r.Get("/course/{course_id}", c.ChatController.GetByCourseID)
 		r.Get("/pr/{pr_id}", c.ChatController.GetByPrID)
-		r.Get("/history/{course_id}/{user_id}/{pr_id}", c.ChatController.GetChatHistoryAsArray)
 	})
 
 	return r
@@ -158,6 +212,28 @@ func (c *RouteConfig) SuperAdminOnly(next stdhttp.Handler) stdhttp.Handler {
 	})
 }
 
+// RelayTokenRequired admits the webhook relay, which sends the shared token in
+// X-Relay-Token or as a bearer token. Without a configured token nobody is let in.
+func (c *RouteConfig) RelayTokenRequired(next stdhttp.Handler) stdhttp.Handler {
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if c.WebhookRelayToken == "" {
+			w.WriteHeader(stdhttp.StatusServiceUnavailable)
+			w.Write([]byte("Webhook relay token not configured"))
+			return
+		}
+		token := r.Header.Get("X-Relay-Token")
+		if token == "" {
+			token = extractTokenFromHeader(r)
+		}
+		if !util.SecureCompare(token, c.WebhookRelayToken) {
+			w.WriteHeader(stdhttp.StatusUnauthorized)
+			w.Write([]byte("Invalid relay token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Add PermissionForCourse middleware here, using c.PermissionUserCourseService
 func (c *RouteConfig) PermissionForCourse(next stdhttp.Handler) stdhttp.Handler {
 	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
@@ -204,6 +280,125 @@ func (c *RouteConfig) PermissionForCourse(next stdhttp.Handler) stdhttp.Handler
 	})
 }
 
+// PermissionForFile lets through a valid ?token= issued for this file and a
+// known purpose, or a logged-in user with permission on the file's course
+func (c *RouteConfig) PermissionForFile(next stdhttp.Handler) stdhttp.Handler {
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		fileID, err := strconv.Atoi(chi.URLParam(r, "file_id"))
+		if err != nil {
+			w.WriteHeader(stdhttp.StatusBadRequest)
+			w.Write([]byte("Invalid file id"))
+			return
+		}
+		if fileToken := r.URL.Query().Get("token"); fileToken != "" {
+			claims, err := c.UserController.JWTUtil.ValidateFileToken(fileToken)
+			if err != nil || claims.FileID != fileID || !service.ValidFilePurpose(claims.Purpose) {
+				w.WriteHeader(stdhttp.StatusForbidden)
+				w.Write([]byte("Invalid file token"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := extractTokenFromHeader(r)
+		if token == "" {
+			w.WriteHeader(stdhttp.StatusUnauthorized)
+			w.Write([]byte("Missing token"))
+			return
+		}
+		claims, err := c.UserController.JWTUtil.ValidateToken(token)
+		if err != nil {
+			w.WriteHeader(stdhttp.StatusForbidden)
+			w.Write([]byte("Invalid token"))
+			return
+		}
+		if claims.Role == "super_admin" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		file, err := c.FileController.FileService.GetByID(r.Context(), fileID)
+		if err != nil {
+			w.WriteHeader(stdhttp.StatusNotFound)
+			w.Write([]byte("File not found"))
+			return
+		}
+		puc, err := c.PermissionUserCourseService.Repository.FindByUserAndCourse(c.PermissionUserCourseService.DB, claims.UserID, file.CourseID)
+		if err != nil || puc == nil {
+			w.WriteHeader(stdhttp.StatusForbidden)
+			w.Write([]byte("No permission for this course"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PermissionForAssignment lets through a logged-in user with permission on
+// the course of the {assignment_id} in the path
+func (c *RouteConfig) PermissionForAssignment(next stdhttp.Handler) stdhttp.Handler {
+	return c.permissionForCourseOf("assignment_id", func(ctx context.Context, id int) (int, error) {
+		assignment, err := c.AssignmentController.AssignmentService.GetByID(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		return assignment.CourseID, nil
+	}, next)
+}
+
+// PermissionForPr lets through a logged-in user with permission on the
+// course of the {pr_id} in the path
+func (c *RouteConfig) PermissionForPr(next stdhttp.Handler) stdhttp.Handler {
+	return c.permissionForCourseOf("pr_id", func(ctx context.Context, id int) (int, error) {
+		pr, err := c.PrController.PrService.GetByID(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		return pr.CourseID, nil
+	}, next)
+}
+
+// permissionForCourseOf checks the caller's permission on the course that
+// courseOf finds for the ID in the path parameter param
+func (c *RouteConfig) permissionForCourseOf(param string, courseOf func(ctx context.Context, id int) (int, error), next stdhttp.Handler) stdhttp.Handler {
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		token := extractTokenFromHeader(r)
+		if token == "" {
+			w.WriteHeader(stdhttp.StatusUnauthorized)
+			w.Write([]byte("Missing token"))
+			return
+		}
+		claims, err := c.UserController.JWTUtil.ValidateToken(token)
+		if err != nil {
+			w.WriteHeader(stdhttp.StatusForbidden)
+			w.Write([]byte("Invalid token"))
+			return
+		}
+		id, err := strconv.Atoi(chi.URLParam(r, param))
+		if err != nil {
+			w.WriteHeader(stdhttp.StatusBadRequest)
+			w.Write([]byte("Invalid " + param))
+			return
+		}
+		if claims.Role == "super_admin" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		courseID, err := courseOf(r.Context(), id)
+		if err != nil {
+			w.WriteHeader(stdhttp.StatusNotFound)
+			w.Write([]byte("Not found"))
+			return
+		}
+		puc, err := c.PermissionUserCourseService.Repository.FindByUserAndCourse(c.PermissionUserCourseService.DB, claims.UserID, courseID)
+		if err != nil || puc == nil {
+			w.WriteHeader(stdhttp.StatusForbidden)
+			w.Write([]byte("No permission for this course"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Update LoginRequiredAndTokenMatchesUserID to allow super admin or matching user_id
 func (c *RouteConfig) LoginRequiredAndTokenMatchesUserID(next stdhttp.Handler) stdhttp.Handler {
 	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
@@ -7,8 +7,13 @@ type AssignmentCreateRequest struct {
 	AssignmentName string    `json:"assignment_name"`
 	Description    string    `json:"description"`
 	AssignmentURL  string    `json:"assignment_url"`
+	TestBundleURL  string    `json:"test_bundle_url"`
+	TestCommand    string    `json:"test_command"`
+	TestReportPath string    `json:"test_report_path"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+	// DueDate is the deadline, if the assignment has one
+	DueDate *time.Time `json:"due_date,omitempty"`
 }
 
 type AssignmentResponse struct {
@@ -17,8 +22,13 @@ type AssignmentResponse struct {
 	AssignmentName string    `json:"assignment_name"`
 	Description    string    `json:"description"`
 	AssignmentURL  string    `json:"assignment_url"`
+	TestBundleURL  string    `json:"test_bundle_url"`
+	TestCommand    string    `json:"test_command"`
+	TestReportPath string    `json:"test_report_path"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+	// DueDate is the deadline, if the assignment has one
+	DueDate *time.Time `json:"due_date,omitempty"`
 }
 
 type AssignmentUpdateRequest struct {
@@ -27,5 +37,10 @@ type AssignmentUpdateRequest struct {
 	AssignmentName string    `json:"assignment_name"`
 	Description    string    `json:"description"`
 	AssignmentURL  string    `json:"assignment_url"`
+	TestBundleURL  string    `json:"test_bundle_url"`
+	TestCommand    string    `json:"test_command"`
+	TestReportPath string    `json:"test_report_path"`
 	UpdatedAt      time.Time `json:"updated_at"`
+	// DueDate is the deadline, if the assignment has one
+	DueDate *time.Time `json:"due_date,omitempty"`
 }
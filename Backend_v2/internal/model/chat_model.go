@@ -2,23 +2,62 @@ package model
 
 import "time"
 
-type ChatCreateRequest struct {
-	CourseID    int                      `json:"course_id"`
-	UserID      int                      `json:"user_id"`
-	PrID        int                      `json:"pr_id"`
-	ChatHistory []map[string]interface{} `json:"chat_history"`
-	CreatedAt   time.Time                `json:"created_at"`
-	UpdatedAt   time.Time                `json:"updated_at"`
-}
-
-type ChatResponse struct {
-	ID          int                      `json:"id"`
-	CourseID    int                      `json:"course_id"`
-	UserID      int                      `json:"user_id"`
-	PrID        int                      `json:"pr_id"`
-	ChatHistory []map[string]interface{} `json:"chat_history"`
-	CreatedAt   time.Time                `json:"created_at"`
-	UpdatedAt   time.Time                `json:"updated_at"`
+// ChatThreadConversation is the thread key of a PR's own conversation, as
+// opposed to its review threads
+const ChatThreadConversation = "conversation"
+
+type ChatThreadResponse struct {
+	ID        int       `json:"id"`
+	CourseID  int       `json:"course_id"`
+	PrID      int       `json:"pr_id"`
+	ThreadKey string    `json:"thread_key"`
+	File      string    `json:"file,omitempty"`
+	Line      *int      `json:"line,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Messages are oldest first; lists of a course's threads leave them out
+	Messages []*ChatMessageResponse `json:"messages,omitempty"`
+}
+
+type ChatMessageResponse struct {
+	ID          int       `json:"id"`
+	ThreadID    int       `json:"thread_id"`
+	AuthorLogin string    `json:"author_login"`
+	Role        string    `json:"role"`
+	Message     string    `json:"message"`
+	GitHubID    string    `json:"github_id,omitempty"`
+	File        string    `json:"file,omitempty"`
+	Line        *int      `json:"line,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ChatMessageCreateRequest adds a message to a thread of a PR, which is
+// started when it is the thread's first message
+type ChatMessageCreateRequest struct {
+	CourseID int `json:"course_id"`
+	// PrID is the PR's row in prs, not its number
+	PrID int `json:"pr_id"`
+	// ThreadKey is empty for the PR's conversation
+	ThreadKey   string `json:"thread_key"`
+	AuthorLogin string `json:"author_login"`
+	Role        string `json:"role"`
+	Message     string `json:"message"`
+	GitHubID    string `json:"github_id"`
+	File        string `json:"file"`
+	Line        *int   `json:"line"`
+	// CreatedAt is when the comment was written, now when it is zero
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChatMigrationReport sums up a move of the legacy chats into threads
+type ChatMigrationReport struct {
+	DryRun   bool `json:"dry_run"`
+	Chats    int  `json:"chats"`
+	Migrated int  `json:"migrated"`
+	Messages int  `json:"messages"`
+	// Skipped lists the legacy chats whose PR is not found, which are kept
+	Skipped []string `json:"skipped,omitempty"`
 }
 
 // ChatAPIRequest represents the request to the chat API endpoint
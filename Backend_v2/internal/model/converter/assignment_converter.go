@@ -15,6 +15,10 @@ func AssignmentToResponse(assignment *entity.Assignment) *model.AssignmentRespon
 		AssignmentName: assignment.AssignmentName,
 		Description:    assignment.Description,
 		AssignmentURL:  assignment.AssignmentURL,
+		TestBundleURL:  assignment.TestBundleURL,
+		TestCommand:    assignment.TestCommand,
+		TestReportPath: assignment.TestReportPath,
+		DueDate:        assignment.DueDate,
 		CreatedAt:      assignment.CreatedAt,
 		UpdatedAt:      assignment.UpdatedAt,
 	}
@@ -26,6 +30,10 @@ func AssignmentToEntity(request *model.AssignmentCreateRequest) *entity.Assignme
 		AssignmentName: request.AssignmentName,
 		Description:    request.Description,
 		AssignmentURL:  request.AssignmentURL,
+		TestBundleURL:  request.TestBundleURL,
+		TestCommand:    request.TestCommand,
+		TestReportPath: request.TestReportPath,
+		DueDate:        request.DueDate,
 		CreatedAt:      request.CreatedAt,
 		UpdatedAt:      request.UpdatedAt,
 	}
@@ -37,11 +45,18 @@ func RequestToAssignmentRequest(r *http.Request) *model.AssignmentCreateRequest
 	description := r.FormValue("description")
 	createdAt, _ := time.Parse(time.RFC3339, r.FormValue("created_at"))
 	updatedAt, _ := time.Parse(time.RFC3339, r.FormValue("updated_at"))
+	var dueDate *time.Time
+	if parsed, err := time.Parse(time.RFC3339, r.FormValue("due_date")); err == nil {
+		dueDate = &parsed
+	}
 	return &model.AssignmentCreateRequest{
 		CourseID:       courseID,
 		AssignmentName: assignmentName,
 		Description:    description,
 		AssignmentURL:  "",
+		TestCommand:    r.FormValue("test_command"),
+		TestReportPath: r.FormValue("test_report_path"),
+		DueDate:        dueDate,
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
 	}
@@ -3,48 +3,67 @@ package converter
 import (
 	"be/neurade/v2/internal/entity"
 	"be/neurade/v2/internal/model"
-	"encoding/json"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 )
 
-func ChatToEntity(request *model.ChatCreateRequest) *entity.Chat {
-	return &entity.Chat{
-		CourseID:    request.CourseID,
-		UserID:      request.UserID,
-		PrID:        request.PrID,
-		ChatHistory: entity.JSON(request.ChatHistory),
-		CreatedAt:   request.CreatedAt,
-		UpdatedAt:   request.UpdatedAt,
+func ChatThreadToResponse(thread *entity.ChatThread) *model.ChatThreadResponse {
+	return &model.ChatThreadResponse{
+		ID:        thread.ID,
+		CourseID:  thread.CourseID,
+		PrID:      thread.PrID,
+		ThreadKey: thread.ThreadKey,
+		File:      thread.File,
+		Line:      thread.Line,
+		CreatedAt: thread.CreatedAt,
+		UpdatedAt: thread.UpdatedAt,
 	}
 }
 
-func ChatToResponse(chat *entity.Chat) *model.ChatResponse {
-	return &model.ChatResponse{
-		ID:          chat.ID,
-		CourseID:    chat.CourseID,
-		UserID:      chat.UserID,
-		PrID:        chat.PrID,
-		ChatHistory: []map[string]interface{}(chat.ChatHistory),
-		CreatedAt:   chat.CreatedAt,
-		UpdatedAt:   chat.UpdatedAt,
+func ChatMessageToResponse(message *entity.ChatMessage) *model.ChatMessageResponse {
+	return &model.ChatMessageResponse{
+		ID:          message.ID,
+		ThreadID:    message.ThreadID,
+		AuthorLogin: message.AuthorLogin,
+		Role:        message.Role,
+		Message:     message.Message,
+		GitHubID:    message.GitHubID,
+		File:        message.File,
+		Line:        message.Line,
+		CreatedAt:   message.CreatedAt,
+		UpdatedAt:   message.UpdatedAt,
 	}
 }
 
-func RequestToChatRequest(r *http.Request) *model.ChatCreateRequest {
-	chatHistoryStr := r.FormValue("chat_history")
-	var chatHistory []map[string]interface{}
-	if chatHistoryStr != "" {
-		json.Unmarshal([]byte(chatHistoryStr), &chatHistory)
+func ChatMessageToEntity(request *model.ChatMessageCreateRequest) *entity.ChatMessage {
+	return &entity.ChatMessage{
+		CourseID:    request.CourseID,
+		AuthorLogin: request.AuthorLogin,
+		Role:        request.Role,
+		Message:     request.Message,
+		GitHubID:    request.GitHubID,
+		File:        request.File,
+		Line:        request.Line,
+		CreatedAt:   request.CreatedAt,
+		UpdatedAt:   request.CreatedAt,
 	}
+}
 
-	return &model.ChatCreateRequest{
-		CourseID:    func() int { val, _ := strconv.Atoi(r.FormValue("course_id")); return val }(),
-		UserID:      func() int { val, _ := strconv.Atoi(r.FormValue("user_id")); return val }(),
-		PrID:        func() int { val, _ := strconv.Atoi(r.FormValue("pr_id")); return val }(),
-		ChatHistory: chatHistory,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+func RequestToChatMessageRequest(r *http.Request) *model.ChatMessageCreateRequest {
+	courseID, _ := strconv.Atoi(r.FormValue("course_id"))
+	prID, _ := strconv.Atoi(r.FormValue("pr_id"))
+	request := &model.ChatMessageCreateRequest{
+		CourseID:    courseID,
+		PrID:        prID,
+		ThreadKey:   r.FormValue("thread_key"),
+		AuthorLogin: r.FormValue("author_login"),
+		Role:        r.FormValue("role"),
+		Message:     strings.TrimSpace(r.FormValue("message")),
+		File:        r.FormValue("file"),
+	}
+	if line, err := strconv.Atoi(r.FormValue("line")); err == nil && line > 0 {
+		request.Line = &line
 	}
+	return request
 }
@@ -3,6 +3,7 @@ package converter
 import (
 	"be/neurade/v2/internal/entity"
 	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/util"
 	"net/http"
 	"strconv"
 	"time"
@@ -10,16 +11,26 @@ import (
 
 func CourseToResponse(course *entity.Course) *model.CourseResponse {
 	return &model.CourseResponse{
-		ID:            course.ID,
-		UserID:        course.UserID,
-		CourseName:    course.CourseName,
-		GithubURL:     course.GithubURL,
-		Owner:         course.Owner,
-		RepoName:      course.RepoName,
-		GeneralAnswer: course.GeneralAnswer,
-		AutoGrade:     course.AutoGrade,
-		CreatedAt:     course.CreatedAt,
-		UpdatedAt:     course.UpdatedAt,
+		ID:              course.ID,
+		UserID:          course.UserID,
+		CourseName:      course.CourseName,
+		GithubURL:       course.GithubURL,
+		Owner:           course.Owner,
+		RepoName:        course.RepoName,
+		GitProvider:     course.GitProvider,
+		GeneralAnswer:   course.GeneralAnswer,
+		AutoGrade:       course.AutoGrade,
+		PassScore:       course.PassScore,
+		BotHandle:       course.BotHandle,
+		Archived:        course.ArchivedAt != nil,
+		ArchivedAt:      course.ArchivedAt,
+		PrSyncedAt:      course.PrSyncedAt,
+		LastSyncAt:      course.LastSyncAt,
+		LastSyncStatus:  course.LastSyncStatus,
+		LastSyncMessage: course.LastSyncMessage,
+		WebhookID:       course.WebhookID,
+		CreatedAt:       course.CreatedAt,
+		UpdatedAt:       course.UpdatedAt,
 	}
 }
 
@@ -30,8 +41,11 @@ func CourseToEntity(request *model.CourseCreateRequest) *entity.Course {
 		GithubURL:     request.GithubURL,
 		Owner:         request.Owner,
 		RepoName:      request.RepoName,
+		GitProvider:   request.GitProvider,
 		GeneralAnswer: request.GeneralAnswer,
 		AutoGrade:     request.AutoGrade,
+		PassScore:     request.PassScore,
+		BotHandle:     request.BotHandle,
 		CreatedAt:     request.CreatedAt,
 		UpdatedAt:     request.UpdatedAt,
 	}
@@ -42,6 +56,14 @@ func RequestToCourseRequest(r *http.Request) *model.CourseCreateRequest {
 	courseName := r.FormValue("course_name")
 	githubURL := r.FormValue("github_url")
 	autoGrade, _ := strconv.ParseBool(r.FormValue("auto_grade"))
+	passScore := model.DefaultPassScore
+	if value := r.FormValue("pass_score"); value != "" {
+		passScore, _ = strconv.Atoi(value)
+	}
+	botHandle := model.DefaultBotHandle
+	if value := util.NormalizeBotHandle(r.FormValue("bot_handle")); value != "" {
+		botHandle = value
+	}
 	createdAt, _ := time.Parse(time.RFC3339, r.FormValue("created_at"))
 	updatedAt, _ := time.Parse(time.RFC3339, r.FormValue("updated_at"))
 	return &model.CourseCreateRequest{
@@ -51,8 +73,21 @@ func RequestToCourseRequest(r *http.Request) *model.CourseCreateRequest {
 		GeneralAnswer: "",
 		Owner:         "",
 		RepoName:      "",
+		GitProvider:   r.FormValue("git_provider"),
 		AutoGrade:     autoGrade,
+		PassScore:     passScore,
+		BotHandle:     botHandle,
 		CreatedAt:     createdAt,
 		UpdatedAt:     updatedAt,
 	}
 }
+
+func RequestToCourseCloneRequest(r *http.Request) *model.CourseCloneRequest {
+	copyPermissions, _ := strconv.ParseBool(r.FormValue("copy_permissions"))
+	return &model.CourseCloneRequest{
+		CourseName:      r.FormValue("course_name"),
+		GithubURL:       r.FormValue("github_url"),
+		GitProvider:     r.FormValue("git_provider"),
+		CopyPermissions: copyPermissions,
+	}
+}
@@ -0,0 +1,44 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+)
+
+func CourseDeletionJobToResponse(job *entity.CourseDeletionJob) *model.CourseDeletionJobResponse {
+	return &model.CourseDeletionJobResponse{
+		ID:          job.ID,
+		CourseID:    job.CourseID,
+		CourseName:  job.CourseName,
+		RequestedBy: job.RequestedBy,
+		Status:      job.Status,
+		Removed:     RemovedFromJSON(job.Report),
+		Error:       job.Error,
+		StartedAt:   job.StartedAt,
+		FinishedAt:  job.FinishedAt,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+	}
+}
+
+// RemovedToJSON stores a deletion report as one {"item", "removed"} row per
+// kind of thing removed
+func RemovedToJSON(removed map[string]int) entity.JSON {
+	out := make(entity.JSON, 0, len(removed))
+	for item, count := range removed {
+		out = append(out, map[string]interface{}{"item": item, "removed": count})
+	}
+	return out
+}
+
+func RemovedFromJSON(data entity.JSON) map[string]int {
+	removed := make(map[string]int, len(data))
+	for _, row := range data {
+		item, _ := row["item"].(string)
+		count, _ := row["removed"].(float64)
+		if item != "" {
+			removed[item] = int(count)
+		}
+	}
+	return removed
+}
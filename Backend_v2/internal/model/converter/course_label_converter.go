@@ -0,0 +1,16 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+)
+
+func CourseLabelToResponse(label *entity.CourseLabel) *model.CourseLabelResponse {
+	return &model.CourseLabelResponse{
+		CourseID: label.CourseID,
+		Kind:     label.Kind,
+		Name:     label.Name,
+		Color:    label.Color,
+		Custom:   true,
+	}
+}
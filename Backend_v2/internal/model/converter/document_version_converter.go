@@ -0,0 +1,23 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+)
+
+func DocumentVersionToResponse(version *entity.DocumentVersion) *model.DocumentVersionResponse {
+	return &model.DocumentVersionResponse{
+		ID:           version.ID,
+		CourseID:     version.CourseID,
+		AssignmentID: version.AssignmentID,
+		DocType:      version.DocType,
+		Version:      version.Version,
+		FileURL:      version.FileURL,
+		FileName:     version.FileName,
+		Size:         version.Size,
+		Checksum:     version.Checksum,
+		UploadedBy:   version.UploadedBy,
+		Note:         version.Note,
+		CreatedAt:    version.CreatedAt,
+	}
+}
@@ -0,0 +1,15 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"fmt"
+)
+
+func FileToResponse(file *entity.File) *model.FileResponse {
+	return &model.FileResponse{
+		ID:       file.ID,
+		CourseID: file.CourseID,
+		URL:      fmt.Sprintf("/files/%d", file.ID),
+	}
+}
@@ -0,0 +1,22 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+)
+
+func GitRepositoryToResponse(repository *entity.GitRepository, cloneURL, submitBranch string) *model.GitRepositoryResponse {
+	return &model.GitRepositoryResponse{
+		ID:           repository.ID,
+		CourseID:     repository.CourseID,
+		AssignmentID: repository.AssignmentID,
+		UserID:       repository.UserID,
+		CloneURL:     cloneURL,
+		SubmitBranch: submitBranch,
+		PrNumber:     repository.ID,
+		SubmitSHA:    repository.SubmitSHA,
+		SubmittedAt:  repository.SubmittedAt,
+		CreatedAt:    repository.CreatedAt,
+		UpdatedAt:    repository.UpdatedAt,
+	}
+}
@@ -0,0 +1,91 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/model"
+	"strings"
+)
+
+// GitLabMergeRequestToPullRequest maps a merge request onto the GitHub pull
+// request shape. The IID, the number shown in GitLab's UI, is the PR number.
+func GitLabMergeRequestToPullRequest(mr *model.GitLabMergeRequest) *model.GitHubPullRequest {
+	pr := &model.GitHubPullRequest{
+		ID:        int(mr.ID),
+		Number:    mr.IID,
+		Title:     mr.Title,
+		Body:      mr.Description,
+		State:     "open",
+		HTMLURL:   mr.WebURL,
+		Draft:     mr.Draft,
+		MergedAt:  mr.MergedAt,
+		CreatedAt: mr.CreatedAt,
+		UpdatedAt: mr.UpdatedAt,
+	}
+	switch mr.State {
+	case "closed", "locked":
+		pr.State = "closed"
+	case "merged":
+		pr.State = "closed"
+		// Merge requests merged before GitLab recorded merged_at lack it
+		if pr.MergedAt == "" {
+			pr.MergedAt = mr.UpdatedAt
+		}
+	}
+	pr.User.Login = mr.Author.Username
+	pr.Head.Ref = mr.SourceBranch
+	pr.Head.SHA = mr.SHA
+	if mr.DiffRefs.HeadSHA != "" {
+		pr.Head.SHA = mr.DiffRefs.HeadSHA
+	}
+	pr.Base.Ref = mr.TargetBranch
+	pr.Base.SHA = mr.DiffRefs.BaseSHA
+	return pr
+}
+
+// GitLabDiffToFile maps one file of a merge request's diff onto a GitHub PR
+// file. GitLab's diff is the same unified hunks GitHub calls the patch.
+func GitLabDiffToFile(diff *model.GitLabDiff) model.GitHubPullRequestFile {
+	file := model.GitHubPullRequestFile{
+		Filename: diff.NewPath,
+		Status:   "modified",
+		Patch:    diff.Diff,
+	}
+	switch {
+	case diff.NewFile:
+		file.Status = "added"
+	case diff.DeletedFile:
+		file.Status = "removed"
+	case diff.RenamedFile:
+		file.Status = "renamed"
+		file.PreviousFilename = diff.OldPath
+	}
+	for _, line := range strings.Split(diff.Diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			file.Additions++
+		case strings.HasPrefix(line, "-"):
+			file.Deletions++
+		}
+	}
+	file.Changes = file.Additions + file.Deletions
+	return file
+}
+
+// GitLabHookToGitHubHook describes a project hook in the GitHub hook shape
+func GitLabHookToGitHubHook(hook *model.GitLabHook) *model.GitHubHook {
+	events := make([]string, 0, 3)
+	if hook.MergeRequestsEvents {
+		events = append(events, "merge_requests")
+	}
+	if hook.NoteEvents {
+		events = append(events, "note")
+	}
+	if hook.PushEvents {
+		events = append(events, "push")
+	}
+	return &model.GitHubHook{
+		ID:     hook.ID,
+		Active: true,
+		Events: events,
+		Config: model.GitHubHookConfig{URL: hook.URL, ContentType: "json"},
+	}
+}
@@ -0,0 +1,42 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+)
+
+func PrCommandToResponse(command *entity.PrCommand) *model.PrCommandResponse {
+	return &model.PrCommandResponse{
+		ID:          command.ID,
+		CourseID:    command.CourseID,
+		PrNumber:    command.PrNumber,
+		CommentKey:  command.CommentKey,
+		ThreadID:    command.ThreadID,
+		File:        command.File,
+		AuthorLogin: command.AuthorLogin,
+		AuthorRole:  command.AuthorRole,
+		Command:     command.Command,
+		Args:        command.Args,
+		Status:      command.Status,
+		Result:      command.Result,
+		Error:       command.Error,
+		StartedAt:   command.StartedAt,
+		FinishedAt:  command.FinishedAt,
+		CreatedAt:   command.CreatedAt,
+		UpdatedAt:   command.UpdatedAt,
+	}
+}
+
+func PrCommandToEntity(request *model.PrCommandCreateRequest) *entity.PrCommand {
+	return &entity.PrCommand{
+		CourseID:    request.CourseID,
+		PrNumber:    request.PrNumber,
+		CommentKey:  request.CommentKey,
+		ThreadID:    request.ThreadID,
+		File:        request.File,
+		AuthorLogin: request.AuthorLogin,
+		AuthorRole:  request.AuthorRole,
+		Command:     request.Command,
+		Args:        request.Args,
+	}
+}
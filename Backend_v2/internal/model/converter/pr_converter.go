@@ -19,6 +19,13 @@ func PrToResponse(pr *entity.Pr) *model.PrResponse {
 		Status:        pr.Status,
 		Result:        pr.Result,
 		StatusGrade:   pr.StatusGrade,
+		AuthorLogin:   pr.AuthorLogin,
+		HeadRef:       pr.HeadRef,
+		HeadRepo:      pr.HeadRepo,
+		BaseRef:       pr.BaseRef,
+		HeadSHA:       pr.HeadSHA,
+		Draft:         pr.Draft,
+		MergedAt:      pr.MergedAt,
 		CreatedAt:     pr.CreatedAt,
 		UpdatedAt:     pr.UpdatedAt,
 	}
@@ -35,6 +42,13 @@ func PrToEntity(request *model.PrCreateRequest) *entity.Pr {
 		Status:        request.Status,
 		Result:        request.Result,
 		StatusGrade:   request.StatusGrade,
+		AuthorLogin:   request.AuthorLogin,
+		HeadRef:       request.HeadRef,
+		HeadRepo:      request.HeadRepo,
+		BaseRef:       request.BaseRef,
+		HeadSHA:       request.HeadSHA,
+		Draft:         request.Draft,
+		MergedAt:      request.MergedAt,
 		CreatedAt:     request.CreatedAt,
 		UpdatedAt:     request.UpdatedAt,
 	}
@@ -60,3 +74,32 @@ func RequestToPrRequest(r *http.Request) *model.PrCreateRequest {
 		UpdatedAt:     updatedAt,
 	}
 }
+
+// GitHubPullRequestToPrRequest maps a pull request from the GitHub API. The
+// status is open, closed or merged, as the webhook relay reports it.
+func GitHubPullRequestToPrRequest(courseID int, pr *model.GitHubPullRequest) *model.PrCreateRequest {
+	createdAt, _ := time.Parse(time.RFC3339, pr.CreatedAt)
+	updatedAt, _ := time.Parse(time.RFC3339, pr.UpdatedAt)
+	status := pr.State
+	var mergedAt *time.Time
+	if t, err := time.Parse(time.RFC3339, pr.MergedAt); err == nil {
+		mergedAt = &t
+		status = "merged"
+	}
+	return &model.PrCreateRequest{
+		CourseID:      courseID,
+		PrName:        pr.Title,
+		PrDescription: pr.Body,
+		PrNumber:      pr.Number,
+		Status:        status,
+		AuthorLogin:   pr.User.Login,
+		HeadRef:       pr.Head.Ref,
+		HeadRepo:      pr.Head.Repo.FullName,
+		BaseRef:       pr.Base.Ref,
+		HeadSHA:       pr.Head.SHA,
+		Draft:         pr.Draft,
+		MergedAt:      mergedAt,
+		CreatedAt:     createdAt,
+		UpdatedAt:     updatedAt,
+	}
+}
@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+)
+
+func TestRunToResponse(run *entity.TestRun) *model.TestRunResponse {
+	return &model.TestRunResponse{
+		ID:           run.ID,
+		CourseID:     run.CourseID,
+		AssignmentID: run.AssignmentID,
+		PrID:         run.PrID,
+		CommitSHA:    run.CommitSHA,
+		Status:       run.Status,
+		Passed:       run.Passed,
+		Failed:       run.Failed,
+		Total:        run.Total,
+		Results:      TestCaseResultsFromJSON(run.Results),
+		Log:          run.Log,
+		StartedAt:    run.StartedAt,
+		FinishedAt:   run.FinishedAt,
+		CreatedAt:    run.CreatedAt,
+		UpdatedAt:    run.UpdatedAt,
+	}
+}
+
+func TestCaseResultsToJSON(results []model.TestCaseResult) entity.JSON {
+	out := make(entity.JSON, 0, len(results))
+	for _, r := range results {
+		out = append(out, map[string]interface{}{
+			"name":     r.Name,
+			"suite":    r.Suite,
+			"passed":   r.Passed,
+			"duration": r.Duration,
+			"message":  r.Message,
+		})
+	}
+	return out
+}
+
+func TestCaseResultsFromJSON(results entity.JSON) []model.TestCaseResult {
+	out := make([]model.TestCaseResult, 0, len(results))
+	for _, r := range results {
+		name, _ := r["name"].(string)
+		suite, _ := r["suite"].(string)
+		passed, _ := r["passed"].(bool)
+		duration, _ := r["duration"].(float64)
+		message, _ := r["message"].(string)
+		out = append(out, model.TestCaseResult{
+			Name:     name,
+			Suite:    suite,
+			Passed:   passed,
+			Duration: duration,
+			Message:  message,
+		})
+	}
+	return out
+}
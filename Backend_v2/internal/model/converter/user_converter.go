@@ -11,6 +11,7 @@ func UserToResponse(user *entity.User) *model.UserResponse {
 		Email:       user.Email,
 		Role:        user.Role,
 		GithubToken: user.GithubToken,
+		GithubLogin: user.GithubLogin,
 		CreatedAt:   user.CreatedAt,
 		UpdatedAt:   user.UpdatedAt,
 	}
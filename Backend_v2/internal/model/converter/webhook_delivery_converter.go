@@ -0,0 +1,24 @@
+package converter
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+)
+
+func WebhookDeliveryToResponse(delivery *entity.WebhookDelivery) *model.WebhookDeliveryResponse {
+	return &model.WebhookDeliveryResponse{
+		ID:          delivery.ID,
+		DeliveryID:  delivery.DeliveryID,
+		Provider:    delivery.Provider,
+		Event:       delivery.Event,
+		Action:      delivery.Action,
+		Repository:  delivery.Repository,
+		Status:      delivery.Status,
+		Result:      delivery.Result,
+		Error:       delivery.Error,
+		Attempts:    delivery.Attempts,
+		ProcessedAt: delivery.ProcessedAt,
+		CreatedAt:   delivery.CreatedAt,
+		UpdatedAt:   delivery.UpdatedAt,
+	}
+}
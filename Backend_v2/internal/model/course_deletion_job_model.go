@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+type CourseDeletionJobResponse struct {
+	ID          int            `json:"id"`
+	CourseID    int            `json:"course_id"`
+	CourseName  string         `json:"course_name"`
+	RequestedBy int            `json:"requested_by"`
+	Status      string         `json:"status"`
+	Removed     map[string]int `json:"removed"`
+	Error       string         `json:"error,omitempty"`
+	StartedAt   *time.Time     `json:"started_at,omitempty"`
+	FinishedAt  *time.Time     `json:"finished_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// CourseLabelResponse is the label a course puts on PRs for one kind. For the
+// "assignment" kind the name is a prefix the assignment name is added to.
+type CourseLabelResponse struct {
+	CourseID int    `json:"course_id"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	// Custom is false for kinds still using the default name and colour
+	Custom bool `json:"custom"`
+}
+
+type CourseLabelUpdateRequest struct {
+	CourseID int    `json:"course_id"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+}
@@ -2,17 +2,36 @@ package model
 
 import "time"
 
+// DefaultPassScore is the pass mark of courses that do not set one
+const DefaultPassScore = 50
+
+// DefaultBotHandle is the handle comments mention the bot with, as "@bot", in
+// courses that do not set their own
+const DefaultBotHandle = "bot"
+
 type CourseResponse struct {
-	ID            int       `json:"id"`
-	UserID        int       `json:"user_id"`
-	CourseName    string    `json:"course_name"`
-	GithubURL     string    `json:"github_url"`
-	Owner         string    `json:"owner"`
-	RepoName      string    `json:"repo_name"`
-	GeneralAnswer string    `json:"general_answer"`
-	AutoGrade     bool      `json:"auto_grade"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            int        `json:"id"`
+	UserID        int        `json:"user_id"`
+	CourseName    string     `json:"course_name"`
+	GithubURL     string     `json:"github_url"`
+	Owner         string     `json:"owner"`
+	RepoName      string     `json:"repo_name"`
+	GitProvider   string     `json:"git_provider"`
+	GeneralAnswer string     `json:"general_answer"`
+	AutoGrade     bool       `json:"auto_grade"`
+	PassScore     int        `json:"pass_score"`
+	BotHandle     string     `json:"bot_handle"`
+	Archived      bool       `json:"archived"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	PrSyncedAt    *time.Time `json:"pr_synced_at,omitempty"`
+	LastSyncAt    *time.Time `json:"last_sync_at,omitempty"`
+	// LastSyncStatus is "ok" or "failed", with a summary or the error in
+	// LastSyncMessage
+	LastSyncStatus  string    `json:"last_sync_status,omitempty"`
+	LastSyncMessage string    `json:"last_sync_message,omitempty"`
+	WebhookID       int64     `json:"webhook_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 type CourseCreateRequest struct {
@@ -21,8 +40,11 @@ type CourseCreateRequest struct {
 	GithubURL     string    `json:"github_url"`
 	Owner         string    `json:"owner"`
 	RepoName      string    `json:"repo_name"`
+	GitProvider   string    `json:"git_provider"`
 	GeneralAnswer string    `json:"general_answer"`
 	AutoGrade     bool      `json:"auto_grade"`
+	PassScore     int       `json:"pass_score"`
+	BotHandle     string    `json:"bot_handle"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
@@ -34,8 +56,26 @@ type CourseUpdateRequest struct {
 	GithubURL     string    `json:"github_url"`
 	Owner         string    `json:"owner"`
 	RepoName      string    `json:"repo_name"`
+	GitProvider   string    `json:"git_provider"`
 	GeneralAnswer string    `json:"general_answer"`
 	AutoGrade     bool      `json:"auto_grade"`
+	PassScore     int       `json:"pass_score"`
+	BotHandle     string    `json:"bot_handle"`
 	UpdatedAt     time.Time `json:"updated_at"`
 	CreatedAt     time.Time `json:"created_at"`
 }
+
+type CourseCloneRequest struct {
+	UserID          int    `json:"user_id"`
+	CourseName      string `json:"course_name"`
+	GithubURL       string `json:"github_url"`
+	GitProvider     string `json:"git_provider"`
+	CopyPermissions bool   `json:"copy_permissions"`
+}
+
+type CourseCloneResponse struct {
+	Course      *CourseResponse       `json:"course"`
+	Assignments []*AssignmentResponse `json:"assignments"`
+	CopiedFiles int                   `json:"copied_files"`
+	Permissions int                   `json:"permissions"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type DocumentVersionResponse struct {
+	ID           int       `json:"id"`
+	CourseID     int       `json:"course_id"`
+	AssignmentID int       `json:"assignment_id"`
+	DocType      string    `json:"doc_type"`
+	Version      int       `json:"version"`
+	FileURL      string    `json:"file_url"`
+	FileName     string    `json:"file_name"`
+	Size         int64     `json:"size"`
+	Checksum     string    `json:"checksum"`
+	UploadedBy   int       `json:"uploaded_by"`
+	Note         string    `json:"note"`
+	Current      bool      `json:"current"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type DocumentUploadRequest struct {
+	CourseID     int
+	AssignmentID int
+	DocType      string
+	FileName     string
+	Content      []byte
+	// Files holds a folder upload; an archive in Content is unpacked into it
+	Files      []DocumentFile
+	UploadedBy int
+	Note       string
+}
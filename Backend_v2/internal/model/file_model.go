@@ -0,0 +1,7 @@
+package model
+
+type FileResponse struct {
+	ID       int    `json:"id"`
+	CourseID int    `json:"course_id"`
+	URL      string `json:"url"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+type GitRepositoryResponse struct {
+	ID           int        `json:"id"`
+	CourseID     int        `json:"course_id"`
+	AssignmentID int        `json:"assignment_id"`
+	UserID       int        `json:"user_id"`
+	CloneURL     string     `json:"clone_url"`
+	SubmitBranch string     `json:"submit_branch"`
+	PrNumber     int        `json:"pr_number"`
+	SubmitSHA    string     `json:"submit_sha,omitempty"`
+	SubmittedAt  *time.Time `json:"submitted_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,122 @@
+package model
+
+// Webhook payloads as GitHub sends them, named after the X-GitHub-Event header.
+// Only the fields we act on are decoded.
+
+type GitHubWebhookRepository struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	HTMLURL  string `json:"html_url"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+type GitHubWebhookUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Type  string `json:"type"`
+}
+
+// GitHubComment is an issue comment, a review comment or a review body
+type GitHubComment struct {
+	ID                int64             `json:"id"`
+	Body              string            `json:"body"`
+	User              GitHubWebhookUser `json:"user"`
+	AuthorAssociation string            `json:"author_association"`
+	Path              string            `json:"path"`
+	CommitID          string            `json:"commit_id"`
+	Position          *int              `json:"position"`
+	Line              *int              `json:"line"`
+	Side              string            `json:"side"`
+	InReplyToID       int64             `json:"in_reply_to_id"`
+	HTMLURL           string            `json:"html_url"`
+	CreatedAt         string            `json:"created_at"`
+	UpdatedAt         string            `json:"updated_at"`
+	SubmittedAt       string            `json:"submitted_at"`
+}
+
+type PullRequestEvent struct {
+	Action      string                  `json:"action"`
+	Number      int                     `json:"number"`
+	PullRequest GitHubPullRequest       `json:"pull_request"`
+	Repository  GitHubWebhookRepository `json:"repository"`
+	Sender      GitHubWebhookUser       `json:"sender"`
+}
+
+type IssueCommentEvent struct {
+	Action string `json:"action"`
+	Issue  struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		// PullRequest is only present when the issue is a pull request
+		PullRequest *struct {
+			URL string `json:"url"`
+		} `json:"pull_request"`
+	} `json:"issue"`
+	Comment    GitHubComment           `json:"comment"`
+	Repository GitHubWebhookRepository `json:"repository"`
+	Sender     GitHubWebhookUser       `json:"sender"`
+}
+
+type PullRequestReviewEvent struct {
+	Action string `json:"action"`
+	Review struct {
+		ID                int64             `json:"id"`
+		Body              string            `json:"body"`
+		State             string            `json:"state"`
+		User              GitHubWebhookUser `json:"user"`
+		AuthorAssociation string            `json:"author_association"`
+		CommitID          string            `json:"commit_id"`
+		SubmittedAt       string            `json:"submitted_at"`
+	} `json:"review"`
+	PullRequest GitHubPullRequest       `json:"pull_request"`
+	Repository  GitHubWebhookRepository `json:"repository"`
+	Sender      GitHubWebhookUser       `json:"sender"`
+}
+
+type PullRequestReviewCommentEvent struct {
+	Action      string                  `json:"action"`
+	Comment     GitHubComment           `json:"comment"`
+	PullRequest GitHubPullRequest       `json:"pull_request"`
+	Repository  GitHubWebhookRepository `json:"repository"`
+	Sender      GitHubWebhookUser       `json:"sender"`
+}
+
+// PullRequestReviewThreadEvent reports a review thread being resolved or unresolved
+type PullRequestReviewThreadEvent struct {
+	Action string `json:"action"`
+	Thread struct {
+		NodeID   string          `json:"node_id"`
+		Comments []GitHubComment `json:"comments"`
+	} `json:"thread"`
+	PullRequest GitHubPullRequest       `json:"pull_request"`
+	Repository  GitHubWebhookRepository `json:"repository"`
+	Sender      GitHubWebhookUser       `json:"sender"`
+}
+
+type PushEvent struct {
+	Ref     string `json:"ref"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Created bool   `json:"created"`
+	Deleted bool   `json:"deleted"`
+	Forced  bool   `json:"forced"`
+	Commits []struct {
+		ID        string `json:"id"`
+		Message   string `json:"message"`
+		Timestamp string `json:"timestamp"`
+		Author    struct {
+			Name     string `json:"name"`
+			Email    string `json:"email"`
+			Username string `json:"username"`
+		} `json:"author"`
+	} `json:"commits"`
+	Pusher struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"pusher"`
+	Repository GitHubWebhookRepository `json:"repository"`
+	Sender     GitHubWebhookUser       `json:"sender"`
+}
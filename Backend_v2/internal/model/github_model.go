@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type GitHubPullRequest struct {
 	ID      int    `json:"id"`
 	Number  int    `json:"number"`
@@ -11,12 +13,102 @@ type GitHubPullRequest struct {
 		Login string `json:"login"`
 	} `json:"user"`
 	Head struct {
+		Ref string `json:"ref"`
 		SHA string `json:"sha"`
+		// Repo is the fork the PR comes from, or the base repository
+		Repo struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
 	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"base"`
+	Draft     bool   `json:"draft"`
+	MergedAt  string `json:"merged_at"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
 }
 
+type GitHubPullRequestFile struct {
+	SHA              string `json:"sha"`
+	Filename         string `json:"filename"`
+	Status           string `json:"status"`
+	Additions        int    `json:"additions"`
+	Deletions        int    `json:"deletions"`
+	Changes          int    `json:"changes"`
+	Patch            string `json:"patch"`
+	PreviousFilename string `json:"previous_filename,omitempty"`
+}
+
+type GitHubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+type GitHubCredentialResponse struct {
+	CourseID   int    `json:"course_id"`
+	Source     string `json:"source"`
+	Token      string `json:"token"`
+	Repository string `json:"repository,omitempty"`
+}
+
+// GitHubHook is a repository webhook
+type GitHubHook struct {
+	ID           int64                  `json:"id"`
+	Active       bool                   `json:"active"`
+	Events       []string               `json:"events"`
+	Config       GitHubHookConfig       `json:"config"`
+	LastResponse GitHubHookLastResponse `json:"last_response"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+type GitHubHookConfig struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	InsecureSSL string `json:"insecure_ssl,omitempty"`
+	Secret      string `json:"secret,omitempty"`
+}
+
+type GitHubHookLastResponse struct {
+	Code    *int   `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// GitHubHookRequest creates or edits a repository webhook
+type GitHubHookRequest struct {
+	Name   string           `json:"name,omitempty"`
+	Active bool             `json:"active"`
+	Events []string         `json:"events"`
+	Config GitHubHookConfig `json:"config"`
+}
+
+type GitHubHookDelivery struct {
+	ID          int64     `json:"id"`
+	GUID        string    `json:"guid"`
+	DeliveredAt time.Time `json:"delivered_at"`
+	Redelivery  bool      `json:"redelivery"`
+	Duration    float64   `json:"duration"`
+	Status      string    `json:"status"`
+	StatusCode  int       `json:"status_code"`
+	Event       string    `json:"event"`
+	Action      string    `json:"action"`
+}
+
+// WebhookHealthResponse describes the course's webhook as GitHub sees it
+type WebhookHealthResponse struct {
+	CourseID     int                    `json:"course_id"`
+	WebhookID    int64                  `json:"webhook_id"`
+	URL          string                 `json:"url"`
+	Active       bool                   `json:"active"`
+	Events       []string               `json:"events"`
+	Healthy      bool                   `json:"healthy"`
+	LastResponse GitHubHookLastResponse `json:"last_response"`
+	LastDelivery *GitHubHookDelivery    `json:"last_delivery,omitempty"`
+	Deliveries   []GitHubHookDelivery   `json:"deliveries"`
+}
+
 type GitHubRepository struct {
 	FullName string `json:"full_name"`
 	HTMLURL  string `json:"html_url"`
@@ -29,9 +121,20 @@ type FetchPullRequestsRequest struct {
 }
 
 type FetchPullRequestsResponse struct {
-	Message           string `json:"message"`
-	PullRequestsCount int    `json:"pull_requests_count"`
-	CourseID          int    `json:"course_id"`
+	Message           string     `json:"message"`
+	PullRequestsCount int        `json:"pull_requests_count"`
+	CourseID          int        `json:"course_id"`
+	Since             *time.Time `json:"since,omitempty"`
+	SyncedAt          *time.Time `json:"synced_at,omitempty"`
+	// What the sync changed, by PR
+	New      int `json:"new"`
+	Updated  int `json:"updated"`
+	Closed   int `json:"closed"`
+	Merged   int `json:"merged"`
+	Comments int `json:"comments"`
+	Failed   int `json:"failed"`
+	// NeedsGrading counts new PRs and open PRs with new commits
+	NeedsGrading int `json:"needs_grading"`
 }
 
 // For posting a review to GitHub
@@ -49,3 +152,55 @@ type GitHubReviewRequest struct {
 	Event    string         `json:"event"`
 	Comments []AgentComment `json:"comments"`
 }
+
+// For reporting a grading run on a commit
+// https://docs.github.com/en/rest/checks/runs?apiVersion=2022-11-28
+
+type GitHubCheckRunRequest struct {
+	Name        string                `json:"name,omitempty"`
+	HeadSHA     string                `json:"head_sha,omitempty"`
+	Status      string                `json:"status,omitempty"`
+	Conclusion  string                `json:"conclusion,omitempty"`
+	ExternalID  string                `json:"external_id,omitempty"`
+	StartedAt   *time.Time            `json:"started_at,omitempty"`
+	CompletedAt *time.Time            `json:"completed_at,omitempty"`
+	Output      *GitHubCheckRunOutput `json:"output,omitempty"`
+}
+
+type GitHubCheckRunOutput struct {
+	Title       string                     `json:"title"`
+	Summary     string                     `json:"summary"`
+	Annotations []GitHubCheckRunAnnotation `json:"annotations,omitempty"`
+}
+
+type GitHubCheckRunAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Title           string `json:"title,omitempty"`
+	Message         string `json:"message"`
+}
+
+type GitHubCheckRun struct {
+	ID         int64  `json:"id"`
+	HeadSHA    string `json:"head_sha"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	HTMLURL    string `json:"html_url"`
+}
+
+// GitHubCommitStatusRequest sets a commit status, the fallback for tokens
+// that may not create check runs
+type GitHubCommitStatusRequest struct {
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+	Context     string `json:"context"`
+	TargetURL   string `json:"target_url,omitempty"`
+}
+
+type GitHubLabel struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description,omitempty"`
+}
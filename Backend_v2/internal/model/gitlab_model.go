@@ -0,0 +1,124 @@
+package model
+
+// GitLab REST v4 resources and webhook payloads. Only the fields we act on are
+// decoded; merge requests are converted to the GitHub shapes used elsewhere.
+
+type GitLabUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type GitLabDiffRefs struct {
+	BaseSHA  string `json:"base_sha"`
+	HeadSHA  string `json:"head_sha"`
+	StartSHA string `json:"start_sha"`
+}
+
+type GitLabMergeRequest struct {
+	ID           int64          `json:"id"`
+	IID          int            `json:"iid"`
+	Title        string         `json:"title"`
+	Description  string         `json:"description"`
+	State        string         `json:"state"`
+	WebURL       string         `json:"web_url"`
+	Author       GitLabUser     `json:"author"`
+	SourceBranch string         `json:"source_branch"`
+	TargetBranch string         `json:"target_branch"`
+	SHA          string         `json:"sha"`
+	Draft        bool           `json:"draft"`
+	DiffRefs     GitLabDiffRefs `json:"diff_refs"`
+	MergedAt     string         `json:"merged_at"`
+	CreatedAt    string         `json:"created_at"`
+	UpdatedAt    string         `json:"updated_at"`
+}
+
+type GitLabDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	Diff        string `json:"diff"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
+}
+
+type GitLabProject struct {
+	ID                int64  `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+// GitLabPosition anchors a discussion to a line of a merge request's diff
+type GitLabPosition struct {
+	PositionType string `json:"position_type"`
+	BaseSHA      string `json:"base_sha"`
+	StartSHA     string `json:"start_sha"`
+	HeadSHA      string `json:"head_sha"`
+	OldPath      string `json:"old_path"`
+	NewPath      string `json:"new_path"`
+	OldLine      int    `json:"old_line,omitempty"`
+	NewLine      int    `json:"new_line,omitempty"`
+}
+
+type GitLabHook struct {
+	ID                    int64  `json:"id"`
+	URL                   string `json:"url"`
+	MergeRequestsEvents   bool   `json:"merge_requests_events"`
+	NoteEvents            bool   `json:"note_events"`
+	PushEvents            bool   `json:"push_events"`
+	EnableSSLVerification bool   `json:"enable_ssl_verification"`
+	CreatedAt             string `json:"created_at"`
+}
+
+// GitLabHookRequest creates or edits a project hook. GitLab sends Token back
+// in the X-Gitlab-Token header of every delivery.
+type GitLabHookRequest struct {
+	URL                   string `json:"url"`
+	Token                 string `json:"token,omitempty"`
+	MergeRequestsEvents   bool   `json:"merge_requests_events"`
+	NoteEvents            bool   `json:"note_events"`
+	PushEvents            bool   `json:"push_events"`
+	EnableSSLVerification bool   `json:"enable_ssl_verification"`
+}
+
+// GitLabMergeRequestEvent is the "Merge Request Hook" payload
+type GitLabMergeRequestEvent struct {
+	ObjectKind       string        `json:"object_kind"`
+	User             GitLabUser    `json:"user"`
+	Project          GitLabProject `json:"project"`
+	ObjectAttributes struct {
+		IID          int    `json:"iid"`
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		State        string `json:"state"`
+		Action       string `json:"action"`
+		URL          string `json:"url"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		Draft        bool   `json:"draft"`
+		// OldRev is set on updates that pushed new commits
+		OldRev     string `json:"oldrev"`
+		LastCommit struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+		CreatedAt string `json:"created_at"`
+		UpdatedAt string `json:"updated_at"`
+	} `json:"object_attributes"`
+}
+
+// GitLabNoteEvent is the "Note Hook" payload of a comment
+type GitLabNoteEvent struct {
+	ObjectKind       string        `json:"object_kind"`
+	User             GitLabUser    `json:"user"`
+	Project          GitLabProject `json:"project"`
+	ObjectAttributes struct {
+		ID           int64           `json:"id"`
+		Note         string          `json:"note"`
+		NoteableType string          `json:"noteable_type"`
+		DiscussionID string          `json:"discussion_id"`
+		Position     *GitLabPosition `json:"position"`
+		System       bool            `json:"system"`
+	} `json:"object_attributes"`
+	MergeRequest *struct {
+		IID int `json:"iid"`
+	} `json:"merge_request"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+type PrCommandResponse struct {
+	ID          int        `json:"id"`
+	CourseID    int        `json:"course_id"`
+	PrNumber    int        `json:"pr_number"`
+	CommentKey  string     `json:"comment_key"`
+	ThreadID    string     `json:"thread_id,omitempty"`
+	File        string     `json:"file,omitempty"`
+	AuthorLogin string     `json:"author_login"`
+	AuthorRole  string     `json:"author_role"`
+	Command     string     `json:"command"`
+	Args        string     `json:"args,omitempty"`
+	Status      string     `json:"status"`
+	Result      string     `json:"result,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type PrCommandCreateRequest struct {
+	CourseID    int    `json:"course_id"`
+	PrNumber    int    `json:"pr_number"`
+	CommentKey  string `json:"comment_key"`
+	ThreadID    string `json:"thread_id"`
+	File        string `json:"file"`
+	AuthorLogin string `json:"author_login"`
+	AuthorRole  string `json:"author_role"`
+	Command     string `json:"command"`
+	Args        string `json:"args"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// PrDiff is the cached snapshot of a pull request's changed files at one head SHA
+type PrDiff struct {
+	CourseID  int                     `json:"course_id"`
+	PrNumber  int                     `json:"pr_number"`
+	HeadSHA   string                  `json:"head_sha"`
+	BaseSHA   string                  `json:"base_sha"`
+	Files     []GitHubPullRequestFile `json:"files"`
+	FetchedAt time.Time               `json:"fetched_at"`
+}
+
+// PrFileSnapshot is the content of one file at a given commit
+type PrFileSnapshot struct {
+	Path    string `json:"path"`
+	SHA     string `json:"sha"`
+	Content string `json:"content"`
+}
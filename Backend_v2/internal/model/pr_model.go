@@ -3,31 +3,45 @@ package model
 import "time"
 
 type PrCreateRequest struct {
-	ID            int       `json:"id"`
-	CourseID      int       `json:"course_id"`
-	AssignmentID  int       `json:"assignment_id"`
-	PrName        string    `json:"pr_name"`
-	PrDescription string    `json:"pr_description"`
-	Status        string    `json:"status"`
-	PrNumber      int       `json:"pr_number"`
-	Result        string    `json:"result"`
-	StatusGrade   string    `json:"status_grade"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            int        `json:"id"`
+	CourseID      int        `json:"course_id"`
+	AssignmentID  int        `json:"assignment_id"`
+	PrName        string     `json:"pr_name"`
+	PrDescription string     `json:"pr_description"`
+	Status        string     `json:"status"`
+	PrNumber      int        `json:"pr_number"`
+	Result        string     `json:"result"`
+	StatusGrade   string     `json:"status_grade"`
+	AuthorLogin   string     `json:"author_login"`
+	HeadRef       string     `json:"head_ref"`
+	HeadRepo      string     `json:"head_repo"`
+	BaseRef       string     `json:"base_ref"`
+	HeadSHA       string     `json:"head_sha"`
+	Draft         bool       `json:"draft"`
+	MergedAt      *time.Time `json:"merged_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 type PrResponse struct {
-	ID            int       `json:"id"`
-	CourseID      int       `json:"course_id"`
-	AssignmentID  int       `json:"assignment_id"`
-	PrName        string    `json:"pr_name"`
-	PrDescription string    `json:"pr_description"`
-	Status        string    `json:"status"`
-	PrNumber      int       `json:"pr_number"`
-	Result        string    `json:"result"`
-	StatusGrade   string    `json:"status_grade"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            int        `json:"id"`
+	CourseID      int        `json:"course_id"`
+	AssignmentID  int        `json:"assignment_id"`
+	PrName        string     `json:"pr_name"`
+	PrDescription string     `json:"pr_description"`
+	Status        string     `json:"status"`
+	PrNumber      int        `json:"pr_number"`
+	Result        string     `json:"result"`
+	StatusGrade   string     `json:"status_grade"`
+	AuthorLogin   string     `json:"author_login"`
+	HeadRef       string     `json:"head_ref"`
+	HeadRepo      string     `json:"head_repo"`
+	BaseRef       string     `json:"base_ref"`
+	HeadSHA       string     `json:"head_sha"`
+	Draft         bool       `json:"draft"`
+	MergedAt      *time.Time `json:"merged_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 type AgentRequest struct {
@@ -43,6 +57,18 @@ type AgentRequest struct {
 type AgentResponse struct {
 	Summary  string                 `json:"summary"`
 	Comments []AgentResponseComment `json:"comments"`
+	// Score is the agent's 0-100 grade and Rubric its breakdown, when the
+	// agent reports them
+	Score  *float64          `json:"score,omitempty"`
+	Rubric []AgentRubricItem `json:"rubric,omitempty"`
+}
+
+// AgentRubricItem is the agent's mark for one grading criterion
+type AgentRubricItem struct {
+	Criterion string  `json:"criterion"`
+	Score     float64 `json:"score"`
+	MaxScore  float64 `json:"max_score"`
+	Comment   string  `json:"comment,omitempty"`
 }
 
 type AgentResponseComment struct {
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// ReferenceManifest lists the files of a reference answer uploaded as a folder
+// or archive. It is stored next to the files as manifest.json.
+type ReferenceManifest struct {
+	AssignmentID int             `json:"assignment_id"`
+	Version      int             `json:"version"`
+	FileName     string          `json:"file_name"`
+	Files        []ReferenceFile `json:"files"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+type ReferenceFile struct {
+	Path        string `json:"path"`
+	FileURL     string `json:"file_url,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Checksum    string `json:"checksum"`
+}
+
+// DocumentFile is one file of a multi-file document upload
+type DocumentFile struct {
+	Path string
+	Data []byte
+}
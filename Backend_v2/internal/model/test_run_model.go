@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+type TestRunResponse struct {
+	ID           int              `json:"id"`
+	CourseID     int              `json:"course_id"`
+	AssignmentID int              `json:"assignment_id"`
+	PrID         int              `json:"pr_id"`
+	CommitSHA    string           `json:"commit_sha"`
+	Status       string           `json:"status"`
+	Passed       int              `json:"passed"`
+	Failed       int              `json:"failed"`
+	Total        int              `json:"total"`
+	Results      []TestCaseResult `json:"results"`
+	Log          string           `json:"log"`
+	StartedAt    *time.Time       `json:"started_at"`
+	FinishedAt   *time.Time       `json:"finished_at"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// TestCaseResult is the outcome of a single hidden test
+type TestCaseResult struct {
+	Name     string  `json:"name"`
+	Suite    string  `json:"suite"`
+	Passed   bool    `json:"passed"`
+	Duration float64 `json:"duration"`
+	Message  string  `json:"message"`
+}
+
+// TestRunRequest describes what the sandbox should check out and run
+type TestRunRequest struct {
+	CourseID     int
+	AssignmentID int
+	PrID         int
+	RepoOwner    string
+	RepoName     string
+	// RepoURL and GitProvider locate repositories outside github.com
+	RepoURL        string
+	GitProvider    string
+	PrNumber       int
+	GithubToken    string
+	TestBundleURL  string
+	TestCommand    string
+	TestReportPath string
+}
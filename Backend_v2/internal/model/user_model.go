@@ -7,6 +7,7 @@ type UserResponse struct {
 	Email       string    `json:"email"`
 	Role        string    `json:"role"`
 	GithubToken string    `json:"github_token,omitempty"`
+	GithubLogin string    `json:"github_login"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Locked      bool      `json:"locked"`
@@ -17,6 +18,7 @@ type UserCreateRequest struct {
 	Email        string `json:"email" validate:"required,email"`
 	PasswordHash string `json:"password" validate:"required,min=8"`
 	Role         string `json:"role" validate:"required,oneof=none teacher admin"`
+	GithubLogin  string `json:"github_login"`
 	Locked       bool   `json:"locked"`
 	Deleted      bool   `json:"deleted"`
 }
@@ -27,6 +29,7 @@ type UserUpdateRequest struct {
 	PasswordHash string `json:"password" validate:"omitempty,min=8"`
 	Role         string `json:"role" validate:"omitempty,oneof=none teacher admin"`
 	GithubToken  string `json:"github_token" validate:"omitempty"`
+	GithubLogin  string `json:"github_login" validate:"omitempty"`
 	Locked       bool   `json:"locked"`
 	Deleted      bool   `json:"deleted"`
 }
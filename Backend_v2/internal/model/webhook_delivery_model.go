@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+type WebhookDeliveryResponse struct {
+	ID          int        `json:"id"`
+	DeliveryID  string     `json:"delivery_id"`
+	Provider    string     `json:"provider"`
+	Event       string     `json:"event"`
+	Action      string     `json:"action,omitempty"`
+	Repository  string     `json:"repository"`
+	Status      string     `json:"status"`
+	Result      string     `json:"result,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Attempts    int        `json:"attempts"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type WebhookReplayResponse struct {
+	Replayed   int                        `json:"replayed"`
+	Succeeded  int                        `json:"succeeded"`
+	Failed     int                        `json:"failed"`
+	Deliveries []*WebhookDeliveryResponse `json:"deliveries"`
+}
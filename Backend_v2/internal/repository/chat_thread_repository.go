@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type ChatThreadRepository struct {
+	Repository[entity.ChatThread]
+	Log *logrus.Logger
+}
+
+func NewChatThreadRepository(db *gorm.DB, log *logrus.Logger) *ChatThreadRepository {
+	return &ChatThreadRepository{
+		Repository: Repository[entity.ChatThread]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *ChatThreadRepository) FindByKey(db *gorm.DB, thread *entity.ChatThread, prID int, threadKey string) error {
+	return db.Where("pr_id = ? AND thread_key = ?", prID, threadKey).First(thread).Error
+}
+
+func (r *ChatThreadRepository) FindAllByPr(db *gorm.DB, threads *[]entity.ChatThread, prID int) error {
+	return db.Where("pr_id = ?", prID).Order("id").Find(threads).Error
+}
+
+func (r *ChatThreadRepository) FindAllByCourse(db *gorm.DB, threads *[]entity.ChatThread, courseID int) error {
+	return db.Where("course_id = ?", courseID).Order("id").Find(threads).Error
+}
+
+type ChatMessageRepository struct {
+	Repository[entity.ChatMessage]
+	Log *logrus.Logger
+}
+
+func NewChatMessageRepository(db *gorm.DB, log *logrus.Logger) *ChatMessageRepository {
+	return &ChatMessageRepository{
+		Repository: Repository[entity.ChatMessage]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *ChatMessageRepository) FindByGitHubID(db *gorm.DB, message *entity.ChatMessage, courseID int, githubID string) error {
+	return db.Where("course_id = ? AND github_id = ?", courseID, githubID).First(message).Error
+}
+
+func (r *ChatMessageRepository) FindAllByThread(db *gorm.DB, messages *[]entity.ChatMessage, threadID int) error {
+	return db.Where("thread_id = ?", threadID).Order("created_at, id").Find(messages).Error
+}
+
+func (r *ChatMessageRepository) FindAllByThreads(db *gorm.DB, messages *[]entity.ChatMessage, threadIDs []int) error {
+	return db.Where("thread_id IN ?", threadIDs).Order("created_at, id").Find(messages).Error
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type CourseDeletionJobRepository struct {
+	Repository[entity.CourseDeletionJob]
+	Log *logrus.Logger
+}
+
+func NewCourseDeletionJobRepository(db *gorm.DB, log *logrus.Logger) *CourseDeletionJobRepository {
+	return &CourseDeletionJobRepository{
+		Repository: Repository[entity.CourseDeletionJob]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *CourseDeletionJobRepository) FindAllUnfinished(db *gorm.DB, jobs *[]entity.CourseDeletionJob) error {
+	return db.Where("status IN ?", []string{"pending", "running"}).Order("id").Find(jobs).Error
+}
+
+func (r *CourseDeletionJobRepository) FindActiveByCourse(db *gorm.DB, job *entity.CourseDeletionJob, courseID int) error {
+	return db.Where("course_id = ? AND status IN ?", courseID, []string{"pending", "running"}).First(job).Error
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type CourseLabelRepository struct {
+	Repository[entity.CourseLabel]
+	Log *logrus.Logger
+}
+
+func NewCourseLabelRepository(db *gorm.DB, log *logrus.Logger) *CourseLabelRepository {
+	return &CourseLabelRepository{
+		Repository: Repository[entity.CourseLabel]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *CourseLabelRepository) FindAllByCourse(db *gorm.DB, labels *[]entity.CourseLabel, courseID int) error {
+	return db.Where("course_id = ?", courseID).Find(labels).Error
+}
+
+func (r *CourseLabelRepository) FindByCourseAndKind(db *gorm.DB, label *entity.CourseLabel, courseID int, kind string) error {
+	return db.Where("course_id = ? AND kind = ?", courseID, kind).First(label).Error
+}
@@ -30,7 +30,8 @@ func (r *CourseRepository) FindAllByGithubURL(db *gorm.DB, course *entity.Course
 	// Normalize input URL
 	githubURL = util.NormalizeGithubURL(githubURL)
 	courses := []entity.Course{}
-	err := db.Find(&courses).Error
+	// A repository reused across terms belongs to its active course
+	err := db.Order("archived_at IS NOT NULL, id DESC").Find(&courses).Error
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type DocumentVersionRepository struct {
+	Repository[entity.DocumentVersion]
+	Log *logrus.Logger
+}
+
+func NewDocumentVersionRepository(db *gorm.DB, log *logrus.Logger) *DocumentVersionRepository {
+	return &DocumentVersionRepository{
+		Repository: Repository[entity.DocumentVersion]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *DocumentVersionRepository) FindAllByCourse(db *gorm.DB, versions *[]entity.DocumentVersion, courseID int) error {
+	return db.Where("course_id = ?", courseID).Order("assignment_id, doc_type, version DESC").Find(versions).Error
+}
+
+func (r *DocumentVersionRepository) FindAllByDocument(db *gorm.DB, versions *[]entity.DocumentVersion, courseID, assignmentID int, docType string) error {
+	return db.Where("course_id = ? AND assignment_id = ? AND doc_type = ?", courseID, assignmentID, docType).Order("version DESC").Find(versions).Error
+}
+
+func (r *DocumentVersionRepository) FindLatestVersion(db *gorm.DB, courseID, assignmentID int, docType string) (int, error) {
+	var latest int
+	err := db.Model(&entity.DocumentVersion{}).
+		Where("course_id = ? AND assignment_id = ? AND doc_type = ?", courseID, assignmentID, docType).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error
+	return latest, err
+}
+
+func (r *DocumentVersionRepository) FindByFileURL(db *gorm.DB, version *entity.DocumentVersion, fileURL string) error {
+	return db.Where("file_url = ?", fileURL).Order("version DESC").First(version).Error
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FileRepository struct {
+	Repository[entity.File]
+	Log *logrus.Logger
+}
+
+func NewFileRepository(db *gorm.DB, log *logrus.Logger) *FileRepository {
+	return &FileRepository{
+		Repository: Repository[entity.File]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *FileRepository) FindByFileURL(db *gorm.DB, file *entity.File, fileURL string) error {
+	return db.Where("file_url = ?", fileURL).First(file).Error
+}
+
+// CreateIfMissing inserts file unless its URL is already registered
+func (r *FileRepository) CreateIfMissing(db *gorm.DB, file *entity.File) error {
+	return db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "file_url"}}, DoNothing: true}).Create(file).Error
+}
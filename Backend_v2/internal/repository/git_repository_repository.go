@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type GitRepositoryRepository struct {
+	Repository[entity.GitRepository]
+	Log *logrus.Logger
+}
+
+func NewGitRepositoryRepository(db *gorm.DB, log *logrus.Logger) *GitRepositoryRepository {
+	return &GitRepositoryRepository{
+		Repository: Repository[entity.GitRepository]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *GitRepositoryRepository) FindByAssignmentAndUser(db *gorm.DB, repository *entity.GitRepository, assignmentID int, userID int) error {
+	return db.Where("assignment_id = ? AND user_id = ?", assignmentID, userID).First(repository).Error
+}
+
+// FindSubmittedByCourse returns the course's repositories with a submission
+func (r *GitRepositoryRepository) FindSubmittedByCourse(db *gorm.DB, repositories *[]entity.GitRepository, courseID int) error {
+	return db.Where("course_id = ? AND submit_sha <> ''", courseID).Order("id").Find(repositories).Error
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type PrCommandRepository struct {
+	Repository[entity.PrCommand]
+	Log *logrus.Logger
+}
+
+func NewPrCommandRepository(db *gorm.DB, log *logrus.Logger) *PrCommandRepository {
+	return &PrCommandRepository{
+		Repository: Repository[entity.PrCommand]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *PrCommandRepository) FindByComment(db *gorm.DB, command *entity.PrCommand, courseID int, commentKey string) error {
+	return db.Where("course_id = ? AND comment_key = ?", courseID, commentKey).First(command).Error
+}
+
+func (r *PrCommandRepository) FindAllUnfinished(db *gorm.DB, commands *[]entity.PrCommand) error {
+	return db.Where("status IN ?", []string{"pending", "running"}).Order("id").Find(commands).Error
+}
+
+func (r *PrCommandRepository) FindAllByPr(db *gorm.DB, commands *[]entity.PrCommand, courseID int, prNumber int) error {
+	return db.Where("course_id = ? AND pr_number = ?", courseID, prNumber).Order("id").Find(commands).Error
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type TestRunRepository struct {
+	Repository[entity.TestRun]
+	Log *logrus.Logger
+}
+
+func NewTestRunRepository(db *gorm.DB, log *logrus.Logger) *TestRunRepository {
+	return &TestRunRepository{
+		Repository: Repository[entity.TestRun]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *TestRunRepository) FindAllByPr(db *gorm.DB, runs *[]entity.TestRun, prID int) error {
+	return db.Where("pr_id = ?", prID).Order("created_at DESC").Find(runs).Error
+}
+
+func (r *TestRunRepository) FindLatestByPr(db *gorm.DB, run *entity.TestRun, prID int) error {
+	return db.Where("pr_id = ?", prID).Order("created_at DESC").First(run).Error
+}
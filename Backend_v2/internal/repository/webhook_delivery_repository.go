@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"be/neurade/v2/internal/entity"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type WebhookDeliveryRepository struct {
+	Repository[entity.WebhookDelivery]
+	Log *logrus.Logger
+}
+
+func NewWebhookDeliveryRepository(db *gorm.DB, log *logrus.Logger) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{
+		Repository: Repository[entity.WebhookDelivery]{
+			DB: db,
+		},
+		Log: log,
+	}
+}
+
+func (r *WebhookDeliveryRepository) FindByDeliveryID(db *gorm.DB, delivery *entity.WebhookDelivery, deliveryID string) error {
+	return db.Where("delivery_id = ?", deliveryID).First(delivery).Error
+}
+
+// FindAllByStatus returns the newest deliveries first; an empty status matches all
+func (r *WebhookDeliveryRepository) FindAllByStatus(db *gorm.DB, deliveries *[]entity.WebhookDelivery, status string, limit int) error {
+	query := db.Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return query.Find(deliveries).Error
+}
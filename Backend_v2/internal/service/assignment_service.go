@@ -93,6 +93,10 @@ func (s *AssignmentService) Update(ctx context.Context, request *model.Assignmen
 		AssignmentName: request.AssignmentName,
 		Description:    request.Description,
 		AssignmentURL:  request.AssignmentURL,
+		TestBundleURL:  request.TestBundleURL,
+		TestCommand:    request.TestCommand,
+		TestReportPath: request.TestReportPath,
+		DueDate:        request.DueDate,
 		UpdatedAt:      request.UpdatedAt,
 	}
 
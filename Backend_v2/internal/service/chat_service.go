@@ -6,6 +6,7 @@ import (
 	"be/neurade/v2/internal/model/converter"
 	"be/neurade/v2/internal/repository"
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,180 +14,336 @@ import (
 	"gorm.io/gorm"
 )
 
+// ChatService keeps the comments on PRs as chat threads: one for the PR's
+// conversation and one per review thread, so the chat agent only sees the
+// thread it is asked in
 type ChatService struct {
-	ChatRepository *repository.ChatRepository
-	Log            *logrus.Logger
+	DB                    *gorm.DB
+	ChatRepository        *repository.ChatRepository
+	ChatThreadRepository  *repository.ChatThreadRepository
+	ChatMessageRepository *repository.ChatMessageRepository
+	Log                   *logrus.Logger
 }
 
-func NewChatService(chatRepository *repository.ChatRepository, log *logrus.Logger) *ChatService {
+func NewChatService(db *gorm.DB, chatRepository *repository.ChatRepository, chatThreadRepository *repository.ChatThreadRepository, chatMessageRepository *repository.ChatMessageRepository, log *logrus.Logger) *ChatService {
 	return &ChatService{
-		ChatRepository: chatRepository,
-		Log:            log,
+		DB:                    db,
+		ChatRepository:        chatRepository,
+		ChatThreadRepository:  chatThreadRepository,
+		ChatMessageRepository: chatMessageRepository,
+		Log:                   log,
 	}
 }
 
-func (s *ChatService) Create(ctx context.Context, request *model.ChatCreateRequest) (*model.ChatResponse, error) {
-	tx := s.ChatRepository.DB.WithContext(ctx).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			s.Log.Error("Transaction failed: ", r)
+// AddMessage adds a message to its thread, starting the thread with the
+// message's file and line when it is new. A message with a GitHub ID already
+// recorded is returned with false instead of being added again; so is one
+// relayed shortly before without an ID and the same text, which gets the ID.
+func (s *ChatService) AddMessage(ctx context.Context, request *model.ChatMessageCreateRequest) (*model.ChatMessageResponse, bool, error) {
+	db := s.DB.WithContext(ctx)
+	thread, err := s.thread(db, request)
+	if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get chat thread")
+		return nil, false, err
+	}
+	if request.GitHubID != "" {
+		if existing, err := s.known(db, thread.ID, request); err != nil || existing != nil {
+			return existing, false, err
 		}
-	}()
+	}
 
-	chat := converter.ChatToEntity(request)
+	message := converter.ChatMessageToEntity(request)
+	message.ThreadID = thread.ID
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	message.UpdatedAt = time.Now()
+	if err := s.ChatMessageRepository.Create(db, message); err != nil {
+		// The same comment may come from a webhook and a sync at once
+		if request.GitHubID != "" {
+			if existing, findErr := s.known(db, thread.ID, request); findErr == nil && existing != nil {
+				return existing, false, nil
+			}
+		}
+		s.Log.WithContext(ctx).WithError(err).Error("failed to create chat message")
+		return nil, false, err
+	}
+	if err := db.Model(thread).Update("updated_at", message.UpdatedAt).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Warn("failed to touch chat thread")
+	}
+	return converter.ChatMessageToResponse(message), true, nil
+}
 
-	if err := tx.Create(chat).Error; err != nil {
-		tx.Rollback()
-		s.Log.Error("Failed to create chat: ", err)
-		return nil, err
+// AddMissing adds the messages not recorded yet and returns how many were
+// added
+func (s *ChatService) AddMissing(ctx context.Context, requests []*model.ChatMessageCreateRequest) (int, error) {
+	added := 0
+	for _, request := range requests {
+		_, created, err := s.AddMessage(ctx, request)
+		if err != nil {
+			return added, err
+		}
+		if created {
+			added++
+		}
 	}
+	return added, nil
+}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		s.Log.Error("Failed to commit transaction: ", err)
+// History is the thread's messages in the shape the chat agent takes them,
+// oldest first
+func (s *ChatService) History(ctx context.Context, threadID int) ([]map[string]interface{}, error) {
+	messages := make([]entity.ChatMessage, 0)
+	if err := s.ChatMessageRepository.FindAllByThread(s.DB.WithContext(ctx), &messages, threadID); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get chat messages")
 		return nil, err
 	}
-
-	return converter.ChatToResponse(chat), nil
+	history := make([]map[string]interface{}, 0, len(messages))
+	for _, message := range messages {
+		entry := map[string]interface{}{
+			"role":    message.Role,
+			"message": message.Message,
+		}
+		if message.AuthorLogin != "" {
+			entry["author_login"] = message.AuthorLogin
+		}
+		if message.File != "" {
+			entry["file"] = message.File
+		}
+		if message.Line != nil {
+			entry["line"] = *message.Line
+		}
+		history = append(history, entry)
+	}
+	return history, nil
 }
 
-func (s *ChatService) GetByID(ctx context.Context, id int) (*model.ChatResponse, error) {
-	chat := &entity.Chat{}
-	err := s.ChatRepository.FindById(s.ChatRepository.DB, chat, id)
+// HistoryOfComment is the History of the thread holding the comment with the
+// GitHub ID, or of the PR's conversation when the comment is not recorded
+func (s *ChatService) HistoryOfComment(ctx context.Context, courseID, prID int, githubID string) ([]map[string]interface{}, error) {
+	db := s.DB.WithContext(ctx)
+	if githubID != "" {
+		message := &entity.ChatMessage{}
+		err := s.ChatMessageRepository.FindByGitHubID(db, message, courseID, githubID)
+		if err == nil {
+			return s.History(ctx, message.ThreadID)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.Log.WithContext(ctx).WithError(err).Error("failed to get chat message")
+			return nil, err
+		}
+	}
+	thread := &entity.ChatThread{}
+	err := s.ChatThreadRepository.FindByKey(db, thread, prID, model.ChatThreadConversation)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []map[string]interface{}{}, nil
+	}
 	if err != nil {
-		s.Log.Error("Failed to find chat by ID: ", err)
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get chat thread")
 		return nil, err
 	}
-	return converter.ChatToResponse(chat), nil
+	return s.History(ctx, thread.ID)
 }
 
-func (s *ChatService) GetByCourseID(ctx context.Context, courseID int) ([]*model.ChatResponse, error) {
-	chats := make([]entity.Chat, 0)
-	err := s.ChatRepository.DB.WithContext(ctx).Where("course_id = ?", courseID).Find(&chats).Error
+// GetThread returns a thread with its messages
+func (s *ChatService) GetThread(ctx context.Context, id int) (*model.ChatThreadResponse, error) {
+	thread := &entity.ChatThread{}
+	if err := s.ChatThreadRepository.FindById(s.DB.WithContext(ctx), thread, id); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get chat thread")
+		return nil, err
+	}
+	threads, err := s.withMessages(ctx, []entity.ChatThread{*thread})
 	if err != nil {
-		s.Log.Error("Failed to get chats by course ID: ", err)
 		return nil, err
 	}
+	return threads[0], nil
+}
 
-	chatResponses := make([]*model.ChatResponse, 0)
-	for i := range chats {
-		chatResponses = append(chatResponses, converter.ChatToResponse(&chats[i]))
+// GetThreadsByPr returns the threads of a PR, by its row ID, with their
+// messages
+func (s *ChatService) GetThreadsByPr(ctx context.Context, prID int) ([]*model.ChatThreadResponse, error) {
+	threads := make([]entity.ChatThread, 0)
+	if err := s.ChatThreadRepository.FindAllByPr(s.DB.WithContext(ctx), &threads, prID); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get chat threads by PR")
+		return nil, err
 	}
-	return chatResponses, nil
+	return s.withMessages(ctx, threads)
 }
 
-func (s *ChatService) Update(ctx context.Context, request *model.ChatCreateRequest) (*model.ChatResponse, error) {
-	tx := s.ChatRepository.DB.WithContext(ctx).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			s.Log.Error("Transaction failed: ", r)
-		}
-	}()
-
-	// Find existing chat by course_id, user_id, and pr_id
-	var existingChat entity.Chat
-	err := tx.Where("course_id = ? AND user_id = ? AND pr_id = ?", request.CourseID, request.UserID, request.PrID).First(&existingChat).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// Create new chat if not exists
-			return s.Create(ctx, request)
-		}
-		tx.Rollback()
-		s.Log.Error("Failed to find existing chat: ", err)
+// GetThreadsByCourse returns the threads of the course's PRs, without their
+// messages
+func (s *ChatService) GetThreadsByCourse(ctx context.Context, courseID int) ([]*model.ChatThreadResponse, error) {
+	threads := make([]entity.ChatThread, 0)
+	if err := s.ChatThreadRepository.FindAllByCourse(s.DB.WithContext(ctx), &threads, courseID); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get chat threads by course")
 		return nil, err
 	}
+	responses := make([]*model.ChatThreadResponse, 0, len(threads))
+	for i := range threads {
+		responses = append(responses, converter.ChatThreadToResponse(&threads[i]))
+	}
+	return responses, nil
+}
 
-	// Update existing chat
-	existingChat.ChatHistory = request.ChatHistory
-	existingChat.UpdatedAt = time.Now()
+// MigrateLegacy moves the chat histories of the legacy chats table into
+// threads. A legacy chat is keyed by the PR's number, or for a few by its row;
+// its messages go to the PR's conversation in their order, since the legacy
+// history does not say which review thread a comment was in. Migrated chats
+// are deleted, so the migration can run again; chats whose PR is not found
+// are kept and reported.
+func (s *ChatService) MigrateLegacy(ctx context.Context, dryRun bool) (*model.ChatMigrationReport, error) {
+	chats := make([]entity.Chat, 0)
+	if err := s.DB.WithContext(ctx).Order("id").Find(&chats).Error; err != nil {
+		return nil, fmt.Errorf("failed to list legacy chats: %w", err)
+	}
+	report := &model.ChatMigrationReport{DryRun: dryRun, Chats: len(chats)}
+	for _, chat := range chats {
+		pr := &entity.Pr{}
+		err := s.DB.WithContext(ctx).Where("course_id = ? AND pr_number = ?", chat.CourseID, chat.PrID).First(pr).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = s.DB.WithContext(ctx).Where("course_id = ? AND id = ?", chat.CourseID, chat.PrID).First(pr).Error
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("chat %d: course %d has no PR %d", chat.ID, chat.CourseID, chat.PrID))
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to get PR of chat %d: %w", chat.ID, err)
+		}
+		if dryRun {
+			report.Migrated++
+			report.Messages += len(chat.ChatHistory)
+			continue
+		}
 
-	if err := tx.Save(&existingChat).Error; err != nil {
-		tx.Rollback()
-		s.Log.Error("Failed to update chat: ", err)
-		return nil, err
+		added := 0
+		err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			scoped := &ChatService{DB: tx, ChatThreadRepository: s.ChatThreadRepository, ChatMessageRepository: s.ChatMessageRepository, Log: s.Log}
+			for i, entry := range chat.ChatHistory {
+				message, _ := entry["message"].(string)
+				if message == "" {
+					continue
+				}
+				role, _ := entry["role"].(string)
+				githubID, _ := entry["github_id"].(string)
+				_, created, err := scoped.AddMessage(ctx, &model.ChatMessageCreateRequest{
+					CourseID: chat.CourseID,
+					PrID:     pr.ID,
+					Role:     role,
+					Message:  message,
+					GitHubID: githubID,
+					// Keeps the history's order among messages of the same time
+					CreatedAt: chat.CreatedAt.Add(time.Duration(i) * time.Microsecond),
+				})
+				if err != nil {
+					return err
+				}
+				if created {
+					added++
+				}
+			}
+			return tx.Delete(&entity.Chat{}, chat.ID).Error
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to migrate chat %d: %w", chat.ID, err)
+		}
+		report.Migrated++
+		report.Messages += added
 	}
+	return report, nil
+}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		s.Log.Error("Failed to commit transaction: ", err)
+// thread finds the request's thread or starts it
+func (s *ChatService) thread(db *gorm.DB, request *model.ChatMessageCreateRequest) (*entity.ChatThread, error) {
+	key := request.ThreadKey
+	if key == "" {
+		key = model.ChatThreadConversation
+	}
+	thread := &entity.ChatThread{}
+	err := s.ChatThreadRepository.FindByKey(db, thread, request.PrID, key)
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return thread, err
+	}
+	now := time.Now()
+	thread = &entity.ChatThread{CourseID: request.CourseID, PrID: request.PrID, ThreadKey: key, CreatedAt: now, UpdatedAt: now}
+	if key != model.ChatThreadConversation {
+		thread.File = request.File
+		thread.Line = request.Line
+	}
+	if err := s.ChatThreadRepository.Create(db, thread); err != nil {
+		// Started by another comment of the same thread in the meantime
+		existing := &entity.ChatThread{}
+		if findErr := s.ChatThreadRepository.FindByKey(db, existing, request.PrID, key); findErr == nil {
+			return existing, nil
+		}
 		return nil, err
 	}
-
-	return converter.ChatToResponse(&existingChat), nil
+	return thread, nil
 }
 
-// AppendToChatHistory appends a new message to the existing chat history
-func (s *ChatService) AppendToChatHistory(ctx context.Context, courseID, userID, prID int, message map[string]interface{}) error {
-	// Find existing chat
-	var existingChat entity.Chat
-	err := s.ChatRepository.DB.WithContext(ctx).Where("course_id = ? AND user_id = ? AND pr_id = ?", courseID, userID, prID).First(&existingChat).Error
-
-	var chatHistory []map[string]interface{}
-
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// Create new chat with initial message
-			chatHistory = []map[string]interface{}{message}
-		} else {
-			return fmt.Errorf("failed to find existing chat: %w", err)
-		}
-	} else {
-		// Use existing chat history or start with empty array
-		if existingChat.ChatHistory != nil {
-			chatHistory = []map[string]interface{}(existingChat.ChatHistory)
-		} else {
-			chatHistory = []map[string]interface{}{}
-		}
-		// Append new message
-		chatHistory = append(chatHistory, message)
-	}
-
-	// Create or update chat
-	request := &model.ChatCreateRequest{
-		CourseID:    courseID,
-		UserID:      userID,
-		PrID:        prID,
-		ChatHistory: chatHistory,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	_, err = s.Update(ctx, request)
-	return err
-}
+// relayMatchWindow is how far apart a relayed message and the GitHub comment
+// it became may be recorded
+const relayMatchWindow = 5 * time.Minute
 
-// GetChatHistoryAsArray returns the chat history as a parsed JSON array
-func (s *ChatService) GetChatHistoryAsArray(ctx context.Context, courseID, userID, prID int) ([]map[string]interface{}, error) {
-	var existingChat entity.Chat
-	err := s.ChatRepository.DB.WithContext(ctx).Where("course_id = ? AND user_id = ? AND pr_id = ?", courseID, userID, prID).First(&existingChat).Error
+// known returns the message already recorded for the request's GitHub ID,
+// or nil. A message of the thread recorded without an ID, with the same text
+// and author and within relayMatchWindow of the comment, such as one relayed
+// before the ID was known, is given the ID.
+func (s *ChatService) known(db *gorm.DB, threadID int, request *model.ChatMessageCreateRequest) (*model.ChatMessageResponse, error) {
+	existing := &entity.ChatMessage{}
+	err := s.ChatMessageRepository.FindByGitHubID(db, existing, request.CourseID, request.GitHubID)
+	if err == nil {
+		return converter.ChatMessageToResponse(existing), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	// Only a row relayed around the time the comment was written is taken
+	// for it, so a question asked again later is still answered
+	written := request.CreatedAt
+	if written.IsZero() {
+		written = time.Now()
+	}
+	query := db.Where("thread_id = ? AND github_id = '' AND message = ?", threadID, request.Message).
+		Where("created_at BETWEEN ? AND ?", written.Add(-relayMatchWindow), written.Add(relayMatchWindow))
+	if request.AuthorLogin != "" {
+		query = query.Where("author_login IN ?", []string{request.AuthorLogin, ""})
+	}
+	err = query.Order("id").First(existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return []map[string]interface{}{}, nil
-		}
-		return nil, fmt.Errorf("failed to find chat: %w", err)
+		return nil, err
 	}
-
-	if existingChat.ChatHistory == nil {
-		return []map[string]interface{}{}, nil
+	if err := db.Model(existing).Updates(map[string]interface{}{"github_id": request.GitHubID, "updated_at": time.Now()}).Error; err != nil {
+		return nil, err
 	}
-
-	return []map[string]interface{}(existingChat.ChatHistory), nil
+	return converter.ChatMessageToResponse(existing), nil
 }
 
-// GetByPrID returns all chats for a specific PR
-func (s *ChatService) GetByPrID(ctx context.Context, prID int) ([]*model.ChatResponse, error) {
-	chats := make([]entity.Chat, 0)
-	err := s.ChatRepository.DB.WithContext(ctx).Where("pr_id = ?", prID).Find(&chats).Error
-	if err != nil {
-		s.Log.Error("Failed to get chats by PR ID: ", err)
+func (s *ChatService) withMessages(ctx context.Context, threads []entity.ChatThread) ([]*model.ChatThreadResponse, error) {
+	responses := make([]*model.ChatThreadResponse, 0, len(threads))
+	if len(threads) == 0 {
+		return responses, nil
+	}
+	byID := make(map[int]*model.ChatThreadResponse, len(threads))
+	ids := make([]int, 0, len(threads))
+	for i := range threads {
+		response := converter.ChatThreadToResponse(&threads[i])
+		response.Messages = make([]*model.ChatMessageResponse, 0)
+		responses = append(responses, response)
+		byID[threads[i].ID] = response
+		ids = append(ids, threads[i].ID)
+	}
+	messages := make([]entity.ChatMessage, 0)
+	if err := s.ChatMessageRepository.FindAllByThreads(s.DB.WithContext(ctx), &messages, ids); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get chat messages")
 		return nil, err
 	}
-
-	chatResponses := make([]*model.ChatResponse, 0)
-	for i := range chats {
-		chatResponses = append(chatResponses, converter.ChatToResponse(&chats[i]))
+	for i := range messages {
+		thread := byID[messages[i].ThreadID]
+		thread.Messages = append(thread.Messages, converter.ChatMessageToResponse(&messages[i]))
 	}
-	return chatResponses, nil
+	return responses, nil
 }
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CheckRunName is the name grading runs show under on the PR's commit
+	CheckRunName = "Neurade review"
+	// checkRunAnnotationBatch is the most annotations GitHub takes per request
+	checkRunAnnotationBatch = 50
+	// checkRunSummaryLimit is GitHub's size limit for an output summary
+	checkRunSummaryLimit = 65535
+	// commitStatusDescriptionLimit is GitHub's size limit for a status description
+	commitStatusDescriptionLimit = 140
+)
+
+// CheckRunService reports review runs on the PR's head commit on GitHub: a
+// check run that is in progress while the agent works and then concludes on
+// the course's pass score, with the agent's comments as annotations. Tokens
+// that may not create check runs, which is any but a GitHub App's, get a
+// commit status instead.
+type CheckRunService struct {
+	GitHubService *GitHubService
+	Log           *logrus.Logger
+}
+
+func NewCheckRunService(githubService *GitHubService, log *logrus.Logger) *CheckRunService {
+	return &CheckRunService{GitHubService: githubService, Log: log}
+}
+
+// CheckRun is one review run reported on a commit
+type CheckRun struct {
+	Owner     string
+	Repo      string
+	HeadSHA   string
+	Token     string
+	PassScore int
+	// ID is the GitHub check run, or 0 when the run is a commit status
+	ID int64
+}
+
+// CheckRunResult is what a finished review run concludes from
+type CheckRunResult struct {
+	Agent *model.AgentResponse
+	// Tests is the hidden test summary, nil when the assignment has none
+	Tests map[string]interface{}
+	// Diff places the agent's comments on lines, nil when it is unavailable
+	Diff *model.PrDiff
+}
+
+// Start marks the review of the commit as in progress. It returns nil, and
+// the other methods do nothing, for courses not on GitHub or when GitHub
+// refuses both a check run and a commit status; reporting never stops a
+// review.
+func (s *CheckRunService) Start(ctx context.Context, course *model.CourseResponse, prNumber int, headSHA, githubToken string) *CheckRun {
+	if headSHA == "" || util.GitProviderOf(course.GithubURL, course.GitProvider) != util.GitProviderGitHub {
+		return nil
+	}
+	repo, err := util.ParseRepoURL(course.GithubURL, course.GitProvider)
+	if err != nil {
+		return nil
+	}
+	run := &CheckRun{Owner: repo.Owner, Repo: repo.Name, HeadSHA: headSHA, Token: githubToken, PassScore: course.PassScore}
+	now := time.Now()
+	created, err := s.GitHubService.CreateCheckRun(ctx, run.Owner, run.Repo, githubToken, &model.GitHubCheckRunRequest{
+		Name:       CheckRunName,
+		HeadSHA:    headSHA,
+		Status:     "in_progress",
+		ExternalID: fmt.Sprintf("course-%d-pr-%d", course.ID, prNumber),
+		StartedAt:  &now,
+		Output: &model.GitHubCheckRunOutput{
+			Title:   "Review in progress",
+			Summary: "The review agent is grading this pull request.",
+		},
+	})
+	if err == nil {
+		run.ID = created.ID
+		return run
+	}
+	var apiErr *GitHubAPIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		s.Log.WithContext(ctx).WithError(err).Errorf("failed to create check run for PR %d of course %d", prNumber, course.ID)
+		return nil
+	}
+	if err := s.setStatus(ctx, run, "pending", "Review in progress"); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Errorf("failed to set commit status for PR %d of course %d", prNumber, course.ID)
+		return nil
+	}
+	return run
+}
+
+// Complete concludes the run from the review: success when the score reaches
+// the pass score, failure below it and neutral when there is no score
+func (s *CheckRunService) Complete(ctx context.Context, run *CheckRun, result *CheckRunResult) {
+	if run == nil {
+		return
+	}
+	score, scored := ReviewScore(result.Agent, result.Tests)
+	conclusion, title := "neutral", "Reviewed"
+	if scored {
+		conclusion, title = "failure", fmt.Sprintf("Score %s / 100, below the pass mark of %d", formatScore(score), run.PassScore)
+		if score >= float64(run.PassScore) {
+			conclusion, title = "success", fmt.Sprintf("Score %s / 100, passed", formatScore(score))
+		}
+	}
+	if run.ID == 0 {
+		state := map[string]string{"neutral": "success", "success": "success", "failure": "failure"}[conclusion]
+		if err := s.setStatus(ctx, run, state, title); err != nil {
+			s.Log.WithContext(ctx).WithError(err).Errorf("failed to set commit status on %s", run.HeadSHA)
+		}
+		return
+	}
+
+	summary := CheckRunSummary(result, run.PassScore)
+	annotations := CheckRunAnnotations(result.Diff, result.Agent.Comments)
+	now := time.Now()
+	request := &model.GitHubCheckRunRequest{
+		Status:      "completed",
+		Conclusion:  conclusion,
+		CompletedAt: &now,
+	}
+	// GitHub takes 50 annotations per request and adds up those of updates
+	for first := true; first || len(annotations) > 0; first = false {
+		batch := annotations
+		if len(batch) > checkRunAnnotationBatch {
+			batch = batch[:checkRunAnnotationBatch]
+		}
+		annotations = annotations[len(batch):]
+		request.Output = &model.GitHubCheckRunOutput{Title: title, Summary: summary, Annotations: batch}
+		if err := s.GitHubService.UpdateCheckRun(ctx, run.Owner, run.Repo, run.ID, run.Token, request); err != nil {
+			s.Log.WithContext(ctx).WithError(err).Errorf("failed to complete check run %d", run.ID)
+			return
+		}
+		request = &model.GitHubCheckRunRequest{}
+	}
+}
+
+// Fail concludes the run when the review could not be made. The conclusion
+// is neutral, since the student's code was not judged.
+func (s *CheckRunService) Fail(ctx context.Context, run *CheckRun, reason string) {
+	if run == nil {
+		return
+	}
+	if run.ID == 0 {
+		if err := s.setStatus(ctx, run, "error", "Review failed: "+reason); err != nil {
+			s.Log.WithContext(ctx).WithError(err).Errorf("failed to set commit status on %s", run.HeadSHA)
+		}
+		return
+	}
+	now := time.Now()
+	err := s.GitHubService.UpdateCheckRun(ctx, run.Owner, run.Repo, run.ID, run.Token, &model.GitHubCheckRunRequest{
+		Status:      "completed",
+		Conclusion:  "neutral",
+		CompletedAt: &now,
+		Output: &model.GitHubCheckRunOutput{
+			Title:   "Review failed",
+			Summary: fmt.Sprintf("The pull request could not be reviewed: %s. It will be graded again on the next review run.", reason),
+		},
+	})
+	if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Errorf("failed to complete check run %d", run.ID)
+	}
+}
+
+func (s *CheckRunService) setStatus(ctx context.Context, run *CheckRun, state, description string) error {
+	if len(description) > commitStatusDescriptionLimit {
+		description = description[:commitStatusDescriptionLimit-3] + "..."
+	}
+	return s.GitHubService.CreateCommitStatus(ctx, run.Owner, run.Repo, run.HeadSHA, run.Token, &model.GitHubCommitStatusRequest{
+		State:       state,
+		Description: description,
+		Context:     CheckRunName,
+	})
+}
+
+// ReviewScore is the 0-100 grade of a review: the agent's score when it gives
+// one, otherwise the hidden tests' score. It reports false when there is
+// neither.
+func ReviewScore(agent *model.AgentResponse, tests map[string]interface{}) (float64, bool) {
+	if agent != nil && agent.Score != nil {
+		return *agent.Score, true
+	}
+	if score, ok := tests["score"].(float64); ok {
+		return score, true
+	}
+	return 0, false
+}
+
+// ReviewPassed reports whether a review reaches the pass score. Reviews
+// without a score pass.
+func ReviewPassed(agent *model.AgentResponse, tests map[string]interface{}, passScore int) bool {
+	score, scored := ReviewScore(agent, tests)
+	return !scored || score >= float64(passScore)
+}
+
+// CheckRunSummary is the markdown summary of a finished review: the score
+// against the pass mark, the rubric, the hidden test results and the agent's
+// summary
+func CheckRunSummary(result *CheckRunResult, passScore int) string {
+	var b strings.Builder
+	if score, ok := ReviewScore(result.Agent, result.Tests); ok {
+		fmt.Fprintf(&b, "**Score: %s / 100** (pass mark %d)\n\n", formatScore(score), passScore)
+	}
+	if len(result.Agent.Rubric) > 0 {
+		b.WriteString("| Criterion | Score | Comment |\n| --- | --- | --- |\n")
+		for _, item := range result.Agent.Rubric {
+			fmt.Fprintf(&b, "| %s | %s / %s | %s |\n", tableCell(item.Criterion), formatScore(item.Score), formatScore(item.MaxScore), tableCell(item.Comment))
+		}
+		b.WriteString("\n")
+	}
+	if result.Tests != nil {
+		fmt.Fprintf(&b, "**Hidden tests:** %v of %v passed\n\n", result.Tests["passed"], result.Tests["total"])
+	}
+	b.WriteString(result.Agent.Summary)
+	summary := b.String()
+	if len(summary) > checkRunSummaryLimit {
+		summary = strings.ToValidUTF8(summary[:checkRunSummaryLimit-3], "") + "..."
+	}
+	return summary
+}
+
+// CheckRunAnnotations turns the agent's comments into annotations on the head
+// commit. Comments whose diff position is not in the diff, or falls on a
+// removed line, go on the first line of the file.
+func CheckRunAnnotations(diff *model.PrDiff, comments []model.AgentResponseComment) []model.GitHubCheckRunAnnotation {
+	patches := make(map[string]string)
+	if diff != nil {
+		for _, f := range diff.Files {
+			patches[f.Filename] = f.Patch
+		}
+	}
+	annotations := make([]model.GitHubCheckRunAnnotation, 0, len(comments))
+	for _, comment := range comments {
+		if comment.Path == "" || comment.Body == "" {
+			continue
+		}
+		line := 1
+		if patch, ok := patches[comment.Path]; ok {
+			if _, newLine, found := DiffPositionLines(patch, comment.Position); found && newLine > 0 {
+				line = newLine
+			}
+		}
+		annotations = append(annotations, model.GitHubCheckRunAnnotation{
+			Path:            comment.Path,
+			StartLine:       line,
+			EndLine:         line,
+			AnnotationLevel: "notice",
+			Title:           CheckRunName,
+			Message:         comment.Body,
+		})
+	}
+	return annotations
+}
+
+// formatScore writes a score with at most one decimal
+func formatScore(score float64) string {
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", score), ".0")
+}
+
+// tableCell keeps text on one markdown table row
+func tableCell(text string) string {
+	text = strings.ReplaceAll(text, "|", `\|`)
+	return strings.Join(strings.Fields(text), " ")
+}
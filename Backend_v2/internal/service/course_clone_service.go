@@ -0,0 +1,254 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"be/neurade/v2/internal/util"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// CourseCloneService copies a course into a new term: settings, assignments,
+// hidden test suites, the current convention and reference answers (as new
+// objects in storage) and, optionally, TA permissions. Pull requests, reviews
+// and document history stay with the original course.
+type CourseCloneService struct {
+	DB                        *gorm.DB
+	CourseRepository          *repository.CourseRepository
+	DocumentVersionRepository *repository.DocumentVersionRepository
+	MinioUtil                 *util.MinioUtil
+	Log                       *logrus.Logger
+}
+
+func NewCourseCloneService(db *gorm.DB, courseRepository *repository.CourseRepository, documentVersionRepository *repository.DocumentVersionRepository, minioUtil *util.MinioUtil, log *logrus.Logger) *CourseCloneService {
+	return &CourseCloneService{
+		DB:                        db,
+		CourseRepository:          courseRepository,
+		DocumentVersionRepository: documentVersionRepository,
+		MinioUtil:                 minioUtil,
+		Log:                       log,
+	}
+}
+
+func (s *CourseCloneService) Clone(ctx context.Context, sourceID int, request *model.CourseCloneRequest) (*model.CourseCloneResponse, error) {
+	source := &entity.Course{}
+	if err := s.CourseRepository.FindById(s.DB.WithContext(ctx), source, sourceID); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get course to clone")
+		return nil, err
+	}
+	assignments := make([]entity.Assignment, 0)
+	if err := s.DB.WithContext(ctx).Where("course_id = ?", sourceID).Order("id").Find(&assignments).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get assignments to clone")
+		return nil, err
+	}
+
+	githubURL := util.NormalizeGithubURL(request.GithubURL)
+	owner, repoName, err := util.ParseGitHubURL(githubURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid github url: %w", err)
+	}
+	gitProvider := request.GitProvider
+	if gitProvider == "" {
+		gitProvider = source.GitProvider
+	}
+	userID := request.UserID
+	if userID == 0 {
+		userID = source.UserID
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	// Objects copied before a failure are removed again, so a failed clone
+	// leaves nothing behind in storage
+	copied := make([]string, 0)
+	cleanup := func() {
+		for _, fileURL := range copied {
+			if err := s.MinioUtil.DeleteFile(context.Background(), fileURL); err != nil {
+				s.Log.Warnf("Failed to remove %s after failed clone: %v", fileURL, err)
+			}
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			cleanup()
+		}
+	}()
+	fail := func(err error, message string) (*model.CourseCloneResponse, error) {
+		tx.Rollback()
+		cleanup()
+		s.Log.WithContext(ctx).WithError(err).Error(message)
+		return nil, err
+	}
+
+	now := time.Now()
+	course := &entity.Course{
+		UserID:      userID,
+		CourseName:  request.CourseName,
+		GithubURL:   githubURL,
+		Owner:       owner,
+		RepoName:    repoName,
+		GitProvider: gitProvider,
+		AutoGrade:   source.AutoGrade,
+		PassScore:   source.PassScore,
+		BotHandle:   source.BotHandle,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := tx.Create(course).Error; err != nil {
+		return fail(err, "failed to create cloned course")
+	}
+
+	labels := make([]entity.CourseLabel, 0)
+	if err := tx.Where("course_id = ?", sourceID).Find(&labels).Error; err != nil {
+		return fail(err, "failed to get course labels")
+	}
+	for _, label := range labels {
+		if err := tx.Create(&entity.CourseLabel{CourseID: course.ID, Kind: label.Kind, Name: label.Name, Color: label.Color, CreatedAt: now, UpdatedAt: now}).Error; err != nil {
+			return fail(err, "failed to copy course label")
+		}
+	}
+
+	copyDocument := func(fileURL string) (string, error) {
+		if fileURL == "" {
+			return "", nil
+		}
+		newURL, err := s.copyDocument(ctx, fileURL, course.ID, &copied)
+		if err != nil {
+			return "", fmt.Errorf("failed to copy %s: %w", fileURL, err)
+		}
+		return newURL, nil
+	}
+
+	generalAnswer, err := copyDocument(source.GeneralAnswer)
+	if err != nil {
+		return fail(err, "failed to copy coding convention")
+	}
+	if generalAnswer != "" {
+		course.GeneralAnswer = generalAnswer
+		if err := tx.Model(course).Update("general_answer", generalAnswer).Error; err != nil {
+			return fail(err, "failed to set cloned coding convention")
+		}
+		if err := s.recordVersion(tx, source.GeneralAnswer, course.ID, 0, DocTypeCodingConvention, generalAnswer, userID, sourceID); err != nil {
+			return fail(err, "failed to record cloned coding convention")
+		}
+	}
+
+	response := &model.CourseCloneResponse{Assignments: make([]*model.AssignmentResponse, 0, len(assignments))}
+	for _, sourceAssignment := range assignments {
+		assignmentURL, err := copyDocument(sourceAssignment.AssignmentURL)
+		if err != nil {
+			return fail(err, "failed to copy reference answer")
+		}
+		testBundleURL, err := copyDocument(sourceAssignment.TestBundleURL)
+		if err != nil {
+			return fail(err, "failed to copy hidden test suite")
+		}
+		assignment := &entity.Assignment{
+			CourseID:       course.ID,
+			AssignmentName: sourceAssignment.AssignmentName,
+			Description:    sourceAssignment.Description,
+			AssignmentURL:  assignmentURL,
+			TestBundleURL:  testBundleURL,
+			TestCommand:    sourceAssignment.TestCommand,
+			TestReportPath: sourceAssignment.TestReportPath,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := tx.Create(assignment).Error; err != nil {
+			return fail(err, "failed to create cloned assignment")
+		}
+		if assignmentURL != "" {
+			if err := s.recordVersion(tx, sourceAssignment.AssignmentURL, course.ID, assignment.ID, DocTypeAssignmentAnswer, assignmentURL, userID, sourceID); err != nil {
+				return fail(err, "failed to record cloned reference answer")
+			}
+		}
+		response.Assignments = append(response.Assignments, converter.AssignmentToResponse(assignment))
+	}
+
+	if request.CopyPermissions {
+		permissions := make([]entity.PermissionUserCourse, 0)
+		if err := tx.Where("course_id = ?", sourceID).Find(&permissions).Error; err != nil {
+			return fail(err, "failed to get course permissions")
+		}
+		for _, permission := range permissions {
+			if err := tx.Create(&entity.PermissionUserCourse{UserID: permission.UserID, CourseID: course.ID}).Error; err != nil {
+				return fail(err, "failed to copy course permission")
+			}
+		}
+		response.Permissions = len(permissions)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		cleanup()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to commit transaction")
+		return nil, err
+	}
+
+	response.Course = converter.CourseToResponse(course)
+	response.CopiedFiles = len(copied)
+	return response, nil
+}
+
+// copyDocument copies one stored document into the new course. A folder upload
+// is copied file by file and gets a manifest pointing at the copies.
+func (s *CourseCloneService) copyDocument(ctx context.Context, fileURL string, courseID int, copied *[]string) (string, error) {
+	if !IsManifestURL(fileURL) {
+		newURL, err := s.MinioUtil.CopyToCourse(ctx, fileURL, courseID, nil)
+		if err != nil {
+			return "", err
+		}
+		*copied = append(*copied, newURL)
+		return newURL, nil
+	}
+
+	newURL, err := s.MinioUtil.CopyToCourse(ctx, fileURL, courseID, func(content []byte) ([]byte, error) {
+		manifest := &model.ReferenceManifest{}
+		if err := json.Unmarshal(content, manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+		for i, file := range manifest.Files {
+			fileCopy, err := s.MinioUtil.CopyToCourse(ctx, file.FileURL, courseID, nil)
+			if err != nil {
+				return nil, err
+			}
+			*copied = append(*copied, fileCopy)
+			manifest.Files[i].FileURL = fileCopy
+		}
+		return json.Marshal(manifest)
+	})
+	if err != nil {
+		return "", err
+	}
+	*copied = append(*copied, newURL)
+	return newURL, nil
+}
+
+// recordVersion starts the cloned document's history at version 1, carrying
+// over the name and checksum of the version it was copied from
+func (s *CourseCloneService) recordVersion(tx *gorm.DB, sourceURL string, courseID, assignmentID int, docType string, fileURL string, userID int, sourceCourseID int) error {
+	version := &entity.DocumentVersion{
+		CourseID:     courseID,
+		AssignmentID: assignmentID,
+		DocType:      docType,
+		Version:      1,
+		FileURL:      fileURL,
+		UploadedBy:   userID,
+		Note:         fmt.Sprintf("cloned from course %d", sourceCourseID),
+		CreatedAt:    time.Now(),
+	}
+	sourceVersion := &entity.DocumentVersion{}
+	if err := s.DocumentVersionRepository.FindByFileURL(tx, sourceVersion, sourceURL); err == nil {
+		version.FileName = sourceVersion.FileName
+		version.Size = sourceVersion.Size
+		version.Checksum = sourceVersion.Checksum
+		version.Note = fmt.Sprintf("cloned from course %d version %d", sourceCourseID, sourceVersion.Version)
+	}
+	return s.DocumentVersionRepository.Create(tx, version)
+}
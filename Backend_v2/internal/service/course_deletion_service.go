@@ -0,0 +1,348 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"be/neurade/v2/internal/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	CourseDeletionPending = "pending"
+	CourseDeletionRunning = "running"
+	CourseDeletionDone    = "done"
+	CourseDeletionFailed  = "failed"
+)
+
+// courseTables are the tables holding per-course rows, children first
+var courseTables = []struct {
+	name   string
+	model  interface{}
+	column string
+}{
+	{"test_runs", &entity.TestRun{}, "course_id"},
+	{"document_versions", &entity.DocumentVersion{}, "course_id"},
+	{"files", &entity.File{}, "course_id"},
+	{"chat_messages", &entity.ChatMessage{}, "course_id"},
+	{"chat_threads", &entity.ChatThread{}, "course_id"},
+	{"chats", &entity.Chat{}, "course_id"},
+	{"git_repositories", &entity.GitRepository{}, "course_id"},
+	{"course_labels", &entity.CourseLabel{}, "course_id"},
+	{"pr_commands", &entity.PrCommand{}, "course_id"},
+	{"prs", &entity.Pr{}, "course_id"},
+	{"assignments", &entity.Assignment{}, "course_id"},
+	{"permissions", &entity.PermissionUserCourse{}, "course_id"},
+	{"courses", &entity.Course{}, "id"},
+}
+
+// CourseDeletionService hard-deletes a course in the background: stored
+// objects first, then every row belonging to the course in one transaction.
+// Each step is idempotent, so a failed or interrupted job can simply run again.
+type CourseDeletionService struct {
+	DB                          *gorm.DB
+	CourseDeletionJobRepository *repository.CourseDeletionJobRepository
+	MinioUtil                   *util.MinioUtil
+	CourseWebhookService        *CourseWebhookService
+	LocalGitService             *LocalGitService
+	Log                         *logrus.Logger
+}
+
+func NewCourseDeletionService(db *gorm.DB, courseDeletionJobRepository *repository.CourseDeletionJobRepository, minioUtil *util.MinioUtil, courseWebhookService *CourseWebhookService, localGitService *LocalGitService, log *logrus.Logger) *CourseDeletionService {
+	return &CourseDeletionService{
+		DB:                          db,
+		CourseDeletionJobRepository: courseDeletionJobRepository,
+		MinioUtil:                   minioUtil,
+		CourseWebhookService:        courseWebhookService,
+		LocalGitService:             localGitService,
+		Log:                         log,
+	}
+}
+
+// Request archives the course straight away, so webhooks and auto-grading
+// stop, and queues the deletion. A course already being deleted returns its
+// existing job.
+func (s *CourseDeletionService) Request(ctx context.Context, courseID int, userID int) (*model.CourseDeletionJobResponse, error) {
+	db := s.DB.WithContext(ctx)
+	existing := &entity.CourseDeletionJob{}
+	if err := s.CourseDeletionJobRepository.FindActiveByCourse(db, existing, courseID); err == nil {
+		return converter.CourseDeletionJobToResponse(existing), nil
+	}
+
+	course := &entity.Course{}
+	if err := db.First(course, courseID).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get course to delete")
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &entity.CourseDeletionJob{
+		CourseID:    courseID,
+		CourseName:  course.CourseName,
+		RequestedBy: userID,
+		Status:      CourseDeletionPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+	if course.ArchivedAt == nil {
+		if err := tx.Model(course).Update("archived_at", now).Error; err != nil {
+			tx.Rollback()
+			s.Log.WithContext(ctx).WithError(err).Error("failed to archive course before deletion")
+			return nil, err
+		}
+	}
+	if err := s.CourseDeletionJobRepository.Create(tx, job); err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to create course deletion job")
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to commit transaction")
+		return nil, err
+	}
+
+	go s.Run(job.ID)
+	return converter.CourseDeletionJobToResponse(job), nil
+}
+
+// InProgress reports whether the course has a deletion job that has not finished
+func (s *CourseDeletionService) InProgress(ctx context.Context, courseID int) bool {
+	job := &entity.CourseDeletionJob{}
+	return s.CourseDeletionJobRepository.FindActiveByCourse(s.DB.WithContext(ctx), job, courseID) == nil
+}
+
+func (s *CourseDeletionService) GetByID(ctx context.Context, id int) (*model.CourseDeletionJobResponse, error) {
+	job := &entity.CourseDeletionJob{}
+	if err := s.CourseDeletionJobRepository.FindById(s.DB.WithContext(ctx), job, id); err != nil {
+		return nil, err
+	}
+	return converter.CourseDeletionJobToResponse(job), nil
+}
+
+// ResumeUnfinished restarts jobs cut short by a restart
+func (s *CourseDeletionService) ResumeUnfinished(ctx context.Context) {
+	jobs := make([]entity.CourseDeletionJob, 0)
+	if err := s.CourseDeletionJobRepository.FindAllUnfinished(s.DB.WithContext(ctx), &jobs); err != nil {
+		s.Log.WithError(err).Error("failed to list unfinished course deletions")
+		return
+	}
+	for _, job := range jobs {
+		s.Log.Infof("Resuming deletion of course %d (job %d)", job.CourseID, job.ID)
+		s.Run(job.ID)
+	}
+}
+
+// Run executes one deletion job and records what it removed
+func (s *CourseDeletionService) Run(jobID int) {
+	ctx := context.Background()
+	defer func() {
+		if r := recover(); r != nil {
+			s.finish(ctx, jobID, nil, fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	job := &entity.CourseDeletionJob{}
+	if err := s.CourseDeletionJobRepository.FindById(s.DB, job, jobID); err != nil {
+		s.Log.WithError(err).Errorf("failed to get course deletion job %d", jobID)
+		return
+	}
+	now := time.Now()
+	if err := s.DB.Model(job).Updates(map[string]interface{}{"status": CourseDeletionRunning, "started_at": now, "error": "", "updated_at": now}).Error; err != nil {
+		s.Log.WithError(err).Errorf("failed to start course deletion job %d", jobID)
+		return
+	}
+
+	removed, err := s.purge(ctx, job.CourseID)
+	s.finish(ctx, jobID, removed, err)
+}
+
+func (s *CourseDeletionService) finish(ctx context.Context, jobID int, removed map[string]int, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      CourseDeletionDone,
+		"report":      converter.RemovedToJSON(removed),
+		"finished_at": now,
+		"updated_at":  now,
+	}
+	if err != nil {
+		updates["status"] = CourseDeletionFailed
+		updates["error"] = err.Error()
+		s.Log.WithError(err).Errorf("course deletion job %d failed", jobID)
+	} else {
+		s.Log.Infof("Course deletion job %d finished: %v", jobID, removed)
+	}
+	if err := s.DB.WithContext(ctx).Model(&entity.CourseDeletionJob{}).Where("id = ?", jobID).Updates(updates).Error; err != nil {
+		s.Log.WithError(err).Errorf("failed to record result of course deletion job %d", jobID)
+	}
+}
+
+func (s *CourseDeletionService) purge(ctx context.Context, courseID int) (map[string]int, error) {
+	removed := make(map[string]int)
+	// A repository we can no longer reach must not keep the course from going
+	if err := s.CourseWebhookService.Unregister(ctx, courseID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.Log.WithError(err).Warnf("failed to remove webhook of course %d", courseID)
+	}
+	objects, err := s.purgeObjects(ctx, courseID)
+	removed["objects"] = objects
+	if err != nil {
+		return removed, err
+	}
+	if err := s.LocalGitService.RemoveCourse(courseID); err != nil {
+		return removed, fmt.Errorf("failed to remove hosted repositories: %w", err)
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, table := range courseTables {
+		result := tx.Where(table.column+" = ?", courseID).Delete(table.model)
+		if result.Error != nil {
+			tx.Rollback()
+			return removed, fmt.Errorf("failed to delete %s: %w", table.name, result.Error)
+		}
+		removed[table.name] = int(result.RowsAffected)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// purgeObjects removes everything under the course's prefix, any object the
+// course references outside it, and the course's legacy bucket contents when
+// no other course shares that bucket
+func (s *CourseDeletionService) purgeObjects(ctx context.Context, courseID int) (int, error) {
+	storage := s.MinioUtil.Storage
+	count := 0
+
+	objects, err := storage.List(ctx, s.MinioUtil.Bucket, util.CoursePrefix(courseID))
+	if err != nil {
+		return count, fmt.Errorf("failed to list course objects: %w", err)
+	}
+	for _, object := range objects {
+		if err := storage.Delete(ctx, s.MinioUtil.Bucket, object.Key); err != nil {
+			return count, fmt.Errorf("failed to delete %s: %w", object.Key, err)
+		}
+		count++
+	}
+
+	referenced, err := s.referencedURLs(ctx, courseID)
+	if err != nil {
+		return count, err
+	}
+	for _, fileURL := range referenced {
+		if strings.HasPrefix(fileURL, s.MinioUtil.URL(util.CoursePrefix(courseID))) {
+			continue
+		}
+		if found, err := s.MinioUtil.ObjectExists(ctx, fileURL); err != nil || !found {
+			continue
+		}
+		if err := s.MinioUtil.DeleteFile(ctx, fileURL); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	course := &entity.Course{}
+	if err := s.DB.WithContext(ctx).First(course, courseID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return count, nil
+		}
+		return count, err
+	}
+	legacyBucket := util.LegacyBucketName(course.CourseName, course.CreatedAt)
+	others := make([]entity.Course, 0)
+	if err := s.DB.WithContext(ctx).Where("id <> ?", courseID).Find(&others).Error; err != nil {
+		return count, err
+	}
+	for _, other := range others {
+		if util.LegacyBucketName(other.CourseName, other.CreatedAt) == legacyBucket {
+			s.Log.Warnf("Legacy bucket %s is shared with course %d, leaving it in place", legacyBucket, other.ID)
+			return count, nil
+		}
+	}
+	legacyObjects, err := storage.List(ctx, legacyBucket, "")
+	if err != nil {
+		// Courses created after the single-bucket layout have no legacy bucket
+		return count, nil
+	}
+	for _, object := range legacyObjects {
+		if err := storage.Delete(ctx, legacyBucket, object.Key); err != nil {
+			return count, fmt.Errorf("failed to delete %s/%s: %w", legacyBucket, object.Key, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// referencedURLs lists every stored object the course's rows point at,
+// including the files listed in folder-upload manifests
+func (s *CourseDeletionService) referencedURLs(ctx context.Context, courseID int) ([]string, error) {
+	db := s.DB.WithContext(ctx)
+	urls := make([]string, 0)
+	course := &entity.Course{}
+	if err := db.First(course, courseID).Error; err == nil {
+		urls = append(urls, course.GeneralAnswer)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	assignments := make([]entity.Assignment, 0)
+	if err := db.Where("course_id = ?", courseID).Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	for _, assignment := range assignments {
+		urls = append(urls, assignment.AssignmentURL, assignment.TestBundleURL)
+	}
+	var versionURLs, fileURLs []string
+	if err := db.Model(&entity.DocumentVersion{}).Where("course_id = ?", courseID).Pluck("file_url", &versionURLs).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&entity.File{}).Where("course_id = ?", courseID).Pluck("file_url", &fileURLs).Error; err != nil {
+		return nil, err
+	}
+	urls = append(urls, versionURLs...)
+	urls = append(urls, fileURLs...)
+
+	seen := make(map[string]bool, len(urls))
+	unique := make([]string, 0, len(urls))
+	for _, fileURL := range urls {
+		if fileURL == "" || seen[fileURL] {
+			continue
+		}
+		seen[fileURL] = true
+		if IsManifestURL(fileURL) {
+			if content, err := s.MinioUtil.GetFile(ctx, fileURL); err == nil {
+				manifest := &model.ReferenceManifest{}
+				if json.Unmarshal([]byte(content), manifest) == nil {
+					for _, file := range manifest.Files {
+						if !seen[file.FileURL] {
+							seen[file.FileURL] = true
+							unique = append(unique, file.FileURL)
+						}
+					}
+				}
+			}
+		}
+		unique = append(unique, fileURL)
+	}
+	return unique, nil
+}
@@ -7,6 +7,7 @@ import (
 	"be/neurade/v2/internal/repository"
 	"be/neurade/v2/internal/util"
 	"context"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -18,6 +19,9 @@ type CourseService struct {
 	Log              *logrus.Logger
 }
 
+// courseManagedColumns are written by their own endpoints or by the PR sync
+var courseManagedColumns = []string{"archived_at", "pr_synced_at", "github_token", "webhook_id", "webhook_secret", "last_sync_at", "last_sync_status", "last_sync_message"}
+
 func NewCourseService(db *gorm.DB, courseRepository *repository.CourseRepository, log *logrus.Logger) *CourseService {
 	return &CourseService{DB: db, CourseRepository: courseRepository, Log: log}
 }
@@ -97,13 +101,19 @@ func (s *CourseService) Update(ctx context.Context, request *model.CourseUpdateR
 		GithubURL:     request.GithubURL,
 		Owner:         request.Owner,
 		RepoName:      request.RepoName,
+		GitProvider:   request.GitProvider,
 		GeneralAnswer: request.GeneralAnswer,
 		AutoGrade:     request.AutoGrade,
+		PassScore:     request.PassScore,
+		BotHandle:     request.BotHandle,
 		CreatedAt:     request.CreatedAt, // FIX: include CreatedAt
 		UpdatedAt:     request.UpdatedAt,
 	}
 
-	if err := tx.Save(course).Error; err != nil {
+	// Archiving, the course credential and the webhook have their own endpoints
+	// and the sync cursor and outcome are kept by the PR sync; all must survive
+	// ordinary edits
+	if err := tx.Omit(courseManagedColumns...).Save(course).Error; err != nil {
 		s.Log.WithContext(ctx).WithError(err).Error("failed to update course")
 		return nil, err
 	}
@@ -116,25 +126,36 @@ func (s *CourseService) Update(ctx context.Context, request *model.CourseUpdateR
 	return converter.CourseToResponse(course), nil
 }
 
-func (s *CourseService) Delete(ctx context.Context, id int) error {
-	tx := s.DB.WithContext(ctx).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+// SetArchived archives or reopens a course. Archived courses are read-only:
+// no auto-grading, reviews, webhook processing or content changes.
+func (s *CourseService) SetArchived(ctx context.Context, id int, archived bool) (*model.CourseResponse, error) {
+	course := &entity.Course{}
+	if err := s.CourseRepository.FindById(s.DB.WithContext(ctx), course, id); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get course by id")
+		return nil, err
+	}
+	var archivedAt *time.Time
+	if archived {
+		if course.ArchivedAt != nil {
+			return converter.CourseToResponse(course), nil
 		}
-	}()
-
-	course := &entity.Course{ID: id}
-	if err := tx.Delete(course).Error; err != nil {
-		s.Log.WithContext(ctx).WithError(err).Error("failed to delete course")
-		return err
+		now := time.Now()
+		archivedAt = &now
 	}
+	if err := s.DB.WithContext(ctx).Model(course).Updates(map[string]interface{}{"archived_at": archivedAt, "updated_at": time.Now()}).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to update course archive state")
+		return nil, err
+	}
+	course.ArchivedAt = archivedAt
+	return converter.CourseToResponse(course), nil
+}
 
-	if err := tx.Commit().Error; err != nil {
-		s.Log.WithContext(ctx).WithError(err).Error("failed to commit transaction")
+// SetPrSyncedAt moves the course's incremental PR sync cursor
+func (s *CourseService) SetPrSyncedAt(ctx context.Context, id int, syncedAt time.Time) error {
+	if err := s.DB.WithContext(ctx).Model(&entity.Course{}).Where("id = ?", id).Update("pr_synced_at", syncedAt).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to update course pr sync cursor")
 		return err
 	}
-
 	return nil
 }
 
@@ -147,3 +168,27 @@ func (s *CourseService) GetPermissionCoursesByUser(ctx context.Context, userID i
 	}
 	return pucs, nil
 }
+
+// RecordSync stores the outcome of a PR sync of the course
+func (s *CourseService) RecordSync(ctx context.Context, id int, at time.Time, status, message string) error {
+	updates := map[string]interface{}{"last_sync_at": at, "last_sync_status": status, "last_sync_message": message}
+	if err := s.DB.WithContext(ctx).Model(&entity.Course{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to record course sync")
+		return err
+	}
+	return nil
+}
+
+// GetAllActive returns every course that is not archived
+func (s *CourseService) GetAllActive(ctx context.Context) ([]*model.CourseResponse, error) {
+	courses := make([]entity.Course, 0)
+	if err := s.DB.WithContext(ctx).Where("archived_at IS NULL").Order("id").Find(&courses).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get active courses")
+		return nil, err
+	}
+	responses := make([]*model.CourseResponse, 0, len(courses))
+	for i := range courses {
+		responses = append(responses, converter.CourseToResponse(&courses[i]))
+	}
+	return responses, nil
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/util"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// webhookEvents are the repository events course webhooks subscribe to
+var webhookEvents = []string{
+	"pull_request",
+	"pull_request_review",
+	"pull_request_review_thread",
+	"pull_request_review_comment",
+	"issue_comment",
+	"issues",
+	"push",
+}
+
+var (
+	ErrWebhookNotConfigured    = errors.New("webhook endpoint is not configured")
+	ErrWebhookHealthGitHubOnly = errors.New("webhook health is only reported for GitHub repositories")
+	ErrWebhookNotRegistered    = errors.New("course has no registered webhook")
+	ErrWebhookSignatureInvalid = errors.New("invalid webhook signature")
+	ErrWebhookLocalCourse      = errors.New("local courses receive submissions by git push and have no webhook")
+)
+
+// CourseWebhookService keeps one webhook on each course repository, pointing at
+// URL, or GitLabURL for GitLab projects, and signed with a secret generated for
+// the course. Secret is the global fallback for hooks set up by hand.
+type CourseWebhookService struct {
+	DB                 *gorm.DB
+	GitHubService      *GitHubService
+	GitProviders       *GitProviders
+	GitHubTokenService *GitHubTokenService
+	URL                string
+	GitLabURL          string
+	Secret             string
+	Log                *logrus.Logger
+}
+
+func NewCourseWebhookService(db *gorm.DB, githubService *GitHubService, gitProviders *GitProviders, githubTokenService *GitHubTokenService, url string, gitlabURL string, secret string, log *logrus.Logger) *CourseWebhookService {
+	return &CourseWebhookService{
+		DB:                 db,
+		GitHubService:      githubService,
+		GitProviders:       gitProviders,
+		GitHubTokenService: githubTokenService,
+		URL:                url,
+		GitLabURL:          gitlabURL,
+		Secret:             secret,
+		Log:                log,
+	}
+}
+
+// Register creates the course's webhook, or brings an existing one back in
+// line with our URL, events and secret. A hook already pointing at the URL,
+// such as one added by hand, is adopted instead of adding a second one.
+func (s *CourseWebhookService) Register(ctx context.Context, courseID int) (*model.GitHubHook, error) {
+	course, provider, repo, token, err := s.load(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	hookURL := s.URL
+	if repo.Provider == util.GitProviderGitLab {
+		hookURL = s.GitLabURL
+	}
+	if hookURL == "" {
+		return nil, ErrWebhookNotConfigured
+	}
+	secret := course.WebhookSecret
+	if secret == "" {
+		if secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	request := &model.GitHubHookRequest{
+		Name:   "web",
+		Active: true,
+		Events: webhookEvents,
+		Config: model.GitHubHookConfig{URL: hookURL, ContentType: "json", InsecureSSL: "0", Secret: secret},
+	}
+	hook, err := provider.RegisterWebhook(ctx, repo, token, course.WebhookID, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.WithContext(ctx).Model(course).Updates(map[string]interface{}{"webhook_id": hook.ID, "webhook_secret": secret}).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to save course webhook")
+		return nil, err
+	}
+	s.Log.Infof("Webhook %d registered on %s for course %d", hook.ID, repo.Path(), courseID)
+	return hook, nil
+}
+
+// Unregister removes the course's webhook from its repository. A hook that is
+// already gone counts as removed.
+func (s *CourseWebhookService) Unregister(ctx context.Context, courseID int) error {
+	course, provider, repo, token, err := s.load(ctx, courseID)
+	if errors.Is(err, ErrWebhookLocalCourse) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if course.WebhookID == 0 {
+		return nil
+	}
+	if err := provider.DeleteWebhook(ctx, repo, token, course.WebhookID); err != nil && !IsNotFound(err) {
+		return err
+	}
+	if err := s.DB.WithContext(ctx).Model(course).Update("webhook_id", 0).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to clear course webhook")
+		return err
+	}
+	s.Log.Infof("Webhook %d removed from %s for course %d", course.WebhookID, repo.Path(), courseID)
+	return nil
+}
+
+// Health reports the webhook's configuration and its latest deliveries
+func (s *CourseWebhookService) Health(ctx context.Context, courseID int) (*model.WebhookHealthResponse, error) {
+	course, _, ref, token, err := s.load(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Provider != util.GitProviderGitHub {
+		return nil, ErrWebhookHealthGitHubOnly
+	}
+	owner, repo := ref.Owner, ref.Name
+	if course.WebhookID == 0 {
+		return nil, ErrWebhookNotRegistered
+	}
+	hook, err := s.GitHubService.GetHook(ctx, owner, repo, course.WebhookID, token)
+	if err != nil {
+		if IsGitHubNotFound(err) {
+			return nil, fmt.Errorf("%w: hook %d no longer exists on %s/%s", ErrWebhookNotRegistered, course.WebhookID, owner, repo)
+		}
+		return nil, err
+	}
+	deliveries, err := s.GitHubService.ListHookDeliveries(ctx, owner, repo, course.WebhookID, token, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &model.WebhookHealthResponse{
+		CourseID:     courseID,
+		WebhookID:    hook.ID,
+		URL:          hook.Config.URL,
+		Active:       hook.Active,
+		Events:       hook.Events,
+		LastResponse: hook.LastResponse,
+		Deliveries:   deliveries,
+	}
+	// A hook that has not delivered anything yet is healthy until it fails
+	healthy := hook.LastResponse.Code == nil || isSuccessStatus(*hook.LastResponse.Code)
+	if len(deliveries) > 0 {
+		response.LastDelivery = &deliveries[0]
+		healthy = isSuccessStatus(deliveries[0].StatusCode)
+	}
+	response.Healthy = hook.Active && healthy
+	return response, nil
+}
+
+// VerifySignature checks a delivery's X-Hub-Signature-256 against the secrets
+// of the courses on the repository at repoURL, then the global secret.
+// Several terms of a course may share one repository, each with its own hook.
+// repoURL must be the URL the event is routed by, so a course's secret only
+// admits events for its own repository.
+func (s *CourseWebhookService) VerifySignature(ctx context.Context, repoURL string, body []byte, signature string) error {
+	secrets, err := s.secrets(ctx, util.GitProviderGitHub, repoURL)
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		if util.VerifyGitHubSignature(secret, body, signature) {
+			return nil
+		}
+	}
+	return ErrWebhookSignatureInvalid
+}
+
+// VerifyToken checks the X-Gitlab-Token of a GitLab delivery the same way.
+// GitLab sends the hook's secret as is instead of signing the payload.
+func (s *CourseWebhookService) VerifyToken(ctx context.Context, repoURL string, token string) error {
+	secrets, err := s.secrets(ctx, util.GitProviderGitLab, repoURL)
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		if token != "" && util.SecureCompare(token, secret) {
+			return nil
+		}
+	}
+	return ErrWebhookSignatureInvalid
+}
+
+// secrets returns the webhook secrets of the provider's courses whose
+// repository URL, host included, is repoURL, matched the way events are
+// routed to a course, followed by the global secret
+func (s *CourseWebhookService) secrets(ctx context.Context, provider string, repoURL string) ([]string, error) {
+	secrets := make([]string, 0)
+	if repoURL = util.NormalizeGithubURL(repoURL); repoURL != "" {
+		courses := make([]entity.Course, 0)
+		if err := s.DB.WithContext(ctx).Select("github_url", "git_provider", "webhook_secret").
+			Where("webhook_secret <> ''").Find(&courses).Error; err != nil {
+			s.Log.WithContext(ctx).WithError(err).Error("failed to get course webhook secrets")
+			return nil, err
+		}
+		for _, course := range courses {
+			if util.GitProviderOf(course.GithubURL, course.GitProvider) == provider && util.NormalizeGithubURL(course.GithubURL) == repoURL {
+				secrets = append(secrets, course.WebhookSecret)
+			}
+		}
+	}
+	if s.Secret != "" {
+		secrets = append(secrets, s.Secret)
+	}
+	return secrets, nil
+}
+
+// SameRepository reports whether a delivery's repository path, such as
+// "owner/repo", is the one its repository URL points at. Events are routed
+// by the URL, so a payload naming another repository in its path is forged.
+// Events about no repository, such as an app's, have neither.
+func SameRepository(path, repoURL string) bool {
+	if path == "" && repoURL == "" {
+		return true
+	}
+	ref, err := util.ParseRepoURL(repoURL, "")
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ref.Path(), path)
+}
+
+func (s *CourseWebhookService) load(ctx context.Context, courseID int) (*entity.Course, GitProvider, *util.RepoRef, string, error) {
+	course := &entity.Course{}
+	if err := s.DB.WithContext(ctx).First(course, courseID).Error; err != nil {
+		return nil, nil, nil, "", err
+	}
+	if course.GitProvider == util.GitProviderLocal {
+		return nil, nil, nil, "", ErrWebhookLocalCourse
+	}
+	provider, repo, err := s.GitProviders.For(course.GithubURL, course.GitProvider)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	token, err := s.GitHubTokenService.Token(ctx, courseID)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	return course, provider, repo, token, nil
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func isSuccessStatus(code int) bool {
+	return code >= 200 && code <= 299
+}
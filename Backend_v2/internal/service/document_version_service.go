@@ -0,0 +1,387 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"be/neurade/v2/internal/util"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	DocTypeCodingConvention = "coding_convention"
+	DocTypeAssignmentAnswer = "assignment_answer"
+)
+
+// ManifestName is the object that lists the files of a folder upload
+const ManifestName = "manifest.json"
+
+// DocumentVersionService keeps every uploaded convention and answer document
+// as an immutable, numbered object and moves the course or assignment pointer
+type DocumentVersionService struct {
+	DB                        *gorm.DB
+	DocumentVersionRepository *repository.DocumentVersionRepository
+	MinioUtil                 *util.MinioUtil
+	Log                       *logrus.Logger
+}
+
+func NewDocumentVersionService(db *gorm.DB, documentVersionRepository *repository.DocumentVersionRepository, minioUtil *util.MinioUtil, log *logrus.Logger) *DocumentVersionService {
+	return &DocumentVersionService{
+		DB:                        db,
+		DocumentVersionRepository: documentVersionRepository,
+		MinioUtil:                 minioUtil,
+		Log:                       log,
+	}
+}
+
+// Upload stores a new version and makes it the current document
+func (s *DocumentVersionService) Upload(ctx context.Context, course *model.CourseResponse, request *model.DocumentUploadRequest) (*model.DocumentVersionResponse, error) {
+	tx := s.DB.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	latest, err := s.DocumentVersionRepository.FindLatestVersion(tx, request.CourseID, request.AssignmentID, request.DocType)
+	if err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get latest document version")
+		return nil, err
+	}
+	version := latest + 1
+
+	fileURL, size, checksum, err := s.store(ctx, course, request, version)
+	if err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to store document")
+		return nil, err
+	}
+
+	documentVersion := &entity.DocumentVersion{
+		CourseID:     request.CourseID,
+		AssignmentID: request.AssignmentID,
+		DocType:      request.DocType,
+		Version:      version,
+		FileURL:      fileURL,
+		FileName:     request.FileName,
+		Size:         size,
+		Checksum:     checksum,
+		UploadedBy:   request.UploadedBy,
+		Note:         request.Note,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.DocumentVersionRepository.Create(tx, documentVersion); err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to create document version")
+		return nil, err
+	}
+	if err := s.setCurrent(tx, documentVersion); err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to point document to new version")
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to commit transaction")
+		return nil, err
+	}
+
+	response := converter.DocumentVersionToResponse(documentVersion)
+	response.Current = true
+	return response, nil
+}
+
+// Rollback records a new version that reuses an older version's object, so the
+// changelog shows the rollback and nothing is overwritten
+func (s *DocumentVersionService) Rollback(ctx context.Context, versionID int, userID int) (*model.DocumentVersionResponse, error) {
+	tx := s.DB.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	target := &entity.DocumentVersion{}
+	if err := s.DocumentVersionRepository.FindById(tx, target, versionID); err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get document version by id")
+		return nil, err
+	}
+	course := &entity.Course{}
+	if err := tx.Select("id", "archived_at").First(course, target.CourseID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if course.ArchivedAt != nil {
+		tx.Rollback()
+		return nil, errors.New("course is archived")
+	}
+	latest, err := s.DocumentVersionRepository.FindLatestVersion(tx, target.CourseID, target.AssignmentID, target.DocType)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if latest == target.Version {
+		tx.Rollback()
+		return nil, errors.New("version is already current")
+	}
+
+	documentVersion := &entity.DocumentVersion{
+		CourseID:     target.CourseID,
+		AssignmentID: target.AssignmentID,
+		DocType:      target.DocType,
+		Version:      latest + 1,
+		FileURL:      target.FileURL,
+		FileName:     target.FileName,
+		Size:         target.Size,
+		Checksum:     target.Checksum,
+		UploadedBy:   userID,
+		Note:         fmt.Sprintf("rollback to version %d", target.Version),
+		CreatedAt:    time.Now(),
+	}
+	if err := s.DocumentVersionRepository.Create(tx, documentVersion); err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to create rollback version")
+		return nil, err
+	}
+	if err := s.setCurrent(tx, documentVersion); err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to point document to rolled back version")
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to commit transaction")
+		return nil, err
+	}
+
+	response := converter.DocumentVersionToResponse(documentVersion)
+	response.Current = true
+	return response, nil
+}
+
+// GetChangelog lists every version of a course's documents, newest first per
+// document; pass assignmentID < 0 for all documents of the course
+func (s *DocumentVersionService) GetChangelog(ctx context.Context, courseID, assignmentID int) ([]*model.DocumentVersionResponse, error) {
+	versions := make([]entity.DocumentVersion, 0)
+	var err error
+	if assignmentID < 0 {
+		err = s.DocumentVersionRepository.FindAllByCourse(s.DB, &versions, courseID)
+	} else {
+		docType := DocTypeAssignmentAnswer
+		if assignmentID == 0 {
+			docType = DocTypeCodingConvention
+		}
+		err = s.DocumentVersionRepository.FindAllByDocument(s.DB, &versions, courseID, assignmentID, docType)
+	}
+	if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get document changelog")
+		return nil, err
+	}
+
+	responses := make([]*model.DocumentVersionResponse, 0, len(versions))
+	seen := make(map[string]bool)
+	for i := range versions {
+		response := converter.DocumentVersionToResponse(&versions[i])
+		key := fmt.Sprintf("%d-%s", versions[i].AssignmentID, versions[i].DocType)
+		// Versions come newest first per document, so the first one seen is current
+		response.Current = !seen[key]
+		seen[key] = true
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// GetByFileURL finds the newest version stored at fileURL, for recording which
+// document a review used
+func (s *DocumentVersionService) GetByFileURL(ctx context.Context, fileURL string) (*model.DocumentVersionResponse, error) {
+	documentVersion := &entity.DocumentVersion{}
+	if err := s.DocumentVersionRepository.FindByFileURL(s.DB.WithContext(ctx), documentVersion, fileURL); err != nil {
+		return nil, err
+	}
+	return converter.DocumentVersionToResponse(documentVersion), nil
+}
+
+// UsedVersions describes the document versions behind the given file URLs in
+// the shape stored on a review result; unknown URLs are skipped
+func (s *DocumentVersionService) UsedVersions(ctx context.Context, fileURLs ...string) []map[string]interface{} {
+	used := make([]map[string]interface{}, 0, len(fileURLs))
+	for _, fileURL := range fileURLs {
+		if fileURL == "" {
+			continue
+		}
+		version, err := s.GetByFileURL(ctx, fileURL)
+		if err != nil {
+			continue
+		}
+		used = append(used, map[string]interface{}{
+			"version_id":    version.ID,
+			"doc_type":      version.DocType,
+			"assignment_id": version.AssignmentID,
+			"version":       version.Version,
+		})
+	}
+	return used
+}
+
+// GetReferenceFiles lists the files behind a document URL. Single-file
+// documents come back as a manifest with one entry.
+func (s *DocumentVersionService) GetReferenceFiles(ctx context.Context, fileURL string) (*model.ReferenceManifest, error) {
+	if fileURL == "" {
+		return &model.ReferenceManifest{Files: []model.ReferenceFile{}}, nil
+	}
+	if !IsManifestURL(fileURL) {
+		_, objectName, err := s.MinioUtil.ParseMinioURL(fileURL)
+		if err != nil {
+			return nil, err
+		}
+		return &model.ReferenceManifest{
+			FileName: objectName,
+			Files:    []model.ReferenceFile{{Path: objectName, FileURL: fileURL}},
+		}, nil
+	}
+
+	content, err := s.MinioUtil.GetFile(ctx, fileURL)
+	if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to read reference manifest")
+		return nil, err
+	}
+	manifest := &model.ReferenceManifest{}
+	if err := json.Unmarshal([]byte(content), manifest); err != nil {
+		return nil, fmt.Errorf("invalid reference manifest %s: %w", fileURL, err)
+	}
+	return manifest, nil
+}
+
+// IsManifestURL reports whether fileURL points at a folder upload's manifest
+func IsManifestURL(fileURL string) bool {
+	return strings.HasSuffix(fileURL, "/"+ManifestName)
+}
+
+// store writes the document and returns its URL, total size and checksum. An
+// archive or multi-file upload is written as a tree plus a manifest, and the
+// manifest's URL is what the course or assignment points to.
+func (s *DocumentVersionService) store(ctx context.Context, course *model.CourseResponse, request *model.DocumentUploadRequest, version int) (string, int64, string, error) {
+	prefix := "course"
+	if request.DocType == DocTypeAssignmentAnswer {
+		prefix = "assignment"
+	}
+
+	files := request.Files
+	if len(files) == 0 && util.IsArchive(request.Content) {
+		entries, err := util.ReadArchive(request.Content)
+		if err != nil {
+			return "", 0, "", err
+		}
+		for _, entry := range entries {
+			files = append(files, model.DocumentFile{Path: entry.Path, Data: entry.Data})
+		}
+	}
+
+	if len(files) == 0 {
+		objectName := fmt.Sprintf("%d-%s-%d-v%d", request.AssignmentID, request.FileName, time.Now().Unix(), version)
+		fileURL, err := s.MinioUtil.SaveObject(ctx, course.ID, prefix, objectName, request.Content, util.ContentTypeFor(request.FileName, request.Content))
+		if err != nil {
+			return "", 0, "", err
+		}
+		checksum := sha256.Sum256(request.Content)
+		return fileURL, int64(len(request.Content)), hex.EncodeToString(checksum[:]), nil
+	}
+
+	files = normalizeDocumentFiles(files)
+	if len(files) == 0 {
+		return "", 0, "", errors.New("upload contains no files")
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	treePrefix := fmt.Sprintf("%s-%d-%d-v%d", prefix, request.AssignmentID, time.Now().Unix(), version)
+	manifest := &model.ReferenceManifest{
+		AssignmentID: request.AssignmentID,
+		Version:      version,
+		FileName:     request.FileName,
+		Files:        make([]model.ReferenceFile, 0, len(files)),
+		CreatedAt:    time.Now(),
+	}
+	treeHash := sha256.New()
+	var size int64
+	for _, file := range files {
+		contentType := util.ContentTypeFor(file.Path, file.Data)
+		fileURL, err := s.MinioUtil.SaveTreeObject(ctx, course.ID, treePrefix, file.Path, file.Data, contentType)
+		if err != nil {
+			return "", 0, "", err
+		}
+		checksum := sha256.Sum256(file.Data)
+		manifest.Files = append(manifest.Files, model.ReferenceFile{
+			Path:        file.Path,
+			FileURL:     fileURL,
+			Size:        int64(len(file.Data)),
+			ContentType: contentType,
+			Checksum:    hex.EncodeToString(checksum[:]),
+		})
+		fmt.Fprintf(treeHash, "%s:%x\n", file.Path, checksum)
+		size += int64(len(file.Data))
+	}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return "", 0, "", err
+	}
+	manifestURL, err := s.MinioUtil.SaveTreeObject(ctx, course.ID, treePrefix, ManifestName, manifestJSON, "application/json")
+	if err != nil {
+		return "", 0, "", err
+	}
+	return manifestURL, size, hex.EncodeToString(treeHash.Sum(nil)), nil
+}
+
+// normalizeDocumentFiles cleans client-supplied paths, drops OS metadata files
+// and, when every file sits below the same top-level folder (as with
+// "solution.zip" containing "solution/"), strips that folder too
+func normalizeDocumentFiles(files []model.DocumentFile) []model.DocumentFile {
+	kept := make([]model.DocumentFile, 0, len(files))
+	for _, file := range files {
+		file.Path = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(file.Path, "\\", "/")), "/")
+		base := path.Base(file.Path)
+		if file.Path == "" || strings.HasPrefix(file.Path, "__MACOSX/") || base == ".DS_Store" || base == "Thumbs.db" {
+			continue
+		}
+		kept = append(kept, file)
+	}
+	if len(kept) == 0 {
+		return kept
+	}
+
+	root, _, found := strings.Cut(kept[0].Path, "/")
+	if !found {
+		return kept
+	}
+	for _, file := range kept[1:] {
+		if !strings.HasPrefix(file.Path, root+"/") {
+			return kept
+		}
+	}
+	for i := range kept {
+		kept[i].Path = strings.TrimPrefix(kept[i].Path, root+"/")
+	}
+	return kept
+}
+
+func (s *DocumentVersionService) setCurrent(tx *gorm.DB, version *entity.DocumentVersion) error {
+	if version.DocType == DocTypeAssignmentAnswer {
+		return tx.Model(&entity.Assignment{}).Where("id = ?", version.AssignmentID).
+			Updates(map[string]interface{}{"assignment_url": version.FileURL, "updated_at": time.Now()}).Error
+	}
+	return tx.Model(&entity.Course{}).Where("id = ?", version.CourseID).
+		Updates(map[string]interface{}{"general_answer": version.FileURL, "updated_at": time.Now()}).Error
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"be/neurade/v2/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	FilePurposeAgentReview = "agent_review"
+	FilePurposeAgentChat   = "agent_chat"
+)
+
+// ValidFilePurpose reports whether a file token was issued for a purpose this
+// service hands out
+func ValidFilePurpose(purpose string) bool {
+	return purpose == FilePurposeAgentReview || purpose == FilePurposeAgentChat
+}
+
+// AgentFileTokenTTL bounds how long an agent can fetch files it was handed;
+// long enough for one review, short enough that a leaked link is useless
+const AgentFileTokenTTL = 30 * time.Minute
+
+// FileService gives stored objects stable IDs so they can be served through
+// the authenticated /files/{id} endpoint instead of presigned storage links
+type FileService struct {
+	DB             *gorm.DB
+	FileRepository *repository.FileRepository
+	MinioUtil      *util.MinioUtil
+	JWTUtil        *util.JWTUtil
+	BaseURL        string
+	Log            *logrus.Logger
+}
+
+func NewFileService(db *gorm.DB, fileRepository *repository.FileRepository, minioUtil *util.MinioUtil, jwtUtil *util.JWTUtil, baseURL string, log *logrus.Logger) *FileService {
+	return &FileService{
+		DB:             db,
+		FileRepository: fileRepository,
+		MinioUtil:      minioUtil,
+		JWTUtil:        jwtUtil,
+		BaseURL:        baseURL,
+		Log:            log,
+	}
+}
+
+// Register returns the file record of a minio:// URL, creating it on first use
+func (s *FileService) Register(ctx context.Context, courseID int, fileURL string) (*model.FileResponse, error) {
+	if fileURL == "" {
+		return nil, errors.New("file URL is empty")
+	}
+	db := s.DB.WithContext(ctx)
+	file := &entity.File{}
+	err := s.FileRepository.FindByFileURL(db, file, fileURL)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		file = &entity.File{CourseID: courseID, FileURL: fileURL, CreatedAt: time.Now()}
+		if err := s.FileRepository.CreateIfMissing(db, file); err != nil {
+			s.Log.WithContext(ctx).WithError(err).Error("failed to register file")
+			return nil, err
+		}
+		// A concurrent request may have registered it first
+		err = s.FileRepository.FindByFileURL(db, file, fileURL)
+	}
+	if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get file by url")
+		return nil, err
+	}
+	return converter.FileToResponse(file), nil
+}
+
+// Path returns the /files/{id} path of a stored object, or "" when there is
+// no file or it cannot be registered
+func (s *FileService) Path(ctx context.Context, courseID int, fileURL string) string {
+	if fileURL == "" {
+		return ""
+	}
+	file, err := s.Register(ctx, courseID, fileURL)
+	if err != nil {
+		return ""
+	}
+	return file.URL
+}
+
+// SignedURL returns an absolute /files/{id} link carrying a short-lived token
+// for one purpose, for callers such as the agents that have no user session
+func (s *FileService) SignedURL(ctx context.Context, courseID int, fileURL string, purpose string, ttl time.Duration) (string, error) {
+	file, err := s.Register(ctx, courseID, fileURL)
+	if err != nil {
+		return "", err
+	}
+	token, err := s.JWTUtil.GenerateFileToken(file.ID, purpose, ttl)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s?token=%s", s.BaseURL, file.URL, url.QueryEscape(token)), nil
+}
+
+func (s *FileService) GetByID(ctx context.Context, id int) (*model.FileResponse, error) {
+	file := &entity.File{}
+	if err := s.FileRepository.FindById(s.DB.WithContext(ctx), file, id); err != nil {
+		return nil, err
+	}
+	return converter.FileToResponse(file), nil
+}
+
+// Open streams the object behind a file ID
+func (s *FileService) Open(ctx context.Context, id int) (io.ReadSeekCloser, *util.ObjectInfo, error) {
+	file := &entity.File{}
+	if err := s.FileRepository.FindById(s.DB.WithContext(ctx), file, id); err != nil {
+		return nil, nil, err
+	}
+	bucketName, objectName, err := s.MinioUtil.ParseMinioURL(file.FileURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.MinioUtil.Storage.Open(ctx, bucketName, objectName)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GitProvider is what the platform needs from a git host. Pull requests,
+// files, reviews and hooks are exchanged in the GitHub shapes of the model
+// package, which GitLab merge requests are converted to and from.
+type GitProvider interface {
+	// ListPullRequests returns every PR, newest update first, stopping at
+	// those updated before since when it is set
+	ListPullRequests(ctx context.Context, repo *util.RepoRef, token string, since *time.Time) ([]model.GitHubPullRequest, error)
+	GetPullRequest(ctx context.Context, repo *util.RepoRef, number int, token string) (*model.GitHubPullRequest, error)
+	// GetPullRequestFiles returns the PR's diff, one patch per changed file
+	GetPullRequestFiles(ctx context.Context, repo *util.RepoRef, number int, token string) ([]model.GitHubPullRequestFile, error)
+	GetFileContent(ctx context.Context, repo *util.RepoRef, path, ref, token string) (string, error)
+	// CreateReview posts the review body and its comments, which are anchored
+	// by GitHub diff position
+	CreateReview(ctx context.Context, repo *util.RepoRef, number int, token string, review *model.GitHubReviewRequest) error
+	CreateComment(ctx context.Context, repo *util.RepoRef, number int, token, body string) error
+	// ReplyToThread answers in the thread of a comment: a review comment ID on
+	// GitHub, a discussion ID on GitLab
+	ReplyToThread(ctx context.Context, repo *util.RepoRef, number int, threadID, token, body string) error
+	// RegisterWebhook creates or updates the repository hook; hookID is the
+	// one registered before, or 0
+	RegisterWebhook(ctx context.Context, repo *util.RepoRef, token string, hookID int64, request *model.GitHubHookRequest) (*model.GitHubHook, error)
+	DeleteWebhook(ctx context.Context, repo *util.RepoRef, token string, hookID int64) error
+	// GetRepositoryName checks the token can reach the repository and returns
+	// its full name
+	GetRepositoryName(ctx context.Context, repo *util.RepoRef, token string) (string, error)
+	// GetAuthenticatedLogin returns the username the token comments as
+	GetAuthenticatedLogin(ctx context.Context, repo *util.RepoRef, token string) (string, error)
+}
+
+// GitProviders picks the provider of each course
+type GitProviders struct {
+	GitHub GitProvider
+	GitLab GitProvider
+	Local  GitProvider
+}
+
+func NewGitProviders(github GitProvider, gitlab GitProvider, local GitProvider) *GitProviders {
+	return &GitProviders{
+		GitHub: github,
+		GitLab: gitlab,
+		Local:  local,
+	}
+}
+
+// For returns the provider and repository of a course from its repository URL
+// and provider setting
+func (p *GitProviders) For(repoURL string, provider string) (GitProvider, *util.RepoRef, error) {
+	repo, err := util.ParseRepoURL(repoURL, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch repo.Provider {
+	case util.GitProviderGitHub:
+		return p.GitHub, repo, nil
+	case util.GitProviderGitLab:
+		return p.GitLab, repo, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported git provider %q", repo.Provider)
+}
+
+// ForCourse is For with the course's settings. Local courses have no URL and
+// get the repositories this server hosts for them.
+func (p *GitProviders) ForCourse(course *model.CourseResponse) (GitProvider, *util.RepoRef, error) {
+	if course.GitProvider == util.GitProviderLocal {
+		return p.Local, util.LocalRepoRef(course.ID), nil
+	}
+	return p.For(course.GithubURL, course.GitProvider)
+}
+
+// IsNotFound reports whether err is the git host answering 404
+func IsNotFound(err error) bool {
+	var apiErr *GitLabAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusNotFound
+	}
+	return IsGitHubNotFound(err)
+}
+
+// GitHubProvider is the GitProvider of github.com, on top of GitHubService
+type GitHubProvider struct {
+	GitHubService *GitHubService
+}
+
+func NewGitHubProvider(githubService *GitHubService) *GitHubProvider {
+	return &GitHubProvider{GitHubService: githubService}
+}
+
+func (p *GitHubProvider) ListPullRequests(ctx context.Context, repo *util.RepoRef, token string, since *time.Time) ([]model.GitHubPullRequest, error) {
+	return p.GitHubService.GetPullRequests(ctx, "https://github.com/"+repo.Path(), token, since)
+}
+
+func (p *GitHubProvider) GetPullRequest(ctx context.Context, repo *util.RepoRef, number int, token string) (*model.GitHubPullRequest, error) {
+	return p.GitHubService.GetPullRequest(ctx, repo.Owner, repo.Name, number, token)
+}
+
+func (p *GitHubProvider) GetPullRequestFiles(ctx context.Context, repo *util.RepoRef, number int, token string) ([]model.GitHubPullRequestFile, error) {
+	return p.GitHubService.GetPullRequestFiles(ctx, repo.Owner, repo.Name, number, token)
+}
+
+func (p *GitHubProvider) GetFileContent(ctx context.Context, repo *util.RepoRef, path, ref, token string) (string, error) {
+	return p.GitHubService.GetFileContent(ctx, repo.Owner, repo.Name, path, ref, token)
+}
+
+func (p *GitHubProvider) CreateReview(ctx context.Context, repo *util.RepoRef, number int, token string, review *model.GitHubReviewRequest) error {
+	return p.GitHubService.CreateReview(ctx, repo.Owner, repo.Name, number, token, review)
+}
+
+func (p *GitHubProvider) CreateComment(ctx context.Context, repo *util.RepoRef, number int, token, body string) error {
+	return p.GitHubService.CreateIssueComment(ctx, repo.Owner, repo.Name, number, token, body)
+}
+
+func (p *GitHubProvider) ReplyToThread(ctx context.Context, repo *util.RepoRef, number int, threadID, token, body string) error {
+	commentID, err := strconv.ParseInt(threadID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid comment ID %q: %w", threadID, err)
+	}
+	return p.GitHubService.ReplyToReviewComment(ctx, repo.Owner, repo.Name, number, commentID, token, body)
+}
+
+// RegisterWebhook updates the hook registered before, or adopts a hook already
+// pointing at the same URL, such as one added by hand, before creating one
+func (p *GitHubProvider) RegisterWebhook(ctx context.Context, repo *util.RepoRef, token string, hookID int64, request *model.GitHubHookRequest) (*model.GitHubHook, error) {
+	if hookID != 0 {
+		hook, err := p.GitHubService.UpdateHook(ctx, repo.Owner, repo.Name, hookID, token, request)
+		if err == nil || !IsGitHubNotFound(err) {
+			return hook, err
+		}
+	}
+	hooks, err := p.GitHubService.ListHooks(ctx, repo.Owner, repo.Name, token)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range hooks {
+		if existing.Config.URL == request.Config.URL {
+			return p.GitHubService.UpdateHook(ctx, repo.Owner, repo.Name, existing.ID, token, request)
+		}
+	}
+	return p.GitHubService.CreateHook(ctx, repo.Owner, repo.Name, token, request)
+}
+
+func (p *GitHubProvider) DeleteWebhook(ctx context.Context, repo *util.RepoRef, token string, hookID int64) error {
+	return p.GitHubService.DeleteHook(ctx, repo.Owner, repo.Name, hookID, token)
+}
+
+func (p *GitHubProvider) GetRepositoryName(ctx context.Context, repo *util.RepoRef, token string) (string, error) {
+	info, err := p.GitHubService.GetRepositoryInfo(ctx, "https://github.com/"+repo.Path(), token)
+	if err != nil {
+		return "", err
+	}
+	return info.FullName, nil
+}
+
+func (p *GitHubProvider) GetAuthenticatedLogin(ctx context.Context, repo *util.RepoRef, token string) (string, error) {
+	user, err := p.GitHubService.GetAuthenticatedUser(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return user.Login, nil
+}
@@ -3,11 +3,14 @@ package service
 import (
 	"be/neurade/v2/internal/model"
 	"be/neurade/v2/internal/util"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -15,100 +18,402 @@ import (
 )
 
 type GitHubService struct {
-	Log *logrus.Logger
+	Client *util.GitHubClient
+	Log    *logrus.Logger
 }
 
-func NewGitHubService(log *logrus.Logger) *GitHubService {
+func NewGitHubService(client *util.GitHubClient, log *logrus.Logger) *GitHubService {
 	return &GitHubService{
-		Log: log,
+		Client: client,
+		Log:    log,
 	}
 }
 
-func (s *GitHubService) GetPullRequests(ctx context.Context, githubURL string, githubToken string) ([]model.GitHubPullRequest, error) {
+// GetPullRequests lists every pull request of the repository, whether open,
+// closed or merged, following the Link header from page to page. With since
+// set only PRs updated at or after it are returned: GitHub sorts them by update
+// time, so paging stops at the first older one.
+func (s *GitHubService) GetPullRequests(ctx context.Context, githubURL string, githubToken string, since *time.Time) ([]model.GitHubPullRequest, error) {
 	owner, repo, err := util.ParseGitHubURL(githubURL)
 	if err != nil {
-		s.Log.Errorf("Cannot parse github url: %v", err)
+		return nil, fmt.Errorf("cannot parse github url: %w", err)
 	}
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls", owner, repo)
-	s.Log.Info("apiURL", apiURL)
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls?state=all&sort=updated&direction=desc&per_page=100", owner, repo)
+
+	pullRequests := make([]model.GitHubPullRequest, 0)
+	pages := 0
+	for apiURL != "" {
+		var batch []model.GitHubPullRequest
+		next, err := s.getPage(ctx, apiURL, githubToken, &batch)
+		if err != nil {
+			return nil, err
+		}
+		pages++
+		for _, pr := range batch {
+			if since != nil {
+				updatedAt, err := time.Parse(time.RFC3339, pr.UpdatedAt)
+				if err == nil && updatedAt.Before(*since) {
+					next = ""
+					break
+				}
+			}
+			pullRequests = append(pullRequests, pr)
+		}
+		apiURL = next
 	}
 
-	// Set headers
-	req.Header.Set("Authorization", "Bearer "+githubToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "Neurade-Backend")
+	s.Log.Infof("Fetched %d pull requests from %s/%s in %d pages", len(pullRequests), owner, repo, pages)
+	return pullRequests, nil
+}
 
-	// In GetPullRequests, set client timeout to 5 minutes
-	client := &http.Client{Timeout: 5 * time.Minute}
-	resp, err := client.Do(req)
+func (s *GitHubService) GetRepositoryInfo(ctx context.Context, githubURL, githubToken string) (*model.GitHubRepository, error) {
+	owner, repo, err := util.ParseGitHubURL(githubURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, fmt.Errorf("cannot parse github url: %w", err)
 	}
-	defer resp.Body.Close()
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
+	var repository model.GitHubRepository
+	if err := s.getJSON(ctx, apiURL, githubToken, &repository); err != nil {
+		return nil, err
+	}
+	return &repository, nil
+}
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("GitHub API error: %s - %s", resp.Status, string(body))
+// GetAuthenticatedUser returns the account a token belongs to, which also
+// proves the token is valid
+func (s *GitHubService) GetAuthenticatedUser(ctx context.Context, githubToken string) (*model.GitHubUser, error) {
+	var user model.GitHubUser
+	if err := s.getJSON(ctx, "https://api.github.com/user", githubToken, &user); err != nil {
+		return nil, err
 	}
-	// Log response body for debugging
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	s.Log.Printf("GitHub API response: %s", string(bodyBytes))
+	return &user, nil
+}
 
-	// Recreate reader for decoding
-	resp.Body = io.NopCloser(strings.NewReader(string(bodyBytes)))
-	// Parse response
-	var pullRequests []model.GitHubPullRequest
-	if err := json.NewDecoder(resp.Body).Decode(&pullRequests); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// GetPullRequest fetches a single pull request, mainly for its head and base SHA
+func (s *GitHubService) GetPullRequest(ctx context.Context, owner, repo string, prNumber int, githubToken string) (*model.GitHubPullRequest, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d", owner, repo, prNumber)
+	var pullRequest model.GitHubPullRequest
+	if err := s.getJSON(ctx, apiURL, githubToken, &pullRequest); err != nil {
+		return nil, err
 	}
+	return &pullRequest, nil
+}
 
-	s.Log.Infof("Fetched %d pull requests from %s/%s", len(pullRequests), owner, repo)
-	return pullRequests, nil
+// GetPullRequestFiles lists every changed file of a pull request with its patch
+func (s *GitHubService) GetPullRequestFiles(ctx context.Context, owner, repo string, prNumber int, githubToken string) ([]model.GitHubPullRequestFile, error) {
+	files := make([]model.GitHubPullRequestFile, 0)
+	// GitHub caps this endpoint at 3000 files, 100 per page
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/files?per_page=100", owner, repo, prNumber)
+	for apiURL != "" {
+		var batch []model.GitHubPullRequestFile
+		next, err := s.getPage(ctx, apiURL, githubToken, &batch)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, batch...)
+		apiURL = next
+	}
+	return files, nil
 }
 
-func (s *GitHubService) GetRepositoryInfo(ctx context.Context, githubURL, githubToken string) (*model.GitHubRepository, error) {
-	owner, repo, err := util.ParseGitHubURL(githubURL)
-	if err != nil {
-		s.Log.Errorf("Cannot parse github url: %v", err)
+// ListIssueComments returns the comments on the pull request's conversation,
+// only those updated at or after since when it is set
+func (s *GitHubService) ListIssueComments(ctx context.Context, owner, repo string, prNumber int, githubToken string, since *time.Time) ([]model.GitHubComment, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/comments?per_page=100", owner, repo, prNumber)
+	if since != nil {
+		apiURL += "&since=" + url.QueryEscape(since.UTC().Format(time.RFC3339))
 	}
-	// GitHub API endpoint for repository info
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
+	return s.listComments(ctx, apiURL, githubToken)
+}
 
-	// Create HTTP request
+// ListReviewComments returns the comments on the pull request's diff, only
+// those updated at or after since when it is set
+func (s *GitHubService) ListReviewComments(ctx context.Context, owner, repo string, prNumber int, githubToken string, since *time.Time) ([]model.GitHubComment, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/comments?per_page=100", owner, repo, prNumber)
+	if since != nil {
+		apiURL += "&since=" + url.QueryEscape(since.UTC().Format(time.RFC3339))
+	}
+	return s.listComments(ctx, apiURL, githubToken)
+}
+
+// ListReviews returns the reviews submitted on the pull request
+func (s *GitHubService) ListReviews(ctx context.Context, owner, repo string, prNumber int, githubToken string) ([]model.GitHubComment, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/reviews?per_page=100", owner, repo, prNumber)
+	return s.listComments(ctx, apiURL, githubToken)
+}
+
+func (s *GitHubService) listComments(ctx context.Context, apiURL, githubToken string) ([]model.GitHubComment, error) {
+	comments := make([]model.GitHubComment, 0)
+	for apiURL != "" {
+		var batch []model.GitHubComment
+		next, err := s.getPage(ctx, apiURL, githubToken, &batch)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, batch...)
+		apiURL = next
+	}
+	return comments, nil
+}
+
+// GetFileContent returns the raw content of a file at the given ref
+func (s *GitHubService) GetFileContent(ctx context.Context, owner, repo, path, ref, githubToken string) (string, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/%s?ref=%s", owner, repo, url.PathEscape(path), url.QueryEscape(ref))
+	apiURL = strings.ReplaceAll(apiURL, "%2F", "/")
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Accept", "application/vnd.github.raw+json")
 
-	// Set headers
-	req.Header.Set("Authorization", "token "+githubToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "Neurade-Backend")
-
-	// Make request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.Client.Do(req, githubToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return "", fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub API error: %s - %s", resp.Status, string(body))
+	}
+	return string(body), nil
+}
+
+// CreateReview posts a review with inline comments on a pull request
+func (s *GitHubService) CreateReview(ctx context.Context, owner, repo string, prNumber int, githubToken string, review *model.GitHubReviewRequest) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/reviews", owner, repo, prNumber)
+	return s.send(ctx, http.MethodPost, apiURL, githubToken, review, nil)
+}
+
+// CreateCheckRun starts a check run on a commit. Only GitHub App tokens may
+// create check runs; others get a 403.
+func (s *GitHubService) CreateCheckRun(ctx context.Context, owner, repo, githubToken string, request *model.GitHubCheckRunRequest) (*model.GitHubCheckRun, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/check-runs", owner, repo)
+	var run model.GitHubCheckRun
+	if err := s.send(ctx, http.MethodPost, apiURL, githubToken, request, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// UpdateCheckRun changes a check run's status, conclusion or output.
+// Annotations are added to those already on the run.
+func (s *GitHubService) UpdateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, githubToken string, request *model.GitHubCheckRunRequest) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/check-runs/%d", owner, repo, checkRunID)
+	return s.send(ctx, http.MethodPatch, apiURL, githubToken, request, nil)
+}
+
+// CreateCommitStatus sets the status of a commit under the request's context
+func (s *GitHubService) CreateCommitStatus(ctx context.Context, owner, repo, sha, githubToken string, request *model.GitHubCommitStatusRequest) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/statuses/%s", owner, repo, sha)
+	return s.send(ctx, http.MethodPost, apiURL, githubToken, request, nil)
+}
+
+// CreateLabel adds a label to the repository. GitHub answers 422 when a
+// label of that name exists.
+func (s *GitHubService) CreateLabel(ctx context.Context, owner, repo, githubToken string, label *model.GitHubLabel) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/labels", owner, repo)
+	return s.send(ctx, http.MethodPost, apiURL, githubToken, label, nil)
+}
+
+// UpdateLabel changes the colour and description of a repository label
+func (s *GitHubService) UpdateLabel(ctx context.Context, owner, repo, githubToken string, label *model.GitHubLabel) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/labels/%s", owner, repo, url.PathEscape(label.Name))
+	return s.send(ctx, http.MethodPatch, apiURL, githubToken, label, nil)
+}
+
+// ListIssueLabels returns the labels on a pull request
+func (s *GitHubService) ListIssueLabels(ctx context.Context, owner, repo string, prNumber int, githubToken string) ([]model.GitHubLabel, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/labels?per_page=100", owner, repo, prNumber)
+	var labels []model.GitHubLabel
+	if err := s.getJSON(ctx, apiURL, githubToken, &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// AddIssueLabels puts existing repository labels on a pull request
+func (s *GitHubService) AddIssueLabels(ctx context.Context, owner, repo string, prNumber int, githubToken string, names []string) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/labels", owner, repo, prNumber)
+	return s.send(ctx, http.MethodPost, apiURL, githubToken, map[string]interface{}{"labels": names}, nil)
+}
+
+// RemoveIssueLabel takes a label off a pull request
+func (s *GitHubService) RemoveIssueLabel(ctx context.Context, owner, repo string, prNumber int, githubToken, name string) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/labels/%s", owner, repo, prNumber, url.PathEscape(name))
+	return s.send(ctx, http.MethodDelete, apiURL, githubToken, nil, nil)
+}
+
+// CreateReaction reacts to a comment; kind is "issues" for conversation
+// comments and "pulls" for review comments
+func (s *GitHubService) CreateReaction(ctx context.Context, owner, repo, kind string, commentID int64, githubToken, content string) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/%s/comments/%d/reactions", owner, repo, kind, commentID)
+	return s.send(ctx, http.MethodPost, apiURL, githubToken, map[string]interface{}{"content": content}, nil)
+}
+
+// ReplyToReviewComment answers in the thread of an existing review comment
+func (s *GitHubService) ReplyToReviewComment(ctx context.Context, owner, repo string, prNumber int, commentID int64, githubToken, body string) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/comments/%d/replies", owner, repo, prNumber, commentID)
+	return s.send(ctx, http.MethodPost, apiURL, githubToken, map[string]interface{}{"body": body}, nil)
+}
+
+// CreateReviewComment comments on a line of the pull request's diff
+func (s *GitHubService) CreateReviewComment(ctx context.Context, owner, repo string, prNumber int, githubToken string, comment map[string]interface{}) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/comments", owner, repo, prNumber)
+	return s.send(ctx, http.MethodPost, apiURL, githubToken, comment, nil)
+}
+
+// CreateIssueComment posts a comment on the pull request's conversation
+func (s *GitHubService) CreateIssueComment(ctx context.Context, owner, repo string, prNumber int, githubToken, body string) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/comments", owner, repo, prNumber)
+	return s.send(ctx, http.MethodPost, apiURL, githubToken, map[string]interface{}{"body": body}, nil)
+}
+
+// ListHooks returns the repository's webhooks
+func (s *GitHubService) ListHooks(ctx context.Context, owner, repo, githubToken string) ([]model.GitHubHook, error) {
+	hooks := make([]model.GitHubHook, 0)
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/hooks?per_page=100", owner, repo)
+	if err := s.getJSON(ctx, apiURL, githubToken, &hooks); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (s *GitHubService) GetHook(ctx context.Context, owner, repo string, hookID int64, githubToken string) (*model.GitHubHook, error) {
+	hook := &model.GitHubHook{}
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/hooks/%d", owner, repo, hookID)
+	if err := s.getJSON(ctx, apiURL, githubToken, hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (s *GitHubService) CreateHook(ctx context.Context, owner, repo, githubToken string, request *model.GitHubHookRequest) (*model.GitHubHook, error) {
+	hook := &model.GitHubHook{}
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/hooks", owner, repo)
+	if err := s.send(ctx, http.MethodPost, apiURL, githubToken, request, hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (s *GitHubService) UpdateHook(ctx context.Context, owner, repo string, hookID int64, githubToken string, request *model.GitHubHookRequest) (*model.GitHubHook, error) {
+	hook := &model.GitHubHook{}
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/hooks/%d", owner, repo, hookID)
+	if err := s.send(ctx, http.MethodPatch, apiURL, githubToken, request, hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (s *GitHubService) DeleteHook(ctx context.Context, owner, repo string, hookID int64, githubToken string) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/hooks/%d", owner, repo, hookID)
+	return s.send(ctx, http.MethodDelete, apiURL, githubToken, nil, nil)
+}
+
+// ListHookDeliveries returns the hook's most recent deliveries, newest first
+func (s *GitHubService) ListHookDeliveries(ctx context.Context, owner, repo string, hookID int64, githubToken string, limit int) ([]model.GitHubHookDelivery, error) {
+	deliveries := make([]model.GitHubHookDelivery, 0)
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/hooks/%d/deliveries?per_page=%d", owner, repo, hookID, limit)
+	if err := s.getJSON(ctx, apiURL, githubToken, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *GitHubService) getJSON(ctx context.Context, apiURL, githubToken string, out interface{}) error {
+	_, err := s.getPage(ctx, apiURL, githubToken, out)
+	return err
+}
 
-	// Check response status
+// getPage decodes one page of a GitHub list into out and returns the URL of
+// the next page, or "" on the last one
+func (s *GitHubService) getPage(ctx context.Context, apiURL, githubToken string, out interface{}) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := s.Client.Do(req, githubToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("GitHub API error: %s - %s", resp.Status, string(body))
+		return "", &GitHubAPIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
+	return nextPageURL(resp.Header.Get("Link")), nil
+}
 
-	// Parse response
-	var repository model.GitHubRepository
-	if err := json.NewDecoder(resp.Body).Decode(&repository); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// send makes a write request with a JSON body and decodes the answer into out
+// when out is not nil
+func (s *GitHubService) send(ctx context.Context, method, apiURL, githubToken string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		content, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.Client.Do(req, githubToken)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &GitHubAPIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
 
-	return &repository, nil
+// GitHubAPIError is a non-success answer from the GitHub API
+type GitHubAPIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *GitHubAPIError) Error() string {
+	return fmt.Sprintf("GitHub API error: %s - %s", e.Status, e.Body)
+}
+
+// IsGitHubNotFound reports whether err is GitHub answering 404, which it also
+// does for private resources the token cannot see
+func IsGitHubNotFound(err error) bool {
+	var apiErr *GitHubAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// nextPageURL picks the rel="next" target out of a GitHub Link header
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(part, ";")
+		if len(segments) < 2 {
+			continue
+		}
+		target := strings.Trim(strings.TrimSpace(segments[0]), "<>")
+		for _, param := range segments[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return target
+			}
+		}
+	}
+	return ""
 }
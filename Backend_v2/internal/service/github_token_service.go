@@ -0,0 +1,184 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	CredentialSourceCourse  = "course"
+	CredentialSourceOwner   = "owner"
+	CredentialSourceApp     = "app"
+	CredentialSourceDefault = "default"
+	// CredentialSourceNone is reported for local courses, which need no token
+	CredentialSourceNone = "none"
+)
+
+var ErrNoGitHubToken = errors.New("no GitHub credentials configured")
+
+// GitHubTokenService resolves the GitHub credential a course acts with: the
+// course's own token, then its owner's personal token, then the GitHub App's
+// installation on the repository owner, then the super admin's token. Courses
+// on GitLab use their own token, then GitLabToken. Local courses need none.
+type GitHubTokenService struct {
+	DB            *gorm.DB
+	GitHubService *GitHubService
+	GitProviders  *GitProviders
+	App           *util.GitHubApp
+	GitLabToken   string
+	Log           *logrus.Logger
+	// identities remembers the login each token comments as
+	identities sync.Map
+}
+
+func NewGitHubTokenService(db *gorm.DB, githubService *GitHubService, gitProviders *GitProviders, app *util.GitHubApp, gitlabToken string, log *logrus.Logger) *GitHubTokenService {
+	return &GitHubTokenService{
+		DB:            db,
+		GitHubService: githubService,
+		GitProviders:  gitProviders,
+		App:           app,
+		GitLabToken:   gitlabToken,
+		Log:           log,
+	}
+}
+
+// Token returns the token GitHub calls for the course should use
+func (s *GitHubTokenService) Token(ctx context.Context, courseID int) (string, error) {
+	token, _, err := s.resolve(ctx, courseID)
+	return token, err
+}
+
+// Identity returns the username the course's credential comments as, so the
+// bot can tell its own comments apart: "<app-slug>[bot]" for the GitHub App,
+// otherwise the token's user. It is empty for local courses.
+func (s *GitHubTokenService) Identity(ctx context.Context, courseID int) (string, error) {
+	token, source, err := s.resolve(ctx, courseID)
+	if err != nil {
+		return "", err
+	}
+	switch source {
+	case CredentialSourceNone:
+		return "", nil
+	case CredentialSourceApp:
+		return s.App.BotLogin(ctx)
+	}
+	if login, ok := s.identities.Load(token); ok {
+		return login.(string), nil
+	}
+	course := &entity.Course{}
+	if err := s.DB.WithContext(ctx).First(course, courseID).Error; err != nil {
+		return "", err
+	}
+	provider, repo, err := s.GitProviders.For(course.GithubURL, course.GitProvider)
+	if err != nil {
+		return "", err
+	}
+	login, err := provider.GetAuthenticatedLogin(ctx, repo, token)
+	if err != nil {
+		return "", err
+	}
+	s.identities.Store(token, login)
+	return login, nil
+}
+
+// Describe reports which credential the course resolves to, masked
+func (s *GitHubTokenService) Describe(ctx context.Context, courseID int) (*model.GitHubCredentialResponse, error) {
+	token, source, err := s.resolve(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.GitHubCredentialResponse{CourseID: courseID, Source: source, Token: util.MaskGitHubToken(token)}, nil
+}
+
+// DefaultToken is the global fallback: the first super admin's token
+func (s *GitHubTokenService) DefaultToken(ctx context.Context) (string, error) {
+	user := &entity.User{}
+	err := s.DB.WithContext(ctx).Where("role = ? AND github_token <> ''", "super_admin").Order("id").First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fmt.Errorf("%w: super admin github_token not found", ErrNoGitHubToken)
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.GithubToken, nil
+}
+
+// SetCourseToken stores the course's own token once it is shown to reach the
+// course repository. An empty token removes it.
+func (s *GitHubTokenService) SetCourseToken(ctx context.Context, courseID int, token string) (*model.GitHubCredentialResponse, error) {
+	course := &entity.Course{}
+	if err := s.DB.WithContext(ctx).First(course, courseID).Error; err != nil {
+		return nil, err
+	}
+	repository := ""
+	if token != "" {
+		provider, repo, err := s.GitProviders.For(course.GithubURL, course.GitProvider)
+		if err != nil {
+			return nil, err
+		}
+		if repository, err = provider.GetRepositoryName(ctx, repo, token); err != nil {
+			return nil, fmt.Errorf("token cannot access %s: %w", course.GithubURL, err)
+		}
+	}
+	if err := s.DB.WithContext(ctx).Model(course).Update("github_token", token).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to update course github token")
+		return nil, err
+	}
+	response, err := s.Describe(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+	response.Repository = repository
+	return response, nil
+}
+
+func (s *GitHubTokenService) resolve(ctx context.Context, courseID int) (string, string, error) {
+	db := s.DB.WithContext(ctx)
+	course := &entity.Course{}
+	if err := db.First(course, courseID).Error; err != nil {
+		return "", "", err
+	}
+	if course.GitProvider == util.GitProviderLocal {
+		return "", CredentialSourceNone, nil
+	}
+	if course.GithubToken != "" {
+		return course.GithubToken, CredentialSourceCourse, nil
+	}
+	// Tokens of GitHub users and the app mean nothing to a GitLab instance
+	if util.GitProviderOf(course.GithubURL, course.GitProvider) == util.GitProviderGitLab {
+		if s.GitLabToken == "" {
+			return "", "", fmt.Errorf("%w: course %d is on GitLab and has no token", ErrNoGitHubToken, courseID)
+		}
+		return s.GitLabToken, CredentialSourceDefault, nil
+	}
+
+	owner := &entity.User{}
+	if err := db.Where("id = ? AND locked = ? AND deleted = ?", course.UserID, false, false).First(owner).Error; err == nil && owner.GithubToken != "" {
+		return owner.GithubToken, CredentialSourceOwner, nil
+	}
+
+	if s.App != nil {
+		repoOwner, repoName, err := util.ParseGitHubURL(course.GithubURL)
+		if err == nil {
+			token, err := s.App.InstallationToken(ctx, repoOwner, repoName)
+			if err == nil {
+				return token, CredentialSourceApp, nil
+			}
+			s.Log.WithContext(ctx).WithError(err).Warnf("GitHub App cannot act on course %d, using the default token", courseID)
+		}
+	}
+
+	token, err := s.DefaultToken(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return token, CredentialSourceDefault, nil
+}
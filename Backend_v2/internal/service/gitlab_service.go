@@ -0,0 +1,320 @@
+package service
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/util"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// GitLabService is the GitProvider of GitLab, gitlab.com or self-hosted,
+// through REST API v4 at the repository's host
+type GitLabService struct {
+	HTTP *http.Client
+	Log  *logrus.Logger
+}
+
+func NewGitLabService(log *logrus.Logger) *GitLabService {
+	return &GitLabService{
+		HTTP: &http.Client{Timeout: 5 * time.Minute},
+		Log:  log,
+	}
+}
+
+func (s *GitLabService) ListPullRequests(ctx context.Context, repo *util.RepoRef, token string, since *time.Time) ([]model.GitHubPullRequest, error) {
+	apiURL := s.projectURL(repo, "/merge_requests?state=all&order_by=updated_at&sort=desc&per_page=100")
+	if since != nil {
+		apiURL += "&updated_after=" + url.QueryEscape(since.UTC().Format(time.RFC3339))
+	}
+	pullRequests := make([]model.GitHubPullRequest, 0)
+	for apiURL != "" {
+		var batch []model.GitLabMergeRequest
+		next, err := s.getPage(ctx, apiURL, token, &batch)
+		if err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			pullRequests = append(pullRequests, *converter.GitLabMergeRequestToPullRequest(&batch[i]))
+		}
+		apiURL = next
+	}
+	s.Log.Infof("Fetched %d merge requests from %s/%s", len(pullRequests), repo.Host, repo.Path())
+	return pullRequests, nil
+}
+
+func (s *GitLabService) GetPullRequest(ctx context.Context, repo *util.RepoRef, number int, token string) (*model.GitHubPullRequest, error) {
+	mr, err := s.getMergeRequest(ctx, repo, number, token)
+	if err != nil {
+		return nil, err
+	}
+	return converter.GitLabMergeRequestToPullRequest(mr), nil
+}
+
+func (s *GitLabService) GetPullRequestFiles(ctx context.Context, repo *util.RepoRef, number int, token string) ([]model.GitHubPullRequestFile, error) {
+	files := make([]model.GitHubPullRequestFile, 0)
+	apiURL := s.projectURL(repo, fmt.Sprintf("/merge_requests/%d/diffs?per_page=100", number))
+	for apiURL != "" {
+		var batch []model.GitLabDiff
+		next, err := s.getPage(ctx, apiURL, token, &batch)
+		if err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			files = append(files, converter.GitLabDiffToFile(&batch[i]))
+		}
+		apiURL = next
+	}
+	return files, nil
+}
+
+func (s *GitLabService) GetFileContent(ctx context.Context, repo *util.RepoRef, path, ref, token string) (string, error) {
+	apiURL := s.projectURL(repo, fmt.Sprintf("/repository/files/%s/raw?ref=%s", url.PathEscape(path), url.QueryEscape(ref)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := s.do(req, token)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", &GitLabAPIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	return string(body), nil
+}
+
+// CreateReview posts each comment as a discussion on its diff line, then the
+// review body as a note. GitLab has no review of its own to bundle them in;
+// comments it cannot place are added to the body instead.
+func (s *GitLabService) CreateReview(ctx context.Context, repo *util.RepoRef, number int, token string, review *model.GitHubReviewRequest) error {
+	body := review.Body
+	if len(review.Comments) > 0 {
+		mr, err := s.getMergeRequest(ctx, repo, number, token)
+		if err != nil {
+			return err
+		}
+		files, err := s.GetPullRequestFiles(ctx, repo, number, token)
+		if err != nil {
+			return err
+		}
+		byPath := make(map[string]*model.GitHubPullRequestFile, len(files))
+		for i := range files {
+			byPath[files[i].Filename] = &files[i]
+		}
+		for _, comment := range review.Comments {
+			if err := s.createDiffDiscussion(ctx, repo, number, token, mr, byPath[comment.Path], comment); err != nil {
+				s.Log.Warnf("Could not place comment on %s at position %d of !%d: %v", comment.Path, comment.Position, number, err)
+				body += fmt.Sprintf("\n\n**%s** (position %d):\n%s", comment.Path, comment.Position, comment.Body)
+			}
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		return nil
+	}
+	return s.CreateComment(ctx, repo, number, token, body)
+}
+
+func (s *GitLabService) CreateComment(ctx context.Context, repo *util.RepoRef, number int, token, body string) error {
+	apiURL := s.projectURL(repo, fmt.Sprintf("/merge_requests/%d/notes", number))
+	return s.send(ctx, http.MethodPost, apiURL, token, map[string]interface{}{"body": body}, nil)
+}
+
+func (s *GitLabService) ReplyToThread(ctx context.Context, repo *util.RepoRef, number int, threadID, token, body string) error {
+	apiURL := s.projectURL(repo, fmt.Sprintf("/merge_requests/%d/discussions/%s/notes", number, url.PathEscape(threadID)))
+	return s.send(ctx, http.MethodPost, apiURL, token, map[string]interface{}{"body": body}, nil)
+}
+
+// RegisterWebhook updates the hook registered before, or adopts a hook already
+// pointing at the same URL, before creating one. The secret becomes the hook's
+// token.
+func (s *GitLabService) RegisterWebhook(ctx context.Context, repo *util.RepoRef, token string, hookID int64, request *model.GitHubHookRequest) (*model.GitHubHook, error) {
+	hookRequest := &model.GitLabHookRequest{
+		URL:                 request.Config.URL,
+		Token:               request.Config.Secret,
+		MergeRequestsEvents: true,
+		NoteEvents:          true,
+		// New commits arrive as merge request updates
+		PushEvents:            false,
+		EnableSSLVerification: request.Config.InsecureSSL != "1",
+	}
+	if hookID == 0 {
+		var hooks []model.GitLabHook
+		if _, err := s.getPage(ctx, s.projectURL(repo, "/hooks?per_page=100"), token, &hooks); err != nil {
+			return nil, err
+		}
+		for _, existing := range hooks {
+			if existing.URL == hookRequest.URL {
+				hookID = existing.ID
+				break
+			}
+		}
+	}
+	hook := &model.GitLabHook{}
+	if hookID != 0 {
+		err := s.send(ctx, http.MethodPut, s.projectURL(repo, fmt.Sprintf("/hooks/%d", hookID)), token, hookRequest, hook)
+		if err == nil {
+			return converter.GitLabHookToGitHubHook(hook), nil
+		}
+		if !IsNotFound(err) {
+			return nil, err
+		}
+	}
+	if err := s.send(ctx, http.MethodPost, s.projectURL(repo, "/hooks"), token, hookRequest, hook); err != nil {
+		return nil, err
+	}
+	return converter.GitLabHookToGitHubHook(hook), nil
+}
+
+func (s *GitLabService) DeleteWebhook(ctx context.Context, repo *util.RepoRef, token string, hookID int64) error {
+	return s.send(ctx, http.MethodDelete, s.projectURL(repo, fmt.Sprintf("/hooks/%d", hookID)), token, nil, nil)
+}
+
+func (s *GitLabService) GetRepositoryName(ctx context.Context, repo *util.RepoRef, token string) (string, error) {
+	project := &model.GitLabProject{}
+	if _, err := s.getPage(ctx, s.projectURL(repo, ""), token, project); err != nil {
+		return "", err
+	}
+	return project.PathWithNamespace, nil
+}
+
+func (s *GitLabService) GetAuthenticatedLogin(ctx context.Context, repo *util.RepoRef, token string) (string, error) {
+	user := &model.GitLabUser{}
+	if _, err := s.getPage(ctx, fmt.Sprintf("%s://%s/api/v4/user", repo.Scheme, repo.Host), token, user); err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+func (s *GitLabService) getMergeRequest(ctx context.Context, repo *util.RepoRef, number int, token string) (*model.GitLabMergeRequest, error) {
+	mr := &model.GitLabMergeRequest{}
+	if _, err := s.getPage(ctx, s.projectURL(repo, fmt.Sprintf("/merge_requests/%d", number)), token, mr); err != nil {
+		return nil, err
+	}
+	return mr, nil
+}
+
+// createDiffDiscussion starts a discussion on the line at the comment's
+// GitHub diff position
+func (s *GitLabService) createDiffDiscussion(ctx context.Context, repo *util.RepoRef, number int, token string, mr *model.GitLabMergeRequest, file *model.GitHubPullRequestFile, comment model.AgentComment) error {
+	if file == nil {
+		return fmt.Errorf("%s is not in the diff", comment.Path)
+	}
+	oldLine, newLine, ok := DiffPositionLines(file.Patch, comment.Position)
+	if !ok {
+		return fmt.Errorf("position %d is outside the diff", comment.Position)
+	}
+	oldPath := file.PreviousFilename
+	if oldPath == "" {
+		oldPath = file.Filename
+	}
+	position := &model.GitLabPosition{
+		PositionType: "text",
+		BaseSHA:      mr.DiffRefs.BaseSHA,
+		StartSHA:     mr.DiffRefs.StartSHA,
+		HeadSHA:      mr.DiffRefs.HeadSHA,
+		OldPath:      oldPath,
+		NewPath:      file.Filename,
+		OldLine:      oldLine,
+		NewLine:      newLine,
+	}
+	apiURL := s.projectURL(repo, fmt.Sprintf("/merge_requests/%d/discussions", number))
+	return s.send(ctx, http.MethodPost, apiURL, token, map[string]interface{}{"body": comment.Body, "position": position}, nil)
+}
+
+// projectURL is the API URL of the project, addressed by its URL-encoded path,
+// followed by suffix
+func (s *GitLabService) projectURL(repo *util.RepoRef, suffix string) string {
+	return fmt.Sprintf("%s://%s/api/v4/projects/%s%s", repo.Scheme, repo.Host, url.PathEscape(repo.Path()), suffix)
+}
+
+// getPage decodes one page of a GitLab list, or a single resource, into out
+// and returns the URL of the next page, or "" on the last one
+func (s *GitLabService) getPage(ctx context.Context, apiURL, token string, out interface{}) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := s.do(req, token)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", &GitLabAPIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nextPageURL(resp.Header.Get("Link")), nil
+}
+
+// send makes a write request with a JSON body and decodes the answer into out
+// when out is not nil
+func (s *GitLabService) send(ctx context.Context, method, apiURL, token string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		content, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.do(req, token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &GitLabAPIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func (s *GitLabService) do(req *http.Request, token string) (*http.Response, error) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	return resp, nil
+}
+
+// GitLabAPIError is a non-success answer from the GitLab API
+type GitLabAPIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *GitLabAPIError) Error() string {
+	return fmt.Sprintf("GitLab API error: %s - %s", e.Status, e.Body)
+}
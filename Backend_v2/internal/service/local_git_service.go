@@ -0,0 +1,349 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"be/neurade/v2/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// LocalSubmitBranch is the branch a push to hands in the work
+	LocalSubmitBranch = "submit"
+	// LocalBaseBranch holds the starting point the submission is diffed against
+	LocalBaseBranch = "main"
+)
+
+var (
+	ErrLocalGitNotConfigured = errors.New("hosted git repositories are not configured")
+	ErrLocalNoWebhook        = errors.New("local repositories have no webhooks")
+)
+
+// LocalGitService hosts a bare repository for each student and assignment of
+// a local course, under Root/<course>/<assignment>/<user>.git. A push to the
+// submit branch becomes the repository's PR, numbered by the repository ID.
+// It is the GitProvider of local courses: reviews and replies, which have no
+// forge to go to, are added to the PR's chat.
+type LocalGitService struct {
+	DB                      *gorm.DB
+	GitRepositoryRepository *repository.GitRepositoryRepository
+	PrService               *PrService
+	ChatService             *ChatService
+	Root                    string
+	// BaseURL is the public URL of the /git routes, for clone URLs
+	BaseURL string
+	Log     *logrus.Logger
+}
+
+func NewLocalGitService(db *gorm.DB, gitRepositoryRepository *repository.GitRepositoryRepository, prService *PrService, chatService *ChatService, root string, baseURL string, log *logrus.Logger) *LocalGitService {
+	return &LocalGitService{
+		DB:                      db,
+		GitRepositoryRepository: gitRepositoryRepository,
+		PrService:               prService,
+		ChatService:             chatService,
+		Root:                    root,
+		BaseURL:                 strings.TrimRight(baseURL, "/"),
+		Log:                     log,
+	}
+}
+
+// Open returns the user's repository for the assignment, creating it on first use
+func (s *LocalGitService) Open(ctx context.Context, courseID, assignmentID, userID int) (*entity.GitRepository, error) {
+	if s.Root == "" {
+		return nil, ErrLocalGitNotConfigured
+	}
+	db := s.DB.WithContext(ctx)
+	repo := &entity.GitRepository{}
+	err := s.GitRepositoryRepository.FindByAssignmentAndUser(db, repo, assignmentID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		now := time.Now()
+		repo = &entity.GitRepository{CourseID: courseID, AssignmentID: assignmentID, UserID: userID, CreatedAt: now, UpdatedAt: now}
+		if err = s.GitRepositoryRepository.Create(db, repo); err != nil {
+			// A concurrent first push may have created it
+			if findErr := s.GitRepositoryRepository.FindByAssignmentAndUser(db, repo, assignmentID, userID); findErr == nil {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get git repository")
+		return nil, err
+	}
+	if err := util.InitBareRepository(ctx, s.Dir(repo), LocalBaseBranch); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Errorf("failed to initialise git repository %d", repo.ID)
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Path is the repository's path under Root
+func (s *LocalGitService) Path(repo *entity.GitRepository) string {
+	return fmt.Sprintf("%d/%d/%d.git", repo.CourseID, repo.AssignmentID, repo.UserID)
+}
+
+func (s *LocalGitService) Dir(repo *entity.GitRepository) string {
+	return filepath.Join(s.Root, filepath.FromSlash(s.Path(repo)))
+}
+
+// Describe returns the repository with the URL its owner clones and pushes to
+func (s *LocalGitService) Describe(repo *entity.GitRepository) *model.GitRepositoryResponse {
+	cloneURL := fmt.Sprintf("%s/%d/%d.git", s.BaseURL, repo.CourseID, repo.AssignmentID)
+	return converter.GitRepositoryToResponse(repo, cloneURL, LocalSubmitBranch)
+}
+
+// Submit saves the head of the submit branch as the repository's PR. It
+// returns a nil PR when the branch is missing or has not moved since the last
+// submission, and reports whether the PR was new.
+func (s *LocalGitService) Submit(ctx context.Context, repo *entity.GitRepository) (*model.PrResponse, bool, error) {
+	sha, err := util.ResolveBranch(ctx, s.Dir(repo), LocalSubmitBranch)
+	if err != nil || sha == "" || sha == repo.SubmitSHA {
+		return nil, false, err
+	}
+	now := time.Now()
+	if err := s.DB.WithContext(ctx).Model(repo).Updates(map[string]interface{}{"submit_sha": sha, "submitted_at": now, "updated_at": now}).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to record submission")
+		return nil, false, err
+	}
+	repo.SubmitSHA, repo.SubmittedAt, repo.UpdatedAt = sha, &now, now
+	pullRequest, err := s.pullRequest(ctx, repo)
+	if err != nil {
+		return nil, false, err
+	}
+	request := converter.GitHubPullRequestToPrRequest(repo.CourseID, pullRequest)
+	request.AssignmentID = repo.AssignmentID
+	pr, created, err := s.PrService.SyncFromGitHub(ctx, request)
+	if err != nil {
+		return nil, false, err
+	}
+	s.Log.Infof("Submission %s of repository %s saved as PR %d (created: %v)", sha, s.Path(repo), pr.ID, created)
+	return pr, created, nil
+}
+
+// CheckoutSubmission puts the latest submission of PR number of the course in
+// dir and returns its commit SHA
+func (s *LocalGitService) CheckoutSubmission(ctx context.Context, dir string, courseID, number int) (string, error) {
+	repo, err := s.submission(ctx, util.LocalRepoRef(courseID), number)
+	if err != nil {
+		return "", err
+	}
+	remote, err := filepath.Abs(s.Dir(repo))
+	if err != nil {
+		return "", err
+	}
+	return util.CheckoutRef(ctx, dir, remote, "refs/heads/"+LocalSubmitBranch, "")
+}
+
+// RemoveCourse deletes the course's repositories from disk
+func (s *LocalGitService) RemoveCourse(courseID int) error {
+	if s.Root == "" {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(s.Root, strconv.Itoa(courseID)))
+}
+
+// pullRequest describes the submission in the GitHub shape: the title and body
+// come from the submitted commit's message
+func (s *LocalGitService) pullRequest(ctx context.Context, repo *entity.GitRepository) (*model.GitHubPullRequest, error) {
+	dir := s.Dir(repo)
+	message, err := util.CommitMessage(ctx, dir, repo.SubmitSHA)
+	if err != nil {
+		return nil, err
+	}
+	title, body, _ := strings.Cut(message, "\n")
+	user := &entity.User{}
+	if err := s.DB.WithContext(ctx).Select("email").First(user, repo.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	pr := &model.GitHubPullRequest{
+		ID:        repo.ID,
+		Number:    repo.ID,
+		Title:     title,
+		Body:      strings.TrimSpace(body),
+		State:     "open",
+		CreatedAt: repo.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: repo.UpdatedAt.Format(time.RFC3339),
+	}
+	if repo.SubmittedAt != nil {
+		pr.UpdatedAt = repo.SubmittedAt.Format(time.RFC3339)
+	}
+	pr.User.Login = user.Email
+	pr.Head.Ref = LocalSubmitBranch
+	pr.Head.SHA = repo.SubmitSHA
+	pr.Base.Ref = LocalBaseBranch
+	pr.Base.SHA = util.MergeBase(ctx, dir, LocalBaseBranch, repo.SubmitSHA)
+	return pr, nil
+}
+
+// submission returns the repository behind PR number of the course ref stands for
+func (s *LocalGitService) submission(ctx context.Context, ref *util.RepoRef, number int) (*entity.GitRepository, error) {
+	courseID, err := strconv.Atoi(ref.Name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local repository %s", ref.Path())
+	}
+	repo := &entity.GitRepository{}
+	if err := s.DB.WithContext(ctx).Where("id = ? AND course_id = ?", number, courseID).First(repo).Error; err != nil {
+		return nil, err
+	}
+	if repo.SubmitSHA == "" {
+		return nil, fmt.Errorf("repository %s has no submission", s.Path(repo))
+	}
+	return repo, nil
+}
+
+func (s *LocalGitService) ListPullRequests(ctx context.Context, ref *util.RepoRef, token string, since *time.Time) ([]model.GitHubPullRequest, error) {
+	courseID, err := strconv.Atoi(ref.Name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local repository %s", ref.Path())
+	}
+	repos := make([]entity.GitRepository, 0)
+	if err := s.GitRepositoryRepository.FindSubmittedByCourse(s.DB.WithContext(ctx), &repos, courseID); err != nil {
+		return nil, err
+	}
+	pullRequests := make([]model.GitHubPullRequest, 0, len(repos))
+	for i := range repos {
+		if since != nil && repos[i].SubmittedAt != nil && repos[i].SubmittedAt.Before(*since) {
+			continue
+		}
+		pr, err := s.pullRequest(ctx, &repos[i])
+		if err != nil {
+			return nil, err
+		}
+		pullRequests = append(pullRequests, *pr)
+	}
+	return pullRequests, nil
+}
+
+func (s *LocalGitService) GetPullRequest(ctx context.Context, ref *util.RepoRef, number int, token string) (*model.GitHubPullRequest, error) {
+	repo, err := s.submission(ctx, ref, number)
+	if err != nil {
+		return nil, err
+	}
+	return s.pullRequest(ctx, repo)
+}
+
+func (s *LocalGitService) GetPullRequestFiles(ctx context.Context, ref *util.RepoRef, number int, token string) ([]model.GitHubPullRequestFile, error) {
+	repo, err := s.submission(ctx, ref, number)
+	if err != nil {
+		return nil, err
+	}
+	dir := s.Dir(repo)
+	diffs, err := util.DiffFiles(ctx, dir, util.MergeBase(ctx, dir, LocalBaseBranch, repo.SubmitSHA), repo.SubmitSHA)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]model.GitHubPullRequestFile, 0, len(diffs))
+	for _, diff := range diffs {
+		files = append(files, model.GitHubPullRequestFile{
+			Filename:         diff.Path,
+			Status:           diff.Status,
+			Additions:        diff.Additions,
+			Deletions:        diff.Deletions,
+			Changes:          diff.Additions + diff.Deletions,
+			Patch:            diff.Patch,
+			PreviousFilename: diff.OldPath,
+		})
+	}
+	return files, nil
+}
+
+// GetFileContent reads path at ref from whichever of the course's
+// repositories holds that commit
+func (s *LocalGitService) GetFileContent(ctx context.Context, ref *util.RepoRef, path, commit, token string) (string, error) {
+	courseID, err := strconv.Atoi(ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("invalid local repository %s", ref.Path())
+	}
+	repos := make([]entity.GitRepository, 0)
+	if err := s.GitRepositoryRepository.FindSubmittedByCourse(s.DB.WithContext(ctx), &repos, courseID); err != nil {
+		return "", err
+	}
+	for i := range repos {
+		dir := s.Dir(&repos[i])
+		if util.HasCommit(ctx, dir, commit) {
+			return util.ShowFile(ctx, dir, commit, path)
+		}
+	}
+	return "", fmt.Errorf("commit %s not found in course %d", commit, courseID)
+}
+
+// CreateReview adds the review to the PR's chat, each comment labelled with
+// the file and line it is about
+func (s *LocalGitService) CreateReview(ctx context.Context, ref *util.RepoRef, number int, token string, review *model.GitHubReviewRequest) error {
+	body := review.Body
+	if len(review.Comments) > 0 {
+		files, err := s.GetPullRequestFiles(ctx, ref, number, token)
+		if err != nil {
+			return err
+		}
+		patches := make(map[string]string, len(files))
+		for _, file := range files {
+			patches[file.Filename] = file.Patch
+		}
+		for _, comment := range review.Comments {
+			if _, line, ok := DiffPositionLines(patches[comment.Path], comment.Position); ok && line != 0 {
+				body += fmt.Sprintf("\n\n**%s** (line %d):\n%s", comment.Path, line, comment.Body)
+			} else {
+				body += fmt.Sprintf("\n\n**%s** (position %d):\n%s", comment.Path, comment.Position, comment.Body)
+			}
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		return nil
+	}
+	return s.CreateComment(ctx, ref, number, token, body)
+}
+
+func (s *LocalGitService) CreateComment(ctx context.Context, ref *util.RepoRef, number int, token, body string) error {
+	repo, err := s.submission(ctx, ref, number)
+	if err != nil {
+		return err
+	}
+	pr, err := s.PrService.GetByCourseIDAndPrNumber(ctx, repo.CourseID, number)
+	if err != nil {
+		return err
+	}
+	// Only the bot comments on local PRs, in their conversation
+	_, _, err = s.ChatService.AddMessage(ctx, &model.ChatMessageCreateRequest{
+		CourseID: repo.CourseID,
+		PrID:     pr.ID,
+		Role:     CommentRoleBot,
+		Message:  body,
+	})
+	return err
+}
+
+// ReplyToThread adds the reply to the PR's chat; there are no threads
+func (s *LocalGitService) ReplyToThread(ctx context.Context, ref *util.RepoRef, number int, threadID, token, body string) error {
+	return s.CreateComment(ctx, ref, number, token, body)
+}
+
+func (s *LocalGitService) RegisterWebhook(ctx context.Context, ref *util.RepoRef, token string, hookID int64, request *model.GitHubHookRequest) (*model.GitHubHook, error) {
+	return nil, ErrLocalNoWebhook
+}
+
+func (s *LocalGitService) DeleteWebhook(ctx context.Context, ref *util.RepoRef, token string, hookID int64) error {
+	return ErrLocalNoWebhook
+}
+
+func (s *LocalGitService) GetRepositoryName(ctx context.Context, ref *util.RepoRef, token string) (string, error) {
+	return ref.Path(), nil
+}
+
+// GetAuthenticatedLogin is empty: the bot's comments on local courses go
+// straight to the chat and never come back as events
+func (s *LocalGitService) GetAuthenticatedLogin(ctx context.Context, ref *util.RepoRef, token string) (string, error) {
+	return "", nil
+}
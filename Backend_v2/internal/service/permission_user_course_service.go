@@ -2,9 +2,12 @@ package service
 
 import (
 	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
 	"be/neurade/v2/internal/repository"
 
 	"context"
+	"errors"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -42,3 +45,43 @@ func (s *PermissionUserCourseService) GetPermissionCoursesByCourse(ctx context.C
 func (s *PermissionUserCourseService) RemoveAllCoursesForUser(userID int) error {
 	return s.DB.Where("user_id = ?", userID).Delete(&entity.PermissionUserCourse{}).Error
 }
+
+// IsCourseStaff reports whether the git account login, commenting with the
+// given author association, is on the course's staff. See isCourseStaff.
+func (s *PermissionUserCourseService) IsCourseStaff(ctx context.Context, course *model.CourseResponse, login, authorAssociation string) (bool, error) {
+	return isCourseStaff(ctx, s.DB, course, login, authorAssociation)
+}
+
+// isCourseStaff tells course staff from students in PR comments. Staff are
+// the repository's owner and the roster's users whose github_login, or email
+// on local courses, is login, when they are super admins, created the course
+// or have permission on it. Students may push to the course repository or
+// have had a PR merged, so being a collaborator or contributor is not enough.
+func isCourseStaff(ctx context.Context, db *gorm.DB, course *model.CourseResponse, login, authorAssociation string) (bool, error) {
+	if login == "" {
+		return false, nil
+	}
+	if authorAssociation == "OWNER" || strings.EqualFold(login, course.Owner) {
+		return true, nil
+	}
+	user := &entity.User{}
+	err := db.WithContext(ctx).
+		Where("(LOWER(github_login) = LOWER(?) OR email = ?) AND NOT locked AND NOT deleted", login, login).
+		First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if user.Role == "super_admin" || user.ID == course.UserID {
+		return true, nil
+	}
+	var count int64
+	if err := db.WithContext(ctx).Model(&entity.PermissionUserCourse{}).
+		Where("user_id = ? AND course_id = ?", user.ID, course.ID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PrCommandPrefix starts a command in a PR comment, as in "/neurade score"
+const PrCommandPrefix = "/neurade"
+
+// Commands a PR comment can give
+const (
+	PrCommandRegrade      = "regrade"
+	PrCommandExplain      = "explain"
+	PrCommandScore        = "score"
+	PrCommandHint         = "hint"
+	PrCommandRequestHuman = "request-human"
+	PrCommandHelp         = "help"
+)
+
+const (
+	PrCommandPending = "pending"
+	PrCommandRunning = "running"
+	PrCommandDone    = "done"
+	PrCommandFailed  = "failed"
+)
+
+// PrCommandUsage is the reply to help and to commands we do not know
+const PrCommandUsage = "Commands, in a comment of their own:\n\n" +
+	"- `/neurade regrade` grades the PR again (course staff)\n" +
+	"- `/neurade explain <file:line>` explains that line; in a review comment the file is optional\n" +
+	"- `/neurade score` shows the latest grade\n" +
+	"- `/neurade hint` gives a hint without the solution\n" +
+	"- `/neurade request-human` asks the course staff to look at the PR\n\n" +
+	"Students can run commands on their own PRs only."
+
+// ParsePrCommand reads a command from a comment starting with /neurade. The
+// command is lower-cased and args is the rest of the first line. It reports
+// false for other comments.
+func ParsePrCommand(body string) (string, string, bool) {
+	line, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), PrCommandPrefix)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return "", "", false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return PrCommandHelp, "", true
+	}
+	return strings.ToLower(fields[0]), strings.Join(fields[1:], " "), true
+}
+
+// PrCommandAllowed reports whether a commenter may run the command on a PR.
+// Course staff, who comment with the "teacher" role once the roster confirms
+// them, may run every command; students only those about their own PR, and
+// never a regrade. authorLogin is the PR's author; when it is not known the
+// PR is nobody's own.
+func PrCommandAllowed(command, role, login, authorLogin string) bool {
+	if role == "teacher" {
+		return true
+	}
+	if command == PrCommandRegrade {
+		return false
+	}
+	return authorLogin != "" && strings.EqualFold(login, authorLogin)
+}
+
+// PrGradeSummary is the answer to /neurade score: the grade kept in the PR's
+// result, against the course's pass score
+func PrGradeSummary(pr *model.PrResponse, passScore int) string {
+	if pr.Result == "" {
+		return "This PR has not been graded yet."
+	}
+	var result struct {
+		Score  *float64                `json:"score"`
+		Rubric []model.AgentRubricItem `json:"rubric"`
+		Tests  map[string]interface{}  `json:"tests"`
+	}
+	if err := json.Unmarshal([]byte(pr.Result), &result); err != nil {
+		return "The grade of this PR could not be read."
+	}
+	agent := &model.AgentResponse{Score: result.Score, Rubric: result.Rubric}
+	verdict := "Graded, without a score."
+	if _, scored := ReviewScore(agent, result.Tests); scored {
+		verdict = "Below the pass mark."
+		if ReviewPassed(agent, result.Tests, passScore) {
+			verdict = "Passed."
+		}
+	}
+	return strings.TrimSpace(verdict + "\n\n" + CheckRunSummary(&CheckRunResult{Agent: agent, Tests: result.Tests}, passScore))
+}
+
+// PrCommandService queues the commands of PR comments as jobs and runs them in
+// the background. A comment redelivered by a webhook or a sync is queued once.
+type PrCommandService struct {
+	DB                  *gorm.DB
+	PrCommandRepository *repository.PrCommandRepository
+	Log                 *logrus.Logger
+	// Execute runs a command and answers it on the PR, returning the answer.
+	// It is set once the controllers exist.
+	Execute func(ctx context.Context, command *model.PrCommandResponse) (string, error)
+}
+
+func NewPrCommandService(db *gorm.DB, prCommandRepository *repository.PrCommandRepository, log *logrus.Logger) *PrCommandService {
+	return &PrCommandService{
+		DB:                  db,
+		PrCommandRepository: prCommandRepository,
+		Log:                 log,
+	}
+}
+
+// Enqueue records the command and starts it. It returns false, with the job
+// already recorded, when the comment was queued before.
+func (s *PrCommandService) Enqueue(ctx context.Context, request *model.PrCommandCreateRequest) (*model.PrCommandResponse, bool, error) {
+	db := s.DB.WithContext(ctx)
+	existing := &entity.PrCommand{}
+	err := s.PrCommandRepository.FindByComment(db, existing, request.CourseID, request.CommentKey)
+	if err == nil {
+		return converter.PrCommandToResponse(existing), false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get PR command")
+		return nil, false, err
+	}
+
+	now := time.Now()
+	command := converter.PrCommandToEntity(request)
+	command.Status = PrCommandPending
+	command.CreatedAt = now
+	command.UpdatedAt = now
+	if err := s.PrCommandRepository.Create(db, command); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to create PR command")
+		return nil, false, err
+	}
+	go s.Run(command.ID)
+	return converter.PrCommandToResponse(command), true, nil
+}
+
+// GetAllByPr lists the commands given on a PR, oldest first
+func (s *PrCommandService) GetAllByPr(ctx context.Context, courseID int, prNumber int) ([]*model.PrCommandResponse, error) {
+	commands := make([]entity.PrCommand, 0)
+	if err := s.PrCommandRepository.FindAllByPr(s.DB.WithContext(ctx), &commands, courseID, prNumber); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get PR commands")
+		return nil, err
+	}
+	responses := make([]*model.PrCommandResponse, 0, len(commands))
+	for i := range commands {
+		responses = append(responses, converter.PrCommandToResponse(&commands[i]))
+	}
+	return responses, nil
+}
+
+// ResumeUnfinished runs again the commands cut short by a restart
+func (s *PrCommandService) ResumeUnfinished(ctx context.Context) {
+	commands := make([]entity.PrCommand, 0)
+	if err := s.PrCommandRepository.FindAllUnfinished(s.DB.WithContext(ctx), &commands); err != nil {
+		s.Log.WithError(err).Error("failed to list unfinished PR commands")
+		return
+	}
+	for _, command := range commands {
+		s.Log.Infof("Resuming /neurade %s on PR %d of course %d (job %d)", command.Command, command.PrNumber, command.CourseID, command.ID)
+		s.Run(command.ID)
+	}
+}
+
+// Run executes one queued command and records its answer
+func (s *PrCommandService) Run(id int) {
+	ctx := context.Background()
+	defer func() {
+		if r := recover(); r != nil {
+			s.finish(ctx, id, "", fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	command := &entity.PrCommand{}
+	if err := s.PrCommandRepository.FindById(s.DB, command, id); err != nil {
+		s.Log.WithError(err).Errorf("failed to get PR command %d", id)
+		return
+	}
+	now := time.Now()
+	if err := s.DB.Model(command).Updates(map[string]interface{}{"status": PrCommandRunning, "started_at": now, "error": "", "updated_at": now}).Error; err != nil {
+		s.Log.WithError(err).Errorf("failed to start PR command %d", id)
+		return
+	}
+	if s.Execute == nil {
+		s.finish(ctx, id, "", errors.New("PR commands are not set up"))
+		return
+	}
+	result, err := s.Execute(ctx, converter.PrCommandToResponse(command))
+	s.finish(ctx, id, result, err)
+}
+
+func (s *PrCommandService) finish(ctx context.Context, id int, result string, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      PrCommandDone,
+		"result":      result,
+		"finished_at": now,
+		"updated_at":  now,
+	}
+	if err != nil {
+		updates["status"] = PrCommandFailed
+		updates["error"] = err.Error()
+		s.Log.WithError(err).Errorf("PR command %d failed", id)
+	}
+	if err := s.DB.WithContext(ctx).Model(&entity.PrCommand{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		s.Log.WithError(err).Errorf("failed to record result of PR command %d", id)
+	}
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/util"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PrDiffService fetches a pull request's diff once per head SHA and keeps it in
+// the course bucket, so reviews, chats and the dashboard share one copy
+type PrDiffService struct {
+	GitProviders *GitProviders
+	MinioUtil    *util.MinioUtil
+	Log          *logrus.Logger
+}
+
+func NewPrDiffService(gitProviders *GitProviders, minioUtil *util.MinioUtil, log *logrus.Logger) *PrDiffService {
+	return &PrDiffService{
+		GitProviders: gitProviders,
+		MinioUtil:    minioUtil,
+		Log:          log,
+	}
+}
+
+// GetDiff returns the diff for the PR's head. headSHA is the one stored on
+// the PR row: a diff cached for it is returned without asking the provider.
+// Otherwise the provider gives the actual head and base, since the stored
+// SHA may be older than the files it would return.
+func (s *PrDiffService) GetDiff(ctx context.Context, course *model.CourseResponse, prNumber int, headSHA, githubToken string) (*model.PrDiff, error) {
+	if headSHA != "" {
+		if cached, err := s.load(ctx, s.diffURL(course.ID, prNumber, headSHA)); err == nil && cached != nil {
+			return cached, nil
+		} else if err != nil {
+			s.Log.WithContext(ctx).WithError(err).Warnf("failed to read cached diff for PR #%d", prNumber)
+		}
+	}
+	provider, repo, err := s.GitProviders.ForCourse(course)
+	if err != nil {
+		return nil, err
+	}
+	pullRequest, err := provider.GetPullRequest(ctx, repo, prNumber, githubToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request: %w", err)
+	}
+	return s.GetDiffAt(ctx, course, prNumber, pullRequest.Head.SHA, pullRequest.Base.SHA, githubToken)
+}
+
+// GetDiffAt is GetDiff for callers that know the PR's current head and base.
+// The provider only lists the files of the current head, so an older headSHA
+// would cache them under the wrong commit.
+func (s *PrDiffService) GetDiffAt(ctx context.Context, course *model.CourseResponse, prNumber int, headSHA, baseSHA, githubToken string) (*model.PrDiff, error) {
+	if cached, err := s.load(ctx, s.diffURL(course.ID, prNumber, headSHA)); err == nil && cached != nil {
+		return cached, nil
+	} else if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Warnf("failed to read cached diff for PR #%d", prNumber)
+	}
+
+	provider, repo, err := s.GitProviders.ForCourse(course)
+	if err != nil {
+		return nil, err
+	}
+	files, err := provider.GetPullRequestFiles(ctx, repo, prNumber, githubToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request files: %w", err)
+	}
+	diff := &model.PrDiff{
+		CourseID:  course.ID,
+		PrNumber:  prNumber,
+		HeadSHA:   headSHA,
+		BaseSHA:   baseSHA,
+		Files:     files,
+		FetchedAt: time.Now(),
+	}
+	content, err := json.Marshal(diff)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.MinioUtil.SaveObject(ctx, course.ID, "diff", fmt.Sprintf("pr-%d-%s", prNumber, headSHA), content, "application/json"); err != nil {
+		// The diff is still usable; the next call simply fetches it again
+		s.Log.WithContext(ctx).WithError(err).Warnf("failed to cache diff for PR #%d", prNumber)
+	}
+	return diff, nil
+}
+
+// GetFileSnapshot returns one file's content at the given commit, cached the same way
+func (s *PrDiffService) GetFileSnapshot(ctx context.Context, course *model.CourseResponse, sha, path, githubToken string) (*model.PrFileSnapshot, error) {
+	name := fmt.Sprintf("%s-%x", sha, sha1.Sum([]byte(path)))
+	objectURL := s.MinioUtil.ObjectURL(course.ID, "snapshot", name)
+	if found, err := s.MinioUtil.ObjectExists(ctx, objectURL); err == nil && found {
+		content, err := s.MinioUtil.GetFile(ctx, objectURL)
+		if err == nil {
+			return &model.PrFileSnapshot{Path: path, SHA: sha, Content: content}, nil
+		}
+	}
+
+	provider, repo, err := s.GitProviders.ForCourse(course)
+	if err != nil {
+		return nil, err
+	}
+	content, err := provider.GetFileContent(ctx, repo, path, sha, githubToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file content: %w", err)
+	}
+	if _, err := s.MinioUtil.SaveObject(ctx, course.ID, "snapshot", name, []byte(content), "text/plain"); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Warnf("failed to cache snapshot of %s@%s", path, sha)
+	}
+	return &model.PrFileSnapshot{Path: path, SHA: sha, Content: content}, nil
+}
+
+// diffURL is where the diff of the PR at headSHA is cached
+func (s *PrDiffService) diffURL(courseID, prNumber int, headSHA string) string {
+	return s.MinioUtil.ObjectURL(courseID, "diff", fmt.Sprintf("pr-%d-%s", prNumber, headSHA))
+}
+
+func (s *PrDiffService) load(ctx context.Context, objectURL string) (*model.PrDiff, error) {
+	found, err := s.MinioUtil.ObjectExists(ctx, objectURL)
+	if err != nil || !found {
+		return nil, err
+	}
+	content, err := s.MinioUtil.GetFile(ctx, objectURL)
+	if err != nil {
+		return nil, err
+	}
+	var diff model.PrDiff
+	if err := json.Unmarshal([]byte(content), &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// AgentFiles flattens the diff into the shape the review agent expects
+func AgentFiles(diff *model.PrDiff) []map[string]interface{} {
+	files := make([]map[string]interface{}, 0, len(diff.Files))
+	for _, f := range diff.Files {
+		files = append(files, map[string]interface{}{
+			"filename": f.Filename,
+			"status":   f.Status,
+			"patch":    f.Patch,
+		})
+	}
+	return files
+}
+
+// AnchorComments splits review comments into those whose path and diff
+// position exist in the diff and those GitHub would reject
+func AnchorComments(diff *model.PrDiff, comments []model.AgentComment) ([]model.AgentComment, []model.AgentComment) {
+	positions := make(map[string]int, len(diff.Files))
+	for _, f := range diff.Files {
+		positions[f.Filename] = diffPositions(f.Patch)
+	}
+	anchored := make([]model.AgentComment, 0, len(comments))
+	unanchored := make([]model.AgentComment, 0)
+	for _, comment := range comments {
+		maxPosition, ok := positions[comment.Path]
+		if ok && comment.Position >= 1 && comment.Position <= maxPosition {
+			anchored = append(anchored, comment)
+		} else {
+			unanchored = append(unanchored, comment)
+		}
+	}
+	return anchored, unanchored
+}
+
+// diffPositions counts the commentable positions in a patch: every line after
+// the first hunk header, including later hunk headers
+func diffPositions(patch string) int {
+	if patch == "" {
+		return 0
+	}
+	return len(strings.Split(strings.TrimSuffix(patch, "\n"), "\n")) - 1
+}
+
+// DiffPositionLines returns the old and new line numbers at a GitHub diff
+// position of a patch, for hosts that anchor comments by line. A removed line
+// has no new line and an added one no old line.
+func DiffPositionLines(patch string, position int) (int, int, bool) {
+	oldLine, newLine := 0, 0
+	current := -1
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		current++
+		if strings.HasPrefix(line, "@@") {
+			var oldStart, newStart int
+			fields := strings.Fields(line)
+			if len(fields) >= 3 {
+				fmt.Sscanf(strings.TrimPrefix(fields[1], "-"), "%d", &oldStart)
+				fmt.Sscanf(strings.TrimPrefix(fields[2], "+"), "%d", &newStart)
+			}
+			oldLine, newLine = oldStart, newStart
+			continue
+		}
+		var atOld, atNew int
+		switch {
+		case strings.HasPrefix(line, "+"):
+			atNew = newLine
+			newLine++
+		case strings.HasPrefix(line, "-"):
+			atOld = oldLine
+			oldLine++
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file" belongs to the line before it
+		default:
+			atOld, atNew = oldLine, newLine
+			oldLine++
+			newLine++
+		}
+		if current == position {
+			return atOld, atNew, atOld != 0 || atNew != 0
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"be/neurade/v2/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Kinds of label kept on graded PRs
+const (
+	LabelKindGraded       = "graded"
+	LabelKindNeedsChanges = "needs_changes"
+	LabelKindLate         = "late"
+	// LabelKindAssignment is a prefix; the PR's label adds the assignment name
+	LabelKindAssignment = "assignment"
+)
+
+// labelNameLimit is the longest label name GitHub accepts
+const labelNameLimit = 50
+
+// ErrInvalidLabel is returned for an unknown kind, an empty or too long
+// name, or a colour that is not six hex digits
+var ErrInvalidLabel = errors.New("invalid label")
+
+var labelColor = regexp.MustCompile(`^[0-9a-f]{6}$`)
+
+// labelKinds lists the kinds in the order they are shown, with the name,
+// colour and description of each before a course changes it
+var labelKinds = []struct {
+	kind        string
+	name        string
+	color       string
+	description string
+}{
+	{LabelKindGraded, "neurade:graded", "0e8a16", "Graded by Neurade"},
+	{LabelKindNeedsChanges, "neurade:needs-changes", "d93f0b", "Scored below the course's pass mark"},
+	{LabelKindLate, "neurade:late", "fbca04", "Opened after the assignment's due date"},
+	{LabelKindAssignment, "assignment:", "1d76db", "Assignment the PR is graded against"},
+}
+
+// PrLabelService keeps labels on a course's GitHub PRs in line with their
+// grading: graded, needs-changes below the pass score, late after the due date
+// and the assignment's name. The labels are created in the repository on
+// first use. Other labels on the PR are left alone.
+type PrLabelService struct {
+	DB                    *gorm.DB
+	CourseLabelRepository *repository.CourseLabelRepository
+	GitHubService         *GitHubService
+	Log                   *logrus.Logger
+	// ensured remembers the colour of repository labels already created or
+	// updated, by repository and name
+	ensured sync.Map
+}
+
+func NewPrLabelService(db *gorm.DB, courseLabelRepository *repository.CourseLabelRepository, githubService *GitHubService, log *logrus.Logger) *PrLabelService {
+	return &PrLabelService{
+		DB:                    db,
+		CourseLabelRepository: courseLabelRepository,
+		GitHubService:         githubService,
+		Log:                   log,
+	}
+}
+
+// Labels returns the course's label for each kind, its own or the default
+func (s *PrLabelService) Labels(ctx context.Context, courseID int) ([]*model.CourseLabelResponse, error) {
+	custom := make([]entity.CourseLabel, 0)
+	if err := s.CourseLabelRepository.FindAllByCourse(s.DB.WithContext(ctx), &custom, courseID); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get course labels")
+		return nil, err
+	}
+	byKind := make(map[string]*entity.CourseLabel, len(custom))
+	for i := range custom {
+		byKind[custom[i].Kind] = &custom[i]
+	}
+	labels := make([]*model.CourseLabelResponse, 0, len(labelKinds))
+	for _, kind := range labelKinds {
+		if label, ok := byKind[kind.kind]; ok {
+			labels = append(labels, converter.CourseLabelToResponse(label))
+			continue
+		}
+		labels = append(labels, &model.CourseLabelResponse{CourseID: courseID, Kind: kind.kind, Name: kind.name, Color: kind.color})
+	}
+	return labels, nil
+}
+
+// SetLabel gives a kind of label the course's own name and colour. An empty
+// name and colour go back to the default. Labels already on PRs keep their old
+// name; PRs get the new one when they are next graded.
+func (s *PrLabelService) SetLabel(ctx context.Context, request *model.CourseLabelUpdateRequest) (*model.CourseLabelResponse, error) {
+	known := false
+	for _, kind := range labelKinds {
+		known = known || kind.kind == request.Kind
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidLabel, request.Kind)
+	}
+	db := s.DB.WithContext(ctx)
+	name := strings.TrimSpace(request.Name)
+	color := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(request.Color), "#"))
+	if name == "" && color == "" {
+		if err := db.Where("course_id = ? AND kind = ?", request.CourseID, request.Kind).Delete(&entity.CourseLabel{}).Error; err != nil {
+			s.Log.WithContext(ctx).WithError(err).Error("failed to reset course label")
+			return nil, err
+		}
+		labels, err := s.Labels(ctx, request.CourseID)
+		if err != nil {
+			return nil, err
+		}
+		for _, label := range labels {
+			if label.Kind == request.Kind {
+				return label, nil
+			}
+		}
+	}
+	if name == "" || len([]rune(name)) > labelNameLimit {
+		return nil, fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidLabel, labelNameLimit)
+	}
+	if !labelColor.MatchString(color) {
+		return nil, fmt.Errorf("%w: color must be six hex digits", ErrInvalidLabel)
+	}
+
+	label := &entity.CourseLabel{}
+	err := s.CourseLabelRepository.FindByCourseAndKind(db, label, request.CourseID, request.Kind)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get course label")
+		return nil, err
+	}
+	now := time.Now()
+	if label.ID == 0 {
+		label = &entity.CourseLabel{CourseID: request.CourseID, Kind: request.Kind, CreatedAt: now}
+	}
+	label.Name = name
+	label.Color = color
+	label.UpdatedAt = now
+	if err := db.Save(label).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to save course label")
+		return nil, err
+	}
+	return converter.CourseLabelToResponse(label), nil
+}
+
+// Apply labels a freshly graded PR: graded, needs-changes when it scored below
+// the course's pass score, late when it was opened after the assignment's due
+// date, and the assignment's name. assignment may be nil. Labels of ours that
+// no longer apply are removed. Failures are only logged; labels never stop
+// grading.
+func (s *PrLabelService) Apply(ctx context.Context, course *model.CourseResponse, pr *model.PrResponse, assignment *model.AssignmentResponse, passed bool, githubToken string) {
+	labels, ok := s.labels(ctx, course)
+	if !ok {
+		return
+	}
+	want := []*model.CourseLabelResponse{labels[LabelKindGraded]}
+	if !passed {
+		want = append(want, labels[LabelKindNeedsChanges])
+	}
+	if assignment != nil {
+		if assignment.DueDate != nil && pr.CreatedAt.After(*assignment.DueDate) {
+			want = append(want, labels[LabelKindLate])
+		}
+		named := *labels[LabelKindAssignment]
+		named.Name = truncateLabel(named.Name + assignment.AssignmentName)
+		want = append(want, &named)
+	}
+	s.sync(ctx, course, pr.PrNumber, githubToken, want, func(name string) bool {
+		return isOurLabel(labels, name)
+	})
+}
+
+// Regrade takes the graded and needs-changes labels off a PR about to be
+// graded again
+func (s *PrLabelService) Regrade(ctx context.Context, course *model.CourseResponse, pr *model.PrResponse, githubToken string) {
+	labels, ok := s.labels(ctx, course)
+	if !ok {
+		return
+	}
+	s.sync(ctx, course, pr.PrNumber, githubToken, nil, func(name string) bool {
+		return name == labels[LabelKindGraded].Name || name == labels[LabelKindNeedsChanges].Name
+	})
+}
+
+// labels returns the course's labels by kind, and false for courses not on
+// GitHub, which have no labels kept
+func (s *PrLabelService) labels(ctx context.Context, course *model.CourseResponse) (map[string]*model.CourseLabelResponse, bool) {
+	if util.GitProviderOf(course.GithubURL, course.GitProvider) != util.GitProviderGitHub {
+		return nil, false
+	}
+	list, err := s.Labels(ctx, course.ID)
+	if err != nil {
+		return nil, false
+	}
+	labels := make(map[string]*model.CourseLabelResponse, len(list))
+	for _, label := range list {
+		labels[label.Kind] = label
+	}
+	return labels, true
+}
+
+// sync puts the wanted labels on the PR and removes those of its labels that
+// ours reports as ours and are not wanted
+func (s *PrLabelService) sync(ctx context.Context, course *model.CourseResponse, prNumber int, githubToken string, want []*model.CourseLabelResponse, ours func(name string) bool) {
+	repo, err := util.ParseRepoURL(course.GithubURL, course.GitProvider)
+	if err != nil {
+		return
+	}
+	current, err := s.GitHubService.ListIssueLabels(ctx, repo.Owner, repo.Name, prNumber, githubToken)
+	if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Errorf("failed to list labels of PR %d of course %d", prNumber, course.ID)
+		return
+	}
+	wanted := make(map[string]bool, len(want))
+	for _, label := range want {
+		wanted[label.Name] = true
+	}
+	present := make(map[string]bool, len(current))
+	for _, label := range current {
+		present[label.Name] = true
+		if wanted[label.Name] || !ours(label.Name) {
+			continue
+		}
+		err := s.GitHubService.RemoveIssueLabel(ctx, repo.Owner, repo.Name, prNumber, githubToken, label.Name)
+		if err != nil && !IsGitHubNotFound(err) {
+			s.Log.WithContext(ctx).WithError(err).Errorf("failed to remove label %q from PR %d of course %d", label.Name, prNumber, course.ID)
+		}
+	}
+
+	missing := make([]string, 0, len(want))
+	for _, label := range want {
+		if present[label.Name] {
+			continue
+		}
+		if err := s.ensure(ctx, repo, githubToken, label); err != nil {
+			s.Log.WithContext(ctx).WithError(err).Errorf("failed to create label %q for course %d", label.Name, course.ID)
+			continue
+		}
+		missing = append(missing, label.Name)
+	}
+	if len(missing) == 0 {
+		return
+	}
+	if err := s.GitHubService.AddIssueLabels(ctx, repo.Owner, repo.Name, prNumber, githubToken, missing); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Errorf("failed to label PR %d of course %d", prNumber, course.ID)
+	}
+}
+
+// ensure makes sure the repository has the label in its colour
+func (s *PrLabelService) ensure(ctx context.Context, repo *util.RepoRef, githubToken string, label *model.CourseLabelResponse) error {
+	key := repo.Path() + "\x00" + label.Name
+	if color, ok := s.ensured.Load(key); ok && color == label.Color {
+		return nil
+	}
+	request := &model.GitHubLabel{Name: label.Name, Color: label.Color, Description: labelDescription(label.Kind)}
+	err := s.GitHubService.CreateLabel(ctx, repo.Owner, repo.Name, githubToken, request)
+	var apiErr *GitHubAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity {
+		err = s.GitHubService.UpdateLabel(ctx, repo.Owner, repo.Name, githubToken, request)
+	}
+	if err != nil {
+		return err
+	}
+	s.ensured.Store(key, label.Color)
+	return nil
+}
+
+// isOurLabel reports whether name is one of the course's labels, counting
+// every label with the assignment prefix
+func isOurLabel(labels map[string]*model.CourseLabelResponse, name string) bool {
+	for kind, label := range labels {
+		if kind == LabelKindAssignment {
+			if strings.HasPrefix(name, label.Name) {
+				return true
+			}
+		} else if name == label.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func labelDescription(kind string) string {
+	for _, k := range labelKinds {
+		if k.kind == kind {
+			return k.description
+		}
+	}
+	return ""
+}
+
+// truncateLabel cuts a label name to the length GitHub accepts
+func truncateLabel(name string) string {
+	runes := []rune(name)
+	if len(runes) > labelNameLimit {
+		return string(runes[:labelNameLimit])
+	}
+	return name
+}
@@ -6,11 +6,17 @@ import (
 	"be/neurade/v2/internal/model/converter"
 	"be/neurade/v2/internal/repository"
 	"context"
+	"errors"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
+// prGitHubColumns are owned by the GitHub sync and kept by ordinary updates,
+// which rebuild the whole row from a PrCreateRequest
+var prGitHubColumns = []string{"author_login", "head_ref", "head_repo", "base_ref", "head_sha", "draft", "merged_at"}
+
 type PrService struct {
 	DB           *gorm.DB
 	PrRepository *repository.PrRepository
@@ -56,7 +62,7 @@ func (s *PrService) Update(ctx context.Context, request *model.PrCreateRequest)
 
 	prEntity := converter.PrToEntity(request)
 
-	if err := tx.Save(prEntity).Error; err != nil {
+	if err := tx.Omit(prGitHubColumns...).Save(prEntity).Error; err != nil {
 		s.Log.WithContext(ctx).WithError(err).Error("failed to update pr")
 		return nil, err
 	}
@@ -67,6 +73,63 @@ func (s *PrService) Update(ctx context.Context, request *model.PrCreateRequest)
 	return converter.PrToResponse(prEntity), nil
 }
 
+// SyncFromGitHub creates the PR or refreshes the fields GitHub owns, leaving
+// the assignment, grading status and review result alone. It reports whether
+// the PR was new.
+func (s *PrService) SyncFromGitHub(ctx context.Context, request *model.PrCreateRequest) (*model.PrResponse, bool, error) {
+	db := s.DB.WithContext(ctx)
+	existing := &entity.Pr{}
+	err := s.PrRepository.FindByCourseIDAndPrNumber(db, existing, request.CourseID, request.PrNumber)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.Log.WithContext(ctx).WithError(err).Error("fail to get pr by course_id and pr_number")
+		return nil, false, err
+	}
+	if err != nil {
+		prEntity := converter.PrToEntity(request)
+		if err := db.Create(prEntity).Error; err != nil {
+			s.Log.WithContext(ctx).WithError(err).Error("failed to create pr")
+			return nil, false, err
+		}
+		return converter.PrToResponse(prEntity), true, nil
+	}
+
+	updates := map[string]interface{}{
+		"pr_name":        request.PrName,
+		"pr_description": request.PrDescription,
+		"status":         request.Status,
+		"author_login":   request.AuthorLogin,
+		"head_ref":       request.HeadRef,
+		"head_repo":      request.HeadRepo,
+		"base_ref":       request.BaseRef,
+		"head_sha":       request.HeadSHA,
+		"draft":          request.Draft,
+		"merged_at":      request.MergedAt,
+		"updated_at":     request.UpdatedAt,
+	}
+	if err := db.Model(existing).Updates(updates).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to update pr")
+		return nil, false, err
+	}
+	if err := s.PrRepository.FindById(db, existing, existing.ID); err != nil {
+		return nil, false, err
+	}
+	return converter.PrToResponse(existing), false, nil
+}
+
+// UpdateHeadByBranch moves the open PRs built from branch of repository, an
+// owner/name, to the pushed commit and returns how many there were. Fork PRs
+// often use a branch name the base repository has too, so both must match.
+func (s *PrService) UpdateHeadByBranch(ctx context.Context, courseID int, repository string, branch string, sha string) (int64, error) {
+	result := s.DB.WithContext(ctx).Model(&entity.Pr{}).
+		Where("course_id = ? AND LOWER(head_repo) = LOWER(?) AND head_ref = ? AND status = ?", courseID, repository, branch, "open").
+		Updates(map[string]interface{}{"head_sha": sha, "updated_at": time.Now()})
+	if result.Error != nil {
+		s.Log.WithContext(ctx).WithError(result.Error).Error("failed to update pr head")
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
 func (s *PrService) GetByID(ctx context.Context, id int) (*model.PrResponse, error) {
 	prEntity := &entity.Pr{}
 	err := s.PrRepository.FindById(s.DB, prEntity, id)
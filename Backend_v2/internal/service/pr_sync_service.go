@@ -0,0 +1,317 @@
+package service
+
+import (
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	PrSyncOK     = "ok"
+	PrSyncFailed = "failed"
+)
+
+var ErrPrSyncRunning = errors.New("a sync of this course is already running")
+
+// PrSyncService reconciles a course's PRs and their comments with GitHub. It
+// backs the manual fetch and a scheduler that catches whatever the webhook
+// missed.
+type PrSyncService struct {
+	DB                 *gorm.DB
+	GitHubService      *GitHubService
+	GitProviders       *GitProviders
+	GitHubTokenService *GitHubTokenService
+	PrService          *PrService
+	CourseService      *CourseService
+	ChatService        *ChatService
+	Log                *logrus.Logger
+	// AutoGrade starts grading the course's ungraded PRs; the scheduler calls
+	// it for courses with auto-grade on when a sync finds work
+	AutoGrade func(course *model.CourseResponse)
+	running   sync.Map
+}
+
+func NewPrSyncService(db *gorm.DB, githubService *GitHubService, gitProviders *GitProviders, githubTokenService *GitHubTokenService, prService *PrService, courseService *CourseService, chatService *ChatService, log *logrus.Logger) *PrSyncService {
+	return &PrSyncService{
+		DB:                 db,
+		GitHubService:      githubService,
+		GitProviders:       gitProviders,
+		GitHubTokenService: githubTokenService,
+		PrService:          prService,
+		CourseService:      courseService,
+		ChatService:        chatService,
+		Log:                log,
+	}
+}
+
+// GitHubCommentKey identifies a GitHub comment in the chat. kind is
+// "issue_comment", "review_comment" or "review".
+func GitHubCommentKey(kind string, id int64) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// ReviewThreadKey is the chat thread key of a review comment: the key of the
+// comment it replies to, or its own when it starts the thread
+func ReviewThreadKey(id, inReplyToID int64) string {
+	if inReplyToID != 0 {
+		return GitHubCommentKey("review_comment", inReplyToID)
+	}
+	return GitHubCommentKey("review_comment", id)
+}
+
+// Sync fetches the PRs updated at or after since, or all of them when since is
+// nil, saves them and backfills the comments of every PR that changed. The
+// cursor only moves after a sync that saved everything, so a failed one is
+// retried next time. The outcome is recorded on the course.
+func (s *PrSyncService) Sync(ctx context.Context, course *model.CourseResponse, since *time.Time) (*model.FetchPullRequestsResponse, error) {
+	if _, busy := s.running.LoadOrStore(course.ID, true); busy {
+		return nil, ErrPrSyncRunning
+	}
+	defer s.running.Delete(course.ID)
+
+	response, err := s.sync(ctx, course, since)
+	status, message := PrSyncOK, ""
+	if err != nil {
+		status, message = PrSyncFailed, err.Error()
+	} else {
+		message = fmt.Sprintf("%d PRs: %d new, %d updated, %d closed, %d merged, %d comments",
+			response.PullRequestsCount, response.New, response.Updated, response.Closed, response.Merged, response.Comments)
+		if response.Failed > 0 {
+			status = PrSyncFailed
+			message += fmt.Sprintf(", %d failed", response.Failed)
+		}
+	}
+	// The outcome is recorded even when the request that asked for it was cancelled
+	if recordErr := s.CourseService.RecordSync(context.WithoutCancel(ctx), course.ID, time.Now(), status, message); recordErr != nil {
+		s.Log.Errorf("Failed to record PR sync of course %d: %v", course.ID, recordErr)
+	}
+	return response, err
+}
+
+func (s *PrSyncService) sync(ctx context.Context, course *model.CourseResponse, since *time.Time) (*model.FetchPullRequestsResponse, error) {
+	if course.GithubURL == "" {
+		return nil, errors.New("course has no GitHub URL")
+	}
+	provider, repo, err := s.GitProviders.ForCourse(course)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.GitHubTokenService.Token(ctx, course.ID)
+	if err != nil {
+		return nil, fmt.Errorf("GitHub token not available: %w", err)
+	}
+	pullRequests, err := provider.ListPullRequests(ctx, repo, token, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pull requests: %w", err)
+	}
+	existing, err := s.PrService.GetAllByCourse(ctx, course.ID)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]*model.PrResponse, len(existing))
+	for _, pr := range existing {
+		known[pr.PrNumber] = pr
+	}
+
+	response := &model.FetchPullRequestsResponse{CourseID: course.ID, Since: since}
+	var newest time.Time
+	for i := range pullRequests {
+		request := converter.GitHubPullRequestToPrRequest(course.ID, &pullRequests[i])
+		before := known[request.PrNumber]
+		if before != nil && before.Status == request.Status && before.HeadSHA == request.HeadSHA && request.UpdatedAt.Equal(before.UpdatedAt) {
+			// Seen at this state already: only the cursor needs it
+			if request.UpdatedAt.After(newest) {
+				newest = request.UpdatedAt
+			}
+			response.PullRequestsCount++
+			continue
+		}
+		if _, _, err := s.PrService.SyncFromGitHub(ctx, request); err != nil {
+			s.Log.Errorf("Failed to save PR %d of course %d: %v", request.PrNumber, course.ID, err)
+			response.Failed++
+			continue
+		}
+		response.PullRequestsCount++
+		if request.UpdatedAt.After(newest) {
+			newest = request.UpdatedAt
+		}
+
+		switch {
+		case before == nil:
+			response.New++
+		case before.Status != request.Status && request.Status == "merged":
+			response.Merged++
+		case before.Status != request.Status && request.Status == "closed":
+			response.Closed++
+		default:
+			response.Updated++
+		}
+		if request.Status == "open" && (before == nil || before.HeadSHA != request.HeadSHA) {
+			response.NeedsGrading++
+		}
+
+		// A comment bumps the PR's updated_at, so only changed PRs can have
+		// comments we have not seen. GitLab notes only arrive by webhook.
+		if repo.Provider != util.GitProviderGitHub {
+			continue
+		}
+		added, err := s.backfillComments(ctx, course, repo.Owner, repo.Name, token, request.PrNumber, since)
+		if err != nil {
+			s.Log.Errorf("Failed to backfill comments of PR %d of course %d: %v", request.PrNumber, course.ID, err)
+			response.Failed++
+			continue
+		}
+		response.Comments += added
+	}
+
+	response.SyncedAt = course.PrSyncedAt
+	if response.Failed == 0 && !newest.IsZero() {
+		if err := s.CourseService.SetPrSyncedAt(ctx, course.ID, newest); err != nil {
+			s.Log.Errorf("Failed to update PR sync cursor for course %d: %v", course.ID, err)
+		} else {
+			response.SyncedAt = &newest
+		}
+	}
+	response.Message = "Successfully fetched and saved pull requests"
+	s.Log.Infof("Synced %d pull requests of course %d: %d new, %d updated, %d closed, %d merged, %d comments, %d failed",
+		response.PullRequestsCount, course.ID, response.New, response.Updated, response.Closed, response.Merged, response.Comments, response.Failed)
+	return response, nil
+}
+
+// backfillComments adds the PR's conversation comments, review comments and
+// reviews that are missing from its chat
+func (s *PrSyncService) backfillComments(ctx context.Context, course *model.CourseResponse, owner, repo, token string, prNumber int, since *time.Time) (int, error) {
+	issueComments, err := s.GitHubService.ListIssueComments(ctx, owner, repo, prNumber, token, since)
+	if err != nil {
+		return 0, err
+	}
+	reviewComments, err := s.GitHubService.ListReviewComments(ctx, owner, repo, prNumber, token, since)
+	if err != nil {
+		return 0, err
+	}
+	reviews, err := s.GitHubService.ListReviews(ctx, owner, repo, prNumber, token)
+	if err != nil {
+		return 0, err
+	}
+
+	identity, err := s.GitHubTokenService.Identity(ctx, course.ID)
+	if err != nil {
+		s.Log.Warnf("Could not tell the bot's comments apart in course %d: %v", course.ID, err)
+	}
+	pr, err := s.PrService.GetByCourseIDAndPrNumber(ctx, course.ID, prNumber)
+	if err != nil {
+		return 0, err
+	}
+	messages := make([]*model.ChatMessageCreateRequest, 0, len(issueComments)+len(reviewComments)+len(reviews))
+	add := func(kind string, comments []model.GitHubComment) {
+		for _, comment := range comments {
+			// Reviews without a summary, such as a bare approval, carry no message
+			if comment.Body == "" {
+				continue
+			}
+			message := &model.ChatMessageCreateRequest{
+				CourseID:    course.ID,
+				PrID:        pr.ID,
+				AuthorLogin: comment.User.Login,
+				Role:        s.commentRole(ctx, course, identity, comment.User.Login, comment.AuthorAssociation),
+				Message:     comment.Body,
+				GitHubID:    GitHubCommentKey(kind, comment.ID),
+				File:        comment.Path,
+				Line:        comment.Line,
+			}
+			if kind == "review_comment" {
+				message.ThreadKey = ReviewThreadKey(comment.ID, comment.InReplyToID)
+			}
+			written := comment.CreatedAt
+			if written == "" {
+				written = comment.SubmittedAt
+			}
+			if createdAt, err := time.Parse(time.RFC3339, written); err == nil {
+				message.CreatedAt = createdAt
+			}
+			messages = append(messages, message)
+		}
+	}
+	add("issue_comment", issueComments)
+	add("review_comment", reviewComments)
+	add("review", reviews)
+	if len(messages) == 0 {
+		return 0, nil
+	}
+	return s.ChatService.AddMissing(ctx, messages)
+}
+
+// RunScheduler syncs every active course from its cursor, one round every
+// interval plus up to jitter, until ctx is done
+func (s *PrSyncService) RunScheduler(ctx context.Context, interval, jitter time.Duration) {
+	s.Log.Infof("PR sync scheduler started: every %s, jitter up to %s", interval, jitter)
+	for {
+		wait := interval
+		if jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(jitter)))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		s.syncAll(ctx)
+	}
+}
+
+func (s *PrSyncService) syncAll(ctx context.Context) {
+	courses, err := s.CourseService.GetAllActive(ctx)
+	if err != nil {
+		s.Log.Errorf("PR sync scheduler could not list courses: %v", err)
+		return
+	}
+	for _, course := range courses {
+		if ctx.Err() != nil {
+			return
+		}
+		if course.GithubURL == "" {
+			continue
+		}
+		response, err := s.Sync(ctx, course, course.PrSyncedAt)
+		if errors.Is(err, ErrPrSyncRunning) {
+			continue
+		}
+		if err != nil {
+			s.Log.Warnf("Scheduled PR sync of course %d failed: %v", course.ID, err)
+			continue
+		}
+		if course.AutoGrade && response.NeedsGrading > 0 && s.AutoGrade != nil {
+			s.AutoGrade(course)
+		}
+	}
+}
+
+// CommentRoleBot is the chat role of the bot's own comments, which are kept
+// in the chat but never answered
+const CommentRoleBot = "bot"
+
+// commentRole tells the bot, teachers and students apart the way incoming
+// webhook comments do. identity is the bot's login, empty when unknown.
+func (s *PrSyncService) commentRole(ctx context.Context, course *model.CourseResponse, identity, login, authorAssociation string) string {
+	if identity != "" && strings.EqualFold(login, identity) {
+		return CommentRoleBot
+	}
+	staff, err := isCourseStaff(ctx, s.DB, course, login, authorAssociation)
+	if err != nil {
+		s.Log.Warnf("Could not look up %s on the roster of course %d: %v", login, course.ID, err)
+	}
+	if staff {
+		return "teacher"
+	}
+	return "student"
+}
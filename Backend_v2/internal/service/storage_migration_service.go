@@ -0,0 +1,348 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/util"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// StorageMigrationReport summarises one run of StorageMigrationService.Migrate
+type StorageMigrationReport struct {
+	DryRun     bool     `json:"dry_run"`
+	Courses    int      `json:"courses"`
+	Objects    int      `json:"objects"`
+	Copied     int      `json:"copied"`
+	Unchanged  int      `json:"unchanged"`
+	Rewritten  int      `json:"rewritten"`
+	Unresolved []string `json:"unresolved"`
+	Failures   []string `json:"failures"`
+}
+
+// StorageMigrationService moves files from the old per-course buckets into
+// the single bucket under courses/{id}/ and rewrites the stored URLs
+type StorageMigrationService struct {
+	DB        *gorm.DB
+	MinioUtil *util.MinioUtil
+	Log       *logrus.Logger
+}
+
+func NewStorageMigrationService(db *gorm.DB, minioUtil *util.MinioUtil, log *logrus.Logger) *StorageMigrationService {
+	return &StorageMigrationService{
+		DB:        db,
+		MinioUtil: minioUtil,
+		Log:       log,
+	}
+}
+
+type migratedObject struct {
+	bucket      string
+	key         string
+	newKey      string
+	contentType string
+}
+
+// migrationPlan is what a course's files are copied to and its URLs rewritten to
+type migrationPlan struct {
+	courseID int
+	objects  []migratedObject
+	// Old URL -> new URL
+	mapping map[string]string
+	// New key -> old URL, so two old objects never land on one key
+	claimed map[string]string
+}
+
+// add plans the copy of bucket/key into the course's prefix and returns its new URL
+func (p *migrationPlan) add(prefix string, newURL func(string) string, bucket, key, contentType string) string {
+	oldURL := fmt.Sprintf("minio://%s/%s", bucket, key)
+	if url, ok := p.mapping[oldURL]; ok {
+		return url
+	}
+	// Objects of another bucket with the same name, such as those saved under
+	// a course's new name, keep their bucket in the key
+	newKey := prefix + key
+	if other, taken := p.claimed[newKey]; taken && other != oldURL {
+		newKey = prefix + bucket + "/" + key
+	}
+	p.claimed[newKey] = oldURL
+	p.mapping[oldURL] = newURL(newKey)
+	p.objects = append(p.objects, migratedObject{bucket: bucket, key: key, newKey: newKey, contentType: contentType})
+	return p.mapping[oldURL]
+}
+
+// storedURL is a minio:// URL kept in a column of a row
+type storedURL struct {
+	courseID int
+	table    string
+	id       int
+	column   string
+	url      string
+}
+
+func (u storedURL) String() string {
+	return fmt.Sprintf("%s %d %s: %s", u.table, u.id, u.column, u.url)
+}
+
+// Migrate copies every object of every course's legacy bucket, and every
+// object a stored URL points at wherever it is, such as the buckets named
+// after a course's later name. Each copy is verified by checksum. Only if all
+// copies succeeded and every stored URL was found are the minio:// URLs in
+// courses, assignments and document versions rewritten, in one transaction;
+// force rewrites the URLs that were found even when others were not. The
+// legacy buckets are left untouched. Re-running is safe: objects already
+// copied with the same content are skipped.
+func (s *StorageMigrationService) Migrate(ctx context.Context, dryRun bool, force bool) (*StorageMigrationReport, error) {
+	report := &StorageMigrationReport{DryRun: dryRun, Unresolved: []string{}, Failures: []string{}}
+	storage := s.MinioUtil.Storage
+
+	courses := make([]entity.Course, 0)
+	if err := s.DB.WithContext(ctx).Find(&courses).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to list courses")
+		return nil, err
+	}
+	report.Courses = len(courses)
+	if !dryRun {
+		if err := storage.EnsureBucket(ctx, s.MinioUtil.Bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	// Per course: similarly named courses could share a legacy bucket, and
+	// each course gets its own copy
+	plans := make(map[int]*migrationPlan, len(courses))
+	planFor := func(courseID int) *migrationPlan {
+		if plans[courseID] == nil {
+			plans[courseID] = &migrationPlan{courseID: courseID, mapping: map[string]string{}, claimed: map[string]string{}}
+		}
+		return plans[courseID]
+	}
+	for _, course := range courses {
+		plan := planFor(course.ID)
+		legacyBucket := util.LegacyBucketName(course.CourseName, course.CreatedAt)
+		objects, err := storage.List(ctx, legacyBucket, "")
+		if err != nil {
+			s.Log.Warnf("Skipping legacy bucket %s of course %d: %v", legacyBucket, course.ID, err)
+			continue
+		}
+		for _, object := range objects {
+			plan.add(util.CoursePrefix(course.ID), s.MinioUtil.URL, legacyBucket, object.Key, object.ContentType)
+		}
+	}
+
+	urls, err := s.storedURLs(s.DB.WithContext(ctx))
+	if err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to list stored URLs")
+		return nil, err
+	}
+	for _, stored := range urls {
+		if err := s.resolve(ctx, planFor(stored.courseID), stored.url); err != nil {
+			report.Unresolved = append(report.Unresolved, fmt.Sprintf("%s (%v)", stored, err))
+		}
+	}
+	for _, plan := range plans {
+		report.Objects += len(plan.objects)
+	}
+	if dryRun {
+		s.countRewrites(urls, plans, report)
+		return report, nil
+	}
+
+	for _, plan := range plans {
+		for _, object := range plan.objects {
+			copied, err := s.copyObject(ctx, object, plan.mapping)
+			if err != nil {
+				report.Failures = append(report.Failures, fmt.Sprintf("%s/%s: %v", object.bucket, object.key, err))
+				continue
+			}
+			if copied {
+				report.Copied++
+			} else {
+				report.Unchanged++
+			}
+		}
+	}
+	if len(report.Failures) > 0 {
+		return report, fmt.Errorf("%d objects failed to copy, stored URLs were not rewritten", len(report.Failures))
+	}
+	if len(report.Unresolved) > 0 && !force {
+		return report, fmt.Errorf("%d stored URLs point at no object, stored URLs were not rewritten; run with -force to rewrite the others", len(report.Unresolved))
+	}
+
+	tx := s.DB.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+	if err := s.rewriteURLs(tx, plans, report); err != nil {
+		tx.Rollback()
+		s.Log.WithContext(ctx).WithError(err).Error("failed to rewrite stored URLs")
+		return report, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to commit transaction")
+		return report, err
+	}
+	return report, nil
+}
+
+// resolve plans the copy of the object behind a stored URL, and of the files
+// it lists when it is a manifest. URLs already in the single bucket and
+// links elsewhere need nothing.
+func (s *StorageMigrationService) resolve(ctx context.Context, plan *migrationPlan, fileURL string) error {
+	if !strings.HasPrefix(fileURL, "minio://") || strings.HasPrefix(fileURL, "minio://"+s.MinioUtil.Bucket+"/") {
+		return nil
+	}
+	if _, planned := plan.mapping[fileURL]; !planned {
+		bucket, key, err := s.MinioUtil.ParseMinioURL(fileURL)
+		if err != nil {
+			return err
+		}
+		info, err := s.MinioUtil.Storage.Stat(ctx, bucket, key)
+		if err != nil {
+			return err
+		}
+		plan.add(util.CoursePrefix(plan.courseID), s.MinioUtil.URL, bucket, key, info.ContentType)
+	}
+	if !IsManifestURL(fileURL) {
+		return nil
+	}
+	content, err := s.MinioUtil.GetFile(ctx, fileURL)
+	if err != nil {
+		return err
+	}
+	manifest := &model.ReferenceManifest{}
+	if err := json.Unmarshal([]byte(content), manifest); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+	for _, file := range manifest.Files {
+		if err := s.resolve(ctx, plan, file.FileURL); err != nil {
+			return fmt.Errorf("%s: %w", file.FileURL, err)
+		}
+	}
+	return nil
+}
+
+// copyObject copies one object and reads it back to compare checksums. It
+// reports false when the destination already held identical content.
+func (s *StorageMigrationService) copyObject(ctx context.Context, object migratedObject, mapping map[string]string) (bool, error) {
+	storage := s.MinioUtil.Storage
+	content, err := storage.Get(ctx, object.bucket, object.key)
+	if err != nil {
+		return false, err
+	}
+	// Folder uploads list their files by URL, so the manifest moves with them
+	if strings.HasSuffix(object.key, "/"+ManifestName) {
+		content, err = rewriteManifest(content, mapping)
+		if err != nil {
+			return false, err
+		}
+	}
+	checksum := sha256.Sum256(content)
+
+	if existing, err := storage.Get(ctx, s.MinioUtil.Bucket, object.newKey); err == nil {
+		if sha256.Sum256(existing) == checksum {
+			return false, nil
+		}
+	} else if !errors.Is(err, util.ErrObjectNotFound) {
+		return false, err
+	}
+
+	if err := storage.Put(ctx, s.MinioUtil.Bucket, object.newKey, content, object.contentType); err != nil {
+		return false, err
+	}
+	copied, err := storage.Get(ctx, s.MinioUtil.Bucket, object.newKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read back copy: %w", err)
+	}
+	if sha256.Sum256(copied) != checksum {
+		return false, errors.New("checksum mismatch after copy")
+	}
+	return true, nil
+}
+
+// storedURLs lists the file URLs kept in courses, assignments and document
+// versions
+func (s *StorageMigrationService) storedURLs(db *gorm.DB) ([]storedURL, error) {
+	urls := make([]storedURL, 0)
+	add := func(courseID int, table string, id int, column, fileURL string) {
+		if fileURL != "" {
+			urls = append(urls, storedURL{courseID: courseID, table: table, id: id, column: column, url: fileURL})
+		}
+	}
+
+	courses := make([]entity.Course, 0)
+	if err := db.Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	for _, course := range courses {
+		add(course.ID, "courses", course.ID, "general_answer", course.GeneralAnswer)
+	}
+
+	assignments := make([]entity.Assignment, 0)
+	if err := db.Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	for _, assignment := range assignments {
+		add(assignment.CourseID, "assignments", assignment.ID, "assignment_url", assignment.AssignmentURL)
+		add(assignment.CourseID, "assignments", assignment.ID, "test_bundle_url", assignment.TestBundleURL)
+	}
+
+	versions := make([]entity.DocumentVersion, 0)
+	if err := db.Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		add(version.CourseID, "document_versions", version.ID, "file_url", version.FileURL)
+	}
+	return urls, nil
+}
+
+// countRewrites fills in how many stored URLs a run would rewrite
+func (s *StorageMigrationService) countRewrites(urls []storedURL, plans map[int]*migrationPlan, report *StorageMigrationReport) {
+	for _, stored := range urls {
+		if plan := plans[stored.courseID]; plan != nil && plan.mapping[stored.url] != "" {
+			report.Rewritten++
+		}
+	}
+}
+
+func (s *StorageMigrationService) rewriteURLs(tx *gorm.DB, plans map[int]*migrationPlan, report *StorageMigrationReport) error {
+	urls, err := s.storedURLs(tx)
+	if err != nil {
+		return err
+	}
+	for _, stored := range urls {
+		plan := plans[stored.courseID]
+		if plan == nil || plan.mapping[stored.url] == "" {
+			continue
+		}
+		newURL := plan.mapping[stored.url]
+		if err := tx.Table(stored.table).Where("id = ?", stored.id).Update(stored.column, newURL).Error; err != nil {
+			return err
+		}
+		report.Rewritten++
+	}
+	return nil
+}
+
+func rewriteManifest(content []byte, mapping map[string]string) ([]byte, error) {
+	manifest := &model.ReferenceManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	for i, file := range manifest.Files {
+		if newURL, ok := mapping[file.FileURL]; ok {
+			manifest.Files[i].FileURL = newURL
+		}
+	}
+	return json.Marshal(manifest)
+}
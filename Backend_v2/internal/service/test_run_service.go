@@ -0,0 +1,258 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"be/neurade/v2/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	TestRunPending = "pending"
+	TestRunRunning = "running"
+	TestRunPassed  = "passed"
+	TestRunFailed  = "failed"
+	TestRunError   = "error"
+)
+
+type TestRunService struct {
+	DB                *gorm.DB
+	TestRunRepository *repository.TestRunRepository
+	MinioUtil         *util.MinioUtil
+	Sandbox           *util.Sandbox
+	// LocalGitService checks out submissions of local courses
+	LocalGitService *LocalGitService
+	Log             *logrus.Logger
+}
+
+func NewTestRunService(db *gorm.DB, testRunRepository *repository.TestRunRepository, minioUtil *util.MinioUtil, sandbox *util.Sandbox, localGitService *LocalGitService, log *logrus.Logger) *TestRunService {
+	return &TestRunService{
+		DB:                db,
+		TestRunRepository: testRunRepository,
+		MinioUtil:         minioUtil,
+		Sandbox:           sandbox,
+		LocalGitService:   localGitService,
+		Log:               log,
+	}
+}
+
+// Start records a pending run so callers can hand back its ID before executing it
+func (s *TestRunService) Start(ctx context.Context, request *model.TestRunRequest) (*model.TestRunResponse, error) {
+	if request.TestCommand == "" || request.TestBundleURL == "" {
+		return nil, errors.New("assignment has no hidden test suite configured")
+	}
+	run := &entity.TestRun{
+		CourseID:     request.CourseID,
+		AssignmentID: request.AssignmentID,
+		PrID:         request.PrID,
+		Status:       TestRunPending,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := s.TestRunRepository.Create(s.DB.WithContext(ctx), run); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to create test run")
+		return nil, err
+	}
+	return converter.TestRunToResponse(run), nil
+}
+
+// Execute checks out the PR, overlays the hidden test bundle and runs the test
+// command in the sandbox, then stores the per-test outcome on the run
+func (s *TestRunService) Execute(ctx context.Context, runID int, request *model.TestRunRequest) (*model.TestRunResponse, error) {
+	run := &entity.TestRun{}
+	if err := s.TestRunRepository.FindById(s.DB.WithContext(ctx), run, runID); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get test run by id")
+		return nil, err
+	}
+	startedAt := time.Now()
+	run.Status = TestRunRunning
+	run.StartedAt = &startedAt
+	run.UpdatedAt = startedAt
+	if err := s.TestRunRepository.Update(s.DB.WithContext(ctx), run); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to mark test run as running")
+		return nil, err
+	}
+
+	if err := s.execute(ctx, run, request); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Errorf("test run %d failed to execute", run.ID)
+		run.Status = TestRunError
+		run.Log = err.Error() + "\n" + run.Log
+	}
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.UpdatedAt = finishedAt
+	if err := s.TestRunRepository.Update(s.DB.WithContext(ctx), run); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to save test run result")
+		return nil, err
+	}
+	return converter.TestRunToResponse(run), nil
+}
+
+// Run starts and executes a test run synchronously
+func (s *TestRunService) Run(ctx context.Context, request *model.TestRunRequest) (*model.TestRunResponse, error) {
+	run, err := s.Start(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return s.Execute(ctx, run.ID, request)
+}
+
+// checkout puts the PR's head in workspace and returns its commit SHA
+func (s *TestRunService) checkout(ctx context.Context, workspace string, request *model.TestRunRequest) (string, error) {
+	if request.GitProvider == util.GitProviderLocal {
+		return s.LocalGitService.CheckoutSubmission(ctx, workspace, request.CourseID, request.PrNumber)
+	}
+	repo := &util.RepoRef{Provider: util.GitProviderGitHub, Scheme: "https", Host: "github.com", Owner: request.RepoOwner, Name: request.RepoName}
+	if request.RepoURL != "" {
+		var err error
+		if repo, err = util.ParseRepoURL(request.RepoURL, request.GitProvider); err != nil {
+			return "", err
+		}
+	}
+	return util.CheckoutPullRequest(ctx, workspace, repo, request.PrNumber, request.GithubToken)
+}
+
+func (s *TestRunService) execute(ctx context.Context, run *entity.TestRun, request *model.TestRunRequest) error {
+	workspace, err := s.Sandbox.NewWorkspace()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workspace)
+
+	sha, err := s.checkout(ctx, workspace, request)
+	if err != nil {
+		return fmt.Errorf("failed to check out pull request: %w", err)
+	}
+	run.CommitSHA = sha
+
+	bundle, err := s.MinioUtil.GetFile(ctx, request.TestBundleURL)
+	if err != nil {
+		return fmt.Errorf("failed to load test bundle: %w", err)
+	}
+	if _, err := util.ExtractArchive([]byte(bundle), workspace); err != nil {
+		return fmt.Errorf("failed to unpack test bundle: %w", err)
+	}
+
+	result, err := s.Sandbox.Run(ctx, workspace, request.TestCommand)
+	if err != nil {
+		return err
+	}
+	run.Log = result.Output
+
+	results := []model.TestCaseResult{}
+	if request.TestReportPath != "" {
+		// The sandbox owned the workspace, so the report may be a symlink out of it
+		report, err := readInWorkspace(workspace, filepath.Clean("/" + request.TestReportPath)[1:])
+		if err == nil {
+			results, err = util.ParseJUnitReport(report)
+		}
+		if err != nil {
+			s.Log.WithContext(ctx).WithError(err).Warnf("test run %d: no usable report at %s", run.ID, request.TestReportPath)
+			results = []model.TestCaseResult{}
+		}
+	}
+	if len(results) == 0 {
+		// Without a report the whole suite counts as one test decided by the exit code
+		message := fmt.Sprintf("exit code %d", result.ExitCode)
+		if result.TimedOut {
+			message = fmt.Sprintf("timed out after %s", result.Duration.Round(time.Second))
+		}
+		results = append(results, model.TestCaseResult{
+			Name:     "test suite",
+			Passed:   result.ExitCode == 0 && !result.TimedOut,
+			Duration: result.Duration.Seconds(),
+			Message:  message,
+		})
+	}
+
+	run.Total = len(results)
+	run.Passed = 0
+	for _, r := range results {
+		if r.Passed {
+			run.Passed++
+		}
+	}
+	run.Failed = run.Total - run.Passed
+	run.Results = converter.TestCaseResultsToJSON(results)
+	run.Status = TestRunPassed
+	if run.Failed > 0 || result.TimedOut || result.ExitCode != 0 {
+		run.Status = TestRunFailed
+	}
+	return nil
+}
+
+// readInWorkspace reads name below workspace without following symlinks out of it
+func readInWorkspace(workspace, name string) ([]byte, error) {
+	root, err := os.OpenRoot(workspace)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (s *TestRunService) GetByID(ctx context.Context, id int) (*model.TestRunResponse, error) {
+	run := &entity.TestRun{}
+	if err := s.TestRunRepository.FindById(s.DB, run, id); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get test run by id")
+		return nil, err
+	}
+	return converter.TestRunToResponse(run), nil
+}
+
+func (s *TestRunService) GetAllByPr(ctx context.Context, prID int) ([]*model.TestRunResponse, error) {
+	runs := make([]entity.TestRun, 0)
+	if err := s.TestRunRepository.FindAllByPr(s.DB, &runs, prID); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to get test runs by pr")
+		return nil, err
+	}
+	responses := make([]*model.TestRunResponse, 0, len(runs))
+	for i := range runs {
+		responses = append(responses, converter.TestRunToResponse(&runs[i]))
+	}
+	return responses, nil
+}
+
+// TestRunSummary condenses a run into what the agent prompt and the stored
+// grade need: counts, a 0-100 score and the failing tests
+func TestRunSummary(run *model.TestRunResponse) map[string]interface{} {
+	score := 0.0
+	if run.Total > 0 {
+		score = float64(run.Passed) * 100 / float64(run.Total)
+	}
+	failures := make([]map[string]interface{}, 0)
+	for _, r := range run.Results {
+		if !r.Passed {
+			failures = append(failures, map[string]interface{}{
+				"name":    r.Name,
+				"message": r.Message,
+			})
+		}
+	}
+	return map[string]interface{}{
+		"test_run_id": run.ID,
+		"status":      run.Status,
+		"passed":      run.Passed,
+		"failed":      run.Failed,
+		"total":       run.Total,
+		"score":       score,
+		"failures":    failures,
+	}
+}
@@ -49,6 +49,9 @@ func (s *UserService) Update(ctx context.Context, request *model.UserUpdateReque
 	if request.GithubToken != "" {
 		updateFields["github_token"] = request.GithubToken
 	}
+	if request.GithubLogin != "" {
+		updateFields["github_login"] = request.GithubLogin
+	}
 
 	if len(updateFields) == 0 {
 		return converter.UserToResponse(user), nil // nothing to update
@@ -87,6 +90,7 @@ func (s *UserService) Register(ctx context.Context, request *model.UserCreateReq
 		Email:        request.Email,
 		PasswordHash: string(hashedPassword),
 		Role:         request.Role,
+		GithubLogin:  request.GithubLogin,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
@@ -134,6 +138,19 @@ func (s *UserService) Login(ctx context.Context, request *model.LoginRequest, jw
 	}, nil
 }
 
+// Authenticate checks an email and password, as git does over HTTP basic auth.
+// Locked and deleted users are refused like a wrong password.
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (*model.UserResponse, error) {
+	user, err := s.UserRepository.FindUserByEmail(email)
+	if err != nil || user.Locked || user.Deleted {
+		return nil, errors.New("invalid credentials")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, errors.New("invalid credentials")
+	}
+	return converter.UserToResponse(user), nil
+}
+
 func (s *UserService) GetAllUsers(ctx context.Context) ([]*model.UserResponse, error) {
 	tx := s.DB.WithContext(ctx)
 	users := &[]entity.User{}
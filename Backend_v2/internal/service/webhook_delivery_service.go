@@ -0,0 +1,188 @@
+package service
+
+import (
+	"be/neurade/v2/internal/entity"
+	"be/neurade/v2/internal/model"
+	"be/neurade/v2/internal/model/converter"
+	"be/neurade/v2/internal/repository"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	WebhookDeliveryProcessing = "processing"
+	WebhookDeliveryDone       = "done"
+	WebhookDeliveryFailed     = "failed"
+)
+
+// webhookDeliveryStuckAfter is how long a delivery may stay processing before
+// it is taken to have died with the server and may be replayed
+const webhookDeliveryStuckAfter = 10 * time.Minute
+
+var ErrWebhookDeliveryNotReplayable = errors.New("only failed deliveries can be replayed")
+
+// WebhookDeliveryService keeps the log of GitHub deliveries. Each delivery is
+// stored before it is handled, so a failure can be replayed, and its
+// X-GitHub-Delivery ID makes GitHub's redeliveries of handled events no-ops.
+type WebhookDeliveryService struct {
+	DB                        *gorm.DB
+	WebhookDeliveryRepository *repository.WebhookDeliveryRepository
+	Log                       *logrus.Logger
+}
+
+func NewWebhookDeliveryService(db *gorm.DB, webhookDeliveryRepository *repository.WebhookDeliveryRepository, log *logrus.Logger) *WebhookDeliveryService {
+	return &WebhookDeliveryService{
+		DB:                        db,
+		WebhookDeliveryRepository: webhookDeliveryRepository,
+		Log:                       log,
+	}
+}
+
+// Record stores a new delivery from the provider's endpoint as processing and
+// returns it. For a delivery seen before it returns false, unless the earlier
+// attempt failed, in which case the delivery is claimed for another attempt.
+func (s *WebhookDeliveryService) Record(ctx context.Context, provider, deliveryID, event, action, repositoryName string, payload []byte) (*entity.WebhookDelivery, bool, error) {
+	db := s.DB.WithContext(ctx)
+	now := time.Now()
+	delivery := &entity.WebhookDelivery{
+		DeliveryID: deliveryID,
+		Provider:   provider,
+		Event:      event,
+		Action:     action,
+		Repository: repositoryName,
+		Payload:    string(payload),
+		Status:     WebhookDeliveryProcessing,
+		Attempts:   1,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	result := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "delivery_id"}}, DoNothing: true}).Create(delivery)
+	if result.Error != nil {
+		s.Log.WithContext(ctx).WithError(result.Error).Error("failed to record webhook delivery")
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return delivery, true, nil
+	}
+
+	existing := &entity.WebhookDelivery{}
+	if err := s.WebhookDeliveryRepository.FindByDeliveryID(db, existing, deliveryID); err != nil {
+		return nil, false, err
+	}
+	// An ID taken on the other endpoint is not this delivery
+	if existing.Provider != provider {
+		return existing, false, nil
+	}
+	claimed, err := s.claim(ctx, existing.ID)
+	if errors.Is(err, ErrWebhookDeliveryNotReplayable) {
+		return existing, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return claimed, true, nil
+}
+
+// Claim marks a failed delivery as processing again for a replay
+func (s *WebhookDeliveryService) Claim(ctx context.Context, id int) (*entity.WebhookDelivery, error) {
+	return s.claim(ctx, id)
+}
+
+// ClaimFailed claims up to limit failed deliveries, oldest first
+func (s *WebhookDeliveryService) ClaimFailed(ctx context.Context, limit int) ([]*entity.WebhookDelivery, error) {
+	ids := make([]int, 0)
+	if err := s.DB.WithContext(ctx).Model(&entity.WebhookDelivery{}).
+		Where("status = ?", WebhookDeliveryFailed).Order("id").Limit(limit).
+		Pluck("id", &ids).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to list failed webhook deliveries")
+		return nil, err
+	}
+	deliveries := make([]*entity.WebhookDelivery, 0, len(ids))
+	for _, id := range ids {
+		delivery, err := s.claim(ctx, id)
+		if errors.Is(err, ErrWebhookDeliveryNotReplayable) {
+			// Taken by a concurrent replay
+			continue
+		}
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// Finish records the outcome of handling a delivery
+func (s *WebhookDeliveryService) Finish(ctx context.Context, delivery *entity.WebhookDelivery, result string, handleErr error) *model.WebhookDeliveryResponse {
+	now := time.Now()
+	delivery.Status = WebhookDeliveryDone
+	delivery.Result = result
+	delivery.Error = ""
+	if handleErr != nil {
+		delivery.Status = WebhookDeliveryFailed
+		delivery.Error = handleErr.Error()
+	}
+	delivery.ProcessedAt = &now
+	delivery.UpdatedAt = now
+	updates := map[string]interface{}{
+		"status":       delivery.Status,
+		"result":       delivery.Result,
+		"error":        delivery.Error,
+		"processed_at": now,
+		"updated_at":   now,
+	}
+	// The outcome is recorded even when the request that carried it was cancelled
+	if err := s.DB.WithContext(context.WithoutCancel(ctx)).Model(delivery).Updates(updates).Error; err != nil {
+		s.Log.WithContext(ctx).WithError(err).Errorf("failed to record outcome of webhook delivery %s", delivery.DeliveryID)
+	}
+	return converter.WebhookDeliveryToResponse(delivery)
+}
+
+func (s *WebhookDeliveryService) GetByID(ctx context.Context, id int) (*model.WebhookDeliveryResponse, error) {
+	delivery := &entity.WebhookDelivery{}
+	if err := s.WebhookDeliveryRepository.FindById(s.DB.WithContext(ctx), delivery, id); err != nil {
+		return nil, err
+	}
+	return converter.WebhookDeliveryToResponse(delivery), nil
+}
+
+// List returns the newest deliveries with the given status, or of any status
+func (s *WebhookDeliveryService) List(ctx context.Context, status string, limit int) ([]*model.WebhookDeliveryResponse, error) {
+	deliveries := make([]entity.WebhookDelivery, 0)
+	if err := s.WebhookDeliveryRepository.FindAllByStatus(s.DB.WithContext(ctx), &deliveries, status, limit); err != nil {
+		s.Log.WithContext(ctx).WithError(err).Error("failed to list webhook deliveries")
+		return nil, err
+	}
+	responses := make([]*model.WebhookDeliveryResponse, 0, len(deliveries))
+	for i := range deliveries {
+		responses = append(responses, converter.WebhookDeliveryToResponse(&deliveries[i]))
+	}
+	return responses, nil
+}
+
+// claim moves a failed delivery, or one left processing by a crash, back to
+// processing. The conditional update lets only one caller win.
+func (s *WebhookDeliveryService) claim(ctx context.Context, id int) (*entity.WebhookDelivery, error) {
+	db := s.DB.WithContext(ctx)
+	now := time.Now()
+	result := db.Model(&entity.WebhookDelivery{}).
+		Where("id = ? AND (status = ? OR (status = ? AND updated_at < ?))", id, WebhookDeliveryFailed, WebhookDeliveryProcessing, now.Add(-webhookDeliveryStuckAfter)).
+		Updates(map[string]interface{}{"status": WebhookDeliveryProcessing, "attempts": gorm.Expr("attempts + 1"), "updated_at": now})
+	if result.Error != nil {
+		s.Log.WithContext(ctx).WithError(result.Error).Error("failed to claim webhook delivery")
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrWebhookDeliveryNotReplayable
+	}
+	delivery := &entity.WebhookDelivery{}
+	if err := s.WebhookDeliveryRepository.FindById(db, delivery, id); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
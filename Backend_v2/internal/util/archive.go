@@ -0,0 +1,179 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxArchiveSize caps the total uncompressed size of an uploaded archive
+const maxArchiveSize = 256 << 20
+
+type ArchiveEntry struct {
+	Path string
+	Data []byte
+}
+
+// ReadArchive unpacks a zip, tar or tar.gz archive in memory. The format is
+// detected from the content, so the original file name is not needed.
+func ReadArchive(data []byte) ([]ArchiveEntry, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return readZip(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip archive: %w", err)
+		}
+		defer gz.Close()
+		return readTar(gz)
+	default:
+		return readTar(bytes.NewReader(data))
+	}
+}
+
+// IsArchive reports whether data looks like an archive ReadArchive can open
+func IsArchive(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return true
+	}
+	return len(data) > 262 && string(data[257:262]) == "ustar"
+}
+
+// ExtractArchive writes every entry of the archive below dest. dest may hold
+// untrusted files, such as a student's checkout, so nothing is written
+// through a symlink leading out of it, and an entry replaces the file or
+// symlink at its path instead of writing through it.
+func ExtractArchive(data []byte, dest string) ([]string, error) {
+	entries, err := ReadArchive(data)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dest, err)
+	}
+	defer root.Close()
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		target := filepath.FromSlash(entry.Path)
+		if err := mkdirAllInRoot(root, filepath.Dir(target)); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", entry.Path, err)
+		}
+		if err := root.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to replace %s: %w", entry.Path, err)
+		}
+		f, err := root.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", entry.Path, err)
+		}
+		_, err = f.Write(entry.Data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", entry.Path, err)
+		}
+		files = append(files, entry.Path)
+	}
+	return files, nil
+}
+
+// mkdirAllInRoot creates dir and its parents inside root. An existing
+// component that is a symlink out of root makes the later open fail.
+func mkdirAllInRoot(root *os.Root, dir string) error {
+	if dir == "." {
+		return nil
+	}
+	if err := mkdirAllInRoot(root, filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := root.Mkdir(dir, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+func readZip(data []byte) ([]ArchiveEntry, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	entries := make([]ArchiveEntry, 0, len(reader.File))
+	var total int64
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name, err := cleanArchivePath(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxArchiveSize-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		total += int64(len(content))
+		if total > maxArchiveSize {
+			return nil, fmt.Errorf("archive exceeds %d bytes", maxArchiveSize)
+		}
+		entries = append(entries, ArchiveEntry{Path: name, Data: content})
+	}
+	return entries, nil
+}
+
+func readTar(r io.Reader) ([]ArchiveEntry, error) {
+	reader := tar.NewReader(r)
+	entries := make([]ArchiveEntry, 0)
+	var total int64
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, err := cleanArchivePath(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(io.LimitReader(reader, maxArchiveSize-total+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		total += int64(len(content))
+		if total > maxArchiveSize {
+			return nil, fmt.Errorf("archive exceeds %d bytes", maxArchiveSize)
+		}
+		entries = append(entries, ArchiveEntry{Path: name, Data: content})
+	}
+	return entries, nil
+}
+
+// cleanArchivePath rejects absolute paths and entries escaping the archive root
+func cleanArchivePath(name string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid path in archive: %s", name)
+	}
+	return strings.TrimPrefix(cleaned, "./"), nil
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sourceExtensions are stored as text so presigned links open in the browser
+// instead of downloading as application/octet-stream
+var sourceExtensions = map[string]string{
+	".go":    "text/x-go",
+	".py":    "text/x-python",
+	".java":  "text/x-java",
+	".c":     "text/x-c",
+	".h":     "text/x-c",
+	".cpp":   "text/x-c++",
+	".hpp":   "text/x-c++",
+	".cs":    "text/x-csharp",
+	".rs":    "text/x-rust",
+	".kt":    "text/x-kotlin",
+	".swift": "text/x-swift",
+	".rb":    "text/x-ruby",
+	".php":   "text/x-php",
+	".ts":    "text/x-typescript",
+	".tsx":   "text/x-typescript",
+	".jsx":   "text/javascript",
+	".sql":   "text/x-sql",
+	".sh":    "text/x-shellscript",
+	".yml":   "text/yaml",
+	".yaml":  "text/yaml",
+	".toml":  "text/plain",
+	".md":    "text/markdown",
+	".txt":   "text/plain",
+}
+
+// ContentTypeFor picks a content type from the file extension, falling back to
+// sniffing the content
+func ContentTypeFor(name string, data []byte) string {
+	ext := strings.ToLower(path.Ext(name))
+	if contentType, ok := sourceExtensions[ext]; ok {
+		return contentType + "; charset=utf-8"
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,203 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// EmptyTreeSHA is git's empty tree, the base of a branch with no history in common
+const EmptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// GitFileDiff is one file changed between two commits; Patch holds the hunks
+// only, as GitHub returns them
+type GitFileDiff struct {
+	Status    string
+	OldPath   string
+	Path      string
+	Patch     string
+	Additions int
+	Deletions int
+}
+
+// CheckoutPullRequest fetches the head of a GitHub pull request or GitLab
+// merge request into dir and returns the checked out commit SHA
+func CheckoutPullRequest(ctx context.Context, dir string, repo *RepoRef, prNumber int, token string) (string, error) {
+	user, ref := "x-access-token", fmt.Sprintf("pull/%d/head", prNumber)
+	if repo.Provider == GitProviderGitLab {
+		user, ref = "oauth2", fmt.Sprintf("refs/merge-requests/%d/head", prNumber)
+	}
+	remote := fmt.Sprintf("%s://%s/%s.git", repo.Scheme, repo.Host, repo.Path())
+	if token != "" {
+		remote = fmt.Sprintf("%s://%s:%s@%s/%s.git", repo.Scheme, user, token, repo.Host, repo.Path())
+	}
+	return CheckoutRef(ctx, dir, remote, ref, token)
+}
+
+// CheckoutRef fetches ref from remote, a URL or a local repository path, into
+// dir and returns the checked out commit SHA
+func CheckoutRef(ctx context.Context, dir, remote, ref, token string) (string, error) {
+	steps := [][]string{
+		{"init", "-q"},
+		{"fetch", "-q", "--depth", "1", remote, ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	}
+	for _, args := range steps {
+		if _, err := runGit(ctx, dir, token, args...); err != nil {
+			return "", err
+		}
+	}
+	sha, err := runGit(ctx, dir, token, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sha), nil
+}
+
+// InitBareRepository creates a bare repository in dir that accepts pushes over
+// smart HTTP. It does nothing when dir already holds one.
+func InitBareRepository(ctx context.Context, dir, defaultBranch string) error {
+	if _, err := os.Stat(dir + "/HEAD"); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	steps := [][]string{
+		{"init", "-q", "--bare", "--initial-branch=" + defaultBranch, "."},
+		{"config", "http.receivepack", "true"},
+	}
+	for _, args := range steps {
+		if _, err := runGit(ctx, dir, "", args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveBranch returns the commit branch points at, or "" when it does not exist
+func ResolveBranch(ctx context.Context, dir, branch string) (string, error) {
+	out, err := runGit(ctx, dir, "", "for-each-ref", "--format=%(objectname)", "refs/heads/"+branch)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// MergeBase returns the best common ancestor of a and b, or "" when they share
+// no history or either is missing
+func MergeBase(ctx context.Context, dir, a, b string) string {
+	out, err := runGit(ctx, dir, "", "merge-base", a, b)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// HasCommit reports whether the repository in dir holds commit sha
+func HasCommit(ctx context.Context, dir, sha string) bool {
+	_, err := runGit(ctx, dir, "", "cat-file", "-e", sha+"^{commit}")
+	return err == nil
+}
+
+// CommitMessage returns the full message of commit sha
+func CommitMessage(ctx context.Context, dir, sha string) (string, error) {
+	out, err := runGit(ctx, dir, "", "log", "-1", "--format=%B", sha)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// ShowFile returns path as it is at rev
+func ShowFile(ctx context.Context, dir, rev, path string) (string, error) {
+	return runGit(ctx, dir, "", "show", rev+":"+path)
+}
+
+// DiffFiles lists the files changed from base to head with their patches.
+// An empty base diffs against the empty tree, so every file is added.
+func DiffFiles(ctx context.Context, dir, base, head string) ([]GitFileDiff, error) {
+	if base == "" {
+		base = EmptyTreeSHA
+	}
+	out, err := runGit(ctx, dir, "", "diff", "--name-status", "-M", "-z", base, head)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	files := make([]GitFileDiff, 0)
+	for i := 0; i < len(fields) && fields[i] != ""; {
+		status := fields[i]
+		file := GitFileDiff{}
+		switch status[0] {
+		case 'A':
+			file.Status = "added"
+		case 'D':
+			file.Status = "removed"
+		case 'R':
+			file.Status = "renamed"
+		default:
+			file.Status = "modified"
+		}
+		if status[0] == 'R' || status[0] == 'C' {
+			if i+2 >= len(fields) {
+				break
+			}
+			file.OldPath, file.Path = fields[i+1], fields[i+2]
+			i += 3
+		} else {
+			if i+1 >= len(fields) {
+				break
+			}
+			file.Path = fields[i+1]
+			i += 2
+		}
+
+		paths := []string{file.Path}
+		if file.OldPath != "" {
+			paths = append(paths, file.OldPath)
+		}
+		patch, err := runGit(ctx, dir, "", append([]string{"diff", "-M", "--no-color", base, head, "--"}, paths...)...)
+		if err != nil {
+			return nil, err
+		}
+		// Drop the diff --git, index and ---/+++ lines before the first hunk
+		if start := strings.Index(patch, "\n@@"); start >= 0 {
+			file.Patch = strings.TrimSuffix(patch[start+1:], "\n")
+		} else if strings.HasPrefix(patch, "@@") {
+			file.Patch = strings.TrimSuffix(patch, "\n")
+		}
+		for _, line := range strings.Split(file.Patch, "\n") {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				file.Additions++
+			case strings.HasPrefix(line, "-"):
+				file.Deletions++
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func runGit(ctx context.Context, dir, token string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = []string{"GIT_TERMINAL_PROMPT=0", "HOME=" + dir}
+	out, err := cmd.Output()
+	if err != nil {
+		output := string(out)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			output = string(exitErr.Stderr)
+		}
+		if token != "" {
+			output = strings.ReplaceAll(output, token, "***")
+		}
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(output))
+	}
+	return string(out), nil
+}
@@ -2,27 +2,122 @@ package util
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
-func ParseGitHubURL(githubURL string) (string, string, error) {
-	if githubURL == "" {
-		return "", "", fmt.Errorf("GitHub URL is empty")
-	}
-	// Remove protocol (http:// or https://)
-	githubURL = strings.TrimPrefix(githubURL, "http://")
-	githubURL = strings.TrimPrefix(githubURL, "https://")
-	// Remove possible trailing .git
-	githubURL = strings.TrimSuffix(githubURL, ".git")
-	// Remove domain prefix
-	githubURL = strings.TrimPrefix(githubURL, "github.com/")
-	parts := strings.Split(githubURL, "/")
+const (
+	GitProviderGitHub = "github"
+	GitProviderGitLab = "gitlab"
+	// GitProviderLocal courses have no forge: this server hosts a bare
+	// repository per student and assignment
+	GitProviderLocal = "local"
+)
+
+// RepoRef locates a repository on its git host. Owner is the user or
+// organization on GitHub and the full group path, subgroups included, on
+// GitLab.
+type RepoRef struct {
+	Provider string
+	Scheme   string
+	Host     string
+	Owner    string
+	Name     string
+}
+
+// Path is the repository's path on its host, such as "owner/repo"
+func (r *RepoRef) Path() string {
+	return r.Owner + "/" + r.Name
+}
+
+// LocalRepoRef stands for the repositories this server hosts for a course
+func LocalRepoRef(courseID int) *RepoRef {
+	return &RepoRef{Provider: GitProviderLocal, Scheme: "file", Owner: "courses", Name: strconv.Itoa(courseID)}
+}
+
+// ParseRepoURL splits a repository URL into its host and path. provider is the
+// course's setting; when it is empty, github.com is GitHub and any other host
+// is taken to be a GitLab instance. A URL without a host is a github.com path.
+// Local courses have no URL; use LocalRepoRef for them.
+func ParseRepoURL(repoURL string, provider string) (*RepoRef, error) {
+	if provider == GitProviderLocal {
+		return nil, fmt.Errorf("local repositories have no URL")
+	}
+	if repoURL == "" {
+		return nil, fmt.Errorf("repository URL is empty")
+	}
+	ref := &RepoRef{Scheme: "https", Host: "github.com"}
+	trimmed := strings.TrimSpace(repoURL)
+	if strings.HasPrefix(trimmed, "http://") {
+		ref.Scheme = "http"
+	}
+	trimmed = strings.TrimPrefix(trimmed, "http://")
+	trimmed = strings.TrimPrefix(trimmed, "https://")
+	trimmed = strings.TrimSuffix(strings.TrimSuffix(trimmed, "/"), ".git")
+	parts := strings.Split(trimmed, "/")
+	if len(parts) > 0 && strings.ContainsAny(parts[0], ".:") {
+		ref.Host = parts[0]
+		parts = parts[1:]
+	}
+
+	ref.Provider = provider
+	if ref.Provider == "" {
+		ref.Provider = GitProviderGitLab
+		if strings.EqualFold(ref.Host, "github.com") || strings.EqualFold(ref.Host, "www.github.com") {
+			ref.Provider = GitProviderGitHub
+		}
+	}
+
+	if ref.Provider == GitProviderGitLab {
+		// GitLab puts pages of a project under "/-/", as in /group/project/-/merge_requests/1
+		for i, part := range parts {
+			if part == "-" {
+				parts = parts[:i]
+				break
+			}
+		}
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("Invalid GitLab URL format: %s", repoURL)
+		}
+		ref.Owner = strings.Join(parts[:len(parts)-1], "/")
+		ref.Name = strings.TrimSuffix(parts[len(parts)-1], ".git")
+		return ref, nil
+	}
 	if len(parts) < 2 {
-		return "", "", fmt.Errorf("Invalid GitHub URL format: %s", githubURL)
+		return nil, fmt.Errorf("Invalid GitHub URL format: %s", repoURL)
+	}
+	ref.Owner = parts[0]
+	ref.Name = strings.TrimSuffix(parts[1], ".git")
+	return ref, nil
+}
+
+// GitProviderOf is the provider a course uses: its setting, or the one its
+// repository URL points at
+func GitProviderOf(repoURL string, provider string) string {
+	if provider != "" {
+		return provider
+	}
+	ref, err := ParseRepoURL(repoURL, "")
+	if err != nil {
+		return GitProviderGitHub
+	}
+	return ref.Provider
+}
+
+// ValidGitProvider reports whether provider is a supported course setting;
+// empty picks the provider from the repository URL
+func ValidGitProvider(provider string) bool {
+	return provider == "" || provider == GitProviderGitHub || provider == GitProviderGitLab || provider == GitProviderLocal
+}
+
+// ParseGitHubURL returns the owner and name of the repository the URL points
+// at, on GitHub or GitLab
+func ParseGitHubURL(githubURL string) (string, string, error) {
+	ref, err := ParseRepoURL(githubURL, "")
+	if err != nil {
+		return "", "", err
 	}
-	owner := parts[0]
-	repo := parts[1]
-	return owner, repo, nil
+	return ref.Owner, ref.Name, nil
 }
 
 // NormalizeGithubURL removes http(s):// and trailing slashes for consistent comparison
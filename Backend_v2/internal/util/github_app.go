@@ -0,0 +1,157 @@
+package util
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// installationTokenSlack renews installation tokens this long before GitHub
+// expires them, so a token never runs out in the middle of a request
+const installationTokenSlack = 5 * time.Minute
+
+type installationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// GitHubApp authenticates as a GitHub App. It signs short-lived app JWTs with
+// the app's private key and exchanges them for installation tokens, one per
+// repository owner, cached until shortly before they expire.
+type GitHubApp struct {
+	AppID      int64
+	PrivateKey *rsa.PrivateKey
+	Client     *GitHubClient
+
+	mu        sync.Mutex
+	jwt       string
+	jwtExpiry time.Time
+	tokens    map[string]installationToken
+	slug      string
+}
+
+func NewGitHubApp(appID int64, privateKeyPEM []byte, client *GitHubClient) (*GitHubApp, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %w", err)
+	}
+	return &GitHubApp{
+		AppID:      appID,
+		PrivateKey: key,
+		Client:     client,
+		tokens:     make(map[string]installationToken),
+	}, nil
+}
+
+// JWT returns an app JWT, valid for up to ten minutes as GitHub requires
+func (a *GitHubApp) JWT() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if a.jwt != "" && now.Add(time.Minute).Before(a.jwtExpiry) {
+		return a.jwt, nil
+	}
+	expiry := now.Add(9 * time.Minute)
+	claims := jwt.RegisteredClaims{
+		// Backdated to allow for clock drift between us and GitHub
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(expiry),
+		Issuer:    strconv.FormatInt(a.AppID, 10),
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(a.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	a.jwt = signed
+	a.jwtExpiry = expiry
+	return signed, nil
+}
+
+// InstallationToken returns a token for the app's installation on the owner
+// of owner/repo, minting a new one when the cached token is close to expiry
+func (a *GitHubApp) InstallationToken(ctx context.Context, owner, repo string) (string, error) {
+	key := strings.ToLower(owner)
+	a.mu.Lock()
+	cached, ok := a.tokens[key]
+	a.mu.Unlock()
+	if ok && time.Now().Add(installationTokenSlack).Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	appJWT, err := a.JWT()
+	if err != nil {
+		return "", err
+	}
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	installationURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/installation", owner, repo)
+	if err := a.call(ctx, http.MethodGet, installationURL, appJWT, &installation); err != nil {
+		return "", fmt.Errorf("GitHub App is not installed for %s/%s: %w", owner, repo, err)
+	}
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	tokenURL := fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", installation.ID)
+	if err := a.call(ctx, http.MethodPost, tokenURL, appJWT, &token); err != nil {
+		return "", fmt.Errorf("failed to create installation token for %s: %w", owner, err)
+	}
+
+	a.mu.Lock()
+	a.tokens[key] = installationToken{token: token.Token, expiresAt: token.ExpiresAt}
+	a.mu.Unlock()
+	return token.Token, nil
+}
+
+// BotLogin returns the login the app's installation tokens write comments
+// as, "<app-slug>[bot]"
+func (a *GitHubApp) BotLogin(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	slug := a.slug
+	a.mu.Unlock()
+	if slug != "" {
+		return slug + "[bot]", nil
+	}
+
+	appJWT, err := a.JWT()
+	if err != nil {
+		return "", err
+	}
+	var app struct {
+		Slug string `json:"slug"`
+	}
+	if err := a.call(ctx, http.MethodGet, "https://api.github.com/app", appJWT, &app); err != nil {
+		return "", fmt.Errorf("failed to get GitHub App: %w", err)
+	}
+	a.mu.Lock()
+	a.slug = app.Slug
+	a.mu.Unlock()
+	return app.Slug + "[bot]", nil
+}
+
+func (a *GitHubApp) call(ctx context.Context, method, apiURL, appJWT string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.Client.Do(req, appJWT)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("GitHub API error: %s - %s", resp.Status, string(body))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,358 @@
+package util
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	githubCacheEntries  = 1000
+	githubCacheMaxBytes = 1 << 20
+)
+
+var ErrGitHubRateLimited = errors.New("GitHub rate limit exhausted")
+
+// GitHubBudget is the last known rate limit of one token for one API resource
+type GitHubBudget struct {
+	Token      string    `json:"token"`
+	Resource   string    `json:"resource"`
+	Limit      int       `json:"limit"`
+	Remaining  int       `json:"remaining"`
+	Used       int       `json:"used"`
+	ResetAt    time.Time `json:"reset_at"`
+	RetryAfter time.Time `json:"retry_after,omitempty"`
+	Requests   int64     `json:"requests"`
+	CacheHits  int64     `json:"cache_hits"`
+	Delayed    int64     `json:"delayed"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type githubCacheEntry struct {
+	key    string
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+// GitHubClient is the one HTTP client for the GitHub API. It authenticates
+// requests, revalidates repeated GETs with If-None-Match against an ETag cache
+// (a 304 does not count against the rate limit) and tracks every token's budget
+// from the X-RateLimit-* headers. Reads wait for the window to reset once a
+// token is down to Reserve requests, keeping the rest for reviews and
+// comments; writes only wait when nothing is left.
+type GitHubClient struct {
+	HTTP    *http.Client
+	Reserve int
+	MaxWait time.Duration
+	Log     *logrus.Logger
+
+	mu      sync.Mutex
+	budgets map[string]*GitHubBudget
+	cache   map[string]*list.Element
+	order   *list.List
+}
+
+func NewGitHubClient(reserve int, maxWait time.Duration, log *logrus.Logger) *GitHubClient {
+	return &GitHubClient{
+		HTTP:    &http.Client{Timeout: 5 * time.Minute},
+		Reserve: reserve,
+		MaxWait: maxWait,
+		Log:     log,
+		budgets: make(map[string]*GitHubBudget),
+		cache:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Do sends req with token, waiting first if the token's budget is spent. A
+// cached GET answered with 304 is returned as the original 200 response.
+func (c *GitHubClient) Do(req *http.Request, token string) (*http.Response, error) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "Neurade-Backend")
+
+	tokenKey := githubTokenKey(token)
+	resource := githubResource(req.URL.Path)
+	reserve := 0
+	cacheKey := ""
+	if req.Method == http.MethodGet {
+		reserve = c.Reserve
+		cacheKey = tokenKey + " " + req.Header.Get("Accept") + " " + req.URL.String()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(req.Context(), token, resource, reserve); err != nil {
+			return nil, err
+		}
+		cached := c.lookup(cacheKey)
+		if cached != nil {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		c.record(token, resource, resp)
+
+		switch {
+		case resp.StatusCode == http.StatusNotModified && cached != nil:
+			resp.Body.Close()
+			c.hit(token, resource)
+			return cached.response(req), nil
+		case resp.StatusCode == http.StatusOK && cacheKey != "" && resp.Header.Get("ETag") != "":
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			c.store(cacheKey, resp.Header, body)
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return resp, nil
+		case isGitHubRateLimited(resp) && req.Method == http.MethodGet && attempt == 0:
+			// The budget is now marked as spent, so the retry waits for the reset
+			resp.Body.Close()
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// RateLimit refreshes the token's budgets from GET /rate_limit, which is free
+func (c *GitHubClient) RateLimit(ctx context.Context, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/rate_limit", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req, token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("GitHub API error: %s - %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+// Budgets returns the known budget of every token and resource. Tokens unused
+// for two hours, such as expired app and installation tokens, are forgotten.
+func (c *GitHubClient) Budgets() []GitHubBudget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	budgets := make([]GitHubBudget, 0, len(c.budgets))
+	for key, budget := range c.budgets {
+		if time.Since(budget.UpdatedAt) > 2*time.Hour {
+			delete(c.budgets, key)
+			continue
+		}
+		budgets = append(budgets, *budget)
+	}
+	sort.Slice(budgets, func(i, j int) bool {
+		if budgets[i].Token != budgets[j].Token {
+			return budgets[i].Token < budgets[j].Token
+		}
+		return budgets[i].Resource < budgets[j].Resource
+	})
+	return budgets
+}
+
+func (c *GitHubClient) budget(token, resource string) *GitHubBudget {
+	key := githubTokenKey(token) + "/" + resource
+	budget, ok := c.budgets[key]
+	if !ok {
+		budget = &GitHubBudget{Token: MaskGitHubToken(token), Resource: resource, Remaining: -1}
+		c.budgets[key] = budget
+	}
+	return budget
+}
+
+// wait blocks until the token may spend another request, or fails when that
+// is further away than MaxWait
+func (c *GitHubClient) wait(ctx context.Context, token, resource string, reserve int) error {
+	c.mu.Lock()
+	budget := c.budget(token, resource)
+	now := time.Now()
+	until := time.Time{}
+	if now.Before(budget.RetryAfter) {
+		until = budget.RetryAfter
+	}
+	if budget.Remaining >= 0 && budget.Remaining <= reserve && now.Before(budget.ResetAt) && budget.ResetAt.After(until) {
+		until = budget.ResetAt
+	}
+	if until.IsZero() {
+		// Count the request now so concurrent callers see it before GitHub answers
+		if budget.Remaining > 0 {
+			budget.Remaining--
+		}
+		budget.Requests++
+		c.mu.Unlock()
+		return nil
+	}
+	budget.Delayed++
+	c.mu.Unlock()
+
+	delay := time.Until(until)
+	if delay > c.MaxWait {
+		return fmt.Errorf("%w for token %s until %s", ErrGitHubRateLimited, MaskGitHubToken(token), until.Format(time.RFC3339))
+	}
+	c.Log.Warnf("GitHub %s budget of token %s is low, waiting %s", resource, MaskGitHubToken(token), delay.Round(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	c.mu.Lock()
+	budget.Requests++
+	c.mu.Unlock()
+	return nil
+}
+
+// record updates the budget from the response's rate limit headers
+func (c *GitHubClient) record(token, resource string, resp *http.Response) {
+	header := resp.Header
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name := header.Get("X-RateLimit-Resource"); name != "" && name != resource {
+		resource = name
+	}
+	budget := c.budget(token, resource)
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		budget.Limit = limit
+	}
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		budget.Remaining = remaining
+	}
+	if used, err := strconv.Atoi(header.Get("X-RateLimit-Used")); err == nil {
+		budget.Used = used
+	}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		budget.ResetAt = time.Unix(reset, 0)
+	}
+	// Secondary limits come with Retry-After instead of an empty budget
+	if isGitHubRateLimited(resp) {
+		if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+			budget.RetryAfter = time.Now().Add(time.Duration(seconds) * time.Second)
+		} else if budget.ResetAt.IsZero() {
+			budget.RetryAfter = time.Now().Add(time.Minute)
+		}
+		if header.Get("X-RateLimit-Remaining") == "0" {
+			budget.Remaining = 0
+		}
+	}
+	budget.UpdatedAt = time.Now()
+}
+
+func (c *GitHubClient) hit(token, resource string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget(token, resource).CacheHits++
+}
+
+func (c *GitHubClient) lookup(key string) *githubCacheEntry {
+	if key == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.cache[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*githubCacheEntry)
+}
+
+func (c *GitHubClient) store(key string, header http.Header, body []byte) {
+	if len(body) > githubCacheMaxBytes {
+		return
+	}
+	entry := &githubCacheEntry{key: key, etag: header.Get("ETag"), header: header.Clone(), body: body}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.cache[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.cache[key] = c.order.PushFront(entry)
+	for c.order.Len() > githubCacheEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.cache, oldest.Value.(*githubCacheEntry).key)
+	}
+}
+
+func (e *githubCacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+func isGitHubRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return resp.StatusCode == http.StatusForbidden &&
+		(resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "")
+}
+
+// githubResource guesses which rate limit a path is counted against before
+// GitHub says so in X-RateLimit-Resource
+func githubResource(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/search/"):
+		return "search"
+	case path == "/graphql":
+		return "graphql"
+	default:
+		return "core"
+	}
+}
+
+func githubTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// MaskGitHubToken keeps only the last characters of a token, for display
+func MaskGitHubToken(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+	if len(token) <= 4 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"be/neurade/v2/internal/model"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	Error     *junitFailure `xml:"error"`
+	Skipped   *struct{}     `xml:"skipped"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	TestCases []junitTestCase  `xml:"testcase"`
+	Suites    []junitTestSuite `xml:"testsuite"`
+}
+
+// ParseJUnitReport reads a JUnit XML report with either <testsuites> or a
+// single <testsuite> at the root. Skipped tests are left out.
+func ParseJUnitReport(data []byte) ([]model.TestCaseResult, error) {
+	var root struct {
+		XMLName xml.Name
+		junitTestSuite
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse junit report: %w", err)
+	}
+	suites := []junitTestSuite{root.junitTestSuite}
+	if root.XMLName.Local == "testsuites" {
+		suites = root.Suites
+	}
+
+	results := make([]model.TestCaseResult, 0)
+	var walk func(suites []junitTestSuite)
+	walk = func(suites []junitTestSuite) {
+		for _, suite := range suites {
+			for _, tc := range suite.TestCases {
+				if tc.Skipped != nil {
+					continue
+				}
+				result := model.TestCaseResult{
+					Name:     tc.Name,
+					Suite:    suite.Name,
+					Passed:   tc.Failure == nil && tc.Error == nil,
+					Duration: tc.Time,
+				}
+				if result.Suite == "" {
+					result.Suite = tc.ClassName
+				}
+				if failure := firstFailure(tc.Failure, tc.Error); failure != nil {
+					result.Message = strings.TrimSpace(failure.Message + "\n" + failure.Text)
+				}
+				results = append(results, result)
+			}
+			walk(suite.Suites)
+		}
+	}
+	walk(suites)
+	return results, nil
+}
+
+func firstFailure(failures ...*junitFailure) *junitFailure {
+	for _, f := range failures {
+		if f != nil {
+			return f
+		}
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package util
 import (
 	"be/neurade/v2/internal/entity"
 	"errors"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -62,3 +64,67 @@ func (j *JWTUtil) ValidateToken(tokenString string) (*JWTClaims, error) {
 
 	return claims, nil
 }
+
+// UserIDFromRequest returns the user ID of the request's bearer token, or 0
+// when the token is missing or invalid
+func UserIDFromRequest(r *http.Request, jwtUtil *JWTUtil) int {
+	header := r.Header.Get("Authorization")
+	parts := strings.Split(header, " ")
+	if len(parts) != 2 || jwtUtil == nil {
+		return 0
+	}
+	claims, err := jwtUtil.ValidateToken(parts[1])
+	if err != nil {
+		return 0
+	}
+	return claims.UserID
+}
+
+// FileTokenClaims grant read access to one stored file for one purpose, such
+// as an agent fetching a reference answer during a review
+type FileTokenClaims struct {
+	FileID  int    `json:"file_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GenerateFileToken signs a short-lived token for a single file. File tokens
+// use a key derived from the secret, so they can never pass as login tokens.
+func (j *JWTUtil) GenerateFileToken(fileID int, purpose string, ttl time.Duration) (string, error) {
+	claims := FileTokenClaims{
+		FileID:  fileID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(j.fileTokenKey())
+}
+
+func (j *JWTUtil) ValidateFileToken(tokenString string) (*FileTokenClaims, error) {
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&FileTokenClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			return j.fileTokenKey(), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*FileTokenClaims)
+	if !ok || !token.Valid || claims.FileID == 0 {
+		return nil, errors.New("invalid file token")
+	}
+
+	return claims, nil
+}
+
+func (j *JWTUtil) fileTokenKey() []byte {
+	return []byte(j.SecretKey + ":files")
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// botHandlePattern accepts GitHub and GitLab usernames
+var botHandlePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,38}$`)
+
+var inlineCode = regexp.MustCompile("`[^`\n]*`")
+
+// ValidBotHandle reports whether handle, without its "@", can be mentioned
+func ValidBotHandle(handle string) bool {
+	return botHandlePattern.MatchString(handle)
+}
+
+// NormalizeBotHandle trims the "@" and spaces a handle may be typed with
+func NormalizeBotHandle(handle string) string {
+	return strings.TrimPrefix(strings.TrimSpace(handle), "@")
+}
+
+// MentionsHandle reports whether text mentions @handle as a word of its own,
+// so "@bot" but not "@botanist" or "me@bot.com". Mentions in code blocks,
+// inline code and quoted lines do not count.
+func MentionsHandle(text, handle string) bool {
+	if handle == "" {
+		return false
+	}
+	mention := regexp.MustCompile(`(?i)(?:^|[^A-Za-z0-9_.@/-])@` + regexp.QuoteMeta(handle) + `(?:$|[^A-Za-z0-9_-])`)
+	return mention.MatchString(StripCodeAndQuotes(text))
+}
+
+// StripCodeAndQuotes removes fenced code blocks, inline code and quoted lines
+// from markdown, leaving the text its author wrote themselves
+func StripCodeAndQuotes(text string) string {
+	var b strings.Builder
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		b.WriteString(inlineCode.ReplaceAllString(line, ""))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
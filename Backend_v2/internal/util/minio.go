@@ -1,76 +1,144 @@
 package util
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/minio/minio-go/v7"
 	"github.com/sirupsen/logrus"
 )
 
+// MinioUtil stores course files in the configured Storage. Everything lives in
+// one bucket with keys under courses/{course_id}/, so renaming a course never
+// moves its files. File URLs keep the minio://bucket/object form whichever
+// backend is in use.
 type MinioUtil struct {
-	MinioClient *minio.Client
-	Log         *logrus.Logger
+	Storage Storage
+	Bucket  string
+	Log     *logrus.Logger
+
+	bucketReady atomic.Bool
 }
 
-func NewMinioUtil(minioClient *minio.Client, log *logrus.Logger) *MinioUtil {
+func NewMinioUtil(storage Storage, bucket string, log *logrus.Logger) *MinioUtil {
 	return &MinioUtil{
-		MinioClient: minioClient,
-		Log:         log,
+		Storage: storage,
+		Bucket:  bucket,
+		Log:     log,
 	}
 }
 
-func (u *MinioUtil) MakeBucketByCourseID(ctx context.Context, courseName string, createdAt time.Time) (string, error) {
-	safeName := sanitizeName(courseName)
+// CoursePrefix is the key prefix of every object belonging to a course
+func CoursePrefix(courseID int) string {
+	return fmt.Sprintf("courses/%d/", courseID)
+}
+
+// LegacyBucketName is the per-course bucket files were stored in before the
+// single-bucket layout; only the storage migration still needs it
+func LegacyBucketName(courseName string, createdAt time.Time) string {
+	return fmt.Sprintf("%s-%s", sanitizeName(courseName), createdAt.Format("20060102"))
+}
 
-	timestamp := createdAt.Format("20060102")
-	bucketName := fmt.Sprintf("%s-%s", safeName, timestamp)
-	found, err := u.MinioClient.BucketExists(ctx, bucketName)
+func (u *MinioUtil) ensureBucket(ctx context.Context) error {
+	if u.bucketReady.Load() {
+		return nil
+	}
+	if err := u.Storage.EnsureBucket(ctx, u.Bucket); err != nil {
+		log.Println("failed to create bucket:", err)
+		return err
+	}
+	u.bucketReady.Store(true)
+	return nil
+}
+
+func (u *MinioUtil) SaveFile(ctx context.Context, courseID int, typeObject string, objectName string, content string) (string, error) {
+	return u.SaveObject(ctx, courseID, typeObject, objectName, []byte(content), "text/markdown")
+}
+
+// SaveObject stores raw bytes with the given content type and returns its minio:// URL
+func (u *MinioUtil) SaveObject(ctx context.Context, courseID int, typeObject string, objectName string, content []byte, contentType string) (string, error) {
+	object := CoursePrefix(courseID) + fmt.Sprintf("%s-%s", typeObject, sanitizeName(objectName))
+	return u.put(ctx, object, content, contentType)
+}
+
+// SaveTreeObject stores one file of an uploaded folder below prefix, keeping its
+// relative path so the tree can be browsed as it was uploaded
+func (u *MinioUtil) SaveTreeObject(ctx context.Context, courseID int, prefix string, filePath string, content []byte, contentType string) (string, error) {
+	object := CoursePrefix(courseID) + fmt.Sprintf("%s/%s", sanitizeName(prefix), strings.TrimPrefix(path.Clean("/"+filePath), "/"))
+	return u.put(ctx, object, content, contentType)
+}
+
+func (u *MinioUtil) put(ctx context.Context, object string, content []byte, contentType string) (string, error) {
+	if err := u.ensureBucket(ctx); err != nil {
+		return "", err
+	}
+	if err := u.Storage.Put(ctx, u.Bucket, object, content, contentType); err != nil {
+		return "", fmt.Errorf("failed to save file %s to bucket %s: %w", object, u.Bucket, err)
+	}
+	return u.URL(object), nil
+}
+
+// CopyToCourse copies the object behind fileURL below courseID's prefix,
+// keeping the rest of its key, and returns the new URL. transform, when set,
+// rewrites the content on the way.
+func (u *MinioUtil) CopyToCourse(ctx context.Context, fileURL string, courseID int, transform func([]byte) ([]byte, error)) (string, error) {
+	bucketName, objectName, err := u.ParseMinioURL(fileURL)
 	if err != nil {
-		log.Println("failed to find bucket:", err)
 		return "", err
 	}
-	if found {
-		return bucketName, nil
-	} else {
-		err = u.MinioClient.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{Region: "us-east-1", ObjectLocking: true})
-		if err != nil {
-			log.Println("failed to create bucket:", err)
+	info, err := u.Storage.Stat(ctx, bucketName, objectName)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat object %s in bucket %s: %w", objectName, bucketName, err)
+	}
+	content, err := u.Storage.Get(ctx, bucketName, objectName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get object %s from bucket %s: %w", objectName, bucketName, err)
+	}
+	if transform != nil {
+		if content, err = transform(content); err != nil {
 			return "", err
 		}
 	}
 
-	return bucketName, nil
+	// Keys from before the single-bucket layout have no course prefix
+	relative := objectName
+	if strings.HasPrefix(objectName, "courses/") {
+		if _, rest, found := strings.Cut(strings.TrimPrefix(objectName, "courses/"), "/"); found {
+			relative = rest
+		}
+	}
+	return u.put(ctx, CoursePrefix(courseID)+relative, content, info.ContentType)
 }
 
-func (u *MinioUtil) SaveFile(ctx context.Context, courseName string, createdAt time.Time, typeObject string, objectName string, content string) (string, error) {
-	object := sanitizeName(objectName)
-	object = fmt.Sprintf("%s-%s", typeObject, object)
-	bucketName, err := u.MakeBucketByCourseID(ctx, courseName, createdAt)
+// URL returns the minio:// URL of an object key in the configured bucket
+func (u *MinioUtil) URL(object string) string {
+	return fmt.Sprintf("minio://%s/%s", u.Bucket, object)
+}
+
+// ObjectURL returns the minio:// URL SaveObject would use, without writing anything
+func (u *MinioUtil) ObjectURL(courseID int, typeObject string, objectName string) string {
+	return u.URL(CoursePrefix(courseID) + fmt.Sprintf("%s-%s", typeObject, sanitizeName(objectName)))
+}
+
+// ObjectExists reports whether the object behind a minio:// URL is stored
+func (u *MinioUtil) ObjectExists(ctx context.Context, fileURL string) (bool, error) {
+	bucketName, objectName, err := u.ParseMinioURL(fileURL)
 	if err != nil {
-		return "", err
+		return false, err
 	}
-
-	contentBytes := bytes.NewReader([]byte(content))
-	_, err = u.MinioClient.PutObject(
-		ctx,
-		bucketName,
-		object,
-		contentBytes,
-		int64(len(content)),
-		minio.PutObjectOptions{ContentType: "text/markdown"},
-	)
+	_, err = u.Storage.Stat(ctx, bucketName, objectName)
 	if err != nil {
-		return "", fmt.Errorf("failed to save file %s to bucket %s: %w", objectName, bucketName, err)
+		if errors.Is(err, ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat object %s in bucket %s: %w", objectName, bucketName, err)
 	}
-
-	fileURL := fmt.Sprintf("minio://%s/%s", bucketName, object)
-	return fileURL, nil
+	return true, nil
 }
 
 func (u *MinioUtil) ParseMinioURL(fileURL string) (bucketName string, objectName string, err error) {
@@ -88,30 +156,22 @@ func (u *MinioUtil) GetFile(ctx context.Context, fileURL string) (string, error)
 		return "", err
 	}
 
-	object, err := u.MinioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	content, err := u.Storage.Get(ctx, bucketName, objectName)
 	if err != nil {
 		return "", fmt.Errorf("failed to get object %s from bucket %s: %w", objectName, bucketName, err)
 	}
-	defer object.Close()
-
-	var buffer bytes.Buffer
-	if _, err := io.Copy(&buffer, object); err != nil {
-		return "", fmt.Errorf("failed to read object content: %w", err)
-	}
 
-	return buffer.String(), nil
+	return string(content), nil
 }
 
-func (u *MinioUtil) GeneratePresignedURL(ctx context.Context, fileURL string) (string, error) {
+// DeleteFile removes the object behind a minio:// URL
+func (u *MinioUtil) DeleteFile(ctx context.Context, fileURL string) error {
 	bucketName, objectName, err := u.ParseMinioURL(fileURL)
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	presignedURL, err := u.MinioClient.PresignedGetObject(ctx, bucketName, objectName, time.Second*24*60*60, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL for %s/%s: %w", bucketName, objectName, err)
+	if err := u.Storage.Delete(ctx, bucketName, objectName); err != nil {
+		return fmt.Errorf("failed to delete object %s from bucket %s: %w", objectName, bucketName, err)
 	}
-
-	return presignedURL.String(), nil
+	return nil
 }
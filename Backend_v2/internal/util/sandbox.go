@@ -0,0 +1,147 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SandboxLimits bounds what a single sandboxed command may consume
+type SandboxLimits struct {
+	CPUSeconds     int
+	MemoryMB       int
+	Timeout        time.Duration
+	AllowNetwork   bool
+	MaxOutputBytes int
+	// UID and GID the command runs as; 0 keeps the backend's own, which is
+	// only meant for development
+	UID int
+	GID int
+}
+
+type SandboxResult struct {
+	ExitCode int
+	Output   string
+	TimedOut bool
+	Duration time.Duration
+}
+
+// sandboxPath is the PATH of the sandboxed command
+const sandboxPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+type Sandbox struct {
+	WorkDir string
+	Limits  SandboxLimits
+	Log     *logrus.Logger
+}
+
+func NewSandbox(workDir string, limits SandboxLimits, log *logrus.Logger) *Sandbox {
+	if workDir == "" {
+		workDir = os.TempDir()
+	}
+	if limits.MaxOutputBytes <= 0 {
+		limits.MaxOutputBytes = 1 << 20
+	}
+	return &Sandbox{
+		WorkDir: workDir,
+		Limits:  limits,
+		Log:     log,
+	}
+}
+
+// NewWorkspace creates an empty directory for one run; the caller removes it
+func (s *Sandbox) NewWorkspace() (string, error) {
+	if err := os.MkdirAll(s.WorkDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create sandbox work dir: %w", err)
+	}
+	return os.MkdirTemp(s.WorkDir, "run-")
+}
+
+// Run executes command with /bin/sh inside dir under the configured limits.
+// The command sees dir as /workspace and nothing of the host but its system
+// directories. A non-zero exit code is reported in the result, not as an error.
+func (s *Sandbox) Run(ctx context.Context, dir string, command string) (*SandboxResult, error) {
+	if err := sandboxSupported(s.Limits); err != nil {
+		return nil, err
+	}
+	if err := handOverWorkspace(dir, s.Limits); err != nil {
+		return nil, fmt.Errorf("failed to prepare sandbox workspace: %w", err)
+	}
+	if s.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Limits.Timeout)
+		defer cancel()
+	}
+
+	output := &cappedBuffer{limit: s.Limits.MaxOutputBytes}
+	name, args := sandboxCommand(s.Limits, dir, s.limitPrefix()+command)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + sandboxPath}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = sandboxSysProcAttr(s.Limits)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	result := &SandboxResult{
+		Output:   output.String(),
+		Duration: time.Since(start),
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to start sandboxed command: %w", err)
+		}
+		result.ExitCode = exitErr.ExitCode()
+	}
+	return result, nil
+}
+
+func (s *Sandbox) limitPrefix() string {
+	prefix := ""
+	if s.Limits.CPUSeconds > 0 {
+		prefix += fmt.Sprintf("ulimit -t %d && ", s.Limits.CPUSeconds)
+	}
+	if s.Limits.MemoryMB > 0 {
+		prefix += fmt.Sprintf("ulimit -v %d && ", s.Limits.MemoryMB*1024)
+	}
+	return prefix
+}
+
+// cappedBuffer keeps the first limit bytes of output and drops the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+			b.truncated = true
+		} else {
+			b.buf.Write(p)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n... output truncated ..."
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,92 @@
+//go:build linux
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// sandboxWorkspace is where the run's directory is mounted in the sandbox
+const sandboxWorkspace = "/workspace"
+
+// sandboxSystemDirs are mounted read-only so toolchains and shared libraries
+// work. The rest of the host, the backend's directory and its .env included,
+// is not visible.
+var sandboxSystemDirs = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64",
+	"/etc/alternatives", "/etc/ssl", "/etc/ca-certificates", "/etc/ld.so.cache",
+	"/etc/passwd", "/etc/group", "/etc/hosts", "/etc/resolv.conf", "/etc/nsswitch.conf",
+}
+
+func sandboxSupported(limits SandboxLimits) error {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		return errors.New("test sandbox needs bubblewrap (bwrap) installed")
+	}
+	if limits.UID > 0 && os.Geteuid() != 0 {
+		return fmt.Errorf("the backend must run as root to start the test sandbox as uid %d", limits.UID)
+	}
+	return nil
+}
+
+// sandboxCommand runs script with bubblewrap in fresh mount, pid, ipc and
+// user namespaces, and a network namespace unless network access is allowed
+func sandboxCommand(limits SandboxLimits, dir, script string) (string, []string) {
+	args := []string{"--unshare-all", "--die-with-parent", "--new-session"}
+	if limits.AllowNetwork {
+		args = append(args, "--share-net")
+	}
+	for _, systemDir := range sandboxSystemDirs {
+		args = append(args, "--ro-bind-try", systemDir, systemDir)
+	}
+	args = append(args,
+		"--proc", "/proc",
+		"--dev", "/dev",
+		"--tmpfs", "/tmp",
+		"--bind", dir, sandboxWorkspace,
+		"--chdir", sandboxWorkspace,
+		"--clearenv",
+		"--setenv", "PATH", sandboxPath,
+		"--setenv", "HOME", sandboxWorkspace,
+		"--setenv", "LANG", "C.UTF-8",
+		"--setenv", "CI", "true",
+		"/bin/sh", "-c", script,
+	)
+	return "bwrap", args
+}
+
+// sandboxSysProcAttr puts the sandbox in its own process group and drops it
+// to the configured uid and gid
+func sandboxSysProcAttr(limits SandboxLimits) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if limits.UID > 0 {
+		attr.Credential = &syscall.Credential{Uid: uint32(limits.UID), Gid: uint32(limits.GID)}
+	}
+	return attr
+}
+
+// handOverWorkspace gives the sandbox's uid the workspace, which the backend
+// filled with the checkout and the test bundle
+func handOverWorkspace(dir string, limits SandboxLimits) error {
+	if limits.UID <= 0 {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, limits.UID, limits.GID)
+	})
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
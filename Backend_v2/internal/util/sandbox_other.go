@@ -0,0 +1,32 @@
+//go:build !linux
+
+package util
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+func sandboxSupported(limits SandboxLimits) error {
+	return errors.New("test sandbox is only supported on linux")
+}
+
+func sandboxCommand(limits SandboxLimits, dir, script string) (string, []string) {
+	return "/bin/sh", []string{"-c", script}
+}
+
+func sandboxSysProcAttr(limits SandboxLimits) *syscall.SysProcAttr {
+	return nil
+}
+
+func handOverWorkspace(dir string, limits SandboxLimits) error {
+	return nil
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
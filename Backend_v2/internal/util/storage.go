@@ -0,0 +1,33 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrObjectNotFound is returned by Storage.Get and Storage.Stat for missing objects
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage is the object store behind MinioUtil. Objects are addressed by
+// bucket and key; buckets are created on demand by EnsureBucket.
+type Storage interface {
+	EnsureBucket(ctx context.Context, bucket string) error
+	Put(ctx context.Context, bucket string, object string, content []byte, contentType string) error
+	Get(ctx context.Context, bucket string, object string) ([]byte, error)
+	// Open streams an object; the reader supports seeking for range requests
+	Open(ctx context.Context, bucket string, object string) (io.ReadSeekCloser, *ObjectInfo, error)
+	Stat(ctx context.Context, bucket string, object string) (*ObjectInfo, error)
+	Presign(ctx context.Context, bucket string, object string, expiry time.Duration) (string, error)
+	Delete(ctx context.Context, bucket string, object string) error
+	List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error)
+}
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
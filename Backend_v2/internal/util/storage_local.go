@@ -0,0 +1,281 @@
+package util
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaDir holds one JSON sidecar per object with what the file system cannot
+// keep (content type, ETag). Bucket names never start with a dot, so it
+// cannot collide with a bucket.
+const metaDir = ".meta"
+
+// LocalStorage keeps objects as plain files below Root/<bucket>/<key>. Presigned
+// URLs point back at the backend (BaseURL + "/storage/...") and carry an HMAC
+// signature checked by Verify, so no object server is needed.
+type LocalStorage struct {
+	Root    string
+	BaseURL string
+	Secret  []byte
+}
+
+type localObjectMeta struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+func NewLocalStorage(root string, baseURL string, secret string) (*LocalStorage, error) {
+	if root == "" {
+		return nil, errors.New("local storage root is not set")
+	}
+	if secret == "" {
+		return nil, errors.New("local storage signing secret is not set")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage root %s: %w", root, err)
+	}
+	return &LocalStorage{
+		Root:    root,
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Secret:  []byte(secret),
+	}, nil
+}
+
+func (s *LocalStorage) EnsureBucket(ctx context.Context, bucket string) error {
+	dir, err := s.path(bucket, "")
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, 0o755)
+}
+
+func (s *LocalStorage) Put(ctx context.Context, bucket string, object string, content []byte, contentType string) error {
+	target, err := s.path(bucket, object)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(target, content); err != nil {
+		return err
+	}
+	sum := md5.Sum(content)
+	meta, err := json.Marshal(localObjectMeta{ContentType: contentType, ETag: hex.EncodeToString(sum[:])})
+	if err != nil {
+		return err
+	}
+	metaPath, err := s.metaPath(bucket, object)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, meta)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, bucket string, object string) ([]byte, error) {
+	target, err := s.path(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return content, err
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, bucket string, object string) (*ObjectInfo, error) {
+	target, err := s.path(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.objectInfo(bucket, object, info), nil
+}
+
+func (s *LocalStorage) Open(ctx context.Context, bucket string, object string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	target, err := s.path(bucket, object)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, nil, ErrObjectNotFound
+	}
+	return file, s.objectInfo(bucket, object, info), nil
+}
+
+func (s *LocalStorage) Presign(ctx context.Context, bucket string, object string, expiry time.Duration) (string, error) {
+	if _, err := s.path(bucket, object); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(bucket, object, expires))
+	return fmt.Sprintf("%s/storage/%s/%s?%s", s.BaseURL, url.PathEscape(bucket), escapeObjectPath(object), query.Encode()), nil
+}
+
+// Verify checks a signature produced by Presign and that it has not expired
+func (s *LocalStorage) Verify(bucket string, object string, expires string, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errors.New("invalid expiry")
+	}
+	if time.Now().Unix() > expiresAt {
+		return errors.New("link has expired")
+	}
+	expected := s.sign(bucket, object, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, bucket string, object string) error {
+	target, err := s.path(bucket, object)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if metaPath, err := s.metaPath(bucket, object); err == nil {
+		os.Remove(metaPath)
+	}
+	return nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	dir, err := s.path(bucket, "")
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]ObjectInfo, 0)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *s.objectInfo(bucket, key, info))
+		return nil
+	})
+	return objects, err
+}
+
+func (s *LocalStorage) objectInfo(bucket string, object string, info fs.FileInfo) *ObjectInfo {
+	objectInfo := &ObjectInfo{
+		Key:          object,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}
+	if metaPath, err := s.metaPath(bucket, object); err == nil {
+		if data, err := os.ReadFile(metaPath); err == nil {
+			meta := localObjectMeta{}
+			if json.Unmarshal(data, &meta) == nil {
+				objectInfo.ContentType = meta.ContentType
+				objectInfo.ETag = meta.ETag
+			}
+		}
+	}
+	if objectInfo.ContentType == "" {
+		objectInfo.ContentType = ContentTypeFor(object, nil)
+	}
+	return objectInfo
+}
+
+func (s *LocalStorage) sign(bucket string, object string, expires string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s", bucket, object, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path maps bucket and key to a file below Root, refusing anything that would
+// escape the bucket directory
+func (s *LocalStorage) path(bucket string, object string) (string, error) {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || strings.HasPrefix(bucket, ".") {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	if object == "" {
+		return filepath.Join(s.Root, bucket), nil
+	}
+	clean := path.Clean("/" + object)
+	if clean == "/" || clean != "/"+object || strings.HasSuffix(object, ".tmp") {
+		return "", fmt.Errorf("invalid object name %q", object)
+	}
+	return filepath.Join(s.Root, bucket, filepath.FromSlash(object)), nil
+}
+
+func (s *LocalStorage) metaPath(bucket string, object string) (string, error) {
+	target, err := s.path(bucket, object)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.Root, target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, metaDir, rel+".json"), nil
+}
+
+func writeFileAtomic(target string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+func escapeObjectPath(object string) string {
+	parts := strings.Split(object, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,137 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// MinioStorage keeps objects in a MinIO (or any S3-compatible) server
+type MinioStorage struct {
+	Client *minio.Client
+}
+
+func NewMinioStorage(client *minio.Client) *MinioStorage {
+	return &MinioStorage{Client: client}
+}
+
+func (s *MinioStorage) EnsureBucket(ctx context.Context, bucket string) error {
+	found, err := s.Client.BucketExists(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("failed to find bucket %s: %w", bucket, err)
+	}
+	if found {
+		return nil
+	}
+	if err := s.Client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: "us-east-1"}); err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+	}
+	return nil
+}
+
+func (s *MinioStorage) Put(ctx context.Context, bucket string, object string, content []byte, contentType string) error {
+	_, err := s.Client.PutObject(ctx, bucket, object, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *MinioStorage) Get(ctx context.Context, bucket string, object string) ([]byte, error) {
+	reader, err := s.Client.GetObject(ctx, bucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == 404 {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return content, nil
+}
+
+func (s *MinioStorage) Open(ctx context.Context, bucket string, object string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	reader, err := s.Client.GetObject(ctx, bucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := reader.Stat()
+	if err != nil {
+		reader.Close()
+		if minio.ToErrorResponse(err).StatusCode == 404 {
+			return nil, nil, ErrObjectNotFound
+		}
+		return nil, nil, err
+	}
+	return reader, &ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (s *MinioStorage) Stat(ctx context.Context, bucket string, object string) (*ObjectInfo, error) {
+	info, err := s.Client.StatObject(ctx, bucket, object, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == 404 {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (s *MinioStorage) Presign(ctx context.Context, bucket string, object string, expiry time.Duration) (string, error) {
+	presignedURL, err := s.Client.PresignedGetObject(ctx, bucket, object, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
+
+// Delete removes every version of an object. Buckets created with object
+// locking are versioned, and a plain remove would only add a delete marker.
+func (s *MinioStorage) Delete(ctx context.Context, bucket string, object string) error {
+	for info := range s.Client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: object, Recursive: true, WithVersions: true}) {
+		if info.Err != nil {
+			return info.Err
+		}
+		if info.Key != object {
+			continue
+		}
+		if err := s.Client.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{VersionID: info.VersionID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MinioStorage) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	objects := make([]ObjectInfo, 0)
+	for info := range s.Client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          info.Key,
+			Size:         info.Size,
+			ContentType:  info.ContentType,
+			ETag:         info.ETag,
+			LastModified: info.LastModified,
+		})
+	}
+	return objects, nil
+}
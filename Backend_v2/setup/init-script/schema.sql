@@ -4,6 +4,7 @@ CREATE TABLE IF NOT EXISTS users (
     password_hash TEXT NOT NULL,
     role TEXT NOT NULL DEFAULT 'user', 
     github_token TEXT, -- 'super_admin' or 'user'
+    github_login TEXT NOT NULL DEFAULT '', -- the user's GitHub or GitLab username, for telling course staff apart in PR comments
     locked BOOLEAN NOT NULL DEFAULT FALSE,
     deleted BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -28,10 +29,21 @@ CREATE TABLE IF NOT EXISTS courses (
     github_url TEXT NOT NULL,
     owner TEXT NOT NULL,
     repo_name TEXT NOT NULL,
+    git_provider TEXT NOT NULL DEFAULT '', -- 'github', 'gitlab', 'local' (hosted here) or empty to follow the URL host
     general_answer TEXT NOT NULL,
     -- assignments JSONB,
     -- prs JSONB,
     auto_grade BOOLEAN NOT NULL DEFAULT FALSE,
+    pass_score INTEGER NOT NULL DEFAULT 50, -- 0-100 score a review needs for a passing check run
+    bot_handle VARCHAR(39) NOT NULL DEFAULT 'bot', -- mentioned as @bot_handle in PR comments to ask the bot
+    archived_at TIMESTAMP, -- set when the course is archived (read-only)
+    pr_synced_at TIMESTAMP, -- cursor for incremental PR syncs
+    last_sync_at TIMESTAMP, -- when the latest PR sync ran
+    last_sync_status TEXT, -- 'ok' or 'failed'
+    last_sync_message TEXT, -- summary or error of the latest PR sync
+    github_token TEXT, -- course-specific GitHub credential
+    webhook_id BIGINT NOT NULL DEFAULT 0, -- repository hook registered for the course
+    webhook_secret TEXT NOT NULL DEFAULT '', -- secret GitHub signs deliveries with
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -42,7 +54,10 @@ CREATE TABLE IF NOT EXISTS assignments (
     assignment_name TEXT NOT NULL,
     description TEXT,
     assignment_url TEXT NOT NULL,
-    -- due_date TIMESTAMP NOT NULL,
+    test_bundle_url TEXT,
+    test_command TEXT,
+    test_report_path TEXT,
+    due_date TIMESTAMP, -- PRs opened after it are labelled late
     -- max_score INTEGER NOT NULL DEFAULT 100,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
@@ -58,10 +73,19 @@ CREATE TABLE IF NOT EXISTS prs (
     pr_number INTEGER NOT NULL,
     result TEXT,
     status_grade TEXT NOT NULL DEFAULT 'Not Graded',
+    author_login TEXT,
+    head_ref TEXT,
+    head_repo TEXT, -- owner/name of the repository head_ref is in
+    base_ref TEXT,
+    head_sha TEXT,
+    draft BOOLEAN NOT NULL DEFAULT FALSE,
+    merged_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- CHATS TABLE: legacy chat histories, one JSONB array per PR number; moved
+-- into chat_threads and chat_messages by cmd/migrate-chats
 CREATE TABLE IF NOT EXISTS chats (
     id SERIAL PRIMARY KEY,
     course_id INTEGER NOT NULL,
@@ -72,6 +96,163 @@ CREATE TABLE IF NOT EXISTS chats (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- CHAT_THREADS TABLE: the conversations on a PR, its main one and one per review thread
+CREATE TABLE IF NOT EXISTS chat_threads (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    pr_id INTEGER NOT NULL REFERENCES prs(id) ON DELETE CASCADE,
+    thread_key TEXT NOT NULL, -- 'conversation', or the key of the thread's first comment, e.g. 'review_comment:123'
+    file TEXT NOT NULL DEFAULT '', -- file of a review thread
+    line INTEGER, -- line of a review thread
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (pr_id, thread_key)
+);
+
+-- CHAT_MESSAGES TABLE: the comments of a chat thread, oldest first by created_at
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    thread_id INTEGER NOT NULL REFERENCES chat_threads(id) ON DELETE CASCADE,
+    author_login TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL, -- 'teacher', 'student' or 'bot'
+    message TEXT NOT NULL,
+    github_id TEXT NOT NULL DEFAULT '', -- kind and ID of the comment, e.g. 'issue_comment:123'; empty when it has none
+    file TEXT NOT NULL DEFAULT '',
+    line INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_messages_github_id ON chat_messages(course_id, github_id) WHERE github_id <> '';
+CREATE INDEX IF NOT EXISTS idx_chat_messages_thread ON chat_messages(thread_id, created_at);
+
+-- TEST_RUNS TABLE: hidden test-suite executions per PR
+CREATE TABLE IF NOT EXISTS test_runs (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL,
+    assignment_id INTEGER NOT NULL,
+    pr_id INTEGER NOT NULL,
+    commit_sha TEXT,
+    status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'running', 'passed', 'failed' or 'error'
+    passed INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    total INTEGER NOT NULL DEFAULT 0,
+    results JSONB,
+    log TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- DOCUMENT_VERSIONS TABLE: immutable history of convention and answer uploads
+CREATE TABLE IF NOT EXISTS document_versions (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL,
+    assignment_id INTEGER NOT NULL DEFAULT 0, -- 0 for course-level documents
+    doc_type TEXT NOT NULL, -- 'coding_convention' or 'assignment_answer'
+    version INTEGER NOT NULL,
+    file_url TEXT NOT NULL,
+    file_name TEXT,
+    size BIGINT NOT NULL DEFAULT 0,
+    checksum TEXT,
+    uploaded_by INTEGER,
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (course_id, assignment_id, doc_type, version)
+);
+
+-- FILES TABLE: stable IDs for stored objects served through /files/{id}
+CREATE TABLE IF NOT EXISTS files (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL,
+    file_url TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- COURSE_DELETION_JOBS TABLE: background cascade deletes and what they removed
+CREATE TABLE IF NOT EXISTS course_deletion_jobs (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL,
+    course_name TEXT,
+    requested_by INTEGER,
+    status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'running', 'done' or 'failed'
+    report JSONB,
+    error TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- WEBHOOK_DELIVERIES TABLE: every GitHub delivery, for deduplication and replay
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    delivery_id TEXT NOT NULL UNIQUE, -- X-GitHub-Delivery
+    provider TEXT NOT NULL DEFAULT 'github', -- the endpoint it came in on: 'github' or 'gitlab'
+    event TEXT NOT NULL,
+    action TEXT,
+    repository TEXT,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'processing', -- 'processing', 'done' or 'failed'
+    result TEXT,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    processed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries(status);
+
+-- GIT_REPOSITORIES TABLE: bare repositories hosted for local courses, one per
+-- student and assignment; the id is the PR number of the submission
+CREATE TABLE IF NOT EXISTS git_repositories (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    assignment_id INTEGER NOT NULL REFERENCES assignments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    submit_sha TEXT NOT NULL DEFAULT '', -- head of the submit branch when last submitted
+    submitted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (assignment_id, user_id)
+);
+
+-- COURSE_LABELS TABLE: the course's names and colours for the labels kept on
+-- graded PRs; kinds without a row use the defaults
+CREATE TABLE IF NOT EXISTS course_labels (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL, -- 'graded', 'needs_changes', 'late' or 'assignment' (a prefix for the assignment name)
+    name TEXT NOT NULL,
+    color TEXT NOT NULL, -- hex without '#'
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (course_id, kind)
+);
+
+-- PR_COMMANDS TABLE: /neurade commands from PR comments, run as queued jobs
+CREATE TABLE IF NOT EXISTS pr_commands (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    pr_number INTEGER NOT NULL,
+    comment_key TEXT NOT NULL, -- kind and ID of the comment, as in chat messages
+    thread_id TEXT NOT NULL DEFAULT '', -- review comment or discussion the answer goes in
+    file TEXT NOT NULL DEFAULT '',
+    author_login TEXT NOT NULL,
+    author_role TEXT NOT NULL, -- 'teacher' or 'student'
+    command TEXT NOT NULL, -- 'regrade', 'explain', 'score', 'hint' or 'request-human'
+    args TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'running', 'done' or 'failed'
+    result TEXT,
+    error TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (course_id, comment_key)
+);
+
 -- PERMISSION_USER_COURSE TABLE: which users can manage which courses
 CREATE TABLE IF NOT EXISTS permission_user_courses (
     id SERIAL PRIMARY KEY,
@@ -26,6 +26,7 @@ func postToBackend(urlStr string, data map[string]string) {
 		return
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Relay-Token", os.Getenv("BACKEND_RELAY_TOKEN"))
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
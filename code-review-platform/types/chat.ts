@@ -1,16 +1,35 @@
-export interface Chat {
+export interface ChatMessage {
+  id: number
+  thread_id: number
+  author_login: string
+  role: "teacher" | "student" | "bot"
+  message: string
+  github_id?: string
+  file?: string
+  line?: number
+  created_at: string
+  updated_at: string
+}
+
+export interface ChatThread {
   id: number
   course_id: number
-  user_id: number
   pr_id: number
-  chat_history: any
+  thread_key: string
+  file?: string
+  line?: number
   created_at: string
   updated_at: string
+  messages?: ChatMessage[]
 }
 
-export interface CreateChatRequest {
+export interface CreateChatMessageRequest {
   course_id: number
-  user_id: number
   pr_id: number
-  chat_history: any
+  thread_key?: string
+  author_login?: string
+  role: string
+  message: string
+  file?: string
+  line?: number
 }
@@ -4,6 +4,7 @@ export interface User {
   username?: string
   role: "super_admin" | "teacher"
   github_token?: string
+  github_login?: string
   verified: boolean
   created_at: string
   updated_at: string
@@ -19,6 +20,7 @@ export interface CreateUserRequest {
   email: string
   password: string
   role: "teacher"
+  github_login?: string
   assigned_courses?: number[]
 }
 